@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sdslabs/beastv4/core"
 	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
+	"github.com/sdslabs/beastv4/core/utils"
+	log "github.com/sirupsen/logrus"
 )
 
 // Ban/Unban a user based on his id and the action provided.
@@ -70,3 +74,411 @@ func banUserHandler(c *gin.Context) {
 	})
 	return
 }
+
+// Returns the flag submission attempts made by the users.
+// @Summary Returns all the flag submission attempts, including the wrong ones.
+// @Description Returns the attempts matching the provided filters with the latest attempt first, paginated using page and per_page. With format=csv all the matching attempts are exported as CSV. This can only be done by admins
+// @Tags admin
+// @Accept  json
+// @Produce json
+// @Param user_id query string false "Id of the user"
+// @Param username query string false "Username of the user"
+// @Param chall_id query string false "Id of the challenge"
+// @Param result query string false "Result of the attempt (correct/incorrect/already_solved/unavailable)"
+// @Param ip query string false "Source IP of the attempt"
+// @Param from query string false "Unix timestamp after which the attempts were made"
+// @Param to query string false "Unix timestamp before which the attempts were made"
+// @Param page query string false "Page number, starting from 1"
+// @Param per_page query string false "Number of attempts per page"
+// @Param format query string false "Format of the response (csv)"
+// @Success 200 {object} api.AttemptsResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/admin/attempts [get]
+func submissionAttemptsHandler(c *gin.Context) {
+	whereMap := make(map[string]interface{})
+
+	for param, column := range map[string]string{"user_id": "user_id", "chall_id": "challenge_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, HTTPErrorResp{
+					Error: fmt.Sprintf("Invalid value for %s", param),
+				})
+				return
+			}
+			whereMap[column] = uint(id)
+		}
+	}
+
+	if username := c.Query("username"); username != "" {
+		user, err := database.QueryFirstUserEntry("username", username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+		whereMap["user_id"] = user.ID
+	}
+
+	if result := c.Query("result"); result != "" {
+		whereMap["result"] = result
+	}
+
+	if ip := c.Query("ip"); ip != "" {
+		whereMap["source_ip"] = ip
+	}
+
+	var timeRange [2]time.Time
+	for index, param := range []string{"from", "to"} {
+		if value := c.Query(param); value != "" {
+			timestamp, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, HTTPErrorResp{
+					Error: fmt.Sprintf("Invalid unix timestamp for %s", param),
+				})
+				return
+			}
+			timeRange[index] = time.Unix(timestamp, 0)
+		}
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Invalid page number",
+		})
+		return
+	}
+
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(core.DEFAULT_PAGE_SIZE)))
+	if err != nil || perPage < 1 || perPage > core.MAX_PAGE_SIZE {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("per_page must be between 1 and %d", core.MAX_PAGE_SIZE),
+		})
+		return
+	}
+
+	format := c.Query("format")
+
+	offset, limit := (page-1)*perPage, perPage
+	if format == "csv" {
+		offset, limit = 0, -1
+	}
+
+	attempts, total, err := database.QuerySubmissionAttempts(whereMap, timeRange[0], timeRange[1], offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	users := make(map[uint]database.User)
+	challenges := make(map[uint]string)
+	attemptsResp := make([]AttemptResp, len(attempts))
+
+	for index, attempt := range attempts {
+		user, ok := users[attempt.UserID]
+		if !ok {
+			user, err = database.QueryUserById(attempt.UserID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "DATABASE ERROR while fetching user details.",
+				})
+				return
+			}
+			users[attempt.UserID] = user
+		}
+
+		challName, ok := challenges[attempt.ChallengeID]
+		if !ok {
+			challenge, err := database.QueryChallengeEntries("id", strconv.Itoa(int(attempt.ChallengeID)))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "DATABASE ERROR while fetching challenge details.",
+				})
+				return
+			}
+			if len(challenge) > 0 {
+				challName = challenge[0].Name
+			}
+			challenges[attempt.ChallengeID] = challName
+		}
+
+		attemptsResp[index] = AttemptResp{
+			Id:          attempt.ID,
+			UserId:      attempt.UserID,
+			Username:    user.Username,
+			ChallId:     attempt.ChallengeID,
+			ChallName:   challName,
+			Flag:        attempt.Flag,
+			Result:      attempt.Result,
+			SourceIP:    attempt.SourceIP,
+			AttemptedAt: attempt.CreatedAt,
+		}
+	}
+
+	if format == "csv" {
+		buff, err := utils.StructToCSV(c, attemptsResp, "attempts.csv")
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "CSV ERROR while processing the request.",
+			})
+			return
+		}
+
+		c.Data(http.StatusOK, "text/csv", buff.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, AttemptsResp{
+		Total:    total,
+		Page:     page,
+		PerPage:  perPage,
+		Attempts: attemptsResp,
+	})
+}
+
+// Returns the cheating reports.
+// @Summary Returns the reports of the users who submitted a flag belonging to another user.
+// @Description Returns the cheating reports matching the provided filters with the latest report first, a report is created when a user submits the flag generated for another user or the flag another user solved the challenge with. With format=csv the reports are exported as CSV. This can only be done by admins
+// @Tags admin
+// @Accept  json
+// @Produce json
+// @Param user_id query string false "Id of the user who submitted the flag"
+// @Param owner_id query string false "Id of the user the flag belongs to"
+// @Param chall_id query string false "Id of the challenge"
+// @Param format query string false "Format of the response (csv)"
+// @Success 200 {object} api.CheatingReportsResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/admin/cheating [get]
+func cheatingReportsHandler(c *gin.Context) {
+	whereMap := make(map[string]interface{})
+
+	for param, column := range map[string]string{"user_id": "submitter_id", "owner_id": "owner_id", "chall_id": "challenge_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, HTTPErrorResp{
+					Error: fmt.Sprintf("Invalid value for %s", param),
+				})
+				return
+			}
+			whereMap[column] = uint(id)
+		}
+	}
+
+	reports, err := database.QueryCheatingReports(whereMap)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	users := make(map[uint]string)
+	username := func(id uint) (string, error) {
+		if name, ok := users[id]; ok {
+			return name, nil
+		}
+
+		user, err := database.QueryUserById(id)
+		if err != nil {
+			return "", err
+		}
+		users[id] = user.Username
+
+		return user.Username, nil
+	}
+
+	challenges := make(map[uint]string)
+	reportsResp := make([]CheatingReportResp, len(reports))
+
+	for index, report := range reports {
+		submitter, err := username(report.SubmitterID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while fetching user details.",
+			})
+			return
+		}
+
+		owner, err := username(report.OwnerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while fetching user details.",
+			})
+			return
+		}
+
+		challName, ok := challenges[report.ChallengeID]
+		if !ok {
+			challenge, err := database.QueryChallengeEntries("id", strconv.Itoa(int(report.ChallengeID)))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "DATABASE ERROR while fetching challenge details.",
+				})
+				return
+			}
+			if len(challenge) > 0 {
+				challName = challenge[0].Name
+			}
+			challenges[report.ChallengeID] = challName
+		}
+
+		reportsResp[index] = CheatingReportResp{
+			Id:            report.ID,
+			UserId:        report.SubmitterID,
+			Username:      submitter,
+			OwnerId:       report.OwnerID,
+			OwnerUsername: owner,
+			ChallId:       report.ChallengeID,
+			ChallName:     challName,
+			Flag:          report.Flag,
+			Reason:        report.Reason,
+			SourceIP:      report.SourceIP,
+			ReportedAt:    report.CreatedAt,
+		}
+	}
+
+	if c.Query("format") == "csv" {
+		buff, err := utils.StructToCSV(c, reportsResp, "cheating.csv")
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "CSV ERROR while processing the request.",
+			})
+			return
+		}
+
+		c.Data(http.StatusOK, "text/csv", buff.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, CheatingReportsResp{
+		Reports: reportsResp,
+	})
+}
+
+// Rebuilds the scores of all the users and teams from their solves.
+// @Summary Recomputes the scores of all the users and teams from the solves.
+// @Description Derives the scores from the solves using the current points of the challenges and the manual adjustments, and reports the users and teams whose stored score did not match. With dry_run=true the stored scores are left untouched. This can only be done by admins
+// @Tags admin
+// @Accept  json
+// @Produce json
+// @Param dry_run query string false "Only report the mismatches (true/false)"
+// @Success 200 {object} api.ScoresRecomputeResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/admin/scores/recompute [post]
+func recomputeScoresHandler(c *gin.Context) {
+	update := c.Query("dry_run") != "true"
+
+	mismatches, err := manager.RecomputeScores(update)
+	if err != nil {
+		log.Errorf("Error while recomputing scores: %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while recomputing the scores.",
+		})
+		return
+	}
+
+	resp := ScoresRecomputeResp{
+		Updated:    update,
+		Mismatches: make([]ScoreMismatchResp, len(mismatches)),
+	}
+	for index, mismatch := range mismatches {
+		resp.Mismatches[index] = ScoreMismatchResp{
+			Type:     mismatch.Type,
+			Id:       mismatch.ID,
+			Name:     mismatch.Name,
+			Stored:   mismatch.Stored,
+			Computed: mismatch.Computed,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Manually adjusts the score of a user.
+// @Summary Adds a manual adjustment to the score of a user.
+// @Description Records the adjustment, which can be negative, and rebuilds the score of the user and their team. This can only be done by admins
+// @Tags admin
+// @Accept  json
+// @Produce json
+// @Param user_id formData string true "Id of the user"
+// @Param points formData string true "Points to add to the score of the user, negative to deduct"
+// @Param reason formData string false "Reason for the adjustment"
+// @Success 200 {object} api.HTTPPlainResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/admin/scores/adjust [post]
+func adjustScoreHandler(c *gin.Context) {
+	userId, err := strconv.ParseUint(c.PostForm("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "User Id format invalid",
+		})
+		return
+	}
+
+	points, err := strconv.Atoi(c.PostForm("points"))
+	if err != nil || points == 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Points must be a non zero integer",
+		})
+		return
+	}
+
+	user, err := database.QueryUserById(uint(userId))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if user.ID == 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "No user with the given id",
+		})
+		return
+	}
+
+	var adminId uint
+	username, err := utils.GetUser(c.GetHeader("Authorization"))
+	if err == nil {
+		admin, err := database.QueryFirstUserEntry("username", username)
+		if err == nil {
+			adminId = admin.ID
+		}
+	}
+
+	err = database.CreateScoreAdjustment(&database.ScoreAdjustment{
+		UserID:  user.ID,
+		Points:  points,
+		Reason:  c.PostForm("reason"),
+		AdminID: adminId,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if err = manager.RefreshScores([]uint{user.ID}); err != nil {
+		log.Errorf("Error while refreshing score of %s: %s", user.Username, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while refreshing the score.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, HTTPPlainResp{
+		Message: fmt.Sprintf("Adjusted the score of %s by %d points", user.Username, points),
+	})
+}
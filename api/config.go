@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/sdslabs/beastv4/core"
 	"github.com/sdslabs/beastv4/core/config"
 	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -53,6 +55,8 @@ func reloadBeastConfig(c *gin.Context) {
 // @Param ending_time formData string true "Competition's ending time"
 // @Param timezone formData string true "Competition's timezone"
 // @Param logo formData file false "Competition's logo"
+// @Param max_team_size formData string false "Maximum number of members in a team"
+// @Param freeze_time formData string false "Time after which the scoreboard is frozen for the contestants"
 // @Success 200 {object} api.HTTPPlainResp
 // @Failure 400 {object} api.HTTPPlainResp
 // @Failure 500 {object} api.HTTPErrorResp
@@ -66,6 +70,27 @@ func updateCompetitionInfoHandler(c *gin.Context) {
 	starting_time := c.PostForm("starting_time")
 	ending_time := c.PostForm("ending_time")
 	timezone := c.PostForm("timezone")
+	maxTeamSize := config.Cfg.CompetitionInfo.MaxTeamSize
+	if teamSize := c.PostForm("max_team_size"); teamSize != "" {
+		parsedTeamSize, err := strconv.ParseUint(teamSize, 10, 32)
+		if err != nil || parsedTeamSize == 0 {
+			c.JSON(http.StatusBadRequest, HTTPPlainResp{
+				Message: "Invalid maximum team size provided",
+			})
+			return
+		}
+		maxTeamSize = uint(parsedTeamSize)
+	}
+	freezeTime := config.Cfg.CompetitionInfo.FreezeTime
+	if freeze, exist := c.GetPostForm("freeze_time"); exist {
+		if _, err := config.ParseCompetitionTime(freeze); freeze != "" && err != nil {
+			c.JSON(http.StatusBadRequest, HTTPPlainResp{
+				Message: "Invalid freeze time provided",
+			})
+			return
+		}
+		freezeTime = freeze
+	}
 	logo, err := c.FormFile("logo")
 
 	// The file cannot be received.
@@ -116,6 +141,9 @@ func updateCompetitionInfoHandler(c *gin.Context) {
 		EndingTime:   ending_time,
 		TimeZone:     timezone,
 		LogoURL:      logoFilePath,
+		DynamicScore: config.Cfg.CompetitionInfo.DynamicScore,
+		MaxTeamSize:  maxTeamSize,
+		FreezeTime:   freezeTime,
 	}
 
 	err = config.UpdateCompetitionInfo(&configInfo)
@@ -139,7 +167,7 @@ func updateCompetitionInfoHandler(c *gin.Context) {
 // @Accept  json
 // @Produce json
 // @Param name formData string true "Challenge Name"
-// @Param hints formData string true "Challenge's hints"
+// @Param hints formData string true "Challenge's hints, either a JSON array of hints with text, cost and unlock_after or free hints separated by the delimiter"
 // @Param desc formData string false "Challenge's description"
 // @Param points formData string true "Challenge's points"
 // @Param flag formData string true "Challenge's flag"
@@ -162,11 +190,6 @@ func updateChallengeInfoHandler(c *gin.Context) {
 		"Name": name,
 	}
 
-	hints, exist := c.GetPostForm("hints")
-	if exist {
-		configInfo["Hints"] = hints
-	}
-
 	desc, exist := c.GetPostForm("desc")
 	if exist {
 		configInfo["Description"] = desc
@@ -210,18 +233,35 @@ func updateChallengeInfoHandler(c *gin.Context) {
 		return
 	}
 
-	// Update ports
-	ports, exist := c.GetPostForm("ports")
+	// Update hints
+	hints, exist := c.GetPostForm("hints")
 	if exist {
-		if err := database.UpdatePorts(&chall); err != nil {
+		challengeHints, err := parseHintsForm(hints)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, HTTPPlainResp{
-				Message: fmt.Sprintf("Error: %s", err.Error()),
+				Message: fmt.Sprintf("Error while parsing hints: %s", err.Error()),
 			})
 			return
 		}
+
+		if err = manager.UpdateChallengeHints(&chall, challengeHints); err != nil {
+			c.JSON(http.StatusBadRequest, HTTPPlainResp{
+				Message: fmt.Sprintf("Error while updating hints: %s", err.Error()),
+			})
+			return
+		}
+	}
+
+	// Update ports
+	ports, exist := c.GetPostForm("ports")
+	if exist {
+		var hostPorts []uint32
 		ports = strings.ReplaceAll(ports, " ", "")
-		portsArray := strings.Split(ports, ",")
-		for _, port := range portsArray {
+		for _, port := range strings.Split(ports, ",") {
+			if port == "" {
+				continue
+			}
+
 			u64, err := strconv.ParseUint(port, 10, 32)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, HTTPPlainResp{
@@ -229,15 +269,14 @@ func updateChallengeInfoHandler(c *gin.Context) {
 				})
 				return
 			}
+			hostPorts = append(hostPorts, uint32(u64))
+		}
 
-			newPort := database.Port{ChallengeID: chall.ID, PortNo: uint32(u64)}
-			_, err = database.PortEntryGetOrCreate(&newPort)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, HTTPPlainResp{
-					Message: fmt.Sprintf("Error while updating challenge ports: %s", err.Error()),
-				})
-				return
-			}
+		if err = manager.UpdateChallengeHostPorts(&chall, hostPorts); err != nil {
+			c.JSON(http.StatusBadRequest, HTTPPlainResp{
+				Message: fmt.Sprintf("Error while updating challenge ports: %s", err.Error()),
+			})
+			return
 		}
 	}
 
@@ -265,3 +304,22 @@ func updateChallengeInfoHandler(c *gin.Context) {
 	})
 	return
 }
+
+// parseHintsForm parses the hints provided while updating the challenge info, the
+// hints can either be a JSON array of hints or free hints separated by the delimiter.
+func parseHintsForm(hints string) ([]config.Hint, error) {
+	var challengeHints []config.Hint
+
+	if strings.HasPrefix(strings.TrimSpace(hints), "[") {
+		err := json.Unmarshal([]byte(hints), &challengeHints)
+		return challengeHints, err
+	}
+
+	for _, hint := range strings.Split(hints, core.DELIMITER) {
+		if hint != "" {
+			challengeHints = append(challengeHints, config.Hint{Text: hint})
+		}
+	}
+
+	return challengeHints, nil
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// Returns the deployment history of a challenge
+// @Summary Returns the runs of the deploy pipeline of the challenge along with their build logs.
+// @Description Returns the latest deployments of the challenge, each with the time spent in every stage of the pipeline, the error it failed with, the git commit it was deployed from and the log of the image build. Useful for finding out why a deploy failed.
+// @Tags info
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param challenge path string true "Name of the challenge"
+// @Param limit query string false "Number of latest deployments, defaults to 10"
+// @Success 200 {object} api.DeploymentsResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPPlainResp
+// @Failure 404 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/info/deployments/{challenge} [get]
+func deploymentsHandler(c *gin.Context) {
+	name := c.Param("challenge")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(core.DEFAULT_DEPLOYMENTS)))
+	if err != nil || limit < 1 || limit > core.MAX_PAGE_SIZE {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("limit must be between 1 and %d", core.MAX_PAGE_SIZE),
+		})
+		return
+	}
+
+	challenge, err := database.QueryFirstChallengeEntry("name", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if challenge.ID == 0 {
+		c.JSON(http.StatusNotFound, HTTPErrorResp{
+			Error: fmt.Sprintf("No challenge found with name %s", name),
+		})
+		return
+	}
+
+	deployments, err := database.QueryDeployments(challenge.ID, limit)
+	if err != nil {
+		log.Errorf("Error while querying deployments of %s : %s", name, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	resp := DeploymentsResp{
+		Challenge:   challenge.Name,
+		Deployments: make([]DeploymentResp, len(deployments)),
+	}
+
+	for index, deployment := range deployments {
+		stages := make([]DeploymentStageResp, len(deployment.Stages))
+		for i, stage := range deployment.Stages {
+			stages[i] = DeploymentStageResp{
+				Name:      stage.Name,
+				StartedAt: stage.StartedAt,
+				EndedAt:   stage.EndedAt,
+				Error:     stage.Error,
+			}
+		}
+
+		resp.Deployments[index] = DeploymentResp{
+			Id:        deployment.ID,
+			Status:    deployment.Status,
+			Commit:    deployment.Commit,
+			Error:     deployment.Error,
+			StartedAt: deployment.CreatedAt,
+			EndedAt:   deployment.EndedAt,
+			Stages:    stages,
+			BuildLog:  deployment.BuildLog,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Returns the image history of a challenge
+// @Summary Returns the images of the challenge which it can be rolled back to.
+// @Description Returns the images kept in the image history of the challenge, latest first, along with the git commit and the time they were built from. The version of an image can be used with the rollback action to recreate the challenge from it.
+// @Tags info
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param challenge path string true "Name of the challenge"
+// @Success 200 {object} api.ChallengeImagesResp
+// @Failure 401 {object} api.HTTPPlainResp
+// @Failure 404 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/info/images/{challenge} [get]
+func challengeImagesHandler(c *gin.Context) {
+	name := c.Param("challenge")
+
+	challenge, err := database.QueryFirstChallengeEntry("name", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if challenge.ID == 0 {
+		c.JSON(http.StatusNotFound, HTTPErrorResp{
+			Error: fmt.Sprintf("No challenge found with name %s", name),
+		})
+		return
+	}
+
+	images, err := database.QueryChallengeImages(challenge.Name)
+	if err != nil {
+		log.Errorf("Error while querying images of %s : %s", name, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	resp := ChallengeImagesResp{
+		Challenge: challenge.Name,
+		Images:    make([]ChallengeImageResp, len(images)),
+	}
+
+	for index, image := range images {
+		resp.Images[index] = ChallengeImageResp{
+			Version: image.Version,
+			ImageId: image.ImageId,
+			Tag:     image.Tag,
+			Commit:  image.Commit,
+			BuiltAt: image.CreatedAt,
+			InUse:   image.ImageId == challenge.ImageId,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// HandoutData is available in the templates of the handouts.
+type HandoutData struct {
+	Flag      string
+	Username  string
+	Challenge string
+}
+
+// isTemplateHandout returns true if the handout of the challenge is rendered for every user.
+func isTemplateHandout(challenge *database.Challenge, file string) bool {
+	for _, handout := range strings.Split(challenge.TemplateHandouts, core.DELIMITER) {
+		if handout != "" && filepath.Clean(handout) == file {
+			return true
+		}
+	}
+
+	return false
+}
+
+// challengeHandouts returns the URLs of the handouts of the challenge.
+func challengeHandouts(challenge *database.Challenge) []string {
+	if challenge.Handouts == "" {
+		return nil
+	}
+
+	handouts := strings.Split(challenge.Handouts, core.DELIMITER)
+	for index, handout := range handouts {
+		handouts[index] = path.Join("/api/handout", challenge.Name, handout)
+	}
+
+	return handouts
+}
+
+// Returns a handout of the challenge
+// @Summary Returns a handout file of the challenge, rendered for the user making the request if it is a template.
+// @Description Handouts marked as templates are rendered for the user, {{.Flag}} is replaced with the flag generated for the user if the challenge uses user flags, and {{.Username}} with the username of the user. Other handouts are returned as they are.
+// @Tags info
+// @Accept  json
+// @Produce octet-stream
+// @Param Authorization header string true "Bearer"
+// @Param name path string true "Name of the challenge"
+// @Param file path string true "Path of the handout"
+// @Success 200 {file} file
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 404 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/handout/{name}/{file} [get]
+func challengeHandoutHandler(c *gin.Context) {
+	name := c.Param("name")
+	file := filepath.Clean(strings.TrimPrefix(c.Param("file"), "/"))
+
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	challenge, err := database.QueryFirstChallengeEntry("name", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	found := false
+	for _, handout := range strings.Split(challenge.Handouts, core.DELIMITER) {
+		if handout != "" && filepath.Clean(handout) == file {
+			found = true
+			break
+		}
+	}
+
+	if challenge.ID == 0 || !found {
+		c.JSON(http.StatusNotFound, HTTPErrorResp{
+			Error: fmt.Sprintf("No handout %s found for challenge %s", file, name),
+		})
+		return
+	}
+
+	if user.Role == core.USER_ROLES["contestant"] {
+		err, state := coreUtils.CheckTime()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, HTTPErrorResp{
+				Error: err.Error(),
+			})
+			return
+		}
+
+		if state == 0 {
+			c.JSON(http.StatusBadRequest, HTTPErrorResp{
+				Error: "Competition is yet to start",
+			})
+			return
+		}
+
+		locked, err := manager.LockedChallenges(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		if locked[challenge.ID] {
+			c.JSON(http.StatusNotFound, HTTPErrorResp{
+				Error: fmt.Sprintf("No handout %s found for challenge %s", file, name),
+			})
+			return
+		}
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(coreUtils.GetChallengeDir(name), file))
+	if err != nil {
+		log.Errorf("Error while reading handout %s of challenge %s : %s", file, name, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "Error while reading the handout",
+		})
+		return
+	}
+
+	if isTemplateHandout(&challenge, file) {
+		content, err = renderHandout(&challenge, &user, file, content)
+		if err != nil {
+			log.Errorf("Error while rendering handout %s of challenge %s for %s : %s", file, name, user.Username, err)
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "Error while rendering the handout",
+			})
+			return
+		}
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(file)))
+	c.Data(http.StatusOK, "application/octet-stream", content)
+}
+
+// renderHandout renders the content of the template handout for the user.
+func renderHandout(challenge *database.Challenge, user *database.User, file string, content []byte) ([]byte, error) {
+	data := HandoutData{
+		Username:  user.Username,
+		Challenge: challenge.Name,
+	}
+
+	if challenge.UserFlag {
+		flag, err := manager.UserFlag(challenge, user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error while generating flag: %s", err)
+		}
+		data.Flag = flag
+	}
+
+	tmpl, err := template.New(file).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing template: %s", err)
+	}
+
+	var handout bytes.Buffer
+	if err = tmpl.Execute(&handout, data); err != nil {
+		return nil, err
+	}
+
+	return handout.Bytes(), nil
+}
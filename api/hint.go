@@ -0,0 +1,250 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// hintUnlocks returns the set of the hints unlocked by the user.
+func hintUnlocks(userID uint) (map[uint]bool, error) {
+	unlocked := make(map[uint]bool)
+	if userID == 0 {
+		return unlocked, nil
+	}
+
+	unlocks, err := database.QueryHintUnlocks(map[string]interface{}{
+		"user_id": userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, unlock := range unlocks {
+		unlocked[unlock.HintID] = true
+	}
+
+	return unlocked, nil
+}
+
+// requestHintUnlocks returns the set of the hints unlocked by the user making the request.
+func requestHintUnlocks(authHeader string) (map[uint]bool, error) {
+	username, err := coreUtils.GetUser(authHeader)
+	if err != nil {
+		return make(map[uint]bool), nil
+	}
+
+	user, err := database.QueryFirstUserEntry("username", username)
+	if err != nil {
+		return nil, err
+	}
+
+	return hintUnlocks(user.ID)
+}
+
+// hintResp returns the response for the hint, the text of the hint is only
+// included if it is free, released or unlocked by the user.
+func hintResp(hint *database.Hint, unlocked map[uint]bool, admin bool) HintResp {
+	resp := HintResp{
+		Id:       hint.ID,
+		Cost:     hint.Cost,
+		Unlocked: admin || unlocked[hint.ID] || (hint.Cost == 0 && hint.UnlockAfter == 0),
+	}
+
+	if hint.UnlockAfter > 0 {
+		start, err := coreUtils.GetCompetitionStartTime()
+		if err != nil {
+			log.Errorf("Error while getting competition start time : %s", err)
+		} else {
+			unlockAt := start.Add(time.Duration(hint.UnlockAfter) * time.Second)
+			resp.UnlockAt = &unlockAt
+			if time.Now().After(unlockAt) {
+				resp.Unlocked = true
+			}
+		}
+	}
+
+	if resp.Unlocked {
+		resp.Text = hint.Text
+	}
+
+	return resp
+}
+
+// challengeHintsResp returns the hints of the challenge as visible to the user. Challenges
+// without any hint entry fall back to the free hints stored with the challenge.
+func challengeHintsResp(challenge *database.Challenge, unlocked map[uint]bool, admin bool) ([]HintResp, error) {
+	hints, err := database.QueryHintEntries(map[string]interface{}{
+		"challenge_id": challenge.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]HintResp, 0, len(hints))
+	if len(hints) == 0 {
+		for _, hint := range strings.Split(challenge.Hints, core.DELIMITER) {
+			if hint != "" {
+				resp = append(resp, HintResp{
+					Text:     hint,
+					Unlocked: true,
+				})
+			}
+		}
+
+		return resp, nil
+	}
+
+	for i := range hints {
+		resp = append(resp, hintResp(&hints[i], unlocked, admin))
+	}
+
+	return resp, nil
+}
+
+// Unlocks a hint for the user
+// @Summary Unlocks a hint of a challenge for the user, the cost of the hint is deducted from the score of the user.
+// @Description Unlocks the hint for the user making the request and returns the text of the hint. Unlocking a free or an already unlocked hint does not deduct anything, a free hint with a release time can not be unlocked before it is released.
+// @Tags hints
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param hint_id formData string true "Id of the hint to unlock"
+// @Success 200 {object} api.HintResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 403 {object} api.HTTPErrorResp
+// @Failure 404 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/hints/unlock [post]
+func unlockHintHandler(c *gin.Context) {
+	hintID, err := strconv.ParseUint(c.PostForm("hint_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Hint id must be a positive integer",
+		})
+		return
+	}
+
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	err, state := coreUtils.CheckTime()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	if state != 1 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Hints can only be unlocked while the competition is running",
+		})
+		return
+	}
+
+	hint, err := database.QueryHintById(uint(hintID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if hint.ID == 0 {
+		c.JSON(http.StatusNotFound, HTTPErrorResp{
+			Error: "No hint found with the given id",
+		})
+		return
+	}
+
+	admin := user.Role != core.USER_ROLES["contestant"]
+	if !admin {
+		locked, err := manager.LockedChallenges(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		if locked[hint.ChallengeID] {
+			c.JSON(http.StatusForbidden, HTTPErrorResp{
+				Error: "Challenge of the hint is locked, solve the challenges it requires first",
+			})
+			return
+		}
+	}
+
+	unlocked, err := hintUnlocks(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	resp := hintResp(&hint, unlocked, admin)
+	if resp.Unlocked {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	if hint.UnlockAfter > 0 {
+		if resp.UnlockAt == nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "Error while getting the release time of the hint",
+			})
+			return
+		}
+
+		// A free hint with a release time is only meant to be released at that
+		// time, unlocking it earlier would reveal it for nothing.
+		if hint.Cost == 0 {
+			c.JSON(http.StatusBadRequest, HTTPErrorResp{
+				Error: "Hint is released at " + resp.UnlockAt.Format(time.RFC3339) + " and can't be unlocked before that",
+			})
+			return
+		}
+	}
+
+	if user.Score < hint.Cost {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Not enough points to unlock the hint",
+		})
+		return
+	}
+
+	err = database.CreateHintUnlock(&database.HintUnlock{
+		UserID: user.ID,
+		HintID: hint.ID,
+		Cost:   hint.Cost,
+	})
+	if err != nil {
+		log.Errorf("Error while unlocking hint %d for %s : %s", hint.ID, user.Username, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if err = manager.RefreshScores([]uint{user.ID}); err != nil {
+		log.Errorf("Error while refreshing score of %s : %s", user.Username, err)
+	}
+
+	log.Infof("User %s unlocked hint %d for %d points", user.Username, hint.ID, hint.Cost)
+
+	unlocked[hint.ID] = true
+	c.JSON(http.StatusOK, hintResp(&hint, unlocked, false))
+}
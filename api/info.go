@@ -13,28 +13,60 @@ import (
 	"github.com/sdslabs/beastv4/core/config"
 	cfg "github.com/sdslabs/beastv4/core/config"
 	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
 	"github.com/sdslabs/beastv4/core/utils"
 	"github.com/sdslabs/beastv4/pkg/auth"
 	log "github.com/sirupsen/logrus"
 )
 
 // Returns port in use by beast.
-// @Summary Returns ports in use by beast by looking in the hack git repository, also returns min and max value of port allowed while specifying in beast challenge config.
+// @Summary Returns ports in use by the challenges deployed by beast, also returns min and max value of port allowed while specifying in beast challenge config.
 // @Description Returns the ports in use by beast, which cannot be used in creating a new challenge..
 // @Tags info
 // @Accept  json
 // @Produce json
 // @Param Authorization header string true "Bearer"
 // @Success 200 {object} api.PortsInUseResp
+// @Failure 500 {object} api.HTTPErrorResp
 // @Router /api/info/ports/used [get]
 func usedPortsInfoHandler(c *gin.Context) {
+	ports, err := database.QueryAllPorts()
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	portsInUse := make([]uint32, len(ports))
+	for index, port := range ports {
+		portsInUse[index] = port.PortNo
+	}
+
 	c.JSON(http.StatusOK, PortsInUseResp{
-		MinPortValue: core.ALLOWED_MIN_PORT_VALUE,
-		MaxPortValue: core.ALLOWED_MAX_PORT_VALUE,
-		PortsInUse:   cfg.USED_PORTS_LIST,
+		MinPortValue: cfg.Cfg.MinPort,
+		MaxPortValue: cfg.Cfg.MaxPort,
+		PortsInUse:   portsInUse,
 	})
 }
 
+// requestLockedChallenges returns the set of the challenges locked for the user making
+// the request because their requirements are not solved yet.
+func requestLockedChallenges(authHeader string) (map[uint]bool, error) {
+	username, err := utils.GetUser(authHeader)
+	if err != nil {
+		return make(map[uint]bool), nil
+	}
+
+	user, err := database.QueryFirstUserEntry("username", username)
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.LockedChallenges(&user)
+}
+
 // Returns information about a challenge
 // @Summary Returns all information about the challenges.
 // @Description Returns all information about the challenges by the challenge name.
@@ -77,6 +109,15 @@ func challengeInfoHandler(c *gin.Context) {
 			return
 		}
 
+		at, ledger, ok := frozenScores(c)
+		if !ok {
+			return
+		}
+
+		// Once the scoreboard is frozen the contestants see the solves and the points
+		// of the challenge as they were at the freeze time.
+		users, points := frozenChallengeSolvers(ledger, at, &challenge, users)
+
 		challengePorts := make([]uint32, len(challenge.Ports))
 		for index, port := range challenge.Ports {
 			challengePorts[index] = port.PortNo
@@ -116,6 +157,42 @@ func challengeInfoHandler(c *gin.Context) {
 
 		autherr := auth.Authorize(values[1], core.ADMIN)
 
+		if autherr != nil {
+			locked, err := requestLockedChallenges(authHeader)
+			if err != nil {
+				log.Error(err)
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "DATABASE ERROR while processing the request.",
+				})
+				return
+			}
+
+			if locked[challenge.ID] {
+				c.JSON(http.StatusNotFound, HTTPErrorResp{
+					Error: "No challenge found with name: " + name,
+				})
+				return
+			}
+		}
+
+		unlocked, err := requestHintUnlocks(authHeader)
+		if err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		hints, err := challengeHintsResp(&challenge, unlocked, autherr == nil)
+		if err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
 		if autherr != nil {
 			c.JSON(http.StatusOK, ChallengeInfoResp{
 				Name:            name,
@@ -125,32 +202,41 @@ func challengeInfoHandler(c *gin.Context) {
 				Tags:            challengeTags,
 				Status:          challenge.Status,
 				Ports:           challengePorts,
-				Hints:           challenge.Hints,
+				Hints:           hints,
+				Handouts:        challengeHandouts(&challenge),
 				Desc:            challenge.Description,
 				Assets:          strings.Split(challenge.Assets, core.DELIMITER),
 				AdditionalLinks: strings.Split(challenge.AdditionalLinks, core.DELIMITER),
-				Points:          challenge.Points,
+				Points:          points,
 				SolvesNumber:    challSolves,
 				Solves:          challengeUser,
 			})
 			return
 		}
 
+		var flags []string
+		if challenge.Flags != "" {
+			flags = strings.Split(challenge.Flags, core.DELIMITER)
+		}
+
 		c.JSON(http.StatusOK, ChallengeInfoResp{
 			Name:            name,
 			ChallId:         challenge.ID,
 			Category:        challenge.Type,
 			DynamicFlag:     challenge.DynamicFlag,
 			Flag:            challenge.Flag,
+			Flags:           flags,
+			FlagMatch:       challenge.FlagMatch,
 			CreatedAt:       challenge.CreatedAt,
 			Tags:            challengeTags,
 			Status:          challenge.Status,
 			Ports:           challengePorts,
-			Hints:           challenge.Hints,
+			Hints:           hints,
+			Handouts:        challengeHandouts(&challenge),
 			Desc:            challenge.Description,
 			Assets:          strings.Split(challenge.Assets, core.DELIMITER),
 			AdditionalLinks: strings.Split(challenge.AdditionalLinks, core.DELIMITER),
-			Points:          challenge.Points,
+			Points:          points,
 			SolvesNumber:    challSolves,
 			Solves:          challengeUser,
 		})
@@ -259,6 +345,40 @@ func challengesInfoHandler(c *gin.Context) {
 			}
 		}
 
+		unlocked, err := requestHintUnlocks(authHeader)
+		if err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		if autherr != nil {
+			locked, err := requestLockedChallenges(authHeader)
+			if err != nil {
+				log.Error(err)
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "DATABASE ERROR while processing the request.",
+				})
+				return
+			}
+
+			// Challenges whose requirements are not solved yet are hidden from the user.
+			visible := challenges[:0]
+			for _, challenge := range challenges {
+				if !locked[challenge.ID] {
+					visible = append(visible, challenge)
+				}
+			}
+			challenges = visible
+		}
+
+		at, ledger, ok := frozenScores(c)
+		if !ok {
+			return
+		}
+
 		availableChallenges := make([]ChallengeInfoResp, len(challenges))
 
 		for index, challenge := range challenges {
@@ -271,6 +391,10 @@ func challengesInfoHandler(c *gin.Context) {
 				return
 			}
 
+			// Once the scoreboard is frozen the contestants see the solves and the points
+			// of the challenges as they were at the freeze time.
+			users, points := frozenChallengeSolvers(ledger, at, &challenge, users)
+
 			challengePorts := make([]uint32, len(challenge.Ports))
 			for index, port := range challenge.Ports {
 				challengePorts[index] = port.PortNo
@@ -297,6 +421,15 @@ func challengesInfoHandler(c *gin.Context) {
 				challengeTags[index] = tags.TagName
 			}
 
+			hints, err := challengeHintsResp(&challenge, unlocked, autherr == nil)
+			if err != nil {
+				log.Error(err)
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "DATABASE ERROR while processing the request.",
+				})
+				return
+			}
+
 			availableChallenges[index] = ChallengeInfoResp{
 				Name:            challenge.Name,
 				ChallId:         challenge.ID,
@@ -305,9 +438,10 @@ func challengesInfoHandler(c *gin.Context) {
 				CreatedAt:       challenge.CreatedAt,
 				Status:          challenge.Status,
 				Ports:           challengePorts,
-				Hints:           challenge.Hints,
+				Hints:           hints,
+				Handouts:        challengeHandouts(&challenge),
 				Desc:            challenge.Description,
-				Points:          challenge.Points,
+				Points:          points,
 				Assets:          strings.Split(challenge.Assets, core.DELIMITER),
 				AdditionalLinks: strings.Split(challenge.AdditionalLinks, core.DELIMITER),
 				SolvesNumber:    challSolves,
@@ -344,6 +478,7 @@ func availableImagesHandler(c *gin.Context) {
 // @Produce json
 // @Param Authorization header string true "Bearer"
 // @Param challenge query string false "The name of the challenge to get the logs for."
+// @Param service query string false "The name of the service of the challenge to get the logs for instead of the challenge container."
 // @Success 200 {object} api.LogsInfoResp
 // @Failure 400 {object} api.HTTPPlainResp
 // @Failure 500 {object} api.HTTPPlainResp
@@ -357,7 +492,7 @@ func challengeLogsHandler(c *gin.Context) {
 		return
 	}
 
-	logs, err := utils.GetLogs(chall, false)
+	logs, err := utils.GetLogs(chall, c.Query("service"), false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, HTTPPlainResp{
 			Message: err.Error(),
@@ -430,6 +565,12 @@ func userInfoHandler(c *gin.Context) {
 		})
 		return
 	}
+
+	at, ledger, ok := frozenScores(c)
+	if !ok {
+		return
+	}
+
 	var resp UserResp
 
 	var challNameString []string
@@ -437,8 +578,11 @@ func userInfoHandler(c *gin.Context) {
 		challNameString = append(challNameString, challenge.Name)
 	}
 
-	userChallenges := make([]ChallengeSolveResp, len(challenges))
-	for index, challenge := range challenges {
+	userChallenges := make([]ChallengeSolveResp, 0, len(challenges))
+	for _, challenge := range challenges {
+		if ledger != nil && challenge.CreatedAt.After(at) {
+			continue
+		}
 
 		challengeTags := make([]string, len(challenge.Tags))
 
@@ -454,7 +598,7 @@ func userInfoHandler(c *gin.Context) {
 			SolvedAt: challenge.CreatedAt,
 			Points:   challenge.Points,
 		}
-		userChallenges[index] = challResp
+		userChallenges = append(userChallenges, challResp)
 	}
 
 	var rank int64
@@ -482,6 +626,45 @@ func userInfoHandler(c *gin.Context) {
 		Email:      user.Email,
 		Challenges: userChallenges,
 	}
+
+	// For members of a team the rank is the rank of the team, since
+	// the solves of the user are credited to the team.
+	if user.TeamID != 0 {
+		team, err := database.QueryTeamById(user.TeamID)
+		if err == nil && team.ID != 0 && user.Status == 0 {
+			resp.TeamId = team.ID
+			resp.TeamName = team.Name
+			resp.Rank, err = database.GetTeamRank(team.ID, team.Score)
+		}
+
+		if err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+	}
+
+	// Once the scoreboard is frozen the contestants see the score and the rank
+	// as they were at the freeze time.
+	if ledger != nil {
+		resp.Score = ledger.ScoresAt(at)[user.ID]
+
+		entries, ok := frozenScoreboard(c, ledger, resp.TeamId != 0, at)
+		if !ok {
+			return
+		}
+
+		id := user.ID
+		if resp.TeamId != 0 {
+			id = resp.TeamId
+		}
+		if entry, found := entries[id]; found {
+			resp.Rank = int64(entry.Rank)
+		}
+	}
+
 	c.JSON(http.StatusOK, resp)
 	return
 }
@@ -505,6 +688,23 @@ func getAllUsersInfoHandler(c *gin.Context) {
 		})
 		return
 	}
+
+	at, ledger, ok := frozenScores(c)
+	if !ok {
+		return
+	}
+
+	// Once the scoreboard is frozen the contestants see the scores and the ranks
+	// as they were at the freeze time.
+	var scores map[uint]uint
+	var entries map[uint]manager.ScoreboardEntry
+	if ledger != nil {
+		scores = ledger.ScoresAt(at)
+		if entries, ok = frozenScoreboard(c, ledger, false, at); !ok {
+			return
+		}
+	}
+
 	availableUsers := make([]UsersResp, len(users))
 	if len(users) > 0 {
 		for index, user := range users {
@@ -535,6 +735,13 @@ func getAllUsersInfoHandler(c *gin.Context) {
 				Email:    user.Email,
 				Rank:     rank,
 			}
+
+			if ledger != nil {
+				availableUsers[index].Score = scores[user.ID]
+				if entry, found := entries[user.ID]; found {
+					availableUsers[index].Rank = int64(entry.Rank)
+				}
+			}
 		}
 
 		// sort the availableUsers according to the given params
@@ -619,9 +826,24 @@ func submissionsHandler(c *gin.Context) {
 		})
 		return
 	}
+	// Once the scoreboard is frozen the contestants only see the submissions made
+	// till the freeze time.
+	at, err := scoreboardTime(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: err.Error(),
+		})
+		return
+	}
+
 	submissionsResp := make([]SubmissionResp, 0)
+	teams := make(map[uint]database.Team)
 
 	for _, submission := range submissions {
+		if !at.IsZero() && submission.CreatedAt.After(at) {
+			continue
+		}
+
 		user, err := database.QueryUserById(submission.UserID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
@@ -648,9 +870,23 @@ func submissionsHandler(c *gin.Context) {
 				challengeTags[index] = tags.TagName
 			}
 
+			team, ok := teams[user.TeamID]
+			if !ok && user.TeamID != 0 {
+				team, err = database.QueryTeamById(user.TeamID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+						Error: "DATABASE ERROR while fetching team details.",
+					})
+					return
+				}
+				teams[user.TeamID] = team
+			}
+
 			singleSubmissionResp := SubmissionResp{
 				UserId:    user.ID,
 				Username:  user.Username,
+				TeamId:    team.ID,
+				TeamName:  team.Name,
 				ChallId:   challenge[0].ID,
 				ChallName: challenge[0].Name,
 				Category:  challenge[0].Type,
@@ -756,6 +992,7 @@ func competitionInfoHandler(c *gin.Context) {
 		EndingTime:   competitionInfo.EndingTime,
 		TimeZone:     competitionInfo.TimeZone,
 		LogoURL:      strings.Trim(logoPath, "/"),
+		FreezeTime:   competitionInfo.FreezeTime,
 	})
 	return
 }
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func instanceResp(instance *database.Instance, challengeName string) InstanceResp {
+	maxExtensions := config.Cfg.Instances.MaxExtensions
+	if maxExtensions < 0 {
+		maxExtensions = 0
+	}
+
+	return InstanceResp{
+		Id:            instance.ID,
+		Challenge:     challengeName,
+		Port:          instance.Port,
+		StartedAt:     instance.CreatedAt,
+		ExpiresAt:     instance.ExpiresAt,
+		Extensions:    instance.Extensions,
+		MaxExtensions: uint(maxExtensions),
+	}
+}
+
+// instanceChallenge returns the instanced challenge in the request for the user,
+// writes the error response and returns ok as false if the challenge is not
+// available to the user. With running set the competition must be running.
+func instanceChallenge(c *gin.Context, user *database.User, running bool) (challenge database.Challenge, ok bool) {
+	name := c.Param("name")
+
+	challenge, err := database.QueryFirstChallengeEntry("name", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return challenge, false
+	}
+
+	if challenge.ID == 0 {
+		c.JSON(http.StatusNotFound, HTTPErrorResp{
+			Error: fmt.Sprintf("No challenge found with name %s", name),
+		})
+		return challenge, false
+	}
+
+	if user.Role != core.USER_ROLES["contestant"] {
+		return challenge, true
+	}
+
+	if running {
+		err, state := coreUtils.CheckTime()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, HTTPErrorResp{
+				Error: err.Error(),
+			})
+			return challenge, false
+		}
+
+		if state != 1 {
+			c.JSON(http.StatusBadRequest, HTTPErrorResp{
+				Error: "Instances can only be started while the competition is running",
+			})
+			return challenge, false
+		}
+	}
+
+	locked, err := manager.LockedChallenges(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return challenge, false
+	}
+
+	if locked[challenge.ID] {
+		c.JSON(http.StatusNotFound, HTTPErrorResp{
+			Error: fmt.Sprintf("No challenge found with name %s", name),
+		})
+		return challenge, false
+	}
+
+	return challenge, true
+}
+
+// userChallengeInstance returns the instance of the challenge of the user, writes
+// the error response and returns ok as false if the user has no instance of it.
+func userChallengeInstance(c *gin.Context, user *database.User, challenge *database.Challenge) (instance database.Instance, ok bool) {
+	instances, err := database.QueryInstances(map[string]interface{}{
+		"challenge_id": challenge.ID,
+		"user_id":      user.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return instance, false
+	}
+
+	if len(instances) == 0 {
+		c.JSON(http.StatusNotFound, HTTPErrorResp{
+			Error: fmt.Sprintf("No instance of challenge %s is running", challenge.Name),
+		})
+		return instance, false
+	}
+
+	return instances[0], true
+}
+
+// Returns the running instances of the user
+// @Summary Returns the instances of the instanced challenges started by the user.
+// @Description Returns the running instances of the user along with the ports they are exposed on and the time at which they expire.
+// @Tags instance
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Success 200 {object} []api.InstanceResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/instance [get]
+func instancesHandler(c *gin.Context) {
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	instances, err := database.QueryInstances(map[string]interface{}{
+		"user_id": user.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	challenges, err := database.QueryAllChallenges()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	names := make(map[uint]string)
+	for _, challenge := range challenges {
+		names[challenge.ID] = challenge.Name
+	}
+
+	resp := make([]InstanceResp, 0, len(instances))
+	for i := range instances {
+		resp = append(resp, instanceResp(&instances[i], names[instances[i].ChallengeID]))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Starts an instance of the challenge for the user
+// @Summary Starts a private instance of an instanced challenge for the user.
+// @Description Starts an instance of the challenge from its committed image exposed on a port allocated to the instance, the instance is stopped once it expires. If the user already has an instance of the challenge running it is returned. The number of instances a user can run at a time is limited.
+// @Tags instance
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param name path string true "Name of the challenge"
+// @Success 200 {object} api.InstanceResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 404 {object} api.HTTPErrorResp
+// @Failure 429 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/instance/{name} [post]
+func startInstanceHandler(c *gin.Context) {
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	challenge, ok := instanceChallenge(c, &user, true)
+	if !ok {
+		return
+	}
+
+	instance, err := manager.StartInstance(&challenge, &user)
+	switch {
+	case errors.Is(err, manager.ErrNotInstanced), errors.Is(err, manager.ErrNotDeployed):
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("Cannot start an instance of challenge %s : %s", challenge.Name, err),
+		})
+		return
+	case errors.Is(err, manager.ErrInstanceLimit):
+		c.JSON(http.StatusTooManyRequests, HTTPErrorResp{
+			Error: fmt.Sprintf("At most %d instances can be running at a time, stop one of them first", config.Cfg.Instances.MaxPerUser),
+		})
+		return
+	case err != nil:
+		log.Errorf("Error while starting instance of %s for %s : %s", challenge.Name, user.Username, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "Error while starting the instance",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, instanceResp(instance, challenge.Name))
+}
+
+// Extends the instance of the challenge of the user
+// @Summary Extends the time for which the instance of the challenge of the user runs.
+// @Description Extends the expiry of the instance of the challenge by the configured extension time, an instance can only be extended a limited number of times.
+// @Tags instance
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param name path string true "Name of the challenge"
+// @Success 200 {object} api.InstanceResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 404 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/instance/{name}/extend [post]
+func extendInstanceHandler(c *gin.Context) {
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	challenge, ok := instanceChallenge(c, &user, true)
+	if !ok {
+		return
+	}
+
+	instance, ok := userChallengeInstance(c, &user, &challenge)
+	if !ok {
+		return
+	}
+
+	err := manager.ExtendInstance(&instance)
+	switch {
+	case errors.Is(err, manager.ErrExtensionDisabled), errors.Is(err, manager.ErrExtensionLimit):
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("Cannot extend the instance : %s", err),
+		})
+		return
+	case err != nil:
+		log.Errorf("Error while extending instance %d : %s", instance.ID, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, instanceResp(&instance, challenge.Name))
+}
+
+// Stops the instance of the challenge of the user
+// @Summary Stops the instance of the challenge started by the user.
+// @Description Stops the instance of the challenge and frees the port allocated to it, the user can start a new instance afterwards.
+// @Tags instance
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param name path string true "Name of the challenge"
+// @Success 200 {object} api.HTTPPlainResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 404 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/instance/{name} [delete]
+func stopInstanceHandler(c *gin.Context) {
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	challenge, ok := instanceChallenge(c, &user, false)
+	if !ok {
+		return
+	}
+
+	instance, ok := userChallengeInstance(c, &user, &challenge)
+	if !ok {
+		return
+	}
+
+	if err := manager.StopInstance(&instance); err != nil {
+		log.Errorf("Error while stopping instance %d : %s", instance.ID, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "Error while stopping the instance",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, HTTPPlainResp{
+		Message: fmt.Sprintf("Instance of challenge %s stopped", challenge.Name),
+	})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -11,10 +12,10 @@ import (
 	_ "github.com/sdslabs/beastv4/api/docs"
 	"github.com/sdslabs/beastv4/core"
 	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
 	"github.com/sdslabs/beastv4/core/manager"
 	"github.com/sdslabs/beastv4/pkg/auth"
 	"github.com/sdslabs/beastv4/pkg/scheduler"
-	wpool "github.com/sdslabs/beastv4/pkg/workerpool"
 )
 
 const (
@@ -51,6 +52,7 @@ func RunBeastApiServer(port, defaultauthorpassword string, autoDeploy, healthPro
 	log.Info("Bootstrapping Beast API server")
 
 	config.InitConfig()
+	initSubmissionRateLimiter()
 
 	if port != "" {
 		port = ":" + port
@@ -58,8 +60,8 @@ func RunBeastApiServer(port, defaultauthorpassword string, autoDeploy, healthPro
 		port = DEFAULT_BEAST_PORT
 	}
 
-	manager.Q = wpool.InitQueue(core.MAX_QUEUE_SIZE, nil)
-	manager.Q.StartWorkers(&manager.Worker{})
+	manager.InitQueue(nil)
+	manager.ResumeQueuedTasks()
 
 	auth.Init(core.ITERATIONS, core.HASH_LENGTH, core.TIMEPERIOD, core.ISSUER, config.Cfg.JWTSecret, []string{core.USER_ROLES["author"]}, []string{core.USER_ROLES["admin"]}, []string{core.USER_ROLES["contestant"]})
 
@@ -87,6 +89,13 @@ func RunBeastApiServer(port, defaultauthorpassword string, autoDeploy, healthPro
 
 	log.Info("Starting beast scheduler")
 	BeastScheduler.Start()
+	loadScheduledActions()
+
+	log.Infof("Scheduling cleanup of expired challenge instances with period: %v", config.Cfg.Instances.CleanupPeriodDuration)
+	BeastScheduler.ScheduleEvery(config.Cfg.Instances.CleanupPeriodDuration, manager.CleanupExpiredInstances)
+
+	log.Infof("Scheduling monitoring of resources used by the challenges with period: %v", config.Cfg.ResourceMonitor.PeriodDuration)
+	BeastScheduler.ScheduleEvery(config.Cfg.ResourceMonitor.PeriodDuration, manager.CollectChallengeResources)
 
 	if periodicSync {
 		log.Infof("Scheduling periodic remote sync and auto update for beast with period: %v", config.Cfg.RemoteSyncPeriod)
@@ -106,3 +115,41 @@ func RunBeastApiServer(port, defaultauthorpassword string, autoDeploy, healthPro
 	}
 	router.Run(port)
 }
+
+// scheduledActionTaskID returns the ID of the task of the scheduled action in the
+// beast scheduler.
+func scheduledActionTaskID(id uint) scheduler.TaskID {
+	return scheduler.TaskID(fmt.Sprintf("scheduled-action-%d", id))
+}
+
+// scheduleAction adds the task running the scheduled action to the beast scheduler.
+func scheduleAction(action *database.ScheduledAction) error {
+	_, err := BeastScheduler.ScheduleTask(scheduledActionTaskID(action.ID), action.Cron, action.NextRun, runScheduledAction, action.ID)
+	return err
+}
+
+// runScheduledAction runs the scheduled action, the task of the action is removed
+// from the scheduler if the action has been cancelled elsewhere like from the CLI.
+func runScheduledAction(id uint) {
+	if !manager.RunScheduledAction(id) {
+		BeastScheduler.Cancel(scheduledActionTaskID(id))
+	}
+}
+
+// loadScheduledActions schedules the actions stored in the database, the actions
+// which were due while beast was not running are run right away.
+func loadScheduledActions() {
+	actions, err := database.QueryScheduledActions()
+	if err != nil {
+		log.Errorf("Error while querying scheduled actions : %s", err)
+		return
+	}
+
+	for index := range actions {
+		if err = scheduleAction(&actions[index]); err != nil {
+			log.Errorf("Error while scheduling action %d : %s", actions[index].ID, err)
+		}
+	}
+
+	log.Infof("Loaded %d scheduled actions", len(actions))
+}
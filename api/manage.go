@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -82,12 +83,14 @@ func manageMultipleChallengeHandlerTagBased(c *gin.Context) {
 
 // Handles route related to managing a challenge
 // @Summary Handles challenge management actions.
-// @Description Handles challenge management routes with actions which includes - DEPLOY, UNDEPLOY, PURGE.
+// @Description Handles challenge management routes with actions which includes - DEPLOY, UNDEPLOY, PURGE, ROLLBACK. ROLLBACK recreates the challenge from an earlier image in its image history, the image before the current one if no version is provided.
 // @Tags manage
 // @Accept  json
 // @Produce json
 // @Param name query string true "Name of the challenge to be managed, here name is the unique identifier for challenge"
 // @Param action query string true "Action for the challenge"
+// @Param version query int false "Version of the image to rollback to"
+// @Param priority query int false "Priority of the task in the queue, tasks with a higher priority are performed first"
 // @Success 200 {object} api.HTTPPlainResp
 // @Failure 400 {object} api.HTTPPlainResp
 // @Router /api/manage/challenge/ [post]
@@ -111,7 +114,31 @@ func manageChallengeHandler(c *gin.Context) {
 
 	log.Infof("Trying %s for challenge with identifier : %s", action, identifier)
 
-	err := challAction(identifier)
+	priority := 0
+	if p := c.PostForm("priority"); p != "" {
+		v, e := strconv.Atoi(p)
+		if e != nil {
+			c.JSON(http.StatusBadRequest, HTTPPlainResp{
+				Message: fmt.Sprintf("Invalid priority : %s", p),
+			})
+			return
+		}
+		priority = v
+	}
+
+	var err error
+	if version := c.PostForm("version"); action == core.MANAGE_ACTION_ROLLBACK && version != "" {
+		v, e := strconv.ParseUint(version, 10, 32)
+		if e != nil || v == 0 {
+			c.JSON(http.StatusBadRequest, HTTPPlainResp{
+				Message: fmt.Sprintf("Invalid version : %s", version),
+			})
+			return
+		}
+		err = manager.RollbackChallenge(identifier, uint(v))
+	} else {
+		err = challAction(identifier)
+	}
 
 	if err != nil {
 		c.JSON(http.StatusBadRequest, HTTPPlainResp{
@@ -120,12 +147,45 @@ func manageChallengeHandler(c *gin.Context) {
 		return
 	}
 
+	// The task may have already been started by a worker, in which case its
+	// priority no longer matters.
+	if priority != 0 {
+		if err = manager.SetTaskPriority(identifier, priority); err != nil {
+			log.Warnf("Could not set priority of %s on %s : %s", action, identifier, err)
+		}
+	}
+
 	respStr := fmt.Sprintf("Your action %s on challenge %s has been triggered, check stats.", action, identifier)
 	c.JSON(http.StatusOK, HTTPPlainResp{
 		Message: respStr,
 	})
 }
 
+// Cancels the queued task of a challenge
+// @Summary Removes the pending task of the challenge from the queue.
+// @Description Cancels the task of the challenge which is pending in the queue, the challenge gets back the status it had before the task was queued. A task which is already being performed can not be cancelled.
+// @Tags manage
+// @Accept  json
+// @Produce json
+// @Param challenge path string true "Name of the challenge whose task is to be cancelled"
+// @Success 200 {object} api.HTTPPlainResp
+// @Failure 400 {object} api.HTTPPlainResp
+// @Router /api/manage/queue/:challenge [delete]
+func cancelQueuedTaskHandler(c *gin.Context) {
+	challengeName := c.Param("challenge")
+
+	if err := manager.CancelQueuedTask(challengeName); err != nil {
+		c.JSON(http.StatusBadRequest, HTTPPlainResp{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, HTTPPlainResp{
+		Message: fmt.Sprintf("Cancelled the queued task of challenge %s", challengeName),
+	})
+}
+
 // Handles route related to managing multiple challenges.
 // @Summary Handles multiple challenge management actions.
 // @Description Handles challenge management routes with actions which includes - DEPLOY, UNDEPLOY, PURGE of multiple challenges.
@@ -329,7 +389,7 @@ func verifyHandler(c *gin.Context) {
 
 // Execute a scheduled action on a challenge.
 // @Summary Schedule an action(deploy, undeploy, purge etc.) on a particular challenge
-// @Description Handles scheduleing of challenge action to executed at some later point of time
+// @Description Handles scheduleing of challenge action to executed at some later point of time, or periodically at the times matching a cron expression. Scheduled actions are stored and survive restarts of beast.
 // @Tags manage
 // @Accept  json
 // @Produce json
@@ -339,7 +399,8 @@ func verifyHandler(c *gin.Context) {
 // @Param tags query string false "Tag corresponding to challenges in context, optional if challenge name is provided"
 // @Param at query string false "Timestamp at which the challenge should be scheduled should be a unix timestamp string."
 // @Param after query string false "Time after which the action on the selector should be executed should be of duration format as in '1m20s' etc."
-// @Success 200 {object} api.HTTPPlainResp
+// @Param cron query string false "Cron expression like '*/30 * * * *' or '@every 30m' at which the action should be executed repeatedly."
+// @Success 200 {object} api.ScheduledActionResp
 // @Failure 400 {object} api.HTTPPlainResp
 // @Router /api/manage/schedule/:action [post]
 func manageScheduledAction(c *gin.Context) {
@@ -349,7 +410,7 @@ func manageScheduledAction(c *gin.Context) {
 
 	authorization := c.GetHeader("Authorization")
 	username, err := coreUtils.GetUser(authorization)
-	if err == nil {
+	if err != nil {
 		log.Warn("Error while getting user from authorization header, using default user(since already authorized)")
 		username = core.DEFAULT_USER_NAME
 	}
@@ -363,15 +424,19 @@ func manageScheduledAction(c *gin.Context) {
 
 	at := c.PostForm("at")
 	after := c.PostForm("after")
-	if at == "" && after == "" {
+	cron := c.PostForm("cron")
+	if at == "" && after == "" && cron == "" {
 		c.JSON(http.StatusBadRequest, HTTPPlainResp{
-			Message: "A time correspondence should be associated with a schedule, no parameter at or after",
+			Message: "A time correspondence should be associated with a schedule, no parameter at, after or cron",
 		})
 		return
 	}
 
 	var duration time.Duration
-	if at != "" {
+	switch {
+	case cron != "":
+		// The cron expression is validated when the schedule is created.
+	case at != "":
 		duration, err = utils.GetDurationFromTimestamp(at)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, HTTPPlainResp{
@@ -379,7 +444,7 @@ func manageScheduledAction(c *gin.Context) {
 			})
 			return
 		}
-	} else {
+	default:
 		duration, err = time.ParseDuration(after)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, HTTPPlainResp{
@@ -389,8 +454,7 @@ func manageScheduledAction(c *gin.Context) {
 		}
 	}
 
-	actionHandler, ok := manager.ChallengeActionHandlers[action]
-	if !ok {
+	if _, ok := manager.ChallengeActionHandlers[action]; !ok {
 		c.JSON(http.StatusBadRequest, HTTPPlainResp{
 			Message: fmt.Sprintf("Invalid Action : %s", action),
 		})
@@ -400,22 +464,108 @@ func manageScheduledAction(c *gin.Context) {
 	// If a tag is provided we deploy using the tag, else we deploy the challenge
 	// name we are provided
 	if tag != "" {
+		challenge = ""
 		manager.LogTransaction(fmt.Sprintf("TAG:%s", tag), "SCHEDULE::"+action, authorization)
-
-		BeastScheduler.ScheduleAfter(duration, manager.HandleTagRelatedChallenges, action, tag, username)
-		log.Infof("Scheduled %s for challenges with tag %s", action, tag)
 	} else {
 		manager.LogTransaction(challenge, "SCHEDULE::"+action, authorization)
+	}
 
-		BeastScheduler.ScheduleAfter(duration, actionHandler, challenge)
-		log.Infof("Scheduled %s for challenge %s", action, challenge)
+	scheduled, err := manager.CreateScheduledAction(action, challenge, tag, username, time.Now().Add(duration), cron)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPPlainResp{
+			Message: err.Error(),
+		})
+		return
 	}
 
+	if err = scheduleAction(scheduled); err != nil {
+		log.Errorf("Error while scheduling action %d : %s", scheduled.ID, err)
+		manager.CancelScheduledAction(scheduled.ID)
+		c.JSON(http.StatusInternalServerError, HTTPPlainResp{
+			Message: fmt.Sprintf("Error while scheduling the action: %s", err),
+		})
+		return
+	}
+
+	log.Infof("Scheduled %s for challenge selector %s%s with ID %d", action, challenge, tag, scheduled.ID)
+	c.JSON(http.StatusOK, scheduledActionResp(scheduled))
+}
+
+// Lists the scheduled actions.
+// @Summary Returns all the scheduled actions on challenges.
+// @Description Returns the scheduled actions along with their challenge selector, cron expression for the recurring ones and the time of the next run, the action to be run first is returned first.
+// @Tags manage
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Success 200 {array} api.ScheduledActionResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/manage/schedule [get]
+func scheduledActionsHandler(c *gin.Context) {
+	actions, err := database.QueryScheduledActions()
+	if err != nil {
+		log.Errorf("Error while querying scheduled actions : %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	resp := make([]ScheduledActionResp, len(actions))
+	for index := range actions {
+		resp[index] = scheduledActionResp(&actions[index])
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Cancels a scheduled action.
+// @Summary Cancels the scheduled action with the ID.
+// @Description Deletes the scheduled action so that it is not run anymore, recurring actions are cancelled along with all their future runs.
+// @Tags manage
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param id path int true "ID of the scheduled action"
+// @Success 200 {object} api.HTTPPlainResp
+// @Failure 400 {object} api.HTTPPlainResp
+// @Router /api/manage/schedule/:id [delete]
+func cancelScheduledActionHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPPlainResp{
+			Message: fmt.Sprintf("Invalid ID : %s", c.Param("id")),
+		})
+		return
+	}
+
+	if err = manager.CancelScheduledAction(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, HTTPPlainResp{
+			Message: err.Error(),
+		})
+		return
+	}
+	BeastScheduler.Cancel(scheduledActionTaskID(uint(id)))
+
 	c.JSON(http.StatusOK, HTTPPlainResp{
-		Message: fmt.Sprintf("Challenge with the provided selector has been scheduled for %s", action),
+		Message: fmt.Sprintf("Cancelled the scheduled action %d", id),
 	})
 }
 
+func scheduledActionResp(action *database.ScheduledAction) ScheduledActionResp {
+	return ScheduledActionResp{
+		ID:        action.ID,
+		Action:    action.Action,
+		Challenge: action.Challenge,
+		Tag:       action.Tag,
+		Username:  action.Username,
+		Cron:      action.Cron,
+		NextRun:   action.NextRun,
+		LastRun:   action.LastRun,
+		CreatedAt: action.CreatedAt,
+	}
+}
+
 // Prepare challenge info from .zip file.
 // @Summary Unzip and fetch info from beast.toml file in challenge
 // @Description Handles the challenge management from a challenge in zip file. Currently prepare the zip file
@@ -503,6 +653,14 @@ func manageUploadHandler(c *gin.Context) {
 		return
 	}
 
+	hints := make([]HintResp, len(config.Challenge.Metadata.Hints))
+	for index, hint := range config.Challenge.Metadata.Hints {
+		hints[index] = HintResp{
+			Text: hint.Text,
+			Cost: hint.Cost,
+		}
+	}
+
 	c.JSON(http.StatusOK, ChallengePreviewResp{
 		Name:            config.Challenge.Metadata.Name,
 		Category:        config.Challenge.Metadata.Type,
@@ -510,7 +668,7 @@ func manageUploadHandler(c *gin.Context) {
 		Assets:          config.Challenge.Metadata.Assets,
 		AdditionalLinks: config.Challenge.Metadata.AdditionalLinks,
 		Ports:           config.Challenge.Env.Ports,
-		Hints:           config.Challenge.Metadata.Hints,
+		Hints:           hints,
 		Desc:            config.Challenge.Metadata.Description,
 		Points:          config.Challenge.Metadata.Points,
 	})
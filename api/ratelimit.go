@@ -0,0 +1,74 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/pkg/notify"
+	"github.com/sdslabs/beastv4/pkg/ratelimit"
+	log "github.com/sirupsen/logrus"
+)
+
+// Rate limiter for the flag submissions, keyed on the user and the challenge.
+// It is nil when rate limiting is disabled in the beast config.
+var submissionLimiter *ratelimit.Limiter
+
+func submissionRateLimitStateFile() string {
+	return filepath.Join(core.BEAST_GLOBAL_DIR, core.BEAST_RATE_LIMIT_STATE_FILE)
+}
+
+func initSubmissionRateLimiter() {
+	limitConfig := config.Cfg.SubmissionRateLimit
+	if !limitConfig.Enabled() {
+		log.Info("Flag submission rate limiting is disabled")
+		return
+	}
+
+	submissionLimiter = ratelimit.NewLimiter(
+		limitConfig.Attempts,
+		limitConfig.PeriodDuration,
+		limitConfig.LockoutDuration,
+		limitConfig.MaxLockoutDuration,
+	)
+
+	if limitConfig.Persist {
+		if err := submissionLimiter.Load(submissionRateLimitStateFile()); err != nil {
+			log.Errorf("Error while loading submission rate limit state: %s", err)
+		}
+	}
+}
+
+// checkSubmissionRateLimit registers a submission of the user for the challenge
+// and returns if it is allowed along with the seconds after which the user can retry.
+func checkSubmissionRateLimit(user *database.User, challenge *database.Challenge) (bool, int64) {
+	if submissionLimiter == nil {
+		return true, 0
+	}
+
+	limitConfig := config.Cfg.SubmissionRateLimit
+	result := submissionLimiter.Attempt(fmt.Sprintf("%d:%d", user.ID, challenge.ID))
+	if result.Allowed {
+		return true, 0
+	}
+
+	if result.NewLockout {
+		log.Warnf("User %s locked out of challenge %s for %s", user.Username, challenge.Name, result.RetryAfter)
+
+		if result.Lockouts >= limitConfig.NotifyAfter {
+			msg := fmt.Sprintf("User %s has hit the flag submission rate limit for challenge %s %d times in a row, locked out for %s", user.Username, challenge.Name, result.Lockouts, result.RetryAfter)
+			go notify.SendNotification(notify.Warning, msg)
+		}
+
+		if limitConfig.Persist {
+			if err := submissionLimiter.Save(submissionRateLimitStateFile()); err != nil {
+				log.Errorf("Error while saving submission rate limit state: %s", err)
+			}
+		}
+	}
+
+	return false, int64(math.Ceil(result.RetryAfter.Seconds()))
+}
@@ -34,9 +34,88 @@ type PortsInUseResp struct {
 }
 
 type ChallengeStatusResp struct {
-	Name      string    `json:"name" example:"Web Challenge"`
-	Status    string    `json:"status" example:"deployed"`
-	UpdatedAt time.Time `json:"updated_at" example:"2018-12-31T22:20:08.948096189+05:30"`
+	Name      string            `json:"name" example:"Web Challenge"`
+	Status    string            `json:"status" example:"deployed"`
+	UpdatedAt time.Time         `json:"updated_at" example:"2018-12-31T22:20:08.948096189+05:30"`
+	Services  map[string]string `json:"services,omitempty"`
+
+	RestartCount int64                  `json:"restart_count" example:"2"`
+	Restarts     []ChallengeRestartResp `json:"restarts,omitempty"`
+}
+
+type ChallengeRestartResp struct {
+	Action    string    `json:"action" example:"restart"`
+	Attempt   int       `json:"attempt" example:"1"`
+	Reason    string    `json:"reason" example:"dial tcp 127.0.0.1:10001: connect: connection refused"`
+	Success   bool      `json:"success" example:"true"`
+	Error     string    `json:"error,omitempty" example:""`
+	CreatedAt time.Time `json:"created_at" example:"2018-12-31T22:20:08.948096189+05:30"`
+}
+
+type HealthUptimeResp struct {
+	LastHour float64 `json:"1h" example:"100"`
+	LastDay  float64 `json:"24h" example:"97.5"`
+	Event    float64 `json:"event" example:"99.2"`
+}
+
+type HealthOutageResp struct {
+	StartedAt time.Time  `json:"started_at" example:"2018-12-31T22:20:08.948096189+05:30"`
+	EndedAt   *time.Time `json:"ended_at,omitempty" example:"2018-12-31T23:20:08.948096189+05:30"`
+	Duration  string     `json:"duration" example:"1h0m0s"`
+	Reason    string     `json:"reason" example:"dial tcp 127.0.0.1:10001: connect: connection refused"`
+}
+
+type HealthResultResp struct {
+	Result    string    `json:"result" example:"failure"`
+	Error     string    `json:"error,omitempty" example:"dial tcp 127.0.0.1:10001: connect: connection refused"`
+	CheckedAt time.Time `json:"checked_at" example:"2018-12-31T22:20:08.948096189+05:30"`
+}
+
+type ChallengeHealthResp struct {
+	Name    string             `json:"name" example:"Web Challenge"`
+	Status  string             `json:"status" example:"Deployed"`
+	Since   time.Time          `json:"since" example:"2018-12-31T10:00:00+05:30"`
+	Uptime  HealthUptimeResp   `json:"uptime"`
+	Outages []HealthOutageResp `json:"outages"`
+	Results []HealthResultResp `json:"results"`
+}
+
+type ChallengeResourcesResp struct {
+	Name          string    `json:"name" example:"Web Challenge"`
+	CPUPercent    float64   `json:"cpu_percent" example:"12.5"`
+	MemoryUsage   uint64    `json:"memory_usage" example:"52428800"`
+	MemoryLimit   uint64    `json:"memory_limit" example:"536870912"`
+	MemoryPercent float64   `json:"memory_percent" example:"9.77"`
+	NetworkRx     uint64    `json:"network_rx" example:"1048576"`
+	NetworkTx     uint64    `json:"network_tx" example:"2097152"`
+	Pids          uint64    `json:"pids" example:"12"`
+	PidsLimit     uint64    `json:"pids_limit" example:"100"`
+	SampledAt     time.Time `json:"sampled_at" example:"2018-12-31T22:20:08.948096189+05:30"`
+}
+
+type QueuedTaskResp struct {
+	Challenge string     `json:"challenge" example:"Web Challenge"`
+	Action    string     `json:"action" example:"deploy"`
+	Priority  int        `json:"priority" example:"0"`
+	QueuedAt  time.Time  `json:"queued_at" example:"2018-12-31T22:20:08.948096189+05:30"`
+	StartedAt *time.Time `json:"started_at,omitempty" example:"2018-12-31T22:20:08.948096189+05:30"`
+}
+
+type QueueResp struct {
+	Pending []QueuedTaskResp `json:"pending"`
+	Running []QueuedTaskResp `json:"running"`
+}
+
+type ScheduledActionResp struct {
+	ID        uint       `json:"id" example:"3"`
+	Action    string     `json:"action" example:"redeploy"`
+	Challenge string     `json:"challenge,omitempty" example:"Web Challenge"`
+	Tag       string     `json:"tag,omitempty" example:"web"`
+	Username  string     `json:"username" example:"fristonio"`
+	Cron      string     `json:"cron,omitempty" example:"*/30 * * * *"`
+	NextRun   time.Time  `json:"next_run" example:"2018-12-31T22:20:08.948096189+05:30"`
+	LastRun   *time.Time `json:"last_run,omitempty" example:"2018-12-31T21:50:08.948096189+05:30"`
+	CreatedAt time.Time  `json:"created_at" example:"2018-12-31T21:20:08.948096189+05:30"`
 }
 
 type ChallengesResp struct {
@@ -70,6 +149,8 @@ type UserResp struct {
 	Score      uint                 `json:"score" example:"750"`
 	Rank       int64                `json:"rank" example:"15"`
 	Email      string               `json:"email" example:"fristonio@gmail.com"`
+	TeamId     uint                 `json:"team_id" example:"2"`
+	TeamName   string               `json:"team_name" example:"sdslabs"`
 	Challenges []ChallengeSolveResp `json:"challenges"`
 }
 
@@ -108,30 +189,91 @@ type ChallengeInfoResp struct {
 	CreatedAt       time.Time       `json:"createdAt"`
 	Status          string          `json:"status" example:"deployed"`
 	Ports           []uint32        `json:"ports" example:[3001, 3002]`
-	Hints           string          `json:"hints" example:"Try robots"`
+	Hints           []HintResp      `json:"hints"`
 	Desc            string          `json:"description" example:"A simple web challenge"`
 	Points          uint            `json:"points" example:"50"`
 	SolvesNumber    int             `json:"solvesNumber" example:"100"`
 	Solves          []UserSolveResp `json:"solves"`
 	DynamicFlag     bool            `json:"dynamicFlag" example:"true"`
 	Flag            string          `json:"flag"`
+
+	Flags     []string `json:"flags,omitempty"`
+	FlagMatch string   `json:"flag_match,omitempty"`
+	Handouts  []string `json:"handouts,omitempty" example:"['/api/handout/web-challenge/notes.txt']"`
+}
+
+type HintResp struct {
+	Id       uint       `json:"id" example:"4"`
+	Text     string     `json:"text,omitempty" example:"Try robots"`
+	Cost     uint       `json:"cost" example:"10"`
+	UnlockAt *time.Time `json:"unlock_at,omitempty"`
+	Unlocked bool       `json:"unlocked" example:"true"`
+}
+
+type DeploymentStageResp struct {
+	Name      string     `json:"name" example:"committing"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type DeploymentResp struct {
+	Id        uint                  `json:"id" example:"12"`
+	Status    string                `json:"status" example:"Failed"`
+	Commit    string                `json:"commit,omitempty" example:"8f2c1e0a9b7d6c5e4f3a2b1c0d9e8f7a6b5c4d3e"`
+	Error     string                `json:"error,omitempty"`
+	StartedAt time.Time             `json:"started_at"`
+	EndedAt   *time.Time            `json:"ended_at,omitempty"`
+	Stages    []DeploymentStageResp `json:"stages"`
+	BuildLog  string                `json:"build_log,omitempty"`
+}
+
+type DeploymentsResp struct {
+	Challenge   string           `json:"challenge" example:"Web Challenge"`
+	Deployments []DeploymentResp `json:"deployments"`
+}
+
+type ChallengeImageResp struct {
+	Version uint      `json:"version" example:"4"`
+	ImageId string    `json:"image_id"`
+	Tag     string    `json:"tag"`
+	Commit  string    `json:"commit,omitempty" example:"8f2c1e0a9b7d6c5e4f3a2b1c0d9e8f7a6b5c4d3e"`
+	BuiltAt time.Time `json:"built_at"`
+	InUse   bool      `json:"in_use" example:"true"`
+}
+
+type ChallengeImagesResp struct {
+	Challenge string               `json:"challenge" example:"Web Challenge"`
+	Images    []ChallengeImageResp `json:"images"`
+}
+
+type InstanceResp struct {
+	Id            uint      `json:"id" example:"3"`
+	Challenge     string    `json:"challenge" example:"Web Challenge"`
+	Port          uint32    `json:"port" example:"20001"`
+	StartedAt     time.Time `json:"started_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	Extensions    uint      `json:"extensions" example:"1"`
+	MaxExtensions uint      `json:"max_extensions" example:"2"`
 }
 
 type ChallengePreviewResp struct {
-	Name            string   `json:"name" example:"Web Challenge"`
-	Category        string   `json:"category" example:"web"`
-	Tags            []string `json:"tags" example:"['pwn','misc']"`
-	Assets          []string `json:"assets" example:"['image1.png', 'zippy.zip']"`
-	AdditionalLinks []string `json:"additionalLinks" example:"['http://link1.abc:8080','http://link2.abc:8081']"`
-	Ports           []uint32 `json:"ports" example:[3001, 3002]`
-	Hints           []string `json:"hints" example:"Try robots"`
-	Desc            string   `json:"description" example:"A simple web challenge"`
-	Points          uint     `json:"points" example:"50"`
+	Name            string     `json:"name" example:"Web Challenge"`
+	Category        string     `json:"category" example:"web"`
+	Tags            []string   `json:"tags" example:"['pwn','misc']"`
+	Assets          []string   `json:"assets" example:"['image1.png', 'zippy.zip']"`
+	AdditionalLinks []string   `json:"additionalLinks" example:"['http://link1.abc:8080','http://link2.abc:8081']"`
+	Ports           []uint32   `json:"ports" example:[3001, 3002]`
+	Hints           []HintResp `json:"hints"`
+	Desc            string     `json:"description" example:"A simple web challenge"`
+	Points          uint       `json:"points" example:"50"`
 }
 
 type SubmissionResp struct {
 	UserId    uint      `json:"user_id" example:"3"`
 	Username  string    `json:"username" example:"fristonio"`
+	TeamId    uint      `json:"team_id" example:"2"`
+	TeamName  string    `json:"team_name" example:"sdslabs"`
 	ChallId   uint      `json:"chall_id" example:"3"`
 	ChallName string    `json:"name" example:"Web Challenge"`
 	Category  string    `json:"category" example:"web"`
@@ -140,9 +282,86 @@ type SubmissionResp struct {
 	SolvedAt  time.Time `json:"solvedAt"`
 }
 
+type TeamMemberResp struct {
+	Id       uint   `json:"id" example:"5"`
+	Username string `json:"username" example:"fristonio"`
+	Score    uint   `json:"score" example:"250"`
+	Captain  bool   `json:"captain" example:"true"`
+}
+
+type TeamResp struct {
+	Id         uint                 `json:"id" example:"2"`
+	Name       string               `json:"name" example:"sdslabs"`
+	Score      uint                 `json:"score" example:"750"`
+	Rank       int64                `json:"rank" example:"3"`
+	CaptainId  uint                 `json:"captain_id" example:"5"`
+	JoinCode   string               `json:"join_code,omitempty" example:"3f2a9c1b7d4e8a60"`
+	Members    []TeamMemberResp     `json:"members"`
+	Challenges []ChallengeSolveResp `json:"challenges"`
+}
+
+type TeamsResp struct {
+	Id      uint   `json:"id" example:"2"`
+	Name    string `json:"name" example:"sdslabs"`
+	Score   uint   `json:"score" example:"750"`
+	Rank    int64  `json:"rank" example:"3"`
+	Members int64  `json:"members" example:"4"`
+}
+
+type AttemptResp struct {
+	Id          uint      `json:"id" example:"42"`
+	UserId      uint      `json:"user_id" example:"3"`
+	Username    string    `json:"username" example:"fristonio"`
+	ChallId     uint      `json:"chall_id" example:"3"`
+	ChallName   string    `json:"chall_name" example:"Web Challenge"`
+	Flag        string    `json:"flag" example:"flag{n0t_th3_fl4g}"`
+	Result      string    `json:"result" example:"incorrect"`
+	SourceIP    string    `json:"source_ip" example:"10.0.0.12"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+}
+
+type AttemptsResp struct {
+	Total    int64         `json:"total" example:"120"`
+	Page     int           `json:"page" example:"1"`
+	PerPage  int           `json:"per_page" example:"50"`
+	Attempts []AttemptResp `json:"attempts"`
+}
+
+type CheatingReportResp struct {
+	Id            uint      `json:"id" example:"7"`
+	UserId        uint      `json:"user_id" example:"3"`
+	Username      string    `json:"username" example:"fristonio"`
+	OwnerId       uint      `json:"owner_id" example:"5"`
+	OwnerUsername string    `json:"owner_username" example:"deepakkumar"`
+	ChallId       uint      `json:"chall_id" example:"3"`
+	ChallName     string    `json:"chall_name" example:"Web Challenge"`
+	Flag          string    `json:"flag" example:"flag{8c5a1e0f}"`
+	Reason        string    `json:"reason" example:"submitted_user_flag"`
+	SourceIP      string    `json:"source_ip" example:"10.0.0.12"`
+	ReportedAt    time.Time `json:"reportedAt"`
+}
+
+type CheatingReportsResp struct {
+	Reports []CheatingReportResp `json:"reports"`
+}
+
+type ScoreMismatchResp struct {
+	Type     string `json:"type" example:"user"`
+	Id       uint   `json:"id" example:"5"`
+	Name     string `json:"name" example:"fristonio"`
+	Stored   uint   `json:"stored" example:"450"`
+	Computed uint   `json:"computed" example:"500"`
+}
+
+type ScoresRecomputeResp struct {
+	Updated    bool                `json:"updated" example:"true"`
+	Mismatches []ScoreMismatchResp `json:"mismatches"`
+}
+
 type FlagSubmitResp struct {
-	Message string `json:"message" example:"Your answer is correct"`
-	Success bool   `json:"success" example:"true"`
+	Message    string `json:"message" example:"Your answer is correct"`
+	Success    bool   `json:"success" example:"true"`
+	RetryAfter int64  `json:"retry_after,omitempty" example:"30"`
 }
 
 type UsersStatisticsResp struct {
@@ -151,6 +370,42 @@ type UsersStatisticsResp struct {
 	UnbannedUsers        uint `json:"unbanned_users" example:"60"`
 }
 
+type ScoreboardEntryResp struct {
+	Rank      uint      `json:"rank" example:"1"`
+	Id        uint      `json:"id" example:"3"`
+	Name      string    `json:"name" example:"fristonio"`
+	Score     uint      `json:"score" example:"750"`
+	Solves    uint      `json:"solves" example:"8"`
+	LastSolve time.Time `json:"last_solve"`
+}
+
+type ScoreboardResp struct {
+	Type     string                `json:"type" example:"users"`
+	Frozen   bool                  `json:"frozen" example:"false"`
+	FrozenAt *time.Time            `json:"frozen_at,omitempty"`
+	Entries  []ScoreboardEntryResp `json:"entries"`
+}
+
+type ScorePointResp struct {
+	Time  time.Time `json:"time"`
+	Score uint      `json:"score" example:"300"`
+}
+
+type ScoreSeriesResp struct {
+	Rank   uint             `json:"rank" example:"1"`
+	Id     uint             `json:"id" example:"3"`
+	Name   string           `json:"name" example:"fristonio"`
+	Score  uint             `json:"score" example:"750"`
+	Points []ScorePointResp `json:"points"`
+}
+
+type ScoreboardGraphResp struct {
+	Type     string            `json:"type" example:"users"`
+	Frozen   bool              `json:"frozen" example:"false"`
+	FrozenAt *time.Time        `json:"frozen_at,omitempty"`
+	Series   []ScoreSeriesResp `json:"series"`
+}
+
 type CompetitionInfoResp struct {
 	Name         string `json:"name" example:"fristonio"`
 	About        string `json:"about" example:"This is a CTF competition"`
@@ -159,6 +414,7 @@ type CompetitionInfoResp struct {
 	EndingTime   string `json:"ending_time"`
 	TimeZone     string `json:"timezone" example:"Asia/Calcutta: UTC +05:30"`
 	LogoURL      string `json:"logo_url"`
+	FreezeTime   string `json:"freeze_time,omitempty"`
 }
 
 type TagInfoResp struct {
@@ -43,6 +43,7 @@ func initGinRouter() *gin.Engine {
 		false)),
 	)
 	router.GET("/api/info/competition-info", competitionInfoHandler)
+	router.GET("/api/scoreboard/ctftime", ctftimeFeedHandler)
 
 	// API routes group
 	apiGroup := router.Group("/api", authorize)
@@ -58,14 +59,20 @@ func initGinRouter() *gin.Engine {
 			manageGroup.POST("/commit/", commitChallenge)
 			manageGroup.POST("/challenge/verify", verifyHandler)
 			manageGroup.POST("/schedule/:action", manageScheduledAction)
+			manageGroup.GET("/schedule", scheduledActionsHandler)
+			manageGroup.DELETE("/schedule/:id", cancelScheduledActionHandler)
 			manageGroup.POST("/challenge/upload", manageUploadHandler)
 			manageGroup.POST("/challenge/validateflag", validateFlagHandler)
+			manageGroup.DELETE("/queue/:challenge", cancelQueuedTaskHandler)
 		}
 
 		// Status route group
 		statusGroup := apiGroup.Group("/status")
 		{
 			statusGroup.GET("/challenge/:name", challengeStatusHandler)
+			statusGroup.GET("/health/:name", challengeHealthHandler)
+			statusGroup.GET("/resources", challengeResourcesHandler)
+			statusGroup.GET("/queue", queueStatusHandler)
 			statusGroup.GET("/all", statusHandler)
 			statusGroup.GET("/all/:filter", statusHandler)
 		}
@@ -80,8 +87,12 @@ func initGinRouter() *gin.Engine {
 			infoGroup.GET("/logs", challengeLogsHandler)
 			infoGroup.GET("/user/:username", userInfoHandler)
 			infoGroup.GET("/users", getAllUsersInfoHandler)
+			infoGroup.GET("/team/:name", teamInfoHandler)
+			infoGroup.GET("/teams", getAllTeamsInfoHandler)
 			infoGroup.GET("/submissions", submissionsHandler)
 			infoGroup.GET("/tags", tagHandler)
+			infoGroup.GET("/deployments/:challenge", managerAuthorize, deploymentsHandler)
+			infoGroup.GET("/images/:challenge", managerAuthorize, challengeImagesHandler)
 		}
 
 		// Notification route group
@@ -106,6 +117,39 @@ func initGinRouter() *gin.Engine {
 			configGroup.POST("/challenge-info", updateChallengeInfoHandler)
 		}
 
+		teamGroup := apiGroup.Group("/team")
+		{
+			teamGroup.POST("/create", createTeamHandler)
+			teamGroup.POST("/join", joinTeamHandler)
+			teamGroup.POST("/leave", leaveTeamHandler)
+			teamGroup.POST("/remove/:id", removeTeamMemberHandler)
+			teamGroup.POST("/code/regenerate", regenerateJoinCodeHandler)
+		}
+
+		handoutGroup := apiGroup.Group("/handout")
+		{
+			handoutGroup.GET("/:name/*file", challengeHandoutHandler)
+		}
+
+		hintGroup := apiGroup.Group("/hints")
+		{
+			hintGroup.POST("/unlock", unlockHintHandler)
+		}
+
+		instanceGroup := apiGroup.Group("/instance")
+		{
+			instanceGroup.GET("", instancesHandler)
+			instanceGroup.POST("/:name", startInstanceHandler)
+			instanceGroup.POST("/:name/extend", extendInstanceHandler)
+			instanceGroup.DELETE("/:name", stopInstanceHandler)
+		}
+
+		scoreboardGroup := apiGroup.Group("/scoreboard")
+		{
+			scoreboardGroup.GET("", scoreboardHandler)
+			scoreboardGroup.GET("/graph", scoreboardGraphHandler)
+		}
+
 		submitGroup := apiGroup.Group("/submit")
 		{
 			submitGroup.POST("/challenge", submitFlagHandler)
@@ -115,6 +159,10 @@ func initGinRouter() *gin.Engine {
 		{
 			adminPanelGroup.POST("/users/:action/:id", banUserHandler)
 			adminPanelGroup.GET("/statistics", getUsersStatisticsHandler)
+			adminPanelGroup.GET("/attempts", submissionAttemptsHandler)
+			adminPanelGroup.GET("/cheating", cheatingReportsHandler)
+			adminPanelGroup.POST("/scores/recompute", recomputeScoresHandler)
+			adminPanelGroup.POST("/scores/adjust", adjustScoreHandler)
 		}
 	}
 
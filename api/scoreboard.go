@@ -0,0 +1,359 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/auth"
+	"github.com/sdslabs/beastv4/pkg/ctftime"
+	log "github.com/sirupsen/logrus"
+)
+
+// scoreboardType returns if the scoreboard requested is of the teams, writes
+// the error response and returns ok as false for an invalid type.
+func scoreboardType(c *gin.Context) (teams bool, ok bool) {
+	switch c.DefaultQuery("type", "users") {
+	case "users":
+		return false, true
+	case "teams":
+		return true, true
+	}
+
+	c.JSON(http.StatusBadRequest, HTTPErrorResp{
+		Error: "Type of the scoreboard must be users or teams",
+	})
+	return false, false
+}
+
+// scoreboardTime returns the time at which the scoreboard is shown to the user making
+// the request. Once the scoreboard is frozen the contestants see it as it was at the
+// freeze time while the admins see the live scoreboard, which is the zero time.
+func scoreboardTime(c *gin.Context) (time.Time, error) {
+	values := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(values) >= 2 && auth.Authorize(values[1], core.ADMIN) == nil {
+		return time.Time{}, nil
+	}
+
+	freeze, err := coreUtils.GetCompetitionFreezeTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if freeze.IsZero() || time.Now().Before(freeze) {
+		return time.Time{}, nil
+	}
+
+	return freeze, nil
+}
+
+// frozenScores returns the freeze time along with the score ledger if the scores are
+// shown to the user making the request as they were at the freeze time, else the zero
+// time. The error response is written and ok is false if the scores can't be loaded.
+func frozenScores(c *gin.Context) (at time.Time, ledger *manager.ScoreLedger, ok bool) {
+	at, err := scoreboardTime(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: err.Error(),
+		})
+		return at, nil, false
+	}
+
+	if at.IsZero() {
+		return at, nil, true
+	}
+
+	ledger, err = manager.LoadScoreLedger()
+	if err != nil {
+		log.Errorf("Error while loading scores : %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return at, nil, false
+	}
+
+	return at, ledger, true
+}
+
+// frozenScoreboard returns the entries of the users, or teams if teams is true, of the
+// scoreboard as it was at the time by their ID. The error response is written and ok
+// is false if the scoreboard can't be built.
+func frozenScoreboard(c *gin.Context, ledger *manager.ScoreLedger, teams bool, at time.Time) (map[uint]manager.ScoreboardEntry, bool) {
+	scoreboard, err := manager.Scoreboard(ledger, teams, at)
+	if err != nil {
+		log.Errorf("Error while building scoreboard : %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return nil, false
+	}
+
+	entries := make(map[uint]manager.ScoreboardEntry, len(scoreboard))
+	for _, entry := range scoreboard {
+		entries[entry.ID] = entry
+	}
+
+	return entries, true
+}
+
+// frozenChallengeSolvers returns the users among the solvers of the challenge who solved
+// it till the time along with the points of the challenge at that time. The users and
+// the current points are returned as they are if the ledger is nil.
+func frozenChallengeSolvers(ledger *manager.ScoreLedger, at time.Time, challenge *database.Challenge, users []database.User) ([]database.User, uint) {
+	if ledger == nil {
+		return users, challenge.Points
+	}
+
+	solvers, points, found := ledger.ChallengeAt(challenge.ID, at)
+	if !found {
+		return users, challenge.Points
+	}
+
+	frozen := make([]database.User, 0, len(solvers))
+	for _, user := range users {
+		if solvers[user.ID] {
+			frozen = append(frozen, user)
+		}
+	}
+
+	return frozen, points
+}
+
+// Returns the scoreboard
+// @Summary Returns the ranked users or teams of the competition.
+// @Description Returns the scoreboard with the users or teams ranked by their score, ties are broken by the time of the last solve. After the freeze time the contestants see the scoreboard as it was at the freeze while the admins see the live scoreboard.
+// @Tags scoreboard
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param type query string false "Type of the scoreboard (users/teams), defaults to users"
+// @Success 200 {object} api.ScoreboardResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/scoreboard [get]
+func scoreboardHandler(c *gin.Context) {
+	teams, ok := scoreboardType(c)
+	if !ok {
+		return
+	}
+
+	at, err := scoreboardTime(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	ledger, err := manager.LoadScoreLedger()
+	if err != nil {
+		log.Errorf("Error while loading scores : %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	scoreboard, err := manager.Scoreboard(ledger, teams, at)
+	if err != nil {
+		log.Errorf("Error while building scoreboard : %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	resp := ScoreboardResp{
+		Type:    c.DefaultQuery("type", "users"),
+		Frozen:  !at.IsZero(),
+		Entries: make([]ScoreboardEntryResp, len(scoreboard)),
+	}
+	if resp.Frozen {
+		resp.FrozenAt = &at
+	}
+
+	for index, entry := range scoreboard {
+		resp.Entries[index] = ScoreboardEntryResp{
+			Rank:      entry.Rank,
+			Id:        entry.ID,
+			Name:      entry.Name,
+			Score:     entry.Score,
+			Solves:    entry.Solves,
+			LastSolve: entry.LastSolve,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Returns the score progression of the top entries of the scoreboard
+// @Summary Returns the score progression over time of the top users or teams.
+// @Description Returns the progression of the score of the top N entries of the scoreboard built from the time of the solves, score adjustments and hint unlocks, a point is present for every change in the score. The freeze time applies in the same way as the scoreboard.
+// @Tags scoreboard
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param type query string false "Type of the scoreboard (users/teams), defaults to users"
+// @Param top query string false "Number of top entries, defaults to 10"
+// @Success 200 {object} api.ScoreboardGraphResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/scoreboard/graph [get]
+func scoreboardGraphHandler(c *gin.Context) {
+	teams, ok := scoreboardType(c)
+	if !ok {
+		return
+	}
+
+	top, err := strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(core.DEFAULT_SCOREBOARD_TOP)))
+	if err != nil || top < 1 || top > core.MAX_SCOREBOARD_TOP {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("top must be between 1 and %d", core.MAX_SCOREBOARD_TOP),
+		})
+		return
+	}
+
+	at, err := scoreboardTime(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	ledger, err := manager.LoadScoreLedger()
+	if err != nil {
+		log.Errorf("Error while loading scores : %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	graph, err := manager.ScoreboardGraph(ledger, teams, top, at)
+	if err != nil {
+		log.Errorf("Error while building scoreboard graph : %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	resp := ScoreboardGraphResp{
+		Type:   c.DefaultQuery("type", "users"),
+		Frozen: !at.IsZero(),
+		Series: make([]ScoreSeriesResp, len(graph)),
+	}
+	if resp.Frozen {
+		resp.FrozenAt = &at
+	}
+
+	for index, series := range graph {
+		points := make([]ScorePointResp, len(series.Points))
+		for i, point := range series.Points {
+			points[i] = ScorePointResp{
+				Time:  point.Time,
+				Score: point.Score,
+			}
+		}
+
+		resp.Series[index] = ScoreSeriesResp{
+			Rank:   series.Rank,
+			Id:     series.ID,
+			Name:   series.Name,
+			Score:  series.Score,
+			Points: points,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ctftimeFeedKey identifies a cached CTFtime feed by the type of the standings and
+// the time they were built at.
+type ctftimeFeedKey struct {
+	teams bool
+	at    int64
+}
+
+type cachedCTFtimeFeed struct {
+	feed    *ctftime.Feed
+	builtAt time.Time
+}
+
+// The CTFtime feed is public, so it is built at most once every
+// core.CTFTIME_FEED_CACHE_DURATION instead of on every request.
+var (
+	ctftimeFeedMux   sync.Mutex
+	ctftimeFeedCache = make(map[ctftimeFeedKey]cachedCTFtimeFeed)
+)
+
+// getCTFtimeFeed returns the CTFtime feed of the users, or teams if teams is true, as
+// the standings were at the time. The feed is built again once the cached one expires.
+func getCTFtimeFeed(teams bool, at time.Time) (*ctftime.Feed, error) {
+	ctftimeFeedMux.Lock()
+	defer ctftimeFeedMux.Unlock()
+
+	key := ctftimeFeedKey{teams: teams, at: at.Unix()}
+	if cached, ok := ctftimeFeedCache[key]; ok && time.Since(cached.builtAt) < core.CTFTIME_FEED_CACHE_DURATION {
+		return cached.feed, nil
+	}
+
+	ledger, err := manager.LoadScoreLedger()
+	if err != nil {
+		return nil, fmt.Errorf("error while loading scores: %s", err)
+	}
+
+	feed, err := manager.CTFtimeFeed(ledger, teams, at)
+	if err != nil {
+		return nil, fmt.Errorf("error while building CTFtime feed: %s", err)
+	}
+
+	ctftimeFeedCache[key] = cachedCTFtimeFeed{feed: feed, builtAt: time.Now()}
+	return feed, nil
+}
+
+// Returns the standings in the CTFtime feed format
+// @Summary Returns the standings of the competition in the CTFtime scoreboard feed format.
+// @Description Returns the ranked users or teams along with the points and time of each of their solves in the JSON format CTFtime imports the results of an event from. The endpoint is public so that it can be used as the scoreboard feed URL, the freeze time applies in the same way as the scoreboard. The feed is cached for 30 seconds.
+// @Tags scoreboard
+// @Accept  json
+// @Produce json
+// @Param type query string false "Type of the standings (users/teams), defaults to users"
+// @Success 200 {object} ctftime.Feed
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/scoreboard/ctftime [get]
+func ctftimeFeedHandler(c *gin.Context) {
+	teams, ok := scoreboardType(c)
+	if !ok {
+		return
+	}
+
+	at, err := scoreboardTime(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	feed, err := getCTFtimeFeed(teams, at)
+	if err != nil {
+		log.Errorf("Error while getting CTFtime feed : %s", err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, feed)
+}
@@ -3,17 +3,23 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sdslabs/beastv4/core"
 	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	wpool "github.com/sdslabs/beastv4/pkg/workerpool"
 	"github.com/sdslabs/beastv4/utils"
+	log "github.com/sirupsen/logrus"
 )
 
 // Gets a challenge deployment status on the basis of name.
 // @Summary Returns challenge deployment status from the beast database.
-// @Description Returns challenge deployment status from the beast database, for those challenges which are not present a status value NA is returned.
+// @Description Returns challenge deployment status from the beast database, for those challenges which are not present a status value NA is returned. The state of the container of each service of the challenge and the latest restarts of the challenge by the self healing are also returned.
 // @Tags status
 // @Accept  json
 // @Produce json
@@ -42,9 +48,46 @@ func challengeStatusHandler(c *gin.Context) {
 
 	var status string
 	var updatedAt time.Time
+	var services map[string]string
+	var restartCount int64
+	var restarts []ChallengeRestartResp
 	if len(challenge) > 0 {
 		status = challenge[0].Status
 		updatedAt = challenge[0].UpdatedAt
+
+		restartCount, err = database.CountChallengeRestarts(challenge[0].ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPPlainResp{
+				Message: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		entries, err := database.QueryChallengeRestarts(challenge[0].ID, core.DEFAULT_RESTARTS)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPPlainResp{
+				Message: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		for _, restart := range entries {
+			restarts = append(restarts, ChallengeRestartResp{
+				Action:    restart.Action,
+				Attempt:   restart.Attempt,
+				Reason:    restart.Reason,
+				Success:   restart.Success,
+				Error:     restart.Error,
+				CreatedAt: restart.CreatedAt,
+			})
+		}
+
+		if challenge[0].Format != core.STATIC_CHALLENGE_TYPE_NAME {
+			services, err = coreUtils.GetServiceStates(name)
+			if err != nil {
+				log.Errorf("Error while getting states of services of %s : %s", name, err)
+			}
+		}
 	} else {
 		status = "Not Available"
 	}
@@ -53,9 +96,204 @@ func challengeStatusHandler(c *gin.Context) {
 		Name:      name,
 		Status:    status,
 		UpdatedAt: updatedAt,
+		Services:  services,
+
+		RestartCount: restartCount,
+		Restarts:     restarts,
 	})
 }
 
+// Returns the health history of a challenge
+// @Summary Returns the uptime, the outages and the latest health check results of the challenge.
+// @Description Returns the percentage of time the challenge was not in an outage over the last hour, the last day and the whole event, which starts at the starting time of the competition, along with the outages of the challenge during the event and its latest health check results. An outage starts at the first of the failed health checks which made the challenge unhealthy and ends once a health check succeeds, an outage without an end is still going on.
+// @Tags status
+// @Accept  json
+// @Produce json
+// @Param name path string true "Name of the challenge"
+// @Param limit query string false "Number of latest health check results, defaults to 50"
+// @Success 200 {object} api.ChallengeHealthResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 404 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/status/health/{name} [get]
+func challengeHealthHandler(c *gin.Context) {
+	name := c.Param("name")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(core.DEFAULT_HEALTH_RESULTS)))
+	if err != nil || limit < 1 || limit > core.MAX_PAGE_SIZE {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("limit must be between 1 and %d", core.MAX_PAGE_SIZE),
+		})
+		return
+	}
+
+	challenge, err := database.QueryFirstChallengeEntry("name", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if challenge.ID == 0 {
+		c.JSON(http.StatusNotFound, HTTPErrorResp{
+			Error: fmt.Sprintf("No challenge found with name %s", name),
+		})
+		return
+	}
+
+	now := time.Now()
+
+	// The event starts at the starting time of the competition, or when the challenge
+	// was added if the competition has not started or has no valid starting time.
+	since, err := coreUtils.GetCompetitionStartTime()
+	if err != nil || since.After(now) || since.Before(challenge.CreatedAt) {
+		since = challenge.CreatedAt
+	}
+
+	outages, err := database.QueryHealthOutages(challenge.ID, since)
+	if err != nil {
+		log.Errorf("Error while querying outages of %s : %s", name, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	results, err := database.QueryHealthCheckResults(challenge.ID, limit)
+	if err != nil {
+		log.Errorf("Error while querying health check results of %s : %s", name, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	lastHour, lastDay := now.Add(-time.Hour), now.Add(-24*time.Hour)
+	if lastHour.Before(since) {
+		lastHour = since
+	}
+	if lastDay.Before(since) {
+		lastDay = since
+	}
+
+	resp := ChallengeHealthResp{
+		Name:   challenge.Name,
+		Status: challenge.Status,
+		Since:  since,
+		Uptime: HealthUptimeResp{
+			LastHour: manager.HealthUptime(outages, lastHour, now),
+			LastDay:  manager.HealthUptime(outages, lastDay, now),
+			Event:    manager.HealthUptime(outages, since, now),
+		},
+		Outages: make([]HealthOutageResp, len(outages)),
+		Results: make([]HealthResultResp, len(results)),
+	}
+
+	for index, outage := range outages {
+		end := now
+		if outage.EndedAt != nil {
+			end = *outage.EndedAt
+		}
+
+		resp.Outages[index] = HealthOutageResp{
+			StartedAt: outage.StartedAt,
+			EndedAt:   outage.EndedAt,
+			Duration:  end.Sub(outage.StartedAt).Round(time.Second).String(),
+			Reason:    outage.Reason,
+		}
+	}
+
+	for index, result := range results {
+		resp.Results[index] = HealthResultResp{
+			Result:    result.Result,
+			Error:     result.Error,
+			CheckedAt: result.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Returns the resources used by the deployed challenges
+// @Summary Returns the latest sample of the resources used by the container of each deployed challenge.
+// @Description Returns the CPU, memory, network I/O and number of processes of the container of each deployed challenge along with its memory and pids limits, sampled periodically using the docker stats API. The network I/O is the total since the container started.
+// @Tags status
+// @Accept  json
+// @Produce json
+// @Success 200 {array} api.ChallengeResourcesResp
+// @Router /api/status/resources [get]
+func challengeResourcesHandler(c *gin.Context) {
+	samples := manager.ChallengeResources()
+
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := make([]ChallengeResourcesResp, len(names))
+	for index, name := range names {
+		stats := samples[name]
+		resp[index] = ChallengeResourcesResp{
+			Name:          name,
+			CPUPercent:    stats.CPUPercent,
+			MemoryUsage:   stats.MemoryUsage,
+			MemoryLimit:   stats.MemoryLimit,
+			MemoryPercent: stats.MemoryPercent(),
+			NetworkRx:     stats.NetworkRx,
+			NetworkTx:     stats.NetworkTx,
+			Pids:          stats.Pids,
+			PidsLimit:     stats.PidsLimit,
+			SampledAt:     stats.SampledAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Returns the tasks in the queue of the workers
+// @Summary Returns the pending tasks and the tasks being performed by the workers.
+// @Description Returns the pending tasks in the order they will be performed, tasks with a higher priority first, and the tasks being performed along with the time they were started.
+// @Tags status
+// @Accept  json
+// @Produce json
+// @Success 200 {object} api.QueueResp
+// @Router /api/status/queue [get]
+func queueStatusHandler(c *gin.Context) {
+	pending, running := manager.QueueState()
+
+	resp := QueueResp{
+		Pending: make([]QueuedTaskResp, len(pending)),
+		Running: make([]QueuedTaskResp, len(running)),
+	}
+	for index, task := range pending {
+		resp.Pending[index] = queuedTaskResp(task)
+	}
+	for index, task := range running {
+		resp.Running[index] = queuedTaskResp(task)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func queuedTaskResp(task wpool.TaskState) QueuedTaskResp {
+	resp := QueuedTaskResp{
+		Challenge: task.ID,
+		Priority:  task.Priority,
+		QueuedAt:  task.QueuedAt,
+	}
+	if info, ok := task.Info.(manager.TaskInfo); ok {
+		resp.Action = info.Action
+	}
+	if !task.StartedAt.IsZero() {
+		startedAt := task.StartedAt
+		resp.StartedAt = &startedAt
+	}
+
+	return resp
+}
+
 // Gets the list of the challenges with status, according to the filter provided.
 // @Summary Returns challenge deployment status from the beast database for the challenges which matches the stauts according to filter.
 // @Description This returns the challenges in the status provided, along with their name and last updated time.
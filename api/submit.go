@@ -1,17 +1,19 @@
 package api
 
 import (
-	"math"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sdslabs/beastv4/core"
-	"github.com/sdslabs/beastv4/core/config"
 	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
 	coreUtils "github.com/sdslabs/beastv4/core/utils"
 	"github.com/sdslabs/beastv4/pkg/notify"
+	"github.com/sdslabs/beastv4/pkg/scoring"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -26,6 +28,8 @@ import (
 // @Success 200 {object} api.ChallengeStatusResp
 // @Failure 400 {object} api.HTTPPlainResp
 // @Failure 401 {object} api.HTTPPlainResp
+// @Failure 403 {object} api.FlagSubmitResp
+// @Failure 429 {object} api.FlagSubmitResp
 // @Failure 500 {object} api.HTTPPlainResp
 // @Router /api/submit/challenge [post]
 func submitFlagHandler(c *gin.Context) {
@@ -106,7 +110,8 @@ func submitFlagHandler(c *gin.Context) {
 		}
 
 		challenge := chall[0]
-		if challenge.Status != core.DEPLOY_STATUS["deployed"] {
+		if challenge.Status != core.DEPLOY_STATUS["deployed"] && challenge.Status != core.DEPLOY_STATUS["crashlooping"] {
+			logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["unavailable"])
 			c.JSON(http.StatusOK, FlagSubmitResp{
 				Message: "Challenge is unavailable",
 				Success: false,
@@ -114,13 +119,67 @@ func submitFlagHandler(c *gin.Context) {
 			return
 		}
 
+		locked, err := manager.LockedChallenges(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		if locked[challenge.ID] {
+			logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["locked"])
+			c.JSON(http.StatusForbidden, FlagSubmitResp{
+				Message: "Challenge is locked, solve the challenges it requires first",
+				Success: false,
+			})
+			return
+		}
+
+		allowed, retryAfter := checkSubmissionRateLimit(&user, &challenge)
+		if !allowed {
+			logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["limited"])
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			c.JSON(http.StatusTooManyRequests, FlagSubmitResp{
+				Message:    "Too many submissions for this challenge, try again later",
+				Success:    false,
+				RetryAfter: retryAfter,
+			})
+			return
+		}
+
 		// If the challenge is dynamic, then the flag is not stored in the database
-		if challenge.DynamicFlag {
-			whereMap := map[string]interface{}{
-				"Name": challenge.Name,
-				"Flag": flag,
+		solvedFlag := flag
+		if challenge.UserFlag {
+			owner, err := manager.MatchUserFlag(&challenge, &user, flag)
+			if err != nil {
+				log.Errorf("Error while matching user flag for challenge %s : %s", challenge.Name, err)
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "DATABASE ERROR while processing the request.",
+				})
+				return
+			}
+
+			if owner == nil {
+				logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["incorrect"])
+				c.JSON(http.StatusOK, FlagSubmitResp{
+					Message: "Your flag is incorrect",
+					Success: false,
+				})
+				return
+			}
+
+			// The flags of the members of the team are valid for the whole team.
+			if owner.ID != user.ID && (user.TeamID == 0 || user.TeamID != owner.TeamID) {
+				reportCheating(c, &user, owner, &challenge, flag, core.CHEATING_REASON["user_flag"])
+				c.JSON(http.StatusOK, FlagSubmitResp{
+					Message: "Your flag is incorrect",
+					Success: false,
+				})
+				return
 			}
-			validFlags, err := database.QueryDynamicFlagEntries(whereMap)
+		} else if challenge.DynamicFlag {
+			validFlag, err := manager.MatchDynamicFlag(&challenge, flag)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
 					Error: "DATABASE ERROR while processing the request.",
@@ -129,7 +188,8 @@ func submitFlagHandler(c *gin.Context) {
 			}
 
 			// flag not present in validFlags table
-			if len(validFlags) == 0 {
+			if validFlag == nil {
+				logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["incorrect"])
 				c.JSON(http.StatusOK, FlagSubmitResp{
 					Message: "Your flag is incorrect",
 					Success: false,
@@ -137,9 +197,10 @@ func submitFlagHandler(c *gin.Context) {
 				return
 			}
 
+			solvedFlag = validFlag.Flag
 			wheremap := map[string]interface{}{
 				"challenge_id": challenge.ID,
-				"flag":         flag,
+				"flag":         solvedFlag,
 			}
 			submissions, err := database.QuerySubmissions(wheremap)
 			if err != nil {
@@ -149,16 +210,15 @@ func submitFlagHandler(c *gin.Context) {
 				return
 			}
 			if len(submissions) > 0 {
-				if user.ID != submissions[0].UserID {
-					// notify the admin about cheating
-					subuser, _ := database.QueryUserById(submissions[0].UserID)
-					msg := "User " + subuser.Username + " has submitted the flag " + flag + " for challenge " + challenge.Name + " which has already been solved by another user " + user.Username
-					go notify.SendNotification(notify.Warning, msg)
+				subuser, _ := database.QueryUserById(submissions[0].UserID)
+				if user.ID != submissions[0].UserID && (user.TeamID == 0 || user.TeamID != subuser.TeamID) {
+					reportCheating(c, &user, &subuser, &challenge, flag, core.CHEATING_REASON["solved_flag"])
 					c.JSON(http.StatusOK, FlagSubmitResp{
 						Message: "Your flag is incorrect",
 						Success: false,
 					})
 				} else {
+					logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["solved"])
 					c.JSON(http.StatusOK, FlagSubmitResp{
 						Message: "You have already solved this challenge",
 						Success: false,
@@ -167,7 +227,17 @@ func submitFlagHandler(c *gin.Context) {
 				return
 			}
 		} else {
-			if challenge.Flag != flag {
+			matcher, err := manager.ChallengeFlagMatcher(&challenge)
+			if err != nil {
+				log.Errorf("Error while getting flag matcher for challenge %s : %s", challenge.Name, err)
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "Error while matching the flag for the challenge",
+				})
+				return
+			}
+
+			if !matcher.Match(flag) {
+				logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["incorrect"])
 				c.JSON(http.StatusOK, FlagSubmitResp{
 					Message: "Your flag is incorrect",
 					Success: false,
@@ -184,6 +254,7 @@ func submitFlagHandler(c *gin.Context) {
 		}
 
 		if solved {
+			logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["solved"])
 			c.JSON(http.StatusOK, FlagSubmitResp{
 				Message: "Challenge has already been solved.",
 				Success: false,
@@ -191,55 +262,65 @@ func submitFlagHandler(c *gin.Context) {
 			return
 		}
 
-		challengePoints := challenge.Points
-		log.Debugf("Dynamic scoring is set to %t", config.Cfg.CompetitionInfo.DynamicScore)
-		if config.Cfg.CompetitionInfo.DynamicScore {
-			submissions, err := database.QuerySubmissions(map[string]interface{}{
-				"challenge_id": parsedChallId,
-			})
+		// Once any member of the team has solved the challenge, it cannot be
+		// scored again by the other members.
+		if user.TeamID != 0 {
+			solved, err = database.CheckPreviousTeamSubmissions(user.TeamID, challenge.ID)
 			if err != nil {
-				log.Error(err)
-			}
-			solvers := len(submissions)
-			newPoints := dynamicScore(challenge.MaxPoints, challenge.MinPoints, uint(solvers))
-			if newPoints != challengePoints {
-				database.UpdateChallenge(&challenge, map[string]interface{}{
-					"Points": newPoints,
+				c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+					Error: "DATABASE ERROR while processing the request.",
 				})
-				log.Debugf("By dynamic scoring the points of challenge %s are changed to %d from %d", challenge.Name, newPoints, challengePoints)
-				err = updatePointsOfSolvers(submissions, newPoints, challengePoints)
-				if err != nil {
-					log.Error(err)
-				}
-				challengePoints = newPoints
+				return
 			}
-		}
 
-		err = database.UpdateUser(&user, map[string]interface{}{"Score": user.Score + challengePoints})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
-				Error: "DATABASE ERROR while processing the request.",
-			})
-			return
+			if solved {
+				logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["solved"])
+				c.JSON(http.StatusOK, FlagSubmitResp{
+					Message: "Challenge has already been solved by your team.",
+					Success: false,
+				})
+				return
+			}
 		}
 
+		now := time.Now()
 		UserChallengesEntry := database.UserChallenges{
-			CreatedAt:   time.Time{},
+			CreatedAt:   now,
 			UserID:      user.ID,
 			ChallengeID: challenge.ID,
 		}
-		if challenge.DynamicFlag {
-			UserChallengesEntry.Flag = flag
+		if challenge.DynamicFlag || challenge.UserFlag {
+			UserChallengesEntry.Flag = solvedFlag
 		}
 
-		err = database.SaveFlagSubmission(&UserChallengesEntry)
-		if err != nil {
+		// Scores are derived from the solves, the new solve can change the points
+		// of all the solvers of the challenge depending on its scoring strategy.
+		solves, err := manager.RecordSolve(&challenge, &UserChallengesEntry)
+		if errors.Is(err, database.ErrAlreadySolved) {
+			logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["solved"])
+			c.JSON(http.StatusOK, FlagSubmitResp{
+				Message: "Challenge has already been solved.",
+				Success: false,
+			})
+			return
+		}
+
+		if solves == nil {
+			log.Errorf("Error while saving solve of challenge %s: %s", challenge.Name, err)
 			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
 				Error: "DATABASE ERROR while processing the request.",
 			})
 			return
 		}
 
+		if err != nil {
+			log.Errorf("Error while updating scores of solvers of challenge %s: %s", challenge.Name, err)
+		}
+
+		updateChallengePoints(&challenge, uint(len(solves)), now)
+
+		logSubmissionAttempt(c, &user, &challenge, flag, core.SUBMISSION_RESULT["correct"])
+
 		c.JSON(http.StatusOK, FlagSubmitResp{
 			Message: "Your flag is correct",
 			Success: true,
@@ -249,28 +330,61 @@ func submitFlagHandler(c *gin.Context) {
 	}
 }
 
-// dynamicScore returns dynamic score of the challenge based on number of solves
-func dynamicScore(maxPoints, minPoints, solvers uint) uint {
-	if solvers == 0 || solvers == 1 {
-		return maxPoints
+// logSubmissionAttempt records the flag submitted by the user along with its result,
+// failing to record the attempt does not affect the submission itself.
+func logSubmissionAttempt(c *gin.Context, user *database.User, challenge *database.Challenge, flag, result string) {
+	attempt := database.SubmissionAttempt{
+		UserID:      user.ID,
+		ChallengeID: challenge.ID,
+		Flag:        flag,
+		Result:      result,
+		SourceIP:    c.ClientIP(),
+	}
+
+	if err := database.CreateSubmissionAttempt(&attempt); err != nil {
+		log.Errorf("Error while recording submission attempt of user %s for challenge %s: %s", user.Username, challenge.Name, err)
 	}
-	divisor := (1 + math.Pow((float64(solvers)-1)/11.92201, 1.206069))
-	return uint(math.Round(float64(minPoints) + (float64(maxPoints)-float64(minPoints))/divisor))
 }
 
-// updatePointsOfSolvers updates the points of solvers, whenever points of challenge changes
-func updatePointsOfSolvers(submissions []database.UserChallenges, newChallengePointsAfterSolve, oldChallengePointsBeforeSolve uint) error {
-	for _, submission := range submissions {
-		user, err := database.QueryUserById(submission.UserID)
-		if err != nil {
-			return err
-		}
-		if user.Role == "contestant" {
-			err = database.UpdateUser(&user, map[string]interface{}{"Score": user.Score + (newChallengePointsAfterSolve - oldChallengePointsBeforeSolve)})
-			if err != nil {
-				return err
-			}
-		}
+// reportCheating records a cheating report for the submission by the user of a flag
+// which belongs to the owner, and notifies the admins about it.
+func reportCheating(c *gin.Context, user, owner *database.User, challenge *database.Challenge, flag, reason string) {
+	logSubmissionAttempt(c, user, challenge, flag, core.SUBMISSION_RESULT["leaked"])
+
+	report := database.CheatingReport{
+		ChallengeID: challenge.ID,
+		SubmitterID: user.ID,
+		OwnerID:     owner.ID,
+		Flag:        flag,
+		Reason:      reason,
+		SourceIP:    c.ClientIP(),
+	}
+
+	if err := database.CreateCheatingReport(&report); err != nil {
+		log.Errorf("Error while creating cheating report for user %s on challenge %s: %s", user.Username, challenge.Name, err)
+	}
+
+	log.Warnf("Cheating report %d: user %s submitted the flag of user %s for challenge %s (%s)", report.ID, user.Username, owner.Username, challenge.Name, reason)
+
+	msg := fmt.Sprintf("Cheating report %d: user %s submitted the flag %s for challenge %s which belongs to user %s (%s)",
+		report.ID, user.Username, flag, challenge.Name, owner.Username, reason)
+	go notify.SendNotification(notify.Warning, msg)
+}
+
+// updateChallengePoints updates the points of the challenge shown to the users, which
+// are the points the next solver of the challenge will get.
+func updateChallengePoints(challenge *database.Challenge, solvers uint, now time.Time) {
+	strategy, err := manager.ChallengeScoringStrategy(challenge)
+	if err != nil {
+		log.Errorf("Error while getting scoring strategy for challenge %s: %s", challenge.Name, err)
+		return
+	}
+
+	nextPoints := strategy.Points(scoring.Solve{Rank: solvers + 1, Solvers: solvers + 1, SolvedAt: now})
+	if nextPoints != challenge.Points {
+		log.Debugf("Points of challenge %s are changed to %d from %d", challenge.Name, nextPoints, challenge.Points)
+		database.UpdateChallenge(challenge, map[string]interface{}{
+			"Points": nextPoints,
+		})
 	}
-	return nil
 }
@@ -0,0 +1,695 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/core/manager"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/auth"
+	"github.com/sdslabs/beastv4/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// getRequestUser returns the user making the request, in case of any error
+// the response is written to the context and ok is false.
+func getRequestUser(c *gin.Context) (user database.User, ok bool) {
+	username, err := coreUtils.GetUser(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, HTTPErrorResp{
+			Error: "Unauthorized user",
+		})
+		return user, false
+	}
+
+	user, err = database.QueryFirstUserEntry("username", username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return user, false
+	}
+
+	if user.ID == 0 {
+		c.JSON(http.StatusUnauthorized, HTTPErrorResp{
+			Error: "Unauthorized user",
+		})
+		return user, false
+	}
+
+	if user.Status == 1 {
+		c.JSON(http.StatusUnauthorized, HTTPErrorResp{
+			Error: "Banned user",
+		})
+		return user, false
+	}
+
+	return user, true
+}
+
+func generateJoinCode() string {
+	return utils.TruncateID(utils.GenerateRandomID(), core.TEAM_JOIN_CODE_LENGTH)
+}
+
+func maxTeamSize() uint {
+	if config.Cfg == nil || config.Cfg.CompetitionInfo.MaxTeamSize == 0 {
+		return core.DEFAULT_MAX_TEAM_SIZE
+	}
+
+	return config.Cfg.CompetitionInfo.MaxTeamSize
+}
+
+// Creates a new team with the user making the request as its captain.
+// @Summary Creates a new team with the requesting user as captain.
+// @Description Creates a team and returns the join code which other users can use to join the team. A user can only be part of a single team, and the solves of the captain are credited to the team.
+// @Tags team
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param name formData string true "Name of the team"
+// @Success 200 {object} api.TeamResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/team/create [post]
+func createTeamHandler(c *gin.Context) {
+	name := c.PostForm("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Name of the team is a required parameter to process request.",
+		})
+		return
+	}
+
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TeamID != 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "You are already a member of a team",
+		})
+		return
+	}
+
+	existingTeam, err := database.QueryFirstTeamEntry("name", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if existingTeam.ID != 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("Team with name %s already exists", name),
+		})
+		return
+	}
+
+	team := database.Team{
+		Name:      name,
+		JoinCode:  generateJoinCode(),
+		CaptainID: user.ID,
+		Score:     user.Score,
+	}
+
+	err = database.CreateTeamEntry(&team)
+	if err != nil {
+		log.Errorf("Error while creating team %s: %s", name, err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	err = database.UpdateUser(&user, map[string]interface{}{"TeamID": team.ID})
+	if err != nil {
+		database.DeleteTeamEntry(&team)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, TeamResp{
+		Id:        team.ID,
+		Name:      team.Name,
+		Score:     team.Score,
+		CaptainId: team.CaptainID,
+		JoinCode:  team.JoinCode,
+		Members: []TeamMemberResp{{
+			Id:       user.ID,
+			Username: user.Username,
+			Score:    user.Score,
+			Captain:  true,
+		}},
+	})
+}
+
+// Joins the team corresponding to the join code provided.
+// @Summary Joins a team using the join code shared by the team captain.
+// @Description Adds the requesting user to the team. Only users who have not solved any challenge yet can join a team, so that the solves of the team remain unique.
+// @Tags team
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param code formData string true "Join code of the team"
+// @Success 200 {object} api.HTTPPlainResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/team/join [post]
+func joinTeamHandler(c *gin.Context) {
+	code := c.PostForm("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Join code is a required parameter to process request.",
+		})
+		return
+	}
+
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TeamID != 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "You are already a member of a team",
+		})
+		return
+	}
+
+	team, err := database.QueryFirstTeamEntry("join_code", code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if team.ID == 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Invalid join code",
+		})
+		return
+	}
+
+	submissions, err := database.QuerySubmissions(map[string]interface{}{
+		"user_id": user.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if len(submissions) > 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Users who have already solved challenges cannot join a team",
+		})
+		return
+	}
+
+	err = database.JoinTeam(&user, team.ID, maxTeamSize())
+	if errors.Is(err, database.ErrTeamFull) {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("Team %s already has the maximum of %d members", team.Name, maxTeamSize()),
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if err = manager.RefreshScores([]uint{user.ID}); err != nil {
+		log.Errorf("Error while refreshing score of team %s: %s", team.Name, err)
+	}
+
+	c.JSON(http.StatusOK, HTTPPlainResp{
+		Message: fmt.Sprintf("Successfully joined the team %s", team.Name),
+	})
+}
+
+// Removes the requesting user from the team.
+// @Summary Leaves the team the requesting user is part of.
+// @Description Members who have solved challenges for the team cannot leave it. The captain can only leave once all the other members have left, in which case the team is deleted.
+// @Tags team
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Success 200 {object} api.HTTPPlainResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/team/leave [post]
+func leaveTeamHandler(c *gin.Context) {
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TeamID == 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "You are not a member of any team",
+		})
+		return
+	}
+
+	team, err := database.QueryTeamById(user.TeamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if team.CaptainID == user.ID {
+		members, err := database.CountTeamMembers(team.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		if members > 1 {
+			c.JSON(http.StatusBadRequest, HTTPErrorResp{
+				Error: "Captain cannot leave the team while it has other members",
+			})
+			return
+		}
+
+		err = database.DeleteTeamEntry(&team)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, HTTPPlainResp{
+			Message: fmt.Sprintf("Left and deleted the team %s", team.Name),
+		})
+		return
+	}
+
+	removeTeamMember(c, &team, &user)
+}
+
+// Removes a member from the team, can only be done by the captain of the team.
+// @Summary Removes a member from the team of the requesting captain.
+// @Description Removes the member with the provided id from the team. Members who have solved challenges for the team cannot be removed.
+// @Tags team
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param id path string true "Id of the member to remove"
+// @Success 200 {object} api.HTTPPlainResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/team/remove/:id [post]
+func removeTeamMemberHandler(c *gin.Context) {
+	memberId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "User Id format invalid",
+		})
+		return
+	}
+
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	team, err := database.QueryTeamById(user.TeamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if user.TeamID == 0 || team.CaptainID != user.ID {
+		c.JSON(http.StatusUnauthorized, HTTPErrorResp{
+			Error: "Only the captain of a team can remove its members",
+		})
+		return
+	}
+
+	if uint(memberId) == user.ID {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Captain cannot remove themselves from the team",
+		})
+		return
+	}
+
+	member, err := database.QueryUserById(uint(memberId))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if member.ID == 0 || member.TeamID != team.ID {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "User is not a member of your team",
+		})
+		return
+	}
+
+	removeTeamMember(c, &team, &member)
+}
+
+func removeTeamMember(c *gin.Context, team *database.Team, member *database.User) {
+	submissions, err := database.QuerySubmissions(map[string]interface{}{
+		"user_id": member.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if len(submissions) > 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("%s has solved challenges for team %s and cannot leave it", member.Username, team.Name),
+		})
+		return
+	}
+
+	err = database.UpdateUser(member, map[string]interface{}{"TeamID": 0})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if err = manager.RefreshTeamScore(team.ID); err != nil {
+		log.Errorf("Error while refreshing score of team %s: %s", team.Name, err)
+	}
+
+	c.JSON(http.StatusOK, HTTPPlainResp{
+		Message: fmt.Sprintf("Removed %s from the team %s", member.Username, team.Name),
+	})
+}
+
+// Regenerates the join code of the team, the previous code becomes invalid.
+// @Summary Regenerates the join code of the team of the requesting captain.
+// @Description Generates a new join code for the team, which invalidates the previous one. Can only be done by the captain of the team.
+// @Tags team
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Success 200 {object} api.HTTPPlainResp
+// @Failure 401 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/team/code/regenerate [post]
+func regenerateJoinCodeHandler(c *gin.Context) {
+	user, ok := getRequestUser(c)
+	if !ok {
+		return
+	}
+
+	team, err := database.QueryTeamById(user.TeamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if user.TeamID == 0 || team.CaptainID != user.ID {
+		c.JSON(http.StatusUnauthorized, HTTPErrorResp{
+			Error: "Only the captain of a team can regenerate its join code",
+		})
+		return
+	}
+
+	joinCode := generateJoinCode()
+	err = database.UpdateTeam(&team, map[string]interface{}{"JoinCode": joinCode})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, HTTPPlainResp{
+		Message: joinCode,
+	})
+}
+
+// Returns information about the team.
+// @Summary Returns the members, score, rank and solves of the team.
+// @Description The join code of the team is only returned to its members and admins.
+// @Tags info
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param name path string true "Name of the team"
+// @Success 200 {object} api.TeamResp
+// @Failure 400 {object} api.HTTPErrorResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/info/team/:name [get]
+func teamInfoHandler(c *gin.Context) {
+	name := c.Param("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: "Name of the team cannot be empty",
+		})
+		return
+	}
+
+	team, err := database.QueryFirstTeamEntry("name", name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	if team.ID == 0 {
+		c.JSON(http.StatusBadRequest, HTTPErrorResp{
+			Error: fmt.Sprintf("No team with name %s", name),
+		})
+		return
+	}
+
+	members, err := database.GetTeamMembers(team.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	submissions, err := database.QueryTeamSubmissions(team.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	rank, err := database.GetTeamRank(team.ID, team.Score)
+	if err != nil {
+		log.Error(err)
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	at, ledger, ok := frozenScores(c)
+	if !ok {
+		return
+	}
+
+	resp := TeamResp{
+		Id:         team.ID,
+		Name:       team.Name,
+		Score:      team.Score,
+		Rank:       rank,
+		CaptainId:  team.CaptainID,
+		Members:    make([]TeamMemberResp, len(members)),
+		Challenges: make([]ChallengeSolveResp, 0, len(submissions)),
+	}
+
+	username, _ := coreUtils.GetUser(c.GetHeader("Authorization"))
+	for index, member := range members {
+		resp.Members[index] = TeamMemberResp{
+			Id:       member.ID,
+			Username: member.Username,
+			Score:    member.Score,
+			Captain:  member.ID == team.CaptainID,
+		}
+		if member.Username == username {
+			resp.JoinCode = team.JoinCode
+		}
+	}
+
+	if resp.JoinCode == "" {
+		values := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(values) == 2 && auth.Authorize(values[1], core.ADMIN) == nil {
+			resp.JoinCode = team.JoinCode
+		}
+	}
+
+	for _, submission := range submissions {
+		if ledger != nil && submission.CreatedAt.After(at) {
+			continue
+		}
+
+		challenges, err := database.QueryChallengeEntries("id", strconv.Itoa(int(submission.ChallengeID)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+		if len(challenges) == 0 {
+			continue
+		}
+
+		challengeTags := make([]string, len(challenges[0].Tags))
+		for index, tags := range challenges[0].Tags {
+			challengeTags[index] = tags.TagName
+		}
+
+		resp.Challenges = append(resp.Challenges, ChallengeSolveResp{
+			Id:       challenges[0].ID,
+			Name:     challenges[0].Name,
+			Tags:     challengeTags,
+			Category: challenges[0].Type,
+			SolvedAt: submission.CreatedAt,
+			Points:   challenges[0].Points,
+		})
+	}
+
+	// Once the scoreboard is frozen the contestants see the scores and the rank
+	// as they were at the freeze time.
+	if ledger != nil {
+		scores := ledger.ScoresAt(at)
+		for index := range resp.Members {
+			resp.Members[index].Score = scores[resp.Members[index].Id]
+		}
+
+		entries, ok := frozenScoreboard(c, ledger, true, at)
+		if !ok {
+			return
+		}
+		if entry, found := entries[team.ID]; found {
+			resp.Score, resp.Rank = entry.Score, int64(entry.Rank)
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Returns information about all the teams.
+// @Summary Returns the score, rank and number of members of all the teams.
+// @Description Teams are sorted by their rank, the list can also be downloaded as CSV with format=csv.
+// @Tags info
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Bearer"
+// @Param format query string false "Format of the response (csv)"
+// @Success 200 {object} api.TeamsResp
+// @Failure 500 {object} api.HTTPErrorResp
+// @Router /api/info/teams [get]
+func getAllTeamsInfoHandler(c *gin.Context) {
+	teams, err := database.QueryAllTeams()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+			Error: "DATABASE ERROR while processing the request.",
+		})
+		return
+	}
+
+	at, ledger, ok := frozenScores(c)
+	if !ok {
+		return
+	}
+
+	// Once the scoreboard is frozen the contestants see the scores and the ranks
+	// as they were at the freeze time.
+	var entries map[uint]manager.ScoreboardEntry
+	if ledger != nil {
+		if entries, ok = frozenScoreboard(c, ledger, true, at); !ok {
+			return
+		}
+	}
+
+	availableTeams := make([]TeamsResp, len(teams))
+	for index, team := range teams {
+		rank, err := database.GetTeamRank(team.ID, team.Score)
+		if err != nil {
+			log.Error(err)
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		members, err := database.CountTeamMembers(team.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "DATABASE ERROR while processing the request.",
+			})
+			return
+		}
+
+		availableTeams[index] = TeamsResp{
+			Id:      team.ID,
+			Name:    team.Name,
+			Score:   team.Score,
+			Rank:    rank,
+			Members: members,
+		}
+
+		if entry, found := entries[team.ID]; found {
+			availableTeams[index].Score = entry.Score
+			availableTeams[index].Rank = int64(entry.Rank)
+		}
+	}
+
+	sort.Slice(availableTeams, func(i, j int) bool {
+		return availableTeams[i].Rank < availableTeams[j].Rank
+	})
+
+	if c.Query("format") == "csv" {
+		buff, err := coreUtils.StructToCSV(c, availableTeams, "teams.csv")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HTTPErrorResp{
+				Error: "CSV ERROR while processing the request.",
+			})
+			return
+		}
+
+		c.Data(http.StatusOK, "text/csv", buff.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, availableTeams)
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/sdslabs/beastv4/core/config"
 	"github.com/sdslabs/beastv4/core/manager"
 	"github.com/sdslabs/beastv4/core/utils"
-	wpool "github.com/sdslabs/beastv4/pkg/workerpool"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -16,7 +15,7 @@ import (
 var challengeCmd = &cobra.Command{
 	Use:   "challenge action [challname] [-atld]",
 	Short: "Performs action to the challs",
-	Long:  "Performs actions like : deploy, undeploy, redeploy, purge to the challs",
+	Long:  "Performs actions like : deploy, undeploy, redeploy, purge, rollback to the challs",
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		config.InitConfig()
@@ -24,6 +23,11 @@ var challengeCmd = &cobra.Command{
 		// Since action is already verfied to exist it does not make sense to check
 		// its existence here therefore we directly parse the action from the command.
 		action := args[0]
+		if RollbackVersion != 0 && action != core.MANAGE_ACTION_ROLLBACK {
+			log.Errorf("to flag is available only for \"rollback\" action")
+			os.Exit(1)
+		}
+
 		noCache, _ := cmd.Flags().GetBool("no-cache")
 		if noCache && action == core.MANAGE_ACTION_DEPLOY {
 			config.NoCache = noCache
@@ -91,8 +95,7 @@ var challengeCmd = &cobra.Command{
 
 		completionChannel := make(chan bool)
 
-		manager.Q = wpool.InitQueue(core.MAX_QUEUE_SIZE, completionChannel)
-		manager.Q.StartWorkers(&manager.Worker{})
+		manager.InitQueue(completionChannel)
 
 		if AllChalls {
 			errstrings := manager.HandleAll(action, core.BEAST_LOCAL_SERVER)
@@ -115,7 +118,12 @@ var challengeCmd = &cobra.Command{
 				log.Errorf("Provide chall name")
 				os.Exit(1)
 			}
-			err := challAction(args[1])
+			var err error
+			if action == core.MANAGE_ACTION_ROLLBACK {
+				err = manager.RollbackChallenge(args[1], RollbackVersion)
+			} else {
+				err = challAction(args[1])
+			}
 			if err != nil {
 				log.Errorf("The action was not performed due to error : %s", err.Error())
 				os.Exit(1)
@@ -7,13 +7,13 @@ import (
 )
 
 var logsCmd = &cobra.Command{
-	Use:   "logs CHALLNAME",
+	Use:   "logs CHALLNAME [--service SERVICE]",
 	Short: "Provides live logs of a container",
 	Args:  cobra.MinimumNArgs(1),
 
 	Run: func(cmd *cobra.Command, args []string) {
 		config.InitConfig()
 
-		utils.GetLogs(args[0], true)
+		utils.GetLogs(args[0], Service, true)
 	},
 }
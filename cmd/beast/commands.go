@@ -31,6 +31,11 @@ var (
 	Status                string
 	Tags                  string
 	NoCache               bool
+	DryRun                bool
+	Output                string
+	Teams                 bool
+	RollbackVersion       uint
+	Service               string
 )
 
 // Root command `beast` all commands are either a flag to this command
@@ -104,24 +109,41 @@ func init() {
 	challengeCmd.PersistentFlags().StringVarP(&LocalDirectory, "local-directory", "l", "", "Deploys challenge from local directory")
 	challengeCmd.PersistentFlags().BoolVarP(&DeleteEntry, "delete-entry", "d", false, "Deletes db entry related to this challenge")
 	challengeCmd.PersistentFlags().BoolVarP(&NoCache, "no-cache", "c", false, "Build image of challenge without using cache")
+	challengeCmd.PersistentFlags().UintVar(&RollbackVersion, "to", 0, "Version of the image to rollback the challenge to")
 
 	cmdRef.PersistentFlags().StringVarP(&RefDirectory, "reference-directory", "r", "", "Generate beast command reference files in reference directory")
 
 	challDetailsCmd.PersistentFlags().StringVarP(&Status, "status", "s", "all", "Filter by status : deployed / undeployed / queued")
 	challDetailsCmd.PersistentFlags().StringVarP(&Tags, "tags", "t", "", "Filter by tagname : pwn / web / image / docker")
 
+	recomputeScoresCmd.PersistentFlags().BoolVarP(&DryRun, "dry-run", "d", false, "Only report the mismatched scores without fixing them")
+	scoresCmd.AddCommand(recomputeScoresCmd)
+
+	exportResultsCmd.PersistentFlags().StringVarP(&Output, "output", "o", "", "Path of the results archive, defaults to beast-results-<date>.zip")
+	exportResultsCmd.PersistentFlags().BoolVarP(&Teams, "teams", "", false, "Use the standings of the teams in the CTFtime feed")
+	exportCmd.AddCommand(exportResultsCmd)
+
+	scheduleCmd.AddCommand(listScheduleCmd)
+	scheduleCmd.AddCommand(cancelScheduleCmd)
+
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(getAuthCmd)
 	rootCmd.AddCommand(createAuthorCmd)
 	rootCmd.AddCommand(createAdminCmd)
+	logsCmd.Flags().StringVarP(&Service, "service", "s", "", "Name of the service of the challenge to get the logs of")
+
 	rootCmd.AddCommand(logsCmd)
 	rootCmd.AddCommand(healthProbeCmd)
+	rootCmd.AddCommand(resourcesCmd)
 	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(challengeCmd)
 	rootCmd.AddCommand(disableUserSSH)
 	rootCmd.AddCommand(cmdRef)
 	rootCmd.AddCommand(generateTemplateCmd)
 	rootCmd.AddCommand(challDetailsCmd)
+	rootCmd.AddCommand(scoresCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(scheduleCmd)
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/manager"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export data of the competition",
+	Long:  "Export data of the competition for uploading or archiving it",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var exportResultsCmd = &cobra.Command{
+	Use:   "results",
+	Short: "Export the results of the competition",
+	Long:  "Writes a zip archive of the results containing the standings in the CTFtime feed format (ctftime.json) along with CSV files of the solves, challenges and users. Use --teams to rank the teams instead of the users in the feed.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config.InitConfig()
+
+		output := Output
+		if output == "" {
+			output = fmt.Sprintf("beast-results-%s.zip", time.Now().Format("2006-01-02"))
+		}
+
+		file, err := os.Create(output)
+		if err != nil {
+			log.Errorf("Error while creating %s: %s", output, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		if err = manager.ExportResults(file, Teams); err != nil {
+			log.Errorf("Error while exporting results: %s", err)
+			os.Exit(1)
+		}
+
+		log.Infof("Results exported to %s", output)
+	},
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/manager"
+	"github.com/sdslabs/beastv4/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var resourcesCmd = &cobra.Command{
+	Use:   "resources",
+	Short: "Show resources used by the deployed challenges",
+	Long:  "Samples the CPU, memory, network I/O and number of processes of the container of each deployed challenge using the docker stats API, along with the memory and pids limits of the containers.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config.InitConfig()
+
+		samples, err := manager.SampleChallengeResources()
+		if err != nil {
+			log.Errorf("Error while sampling resources of the challenges: %s", err)
+			os.Exit(1)
+		}
+
+		names := make([]string, 0, len(samples))
+		for name := range samples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		header := []string{"Challenge", "CPU %", "Memory", "Memory %", "Net RX / TX", "PIDs"}
+		border := utils.CreateBorder(true, false, true, false)
+		tConfigs := utils.CreateTableConfigs(border, header, "|")
+
+		tData := make([][]string, len(names))
+		for index, name := range names {
+			stats := samples[name]
+			tData[index] = []string{
+				name,
+				fmt.Sprintf("%.2f", stats.CPUPercent),
+				fmt.Sprintf("%s / %s", formatBytes(stats.MemoryUsage), formatBytes(stats.MemoryLimit)),
+				fmt.Sprintf("%.2f", stats.MemoryPercent()),
+				fmt.Sprintf("%s / %s", formatBytes(stats.NetworkRx), formatBytes(stats.NetworkTx)),
+				fmt.Sprintf("%d / %d", stats.Pids, stats.PidsLimit),
+			}
+		}
+		utils.LogTable(tConfigs, tData)
+	},
+}
+
+// formatBytes formats the size in bytes using binary units.
+func formatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
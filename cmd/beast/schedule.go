@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/manager"
+	"github.com/sdslabs/beastv4/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage the scheduled actions on challenges",
+	Long:  "Manage the actions on challenges scheduled through the API, which are run once at some later point of time or repeatedly at the times matching a cron expression",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var listScheduleCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the scheduled actions",
+	Long:  "Lists the scheduled actions along with their challenge selector, cron expression for the recurring ones and the time of their next run.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config.InitConfig()
+
+		actions, err := manager.ListScheduledActions()
+		if err != nil {
+			log.Errorf("Error while querying scheduled actions: %s", err)
+			os.Exit(1)
+		}
+
+		header := []string{"ID", "Action", "Challenge", "Tag", "Cron", "Next Run", "Last Run"}
+		border := utils.CreateBorder(true, false, true, false)
+		tConfigs := utils.CreateTableConfigs(border, header, "|")
+
+		tData := make([][]string, len(actions))
+		for index, action := range actions {
+			lastRun := "-"
+			if action.LastRun != nil {
+				lastRun = action.LastRun.Format(time.RFC3339)
+			}
+
+			tData[index] = []string{
+				fmt.Sprint(action.ID),
+				action.Action,
+				action.Challenge,
+				action.Tag,
+				action.Cron,
+				action.NextRun.Format(time.RFC3339),
+				lastRun,
+			}
+		}
+		utils.LogTable(tConfigs, tData)
+	},
+}
+
+var cancelScheduleCmd = &cobra.Command{
+	Use:   "cancel [id]",
+	Short: "Cancel a scheduled action",
+	Long:  "Cancels the scheduled action with the ID, recurring actions are cancelled along with all their future runs. A running beast server drops the action when it is next due.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config.InitConfig()
+
+		id, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			log.Errorf("Invalid ID of scheduled action: %s", args[0])
+			os.Exit(1)
+		}
+
+		if err = manager.CancelScheduledAction(uint(id)); err != nil {
+			log.Errorf("Error while cancelling scheduled action: %s", err)
+			os.Exit(1)
+		}
+
+		log.Infof("Cancelled the scheduled action %d", id)
+	},
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/manager"
+	"github.com/sdslabs/beastv4/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var scoresCmd = &cobra.Command{
+	Use:   "scores",
+	Short: "Manage scores of the users and teams",
+	Long:  "Manage scores of the users and teams, which are derived from the solves of the challenges",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var recomputeScoresCmd = &cobra.Command{
+	Use:   "recompute",
+	Short: "Rebuild all the scores from the solves",
+	Long:  "Derives the scores of all the users and teams from the solves, the current points of the challenges and the manual adjustments, rebuilds the stored scores and reports the ones which did not match. Use --dry-run to only report the mismatches.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config.InitConfig()
+
+		mismatches, err := manager.RecomputeScores(!DryRun)
+		if err != nil {
+			log.Errorf("Error while recomputing scores: %s", err)
+			os.Exit(1)
+		}
+
+		if len(mismatches) == 0 {
+			log.Info("All the stored scores match the scores derived from the solves")
+			return
+		}
+
+		header := []string{"Type", "ID", "Name", "Stored", "Computed"}
+		border := utils.CreateBorder(true, false, true, false)
+		tConfigs := utils.CreateTableConfigs(border, header, "|")
+
+		tData := make([][]string, len(mismatches))
+		for index, mismatch := range mismatches {
+			tData[index] = []string{
+				mismatch.Type,
+				fmt.Sprint(mismatch.ID),
+				mismatch.Name,
+				fmt.Sprint(mismatch.Stored),
+				fmt.Sprint(mismatch.Computed),
+			}
+		}
+		utils.LogTable(tConfigs, tData)
+
+		if DryRun {
+			log.Warnf("Found %d mismatched scores, run without --dry-run to fix them", len(mismatches))
+		} else {
+			log.Infof("Fixed %d mismatched scores", len(mismatches))
+		}
+	},
+}
@@ -3,11 +3,17 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sdslabs/beastv4/core"
 	"github.com/sdslabs/beastv4/pkg/cr"
+	"github.com/sdslabs/beastv4/pkg/flagmatch"
+	"github.com/sdslabs/beastv4/pkg/scoring"
 	"github.com/sdslabs/beastv4/utils"
 
 	log "github.com/sirupsen/logrus"
@@ -51,7 +57,7 @@ func (Metadata *ChallengeMetadata) PopulateChallengeMetadata() {
 
 func (Env *ChallengeEnv) PopulateChallengeEnv() {
 	Env.AptDeps = []string{}
-	Env.Ports = []uint32{}
+	Env.Ports = PortList{}
 	Env.SetupScripts = []string{}
 	Env.StaticContentDir = "StaticContentDir"
 	Env.BaseImage = "ChallengeBase"
@@ -91,9 +97,37 @@ func (config *BeastChallengeConfig) ValidateRequiredFields(challdir string) erro
 //
 // * ChallengeEnv - Challenge environment configuration variables
 // * ChallengeMetadata - Challenge Metadata configuration variables
+// * Services - Additional containers deployed along with the challenge
+// * HealthCheck - Health check of the challenge container
 type Challenge struct {
-	Metadata ChallengeMetadata `toml:"metadata"`
-	Env      ChallengeEnv      `toml:"env"`
+	Metadata    ChallengeMetadata `toml:"metadata"`
+	Env         ChallengeEnv      `toml:"env"`
+	Services    []Service         `toml:"services"`
+	HealthCheck HealthCheck       `toml:"healthcheck"`
+}
+
+// GetAllHostPorts returns all the host ports used by the challenge including
+// the host ports the services of the challenge are exposed on. The host ports
+// allocated by beast are not included.
+func (config *Challenge) GetAllHostPorts() ([]uint32, error) {
+	hostPorts, err := config.Env.GetAllHostPorts()
+	if err != nil {
+		return hostPorts, err
+	}
+
+	for _, service := range config.Services {
+		for _, portMap := range service.PortMappings {
+			hp, _, err := utils.ParsePortMapping(portMap)
+			if err != nil {
+				return hostPorts, err
+			}
+			if hp != 0 {
+				hostPorts = append(hostPorts, hp)
+			}
+		}
+	}
+
+	return hostPorts, nil
 }
 
 func (config *Challenge) ValidateRequiredFields(challdir string) error {
@@ -101,7 +135,24 @@ func (config *Challenge) ValidateRequiredFields(challdir string) error {
 	if err != nil {
 		log.Debugf("Error while validating `ChallengeMetadata`'s required fields : %s", err.Error())
 		return err
-	} else if staticChall {
+	}
+
+	for _, handout := range config.Metadata.HandoutFiles() {
+		if handout == "" {
+			return fmt.Errorf("File is required for the handout")
+		}
+
+		if filepath.IsAbs(handout) || strings.HasPrefix(filepath.Clean(handout), "..") {
+			return fmt.Errorf("Handout %s must be relative to the challenge directory", handout)
+		}
+
+		err = utils.ValidateFileExists(filepath.Join(challdir, handout))
+		if err != nil {
+			return fmt.Errorf("Handout %s does not exist : %s", handout, err)
+		}
+	}
+
+	if staticChall {
 		log.Debugf("Challenge provided is a static challenge.")
 		return nil
 	}
@@ -112,9 +163,316 @@ func (config *Challenge) ValidateRequiredFields(challdir string) error {
 		return err
 	}
 
+	if len(config.Services) > 0 && config.Env.Instanced {
+		return errors.New("Instanced challenges can't have services")
+	}
+
+	if err = config.Env.Egress.ValidateRequiredFields(); err != nil {
+		return err
+	}
+
+	if config.Env.Egress.Restricted() && config.Env.Instanced {
+		return errors.New("Instanced challenges can't restrict egress")
+	}
+
+	// The egress proxy forwards the port of the sidecar to it, so the port can't
+	// be used by a destination.
+	if sidecar := config.Metadata.Sidecar; sidecar != "" && config.Env.Egress.Restricted() {
+		for _, destination := range config.Env.Egress.Destinations {
+			if destination.Port == core.SIDECAR_PORT_MAP[sidecar] {
+				return fmt.Errorf("Port %d of egress destination %s is used by the sidecar", destination.Port, destination.Host)
+			}
+		}
+	}
+
+	for i := range config.Services {
+		if err = config.Services[i].ValidateRequiredFields(challdir); err != nil {
+			log.Debugf("Error while validating `Service`'s required fields : %s", err.Error())
+			return err
+		}
+
+		for _, service := range config.Services[:i] {
+			if service.Name == config.Services[i].Name {
+				return fmt.Errorf("Service %s is specified more than once", service.Name)
+			}
+		}
+	}
+
+	err = config.HealthCheck.ValidateRequiredFields(&config.Env)
+	if err != nil {
+		log.Debugf("Error while validating `HealthCheck`'s required fields : %s", err.Error())
+		return err
+	}
+
+	hostPorts, err := config.GetAllHostPorts()
+	if err != nil {
+		return fmt.Errorf("Error while parsing port mapping: %s", err)
+	}
+
+	for i, port := range hostPorts {
+		if utils.UInt32InList(port, hostPorts[:i]) {
+			return fmt.Errorf("Host port %d is used more than once by the challenge", port)
+		}
+	}
+
 	return nil
 }
 
+// A service is an additional container deployed along with the challenge, like a
+// bot, a cache or a separate backend. All the containers of a challenge share a
+// network of the challenge in which each service can be reached using its name and
+// the challenge container using the name `challenge`.
+//
+// ```toml
+// [[challenge.services]]
+// name = "" # Name of the service, lowercase letters, digits and hyphens.
+//
+// # Either an image to run or a directory relative to the challenge directory to
+// # build the image of the service from, dockerfile is the Dockerfile in the
+// # context and defaults to Dockerfile.
+// image = ""
+// context = ""
+// dockerfile = ""
+//
+// # Ports of the service reachable by the other containers of the challenge.
+// ports = [0, 0]
+//
+// # Ports of the service exposed on the host, in the same format as port_mappings
+// # of the challenge environment, "8080" exposes the port on an allocated host port.
+// port_mappings = ["10002:8080"]
+//
+// # Environment variables of the service.
+// [challenge.services.env]
+// KEY = "value"
+// ```
+type Service struct {
+	Name         string            `toml:"name"`
+	Image        string            `toml:"image"`
+	Context      string            `toml:"context"`
+	Dockerfile   string            `toml:"dockerfile"`
+	Env          map[string]string `toml:"env"`
+	Ports        []uint32          `toml:"ports"`
+	PortMappings []string          `toml:"port_mappings"`
+
+	// Host ports allocated to the container ports of the port mappings
+	// without a host port.
+	HostPorts map[uint32]uint32 `toml:"-"`
+}
+
+var serviceNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+func (config *Service) ValidateRequiredFields(challdir string) error {
+	if !serviceNameRegexp.MatchString(config.Name) || len(config.Name) > core.MAX_SERVICE_NAME_LENGTH {
+		return fmt.Errorf("Invalid service name %q, must start with a lowercase letter followed by at most %d lowercase letters, digits or hyphens",
+			config.Name, core.MAX_SERVICE_NAME_LENGTH-1)
+	}
+
+	if config.Name == core.CHALLENGE_NETWORK_ALIAS {
+		return fmt.Errorf("Service name %s is reserved for the challenge container", config.Name)
+	}
+
+	if (config.Image == "") == (config.Context == "") {
+		return fmt.Errorf("Exactly one of image and context must be provided for service %s", config.Name)
+	}
+
+	if config.Context != "" {
+		if filepath.IsAbs(config.Context) || strings.HasPrefix(filepath.Clean(config.Context), "..") {
+			return fmt.Errorf("Context of service %s must be relative to the challenge directory", config.Name)
+		}
+
+		if config.Dockerfile == "" {
+			config.Dockerfile = core.DEFAULT_DOCKER_FILE
+		}
+
+		if err := utils.ValidateFileExists(filepath.Join(challdir, config.Context, config.Dockerfile)); err != nil {
+			return fmt.Errorf("Dockerfile %s of service %s does not exist", config.Dockerfile, config.Name)
+		}
+	} else if config.Dockerfile != "" {
+		return fmt.Errorf("dockerfile can only be provided along with context for service %s", config.Name)
+	}
+
+	for _, port := range config.Ports {
+		if port == 0 || port > 65535 {
+			return fmt.Errorf("Invalid port %d of service %s", port, config.Name)
+		}
+	}
+
+	for _, portMap := range config.PortMappings {
+		hp, _, err := utils.ParsePortMapping(portMap)
+		if err != nil {
+			return fmt.Errorf("Error while parsing port mapping of service %s: %s", config.Name, err)
+		}
+
+		if err = validateHostPort(hp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetPortMappings returns the host port mappings of the service, the host port
+// of a mapping is 0 if it is to be allocated and is not allocated yet.
+func (config *Service) GetPortMappings() ([]cr.PortMapping, error) {
+	var mapping []cr.PortMapping
+	for _, portMap := range config.PortMappings {
+		hp, cp, err := utils.ParsePortMapping(portMap)
+		if err != nil {
+			return mapping, err
+		}
+		if hp == 0 {
+			hp = config.HostPorts[cp]
+		}
+		mapping = append(mapping, NewPortMapping(hp, cp))
+	}
+
+	return mapping, nil
+}
+
+// The health check of the challenge container, run periodically by beast once the
+// challenge is deployed. A check of type tcp connects to the port, a check of type
+// http requests the path on the port and an exec check runs the command inside the
+// container and succeeds if it exits with status 0. For a challenge with udp traffic
+// a tcp check only checks that the container is running. The challenge is reported
+// as unhealthy only once failure_threshold consecutive checks fail.
+//
+// ```toml
+// [challenge.healthcheck]
+// type = "tcp" # One of tcp, http and exec, defaults to tcp.
+// port = 0 # Container port to check, defaults to the default port of the challenge.
+//
+// # For http checks, the response must have the status if provided, else any 2xx
+// # or 3xx status, and must contain the body substring if provided.
+// path = "/"
+// status = 200
+// body = ""
+//
+// # For exec checks, the command to run inside the container.
+// command = ["", ""]
+//
+// interval = "1m" # Time between two checks, defaults to ticker_frequency of beast.
+// timeout = "10s"
+// failure_threshold = 3
+// ```
+type HealthCheck struct {
+	Type             string   `toml:"type"`
+	Port             uint32   `toml:"port"`
+	Path             string   `toml:"path"`
+	Status           int      `toml:"status"`
+	Body             string   `toml:"body"`
+	Command          []string `toml:"command"`
+	Interval         string   `toml:"interval"`
+	Timeout          string   `toml:"timeout"`
+	FailureThreshold int      `toml:"failure_threshold"`
+}
+
+func (config *HealthCheck) ValidateRequiredFields(env *ChallengeEnv) error {
+	switch config.Type {
+	case "":
+		config.Type = core.HEALTHCHECK_TYPE_TCP
+	case core.HEALTHCHECK_TYPE_TCP, core.HEALTHCHECK_TYPE_HTTP, core.HEALTHCHECK_TYPE_EXEC:
+	default:
+		return fmt.Errorf("Invalid health check type %s, must be one of %s, %s or %s", config.Type,
+			core.HEALTHCHECK_TYPE_TCP, core.HEALTHCHECK_TYPE_HTTP, core.HEALTHCHECK_TYPE_EXEC)
+	}
+
+	if config.Type != core.HEALTHCHECK_TYPE_EXEC {
+		if env.TrafficType() == cr.UDPTraffic && config.Type == core.HEALTHCHECK_TYPE_HTTP {
+			return errors.New("http health check can't be used for a challenge with udp traffic")
+		}
+
+		if config.Port != 0 {
+			portMappings, err := env.GetPortMappings()
+			if err != nil {
+				return fmt.Errorf("Error while parsing port mapping: %s", err)
+			}
+
+			if !checkIfPortExistInMapping(portMappings, config.Port) {
+				return fmt.Errorf("Health check port %d is not a port of the challenge", config.Port)
+			}
+		}
+	}
+
+	if config.Type == core.HEALTHCHECK_TYPE_HTTP {
+		if config.Path == "" {
+			config.Path = "/"
+		} else if !strings.HasPrefix(config.Path, "/") {
+			return fmt.Errorf("Health check path %s must start with /", config.Path)
+		}
+
+		if config.Status != 0 && (config.Status < 100 || config.Status > 599) {
+			return fmt.Errorf("Invalid health check status %d", config.Status)
+		}
+	} else if config.Path != "" || config.Status != 0 || config.Body != "" {
+		return errors.New("path, status and body can only be provided for http health checks")
+	}
+
+	if config.Type == core.HEALTHCHECK_TYPE_EXEC {
+		if len(config.Command) == 0 {
+			return errors.New("command is required for exec health checks")
+		}
+	} else if len(config.Command) > 0 {
+		return errors.New("command can only be provided for exec health checks")
+	}
+
+	if config.Interval != "" {
+		if interval, err := time.ParseDuration(config.Interval); err != nil || interval <= 0 {
+			return fmt.Errorf("Invalid health check interval %s", config.Interval)
+		}
+	}
+
+	if config.Timeout != "" {
+		if timeout, err := time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid health check timeout %s", config.Timeout)
+		}
+	}
+
+	if config.FailureThreshold < 0 {
+		return fmt.Errorf("Invalid health check failure_threshold %d", config.FailureThreshold)
+	} else if config.FailureThreshold == 0 {
+		config.FailureThreshold = core.DEFAULT_HEALTHCHECK_FAILURE_THRESHOLD
+	}
+
+	return nil
+}
+
+// GetType returns the type of the health check.
+func (config *HealthCheck) GetType() string {
+	if config.Type == "" {
+		return core.HEALTHCHECK_TYPE_TCP
+	}
+
+	return config.Type
+}
+
+// GetInterval returns the time between two health checks.
+func (config *HealthCheck) GetInterval() time.Duration {
+	if interval, err := time.ParseDuration(config.Interval); err == nil && interval > 0 {
+		return interval
+	}
+
+	return time.Duration(Cfg.TickerFrequency) * time.Second
+}
+
+// GetTimeout returns the time after which a health check fails.
+func (config *HealthCheck) GetTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(config.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+
+	return time.Duration(core.DEFAULT_PROBE_TIMEOUT) * time.Second
+}
+
+// GetFailureThreshold returns the number of consecutive failed health checks
+// after which the challenge is unhealthy.
+func (config *HealthCheck) GetFailureThreshold() int {
+	if config.FailureThreshold > 0 {
+		return config.FailureThreshold
+	}
+
+	return core.DEFAULT_HEALTHCHECK_FAILURE_THRESHOLD
+}
+
 // This contains challenge meta data
 //
 // ```toml
@@ -126,8 +484,51 @@ func (config *Challenge) ValidateRequiredFields(challdir string) error {
 //
 // # Optional fields.
 // tags = ["", ""] # Tags that the challenge might belong to, used to do bulk query and handling eg. binary, misc etc.
-// hints = ["", ""]
+// hints = ["", ""] # Free hints visible to everyone.
 // sidecar = "" # Name of the sidecar if any used by the challenge.
+//
+// # Hints can also be structured, a hint with a cost has to be unlocked by the users
+// # which deducts the cost from their score. With unlock_after the hint is released for
+// # free to everyone once the duration has passed since the start of the competition.
+// [[challenge.metadata.hints]]
+// text = ""
+// cost = 0
+// unlock_after = "2h"
+//
+// # Additional valid flags for the challenge, along with the flag.
+// flags = ["", ""]
+//
+// # How the submitted flags are matched, one of exact, case_insensitive, regex or
+// # wrapper_insensitive. With regex the flags are regular expressions which must match
+// # the complete submitted flag, with wrapper_insensitive the wrapper like flag{...}
+// # is ignored while comparing. Defaults to exact.
+// flag_match = ""
+//
+// # Beast generates a different flag for every user, derived from a secret of the challenge
+// # and the user. The flag is delivered through the instances of the challenge and the
+// # template handouts, and submitting the flag of another user is reported as cheating.
+// user_flag = false
+// flag_format = "flag{%s}" # Format of the generated flags, %s is replaced by the user specific part and no other % is allowed.
+//
+// # Files in the challenge directory handed out to the users.
+// handouts = ["", ""]
+//
+// # Handouts can also be specified as tables, handouts with template set are rendered for
+// # every user before being handed out, {{.Flag}} and {{.Username}} in these files are
+// # replaced by the flag and the username of the user.
+// [[challenge.metadata.handouts]]
+// file = ""
+// template = true
+//
+// # Challenges which must be solved before this challenge is visible to the users.
+// requires = ["", ""]
+//
+// # Scoring strategy for the challenge, one of static, logarithmic, linear, time_decay
+// # or first_blood. Defaults to logarithmic if dynamic scoring is enabled for the
+// # competition and static otherwise.
+// scoring = ""
+// decay = 0 # Points reduced per solve for linear and per hour for time_decay scoring.
+// first_blood_bonus = [0, 0] # Bonus points for the first solvers with first_blood scoring.
 // ```
 type ChallengeMetadata struct {
 	DynamicFlag     bool     `toml:"dynamic_flag"`
@@ -137,25 +538,214 @@ type ChallengeMetadata struct {
 	Tags            []string `toml:"tags"`
 	Sidecar         string   `toml:"sidecar"`
 	Description     string   `toml:"description"`
-	Hints           []string `toml:"hints"`
+	Hints           []Hint   `toml:"hints"`
 	Points          uint     `toml:"points"`
 	MaxPoints       uint     `toml:"maxPoints"`
 	MinPoints       uint     `toml:"minPoints"`
 	Assets          []string `toml:"assets"`
 	AdditionalLinks []string `toml:"additionalLinks"`
+	Scoring         string   `toml:"scoring"`
+	Decay           float64  `toml:"decay"`
+	FirstBloodBonus []uint   `toml:"first_blood_bonus"`
+
+	Requires []string `toml:"requires"`
+
+	Flags     []string `toml:"flags"`
+	FlagMatch string   `toml:"flag_match"`
+
+	UserFlag   bool      `toml:"user_flag"`
+	FlagFormat string    `toml:"flag_format"`
+	Handouts   []Handout `toml:"handouts"`
+}
+
+// AllFlags returns all the valid flags of the challenge.
+func (config *ChallengeMetadata) AllFlags() []string {
+	var flags []string
+	if config.Flag != "" {
+		flags = append(flags, config.Flag)
+	}
+
+	return append(flags, config.Flags...)
+}
+
+// HandoutFiles returns the paths of all the handouts of the challenge.
+func (config *ChallengeMetadata) HandoutFiles() []string {
+	files := make([]string, len(config.Handouts))
+	for i := range config.Handouts {
+		files[i] = config.Handouts[i].File
+	}
+
+	return files
+}
+
+// TemplateHandouts returns the paths of the handouts of the challenge which are
+// rendered for every user.
+func (config *ChallengeMetadata) TemplateHandouts() []string {
+	var files []string
+	for i := range config.Handouts {
+		if config.Handouts[i].Template {
+			files = append(files, config.Handouts[i].File)
+		}
+	}
+
+	return files
+}
+
+// Handout of the challenge, in beast.toml a handout can either be a string, which
+// is the path of a file handed out as it is, or a table with the file and template
+// fields. Handouts with template set are rendered for every user before being handed out.
+type Handout struct {
+	File     string `toml:"file" json:"file"`
+	Template bool   `toml:"template" json:"template"`
+}
+
+func (handout *Handout) UnmarshalTOML(data interface{}) error {
+	switch value := data.(type) {
+	case string:
+		handout.File = value
+	case map[string]interface{}:
+		if file, ok := value["file"].(string); ok {
+			handout.File = file
+		}
+		if template, ok := value["template"].(bool); ok {
+			handout.Template = template
+		}
+	default:
+		return fmt.Errorf("Handout must be a string or a table with file and template")
+	}
+
+	return nil
+}
+
+// Hint for the challenge, in beast.toml a hint can either be a string, which is
+// a free hint, or a table with the text, cost and unlock_after fields.
+type Hint struct {
+	Text        string `toml:"text" json:"text"`
+	Cost        uint   `toml:"cost" json:"cost"`
+	UnlockAfter string `toml:"unlock_after" json:"unlock_after"`
+}
+
+func (hint *Hint) UnmarshalTOML(data interface{}) error {
+	switch value := data.(type) {
+	case string:
+		hint.Text = value
+	case map[string]interface{}:
+		if text, ok := value["text"].(string); ok {
+			hint.Text = text
+		}
+		if cost, ok := value["cost"].(int64); ok {
+			if cost < 0 {
+				return fmt.Errorf("Cost of hint can't be negative : %d", cost)
+			}
+			hint.Cost = uint(cost)
+		}
+		if unlockAfter, ok := value["unlock_after"].(string); ok {
+			hint.UnlockAfter = unlockAfter
+		}
+	default:
+		return fmt.Errorf("Hint must be a string or a table with text, cost and unlock_after")
+	}
+
+	return nil
+}
+
+func (hint *Hint) Validate() error {
+	if hint.Text == "" {
+		return fmt.Errorf("Text is required for the hint")
+	}
+
+	if _, err := hint.UnlockDuration(); err != nil {
+		return fmt.Errorf("Invalid unlock_after for hint : %s", err)
+	}
+
+	return nil
+}
+
+// UnlockDuration returns the duration after the start of the competition after which
+// the hint is released to everyone, zero if the hint is never released.
+func (hint *Hint) UnlockDuration() (time.Duration, error) {
+	if hint.UnlockAfter == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(hint.UnlockAfter)
+	if err != nil {
+		return 0, err
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("duration can't be negative : %s", hint.UnlockAfter)
+	}
+
+	return duration, nil
 }
 
 // In this validation returned boolean value represents if the challenge type is
 // static or not.
 func (config *ChallengeMetadata) ValidateRequiredFields() (error, bool) {
-	if config.Name == "" || (config.Flag == "" && !config.DynamicFlag) {
+	if config.Name == "" || (len(config.AllFlags()) == 0 && !config.DynamicFlag && !config.UserFlag) {
 		return fmt.Errorf("Name and Flag required for the challenge"), false
 	}
 
+	for _, flag := range config.Flags {
+		if flag == "" {
+			return fmt.Errorf("Flags of the challenge can't be empty"), false
+		}
+	}
+
+	if _, err := flagmatch.NewMatcher(config.FlagMatch, config.AllFlags()); err != nil {
+		return fmt.Errorf("Invalid flag for the challenge : %s", err), false
+	}
+
+	if config.UserFlag && config.DynamicFlag {
+		return fmt.Errorf("Challenge can't have both user_flag and dynamic_flag"), false
+	}
+
+	// The flag format is used with fmt.Sprintf, so any other verb would end up in the flags.
+	if config.FlagFormat != "" && (strings.Count(config.FlagFormat, "%s") != 1 || strings.Count(config.FlagFormat, "%") != 1) {
+		return fmt.Errorf("flag_format must contain %%s exactly once and no other %% : %s", config.FlagFormat), false
+	}
+
 	if !(utils.StringInSlice(config.Sidecar, Cfg.AvailableSidecars) || config.Sidecar == "") {
 		return fmt.Errorf("Sidecar provided is not an available sidecar."), false
 	}
 
+	for _, hint := range config.Hints {
+		if err := hint.Validate(); err != nil {
+			return err, false
+		}
+	}
+
+	for i, required := range config.Requires {
+		if required == "" {
+			return fmt.Errorf("Name of the required challenge can't be empty"), false
+		}
+
+		if required == config.Name {
+			return fmt.Errorf("Challenge %s can't require itself", config.Name), false
+		}
+
+		if utils.StringInSlice(required, config.Requires[:i]) {
+			return fmt.Errorf("Required challenge %s is specified more than once", required), false
+		}
+	}
+
+	if config.Scoring != "" {
+		maxPoints := config.MaxPoints
+		if maxPoints == 0 {
+			maxPoints = config.Points
+		}
+		err := scoring.ValidateParams(config.Scoring, scoring.Params{
+			MaxPoints:       maxPoints,
+			MinPoints:       config.MinPoints,
+			Decay:           config.Decay,
+			FirstBloodBonus: config.FirstBloodBonus,
+		})
+		if err != nil {
+			return fmt.Errorf("Invalid scoring for the challenge : %s", err), false
+		}
+	}
+
 	// Check if the config type is static here and if it is
 	// then return an indication for that, so that caller knows if it need
 	// to check a valid environment or not.
@@ -175,81 +765,139 @@ func (config *ChallengeMetadata) ValidateRequiredFields() (error, bool) {
 	return fmt.Errorf("Not a valid challenge type : %s", config.Type), false
 }
 
+// ValidateRequirementGraph checks that the graph of challenge requirements, which maps
+// the name of each challenge to the names of the challenges it requires, has no cycles.
+func ValidateRequirementGraph(graph map[string][]string) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i := range path {
+				if path[i] == name {
+					return fmt.Errorf("Cyclic challenge requirements : %s -> %s", strings.Join(path[i:], " -> "), name)
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, required := range graph[name] {
+			if err := visit(required); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	for name := range graph {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // This contains challenge specific properties which includes the following toml fields
 //
 // ```toml
 // # Ports to reserve for the challenge, we bind only one of these to host other are for internal communictaions only.
-// # Should be within a particular permissible range.
+// # Should be within the port range of the beast configuration. With "auto" a free host port
+// # from the range is allocated by beast for the default port, which is then required.
 // ports = [0, 0]
 // default_port = 0 # Default port to use for any port specific action by beast. This is the container port.
 //
 // # Ports can also be specified as a mapping between host and the container.
 // # This can be used when we need customized port mapping between container and the host.
+// # The host port is allocated by beast for "auto:80" or just the container port "80".
 // port_mappings = ["10001:80"]
 //
 // # Dependencies required by challenge, installed using default package manager of base image apt for most cases.
 // apt_deps = ["", ""]
 //
-//
 // # A list of setup scripts to run for building challenge enviroment.
 // # Keep in mind that these are only for building the challenge environment and are executed
 // # in the iamge building step of the deployment pipeline.
 // setup_scripts = ["", ""]
 //
-//
 // # A directory containing any of the static assets for the challenge, exposed by beast static endpoint.
 // static_dir = ""
 //
-//
 // # Command to execute inside the container, if a predefined type is being used try to
 // # use an existing field to let beast automatically calculate what command to run.
 // # If you want to host a binary using xinetd use type service and specify absolute path
 // # of the service using service_path field.
 // run_cmd = ""
 //
-//
 // # Similar to run_cmd but in this case you have the entire container to yourself
 // # and everything you are doing is done using root permissions inside the container
 // # When using this keep in mind you are root inside the container.
 // entrypoint = ""
 //
-//
 // # Relative path to binary which needs to be executed when the specified
 // # Type for the challenge is service.
 // # This can be anything which can be exeucted, a python file, a binary etc.
 // service_path = ""
 //
-//
 // # Relative directory corresponding to root of the challenge where the root
 // # of the web application lies.
 // web_root = ""
 //
-//
 // # Any custom base image you might want to use for your particular challenge.
 // # Exists for flexibility reasons try to use existing base iamges wherever possible.
 // base_image = ""
 //
-//
 // # Docker file name for specific type challenge - `docker`.
 // # Helps to build flexible images for specific user-custom challenges
 // docket_context = ""
 //
-//
 // # Environment variables that can be used in the application code.
 // [[var]]
-//     key = ""
-//     value = ""
+//
+//	key = ""
+//	value = ""
 //
 // [[var]]
-//     key = ""
-//     value = ""
+//
+//	key = ""
+//	value = ""
 //
 // Type of traffic to expose through the port mapping provided.
 // traffic = "udp" / "tcp"
+//
+// # Instead of a single container shared by everyone, let each contestant start
+// # a private instance of the challenge from the committed image. The default port
+// # of an instance is exposed on a host port allocated from the instances port range.
+// instanced = false
+//
+// # Time after which an instance is stopped, overrides the instances timeout of the
+// # beast configuration.
+// instance_timeout = "30m"
+//
+// # Outbound traffic allowed from the containers of the challenge, "allow" for any,
+// # "none" for no outbound traffic or a list of the tcp destinations allowed as
+// # "host:port". The containers of a challenge with restricted egress run in an
+// # internal network and are reached through the egress proxy of the challenge,
+// # the sidecar of the challenge is always allowed.
+// egress = "allow"
 // ```
 type ChallengeEnv struct {
 	AptDeps          []string         `toml:"apt_deps"`
-	Ports            []uint32         `toml:"ports"`
+	Ports            PortList         `toml:"ports"`
 	DefaultPort      uint32           `toml:"default_port"`
 	PortMappings     []string         `toml:"port_mappings"`
 	SetupScripts     []string         `toml:"setup_scripts"`
@@ -262,6 +910,149 @@ type ChallengeEnv struct {
 	DockerCtx        string           `toml:"docker_context"`
 	EnvironmentVars  []EnvironmentVar `toml:"var"`
 	Traffic          string           `toml:"traffic"`
+
+	Instanced       bool   `toml:"instanced"`
+	InstanceTimeout string `toml:"instance_timeout"`
+
+	Egress Egress `toml:"egress"`
+
+	// Host ports allocated to the container ports which are exposed
+	// without a host port.
+	HostPorts map[uint32]uint32 `toml:"-"`
+}
+
+// PortList is the list of the ports of the challenge. Along with the ports, the
+// list can contain "auto" which is kept as port 0 and is the default port exposed
+// on a host port allocated by beast.
+type PortList []uint32
+
+func (ports *PortList) UnmarshalTOML(data interface{}) error {
+	values, ok := data.([]interface{})
+	if !ok {
+		return fmt.Errorf("ports must be a list of ports")
+	}
+
+	list := make(PortList, len(values))
+	for i, value := range values {
+		switch port := value.(type) {
+		case int64:
+			if port <= 0 || port > 65535 {
+				return fmt.Errorf("Invalid port %d in ports", port)
+			}
+			list[i] = uint32(port)
+		case string:
+			if port == utils.AutoPort {
+				continue
+			}
+
+			p, err := strconv.ParseUint(port, 10, 16)
+			if err != nil || p == 0 {
+				return fmt.Errorf("Invalid port %q in ports", port)
+			}
+			list[i] = uint32(p)
+		default:
+			return fmt.Errorf("Invalid port %v in ports", value)
+		}
+	}
+
+	*ports = list
+	return nil
+}
+
+// Egress is the policy for the outbound traffic of the containers of the challenge,
+// either "allow", "none" or a list of the allowed destinations.
+type Egress struct {
+	Policy       string
+	Destinations []EgressDestination
+}
+
+// EgressDestination is a destination the containers of the challenge can connect to.
+type EgressDestination struct {
+	Host string
+	Port uint32
+}
+
+func (egress *Egress) UnmarshalTOML(data interface{}) error {
+	switch value := data.(type) {
+	case string:
+		egress.Policy = value
+	case []interface{}:
+		egress.Policy = core.EGRESS_POLICY_LIST
+		for _, v := range value {
+			destination, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("Invalid egress destination %v, must be a string host:port", v)
+			}
+
+			host, port, err := net.SplitHostPort(destination)
+			if err != nil {
+				return fmt.Errorf("Invalid egress destination %q : %s", destination, err)
+			}
+
+			p, err := strconv.ParseUint(port, 10, 16)
+			if host == "" || err != nil || p == 0 {
+				return fmt.Errorf("Invalid egress destination %q, must be host:port", destination)
+			}
+
+			egress.Destinations = append(egress.Destinations, EgressDestination{Host: host, Port: uint32(p)})
+		}
+	default:
+		return fmt.Errorf("egress must be a policy or a list of destinations")
+	}
+
+	return nil
+}
+
+// GetPolicy returns the egress policy, outbound traffic is allowed by default.
+func (egress *Egress) GetPolicy() string {
+	if egress.Policy == "" {
+		return core.EGRESS_POLICY_ALLOW
+	}
+
+	return egress.Policy
+}
+
+// Restricted returns whether the outbound traffic of the challenge is restricted.
+func (egress *Egress) Restricted() bool {
+	return egress.GetPolicy() != core.EGRESS_POLICY_ALLOW
+}
+
+func (egress *Egress) ValidateRequiredFields() error {
+	switch egress.GetPolicy() {
+	case core.EGRESS_POLICY_ALLOW, core.EGRESS_POLICY_NONE:
+		return nil
+	case core.EGRESS_POLICY_LIST:
+	default:
+		return fmt.Errorf("Invalid egress policy %q, should be one of %s, %s or a list of destinations",
+			egress.Policy, core.EGRESS_POLICY_ALLOW, core.EGRESS_POLICY_NONE)
+	}
+
+	// The egress proxy listens on the port of a destination for it, so a port
+	// can only be used by a single destination. The containers of the challenge
+	// reach the proxy using the host names of the destinations.
+	var ports []uint32
+	for _, destination := range egress.Destinations {
+		if net.ParseIP(destination.Host) != nil {
+			return fmt.Errorf("Egress destination %s must be a host name", destination.Host)
+		}
+
+		if utils.UInt32InList(destination.Port, ports) {
+			return fmt.Errorf("Port %d is used by more than one egress destination", destination.Port)
+		}
+		ports = append(ports, destination.Port)
+	}
+
+	return nil
+}
+
+// validateHostPort checks if the host port is in the port range of the challenges,
+// a host port 0 is allocated by beast and is always valid.
+func validateHostPort(port uint32) error {
+	if port != 0 && (port < Cfg.MinPort || port > Cfg.MaxPort) {
+		return fmt.Errorf("Port value must be between %d and %d", Cfg.MinPort, Cfg.MaxPort)
+	}
+
+	return nil
 }
 
 func (config *ChallengeEnv) TrafficType() cr.TrafficType {
@@ -292,7 +1083,8 @@ func checkIfPortExistInMapping(portMapping []cr.PortMapping, port uint32) bool {
 }
 
 // GetPortMappings returns the entire port mapping for the challenge from the challenge
-// environment configuration.
+// environment configuration. The host port of a mapping is 0 if it is to be allocated
+// and is not allocated yet.
 func (config *ChallengeEnv) GetPortMappings() ([]cr.PortMapping, error) {
 	var mapping []cr.PortMapping
 
@@ -302,14 +1094,22 @@ func (config *ChallengeEnv) GetPortMappings() ([]cr.PortMapping, error) {
 		if err != nil {
 			return mapping, err
 		}
+		if hp == 0 {
+			hp = config.HostPorts[cp]
+		}
 		mapping = append(mapping, NewPortMapping(hp, cp))
 		containerPorts = append(containerPorts, cp)
 	}
 
 	for _, port := range config.Ports {
-		if !utils.UInt32InList(port, containerPorts) {
-			containerPorts = append(containerPorts, port)
-			mapping = append(mapping, NewPortMapping(port, port))
+		hp, cp := port, port
+		if port == 0 {
+			hp, cp = config.HostPorts[config.DefaultPort], config.DefaultPort
+		}
+
+		if !utils.UInt32InList(cp, containerPorts) {
+			containerPorts = append(containerPorts, cp)
+			mapping = append(mapping, NewPortMapping(hp, cp))
 		}
 	}
 
@@ -317,7 +1117,8 @@ func (config *ChallengeEnv) GetPortMappings() ([]cr.PortMapping, error) {
 }
 
 // GetAllHostPorts is utility function for the ChallengeEnv configuration which returns
-// the entire list of all the host ports which are being used by the challenge.
+// the entire list of all the host ports which are being used by the challenge, except
+// the host ports allocated by beast.
 func (config *ChallengeEnv) GetAllHostPorts() ([]uint32, error) {
 	var hostPorts []uint32
 	var containerPorts []uint32
@@ -327,12 +1128,14 @@ func (config *ChallengeEnv) GetAllHostPorts() ([]uint32, error) {
 		if err != nil {
 			return hostPorts, err
 		}
-		hostPorts = append(hostPorts, hp)
+		if hp != 0 {
+			hostPorts = append(hostPorts, hp)
+		}
 		containerPorts = append(containerPorts, cp)
 	}
 
 	for _, port := range config.Ports {
-		if !utils.UInt32InList(port, containerPorts) {
+		if port != 0 && !utils.UInt32InList(port, containerPorts) {
 			hostPorts = append(hostPorts, port)
 			containerPorts = append(containerPorts, port)
 		}
@@ -355,6 +1158,9 @@ func (config *ChallengeEnv) GetAllContainerPorts() ([]uint32, error) {
 	}
 
 	for _, port := range config.Ports {
+		if port == 0 {
+			port = config.DefaultPort
+		}
 		if !utils.UInt32InList(port, containerPorts) {
 			containerPorts = append(containerPorts, port)
 		}
@@ -387,6 +1193,21 @@ func (config *ChallengeEnv) ValidateRequiredFields(challType string, challdir st
 		return fmt.Errorf("Max ports allowed for challenge : %d given : %d", core.MAX_PORT_PER_CHALL, len(config.Ports))
 	}
 
+	autoPorts := 0
+	for _, port := range config.Ports {
+		if port == 0 {
+			autoPorts++
+		}
+	}
+
+	if autoPorts > 1 {
+		return fmt.Errorf("`auto` can be used only once in the `ports` list")
+	}
+
+	if autoPorts == 1 && config.DefaultPort == 0 {
+		return fmt.Errorf("`default_port` is required along with `auto` in the `ports` list")
+	}
+
 	portMappings, err := config.GetPortMappings()
 	if err != nil {
 		return fmt.Errorf("Error while parsing port mapping: %s", err)
@@ -403,8 +1224,8 @@ func (config *ChallengeEnv) ValidateRequiredFields(challType string, challdir st
 	}
 
 	for _, portMap := range portMappings {
-		if portMap.HostPort < core.ALLOWED_MIN_PORT_VALUE || portMap.HostPort > core.ALLOWED_MAX_PORT_VALUE {
-			return fmt.Errorf("Port value must be between %s and %s", core.ALLOWED_MIN_PORT_VALUE, core.ALLOWED_MAX_PORT_VALUE)
+		if err = validateHostPort(portMap.HostPort); err != nil {
+			return err
 		}
 	}
 
@@ -498,15 +1319,34 @@ func (config *ChallengeEnv) ValidateRequiredFields(challType string, challdir st
 		return fmt.Errorf("Not a valid traffic type provided, required (%v), got %s", cr.GetValidTrafficTypes(), config.Traffic)
 	}
 
+	if config.InstanceTimeout != "" {
+		if !config.Instanced {
+			return errors.New("instance_timeout can only be provided for instanced challenges")
+		}
+
+		if timeout, err := time.ParseDuration(config.InstanceTimeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid instance_timeout %s", config.InstanceTimeout)
+		}
+	}
+
 	return nil
 }
 
+// GetInstanceTimeout returns the time for which an instance of the challenge runs.
+func (config *ChallengeEnv) GetInstanceTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(config.InstanceTimeout); err == nil && timeout > 0 {
+		return timeout
+	}
+
+	return Cfg.Instances.TimeoutDuration
+}
+
 // Metadata related to author of the challenge, this structure includes
 //
-// * Name - Name of the author of the challenge
-// * Email - Email of the author
-// * SSHKey - Public SSH key for the challenge author, to give the access
-//		to the challenge container.
+//   - Name - Name of the author of the challenge
+//   - Email - Email of the author
+//   - SSHKey - Public SSH key for the challenge author, to give the access
+//     to the challenge container.
 //
 // ```toml
 // # Optional fields
@@ -7,12 +7,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/pkg/cr"
 	"github.com/sdslabs/beastv4/utils"
 
 	"github.com/BurntSushi/toml"
+	"github.com/araddon/dateparse"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -70,6 +73,106 @@ import (
 // default_pids_limit = 100
 //
 //
+// # Number of the latest committed images kept for each challenge, a challenge can
+// # be rolled back to any of these images without rebuilding it.
+// image_history = 3
+//
+//
+// # Time for which the result of every health check of the challenges is kept, the
+// # outages of the challenges are kept for the whole event.
+// health_history = "24h"
+//
+//
+// # Container runtime used to build and run the challenges, either "docker" or
+// # "podman". Docker is configured from the environment like DOCKER_HOST, podman is
+// # reached on `podman_socket`, which defaults to the socket of the rootless podman
+// # service if it exists, else /run/podman/podman.sock.
+// container_runtime = "docker"
+// podman_socket = "/run/podman/podman.sock"
+//
+//
+// # Range of the host ports the challenges are exposed on. The host ports chosen by
+// # the authors must be in the range and the ports written as "auto" in the challenge
+// # configuration are allocated from it, it must not overlap the instances port range.
+// port_range = "10000-20000"
+//
+//
+// # Image of the egress proxy of the challenges restricting their outbound traffic, the
+// # proxy publishes the ports of the challenge and forwards the allowed destinations
+// # using socat, so the image must provide `sh` and `socat`.
+// egress_proxy_image = "alpine/socat"
+//
+//
+// # Rate limiting of flag submissions, each user can make at most `attempts`
+// # submissions for a challenge in `period`. On exceeding the limit the user is
+// # locked out of the challenge, the lockout doubles on every consecutive lockout
+// # starting from `lockout` upto `max_lockout`. A warning notification is sent once
+// # a user has been locked out `notify_after` times in a row. With `persist`
+// # the state of the limiter survives restarts of beast.
+// [submission_rate_limit]
+// attempts = 10
+// period = "1m"
+// lockout = "30s"
+// max_lockout = "1h"
+// notify_after = 3
+// persist = false
+//
+//
+// # Instances of the instanced challenges started by the contestants. Each instance
+// # is exposed on a host port from `port_range` and is stopped after `timeout`, a
+// # contestant can extend an instance by `extension` at most `max_extensions` times,
+// # a negative value disables the extensions, and can run at most `max_per_user`
+// # instances at a time. Expired instances are cleaned up every `cleanup_period`.
+// [instances]
+// port_range = "20001-30000"
+// timeout = "30m"
+// extension = "30m"
+// max_extensions = 2
+// max_per_user = 1
+// cleanup_period = "1m"
+//
+//
+// # Strategy used while redeploying the challenges, `recreate` removes the container
+// # of the challenge before building the new one. With `blue_green` the new container
+// # is first started on a temporary port and is health checked for at most
+// # `health_timeout`, the port binding is switched to it only if it is healthy and
+// # the old container keeps serving the challenge otherwise.
+// [redeploy]
+// strategy = "recreate"
+// health_timeout = "1m"
+//
+//
+// # Queue of the tasks, like deploys and undeploys of the challenges, performed by the
+// # workers of beast. The queued tasks are persisted and resumed when beast restarts.
+// # `workers` is the number of tasks performed at a time, one for each CPU if 0, and
+// # `max_size` the maximum number of pending tasks.
+// [queue]
+// workers = 0
+// max_size = 100
+//
+//
+// # Self healing of the challenges found unhealthy by the health checks. With `enabled`
+// # the container of an unhealthy challenge is restarted and, if that does not help,
+// # recreated from the committed image. Attempts are made at least `backoff` apart, the
+// # back-off doubling after every attempt up to `max_backoff`. A challenge still unhealthy
+// # after `max_attempts` attempts is marked as crashlooping.
+// [self_heal]
+// enabled = false
+// max_attempts = 5
+// backoff = "30s"
+// max_backoff = "10m"
+//
+//
+// # Monitoring of the resources used by the containers of the deployed challenges, the
+// # containers are sampled every `period`. A warning notification is sent once the memory
+// # or the number of processes of a challenge stays above `threshold` percent of its limit
+// # for `alert_after`.
+// [resource_monitor]
+// period = "30s"
+// threshold = 90
+// alert_after = "5m"
+//
+//
 // # Configuration corresponding to the remote repository used by beast
 // # We use ssh authentication mechanism for interacting with git repository.
 // [remote]
@@ -104,6 +207,32 @@ type BeastConfig struct {
 	CPUShares int64 `toml:"default_cpu_shares"`
 	Memory    int64 `toml:"default_memory_limit"`
 	PidsLimit int64 `toml:"default_pids_limit"`
+
+	SubmissionRateLimit SubmissionRateLimit `toml:"submission_rate_limit"`
+
+	Instances InstancesConfig `toml:"instances"`
+
+	ImageHistory int `toml:"image_history"`
+
+	HealthHistory         string        `toml:"health_history"`
+	HealthHistoryDuration time.Duration `toml:"-"`
+
+	ContainerRuntime string `toml:"container_runtime"`
+	PodmanSocket     string `toml:"podman_socket"`
+
+	PortRange string `toml:"port_range"`
+	MinPort   uint32 `toml:"-"`
+	MaxPort   uint32 `toml:"-"`
+
+	EgressProxyImage string `toml:"egress_proxy_image"`
+
+	Redeploy RedeployConfig `toml:"redeploy"`
+
+	SelfHeal SelfHealConfig `toml:"self_heal"`
+
+	ResourceMonitor ResourceMonitorConfig `toml:"resource_monitor"`
+
+	Queue QueueConfig `toml:"queue"`
 }
 
 func (config *BeastConfig) ValidateConfig() error {
@@ -194,9 +323,327 @@ func (config *BeastConfig) ValidateConfig() error {
 		config.PidsLimit = core.DEFAULT_PIDS_LIMIT
 	}
 
+	if config.ImageHistory <= 0 {
+		log.Debug("Image history size not provided using default value")
+		config.ImageHistory = core.DEFAULT_IMAGE_HISTORY
+	}
+
+	healthHistory, err := time.ParseDuration(config.HealthHistory)
+	if config.HealthHistory == "" || err != nil || healthHistory <= 0 {
+		log.Debugf("Invalid or no health history provided using default value %s", core.DEFAULT_HEALTH_HISTORY)
+		healthHistory = core.DEFAULT_HEALTH_HISTORY
+	}
+	config.HealthHistoryDuration = healthHistory
+
+	if config.ContainerRuntime == "" {
+		log.Debug("Container runtime not provided using docker")
+		config.ContainerRuntime = cr.DockerRuntimeName
+	}
+
+	if !cr.IsValidRuntime(config.ContainerRuntime) {
+		return fmt.Errorf("Invalid container runtime %s, should be one of docker or podman", config.ContainerRuntime)
+	}
+
+	config.MinPort, config.MaxPort = core.ALLOWED_MIN_PORT_VALUE, core.ALLOWED_MAX_PORT_VALUE
+	if config.PortRange != "" {
+		if config.MinPort, config.MaxPort, err = utils.ParsePortRange(config.PortRange); err != nil {
+			return fmt.Errorf("Invalid port_range %s : %s", config.PortRange, err)
+		}
+	}
+
+	if config.EgressProxyImage == "" {
+		log.Debug("Egress proxy image not provided using default value")
+		config.EgressProxyImage = core.DEFAULT_EGRESS_PROXY_IMAGE
+	}
+
+	if err = config.SubmissionRateLimit.ValidateRateLimitConfig(); err != nil {
+		return err
+	}
+
+	if err = config.Instances.ValidateInstancesConfig(config.MinPort, config.MaxPort); err != nil {
+		return err
+	}
+
+	if err = config.Redeploy.ValidateRedeployConfig(); err != nil {
+		return err
+	}
+
+	config.SelfHeal.ValidateSelfHealConfig()
+
+	config.ResourceMonitor.ValidateResourceMonitorConfig()
+
+	config.Queue.ValidateQueueConfig()
+
+	if config.CompetitionInfo.MaxTeamSize == 0 {
+		log.Debug("Maximum team size not provided using default value")
+		config.CompetitionInfo.MaxTeamSize = core.DEFAULT_MAX_TEAM_SIZE
+	}
+
+	if err = config.CompetitionInfo.ValidateFreezeTime(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rate limiting configuration for the flag submissions, a negative
+// value of attempts disables the rate limiting.
+type SubmissionRateLimit struct {
+	Attempts    int    `toml:"attempts"`
+	Period      string `toml:"period"`
+	Lockout     string `toml:"lockout"`
+	MaxLockout  string `toml:"max_lockout"`
+	NotifyAfter int    `toml:"notify_after"`
+	Persist     bool   `toml:"persist"`
+
+	PeriodDuration     time.Duration `toml:"-"`
+	LockoutDuration    time.Duration `toml:"-"`
+	MaxLockoutDuration time.Duration `toml:"-"`
+}
+
+func (config *SubmissionRateLimit) Enabled() bool {
+	return config.Attempts > 0
+}
+
+func (config *SubmissionRateLimit) ValidateRateLimitConfig() error {
+	if config.Attempts == 0 {
+		log.Debug("Submission attempts limit not provided using default value")
+		config.Attempts = core.DEFAULT_SUBMIT_ATTEMPTS
+	}
+
+	if config.NotifyAfter <= 0 {
+		log.Debug("Submission lockouts before notification not provided using default value")
+		config.NotifyAfter = core.DEFAULT_SUBMIT_NOTIFY
+	}
+
+	durations := []struct {
+		name     string
+		value    string
+		target   *time.Duration
+		fallback time.Duration
+	}{
+		{"period", config.Period, &config.PeriodDuration, core.DEFAULT_SUBMIT_PERIOD},
+		{"lockout", config.Lockout, &config.LockoutDuration, core.DEFAULT_SUBMIT_LOCKOUT},
+		{"max_lockout", config.MaxLockout, &config.MaxLockoutDuration, core.DEFAULT_SUBMIT_MAX_LOCKOUT},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			log.Debugf("Submission rate limit %s not provided using default value %s", d.name, d.fallback)
+			*d.target = d.fallback
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("Invalid submission rate limit %s %s : %s", d.name, d.value, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("Submission rate limit %s must be positive : %s", d.name, d.value)
+		}
+		*d.target = duration
+	}
+
+	if config.MaxLockoutDuration < config.LockoutDuration {
+		log.Debug("Maximum submission lockout is less than the lockout, using the lockout as maximum")
+		config.MaxLockoutDuration = config.LockoutDuration
+	}
+
+	return nil
+}
+
+// Configuration of the instances of the instanced challenges, a negative
+// value of max_extensions disables extending the instances.
+type InstancesConfig struct {
+	PortRange     string `toml:"port_range"`
+	Timeout       string `toml:"timeout"`
+	Extension     string `toml:"extension"`
+	MaxExtensions int    `toml:"max_extensions"`
+	MaxPerUser    int    `toml:"max_per_user"`
+	CleanupPeriod string `toml:"cleanup_period"`
+
+	MinPort               uint32        `toml:"-"`
+	MaxPort               uint32        `toml:"-"`
+	TimeoutDuration       time.Duration `toml:"-"`
+	ExtensionDuration     time.Duration `toml:"-"`
+	CleanupPeriodDuration time.Duration `toml:"-"`
+}
+
+// ValidateInstancesConfig validates the instances configuration, challengeMinPort and
+// challengeMaxPort is the port range of the challenges the instances must not overlap.
+func (config *InstancesConfig) ValidateInstancesConfig(challengeMinPort, challengeMaxPort uint32) error {
+	config.MinPort, config.MaxPort = core.DEFAULT_INSTANCE_MIN_PORT, core.DEFAULT_INSTANCE_MAX_PORT
+	if config.PortRange != "" {
+		min, max, err := utils.ParsePortRange(config.PortRange)
+		if err != nil {
+			return fmt.Errorf("Invalid instances port_range %s : %s", config.PortRange, err)
+		}
+		config.MinPort, config.MaxPort = min, max
+	}
+
+	if config.MinPort <= challengeMaxPort && config.MaxPort >= challengeMinPort {
+		return fmt.Errorf("Instances port range %d-%d overlaps with the challenge ports %d-%d",
+			config.MinPort, config.MaxPort, challengeMinPort, challengeMaxPort)
+	}
+
+	if config.MaxPerUser == 0 {
+		log.Debug("Instances per user limit not provided using default value")
+		config.MaxPerUser = core.DEFAULT_INSTANCE_MAX_PER_USER
+	}
+
+	if config.MaxExtensions == 0 {
+		log.Debug("Instance extensions limit not provided using default value")
+		config.MaxExtensions = core.DEFAULT_INSTANCE_MAX_EXTENSIONS
+	}
+
+	durations := []struct {
+		name     string
+		value    string
+		target   *time.Duration
+		fallback time.Duration
+	}{
+		{"timeout", config.Timeout, &config.TimeoutDuration, core.DEFAULT_INSTANCE_TIMEOUT},
+		{"extension", config.Extension, &config.ExtensionDuration, core.DEFAULT_INSTANCE_EXTENSION},
+		{"cleanup_period", config.CleanupPeriod, &config.CleanupPeriodDuration, core.DEFAULT_INSTANCE_CLEANUP_PERIOD},
+	}
+
+	for _, d := range durations {
+		duration, err := time.ParseDuration(d.value)
+		if d.value == "" || err != nil || duration <= 0 {
+			log.Debugf("Invalid or no instances %s provided using default value %s", d.name, d.fallback)
+			duration = d.fallback
+		}
+		*d.target = duration
+	}
+
+	return nil
+}
+
+// Configuration of the redeploys of the challenges, see the strategies
+// REDEPLOY_STRATEGY_RECREATE and REDEPLOY_STRATEGY_BLUE_GREEN.
+type RedeployConfig struct {
+	Strategy      string `toml:"strategy"`
+	HealthTimeout string `toml:"health_timeout"`
+
+	HealthTimeoutDuration time.Duration `toml:"-"`
+}
+
+func (config *RedeployConfig) ValidateRedeployConfig() error {
+	switch config.Strategy {
+	case "":
+		log.Debug("Redeploy strategy not provided using default value")
+		config.Strategy = core.REDEPLOY_STRATEGY_RECREATE
+	case core.REDEPLOY_STRATEGY_RECREATE, core.REDEPLOY_STRATEGY_BLUE_GREEN:
+	default:
+		return fmt.Errorf("Invalid redeploy strategy %s, must be one of %s, %s",
+			config.Strategy, core.REDEPLOY_STRATEGY_RECREATE, core.REDEPLOY_STRATEGY_BLUE_GREEN)
+	}
+
+	duration, err := time.ParseDuration(config.HealthTimeout)
+	if config.HealthTimeout == "" || err != nil || duration <= 0 {
+		log.Debugf("Invalid or no redeploy health_timeout provided using default value %s", core.DEFAULT_REDEPLOY_HEALTH_TIMEOUT)
+		duration = core.DEFAULT_REDEPLOY_HEALTH_TIMEOUT
+	}
+	config.HealthTimeoutDuration = duration
+
 	return nil
 }
 
+// Configuration of the self healing of the unhealthy challenges.
+type SelfHealConfig struct {
+	Enabled     bool   `toml:"enabled"`
+	MaxAttempts int    `toml:"max_attempts"`
+	Backoff     string `toml:"backoff"`
+	MaxBackoff  string `toml:"max_backoff"`
+
+	BackoffDuration    time.Duration `toml:"-"`
+	MaxBackoffDuration time.Duration `toml:"-"`
+}
+
+func (config *SelfHealConfig) ValidateSelfHealConfig() {
+	if config.MaxAttempts <= 0 {
+		log.Debug("Self heal max_attempts not provided using default value")
+		config.MaxAttempts = core.DEFAULT_SELF_HEAL_MAX_ATTEMPTS
+	}
+
+	durations := []struct {
+		name     string
+		value    string
+		target   *time.Duration
+		fallback time.Duration
+	}{
+		{"backoff", config.Backoff, &config.BackoffDuration, core.DEFAULT_SELF_HEAL_BACKOFF},
+		{"max_backoff", config.MaxBackoff, &config.MaxBackoffDuration, core.DEFAULT_SELF_HEAL_MAX_BACKOFF},
+	}
+
+	for _, d := range durations {
+		duration, err := time.ParseDuration(d.value)
+		if d.value == "" || err != nil || duration <= 0 {
+			log.Debugf("Invalid or no self heal %s provided using default value %s", d.name, d.fallback)
+			duration = d.fallback
+		}
+		*d.target = duration
+	}
+
+	if config.MaxBackoffDuration < config.BackoffDuration {
+		config.MaxBackoffDuration = config.BackoffDuration
+	}
+}
+
+// Configuration of the monitoring of the resources used by the challenges.
+type ResourceMonitorConfig struct {
+	Period     string  `toml:"period"`
+	Threshold  float64 `toml:"threshold"`
+	AlertAfter string  `toml:"alert_after"`
+
+	PeriodDuration     time.Duration `toml:"-"`
+	AlertAfterDuration time.Duration `toml:"-"`
+}
+
+func (config *ResourceMonitorConfig) ValidateResourceMonitorConfig() {
+	if config.Threshold <= 0 || config.Threshold > 100 {
+		log.Debug("Invalid or no resource monitor threshold provided using default value")
+		config.Threshold = core.DEFAULT_RESOURCE_THRESHOLD
+	}
+
+	durations := []struct {
+		name     string
+		value    string
+		target   *time.Duration
+		fallback time.Duration
+	}{
+		{"period", config.Period, &config.PeriodDuration, core.DEFAULT_RESOURCE_MONITOR_PERIOD},
+		{"alert_after", config.AlertAfter, &config.AlertAfterDuration, core.DEFAULT_RESOURCE_ALERT_AFTER},
+	}
+
+	for _, d := range durations {
+		duration, err := time.ParseDuration(d.value)
+		if d.value == "" || err != nil || duration <= 0 {
+			log.Debugf("Invalid or no resource monitor %s provided using default value %s", d.name, d.fallback)
+			duration = d.fallback
+		}
+		*d.target = duration
+	}
+}
+
+// Configuration of the queue of the tasks performed by the workers.
+type QueueConfig struct {
+	Workers int    `toml:"workers"`
+	MaxSize uint32 `toml:"max_size"`
+}
+
+func (config *QueueConfig) ValidateQueueConfig() {
+	if config.Workers < 0 {
+		log.Debug("Invalid number of workers provided using one worker for each CPU")
+		config.Workers = 0
+	}
+
+	if config.MaxSize == 0 {
+		log.Debug("Queue max_size not provided using default value")
+		config.MaxSize = core.MAX_QUEUE_SIZE
+	}
+}
+
 type GitRemote struct {
 	Url        string `toml:"url"`
 	RemoteName string `toml:"name"`
@@ -250,6 +697,44 @@ type CompetitionInfo struct {
 	TimeZone     string `toml:"timezone"`
 	LogoURL      string `toml:"logo_url"`
 	DynamicScore bool   `toml:"dynamic_score"`
+	MaxTeamSize  uint   `toml:"max_team_size"`
+
+	// Time after which the scoreboard shown to the contestants is frozen, in
+	// the same format as the starting and ending time.
+	FreezeTime string `toml:"freeze_time"`
+}
+
+// ValidateFreezeTime checks if the freeze time, if any, is in the format of the
+// competition times.
+func (config *CompetitionInfo) ValidateFreezeTime() error {
+	if config.FreezeTime == "" {
+		return nil
+	}
+
+	if _, err := ParseCompetitionTime(config.FreezeTime); err != nil {
+		return fmt.Errorf("Invalid freeze_time %s : %s", config.FreezeTime, err)
+	}
+
+	return nil
+}
+
+// ParseCompetitionTime parses the time of the competition in the format
+// `16:31:23 UTC: +05:30, 17th February 2021, Wednesday` in the local timezone.
+func ParseCompetitionTime(compTime string) (time.Time, error) {
+	compTimeParts := strings.Split(compTime, ",")
+	if len(compTimeParts) < 2 || len(compTimeParts[1]) < 1 {
+		return time.Time{}, fmt.Errorf("Invalid competition time format: %s", compTime)
+	}
+
+	compDate := strings.Split(compTimeParts[1][1:], " ")
+	if len(compDate) < 3 {
+		return time.Time{}, fmt.Errorf("Invalid competition time format: %s", compTime)
+	}
+
+	date := fmt.Sprintf("%s %s, %s", compDate[1], compDate[0], compDate[2])
+	clock := strings.Split(compTimeParts[0], " ")[0]
+
+	return dateparse.ParseLocal(fmt.Sprintf("%s, %s", date, clock))
 }
 
 func UpdateCompetitionInfo(competitionInfo *CompetitionInfo) error {
@@ -328,44 +813,9 @@ func LoadBeastConfig(configPath string) (BeastConfig, error) {
 	return config, nil
 }
 
-// Update the USED_PORT_LIST variable in config.
-// Don't do this very often, we do this once during syncing the git repository
-// then whenever you need updated used port list you need to sync the git remote
-// by beast.
-func UpdateUsedPortList() {
-	USED_PORTS_LIST = make([]uint32, 0)
-
-	beastRemoteDir := filepath.Join(core.BEAST_GLOBAL_DIR, core.BEAST_REMOTES_DIR)
-
-	for _, gitRemote := range Cfg.GitRemotes {
-		if gitRemote.Active != true {
-			continue
-		}
-
-		challengeDir := filepath.Join(beastRemoteDir, gitRemote.RemoteName, core.BEAST_REMOTE_CHALLENGE_DIR)
-		dirs := utils.GetAllDirectoriesName(challengeDir)
-		for _, dir := range dirs {
-			configFilePath := filepath.Join(dir, core.CHALLENGE_CONFIG_FILE_NAME)
-			var config BeastChallengeConfig
-			_, err := toml.DecodeFile(configFilePath, &config)
-			if err == nil {
-				hostPorts, err := config.Challenge.Env.GetAllHostPorts()
-				if err != nil {
-					log.Errorf("Error while parsing host ports for challenge %s", dir)
-					continue
-				}
-
-				USED_PORTS_LIST = append(USED_PORTS_LIST, hostPorts...)
-			}
-		}
-	}
-	log.Debugf("Used port list updated: %v", USED_PORTS_LIST)
-}
-
 var Cfg *BeastConfig
 var SkipAuthorization bool
 var NoCache bool
-var USED_PORTS_LIST []uint32
 
 // InitConfig loads the config from the global config file and populate
 // the Cfg global variable used everywhere else.
@@ -385,6 +835,14 @@ func InitConfig() {
 
 	log.Debugf("CONFIG LOAD: New Config : %v", cfg)
 	Cfg = &cfg
+
+	runtime, err := cr.NewRuntime(cfg.ContainerRuntime, cfg.PodmanSocket)
+	if err != nil {
+		log.Errorf("Error while initializing the container runtime : %s", err)
+		os.Exit(1)
+	}
+	cr.SetRuntime(runtime)
+	log.Debugf("Using container runtime %s", runtime.Name())
 }
 
 // ReloadBeastConfig reloads the beast configuration and reinitializes the Cfg global
@@ -30,6 +30,7 @@ const ( //names
 	HIDDEN                      string = ".hidden"
 	ISSUER                      string = "beast-sds"
 	DELIMITER                   string = "::::"
+	BEAST_RATE_LIMIT_STATE_FILE string = "submission_rate_limit.json"
 )
 
 const ( //paths
@@ -58,6 +59,7 @@ const ( // chall actions
 	MANAGE_ACTION_PURGE    string = "purge"
 	MANAGE_ACTION_REDEPLOY string = "redeploy"
 	MANAGE_ACTION_SHOW     string = "show"
+	MANAGE_ACTION_ROLLBACK string = "rollback"
 )
 
 const ( // chall env
@@ -70,19 +72,79 @@ const ( // chall env
 	ALLOWED_MAX_PORT_VALUE       uint32 = 20000
 )
 const ( // default config
-	IMAGE_NA                 string = "IMAGE_NA"
-	CONTAINER_NA             string = "CONTAINER_NA"
-	MAX_QUEUE_SIZE           uint32 = 100
-	DEFAULT_TICKER_FREQUENCY int    = 1500
-	DEFAULT_PROBE_TIMEOUT    int    = 10
-	DEFAULT_USER_NAME        string = "ghost"
-	DEFAULT_USER_EMAIL       string = "ghost@ghost.com"
-	DEFAULT_CPU_SHARE        int64  = (1 << 9)
-	DEFAULT_MEMORY_LIMIT     int64  = (1 << 29)
-	DEFAULT_PIDS_LIMIT       int64  = 100
-	ITERATIONS               int    = 65536
-	HASH_LENGTH              int    = 32
-	TIMEPERIOD               int64  = 6 * 60 * 60
+	IMAGE_NA                   string  = "IMAGE_NA"
+	CONTAINER_NA               string  = "CONTAINER_NA"
+	MAX_QUEUE_SIZE             uint32  = 100
+	DEFAULT_TICKER_FREQUENCY   int     = 1500
+	DEFAULT_PROBE_TIMEOUT      int     = 10
+	DEFAULT_USER_NAME          string  = "ghost"
+	DEFAULT_USER_EMAIL         string  = "ghost@ghost.com"
+	DEFAULT_CPU_SHARE          int64   = (1 << 9)
+	DEFAULT_MEMORY_LIMIT       int64   = (1 << 29)
+	DEFAULT_PIDS_LIMIT         int64   = 100
+	ITERATIONS                 int     = 65536
+	HASH_LENGTH                int     = 32
+	TIMEPERIOD                 int64   = 6 * 60 * 60
+	DEFAULT_MAX_TEAM_SIZE      uint    = 4
+	TEAM_JOIN_CODE_LENGTH      int     = 16
+	DEFAULT_PAGE_SIZE          int     = 50
+	MAX_PAGE_SIZE              int     = 500
+	DEFAULT_SUBMIT_ATTEMPTS    int     = 10
+	DEFAULT_SUBMIT_NOTIFY      int     = 3
+	DEFAULT_USER_FLAG_FORMAT   string  = "flag{%s}"
+	USER_FLAG_LENGTH           int     = 32
+	DEFAULT_SCOREBOARD_TOP     int     = 10
+	MAX_SCOREBOARD_TOP         int     = 50
+	DEFAULT_DEPLOYMENTS        int     = 10
+	DEFAULT_IMAGE_HISTORY      int     = 3
+	DEFAULT_RESTARTS           int     = 10
+	DEFAULT_HEALTH_RESULTS     int     = 50
+	DEFAULT_RESOURCE_THRESHOLD float64 = 90
+)
+
+const ( // challenge instances
+	DEFAULT_INSTANCE_MIN_PORT       uint32 = 20001
+	DEFAULT_INSTANCE_MAX_PORT       uint32 = 30000
+	DEFAULT_INSTANCE_MAX_PER_USER   int    = 1
+	DEFAULT_INSTANCE_MAX_EXTENSIONS int    = 2
+	INSTANCE_FLAG_ENV               string = "FLAG"
+)
+
+const ( // challenge services
+	MAX_SERVICE_NAME_LENGTH int    = 32
+	CHALLENGE_NETWORK_ALIAS string = "challenge"
+	BEAST_SERVICES_DIR      string = "services"
+)
+
+const ( // challenge egress
+	EGRESS_POLICY_ALLOW        string = "allow"
+	EGRESS_POLICY_NONE         string = "none"
+	EGRESS_POLICY_LIST         string = "list"
+	EGRESS_PROXY_SUFFIX        string = "_egress"
+	DEFAULT_EGRESS_PROXY_IMAGE string = "alpine/socat"
+)
+
+const ( // challenge health checks
+	HEALTHCHECK_TYPE_TCP                  string = "tcp"
+	HEALTHCHECK_TYPE_HTTP                 string = "http"
+	HEALTHCHECK_TYPE_EXEC                 string = "exec"
+	DEFAULT_HEALTHCHECK_FAILURE_THRESHOLD int    = 3
+	DEFAULT_SELF_HEAL_MAX_ATTEMPTS        int    = 5
+	RESTART_ACTION_RESTART                string = "restart"
+	RESTART_ACTION_RECREATE               string = "recreate"
+)
+
+const ( // redeploy strategies
+	REDEPLOY_STRATEGY_RECREATE   string = "recreate"
+	REDEPLOY_STRATEGY_BLUE_GREEN string = "blue_green"
+	REDEPLOY_HEALTHY_CHECKS      int    = 3
+)
+
+const ( // files of the results archive
+	RESULTS_CTFTIME_FILE    string = "ctftime.json"
+	RESULTS_SOLVES_FILE     string = "solves.csv"
+	RESULTS_CHALLENGES_FILE string = "challenges.csv"
+	RESULTS_USERS_FILE      string = "users.csv"
 )
 
 const ( // roles
@@ -93,16 +155,37 @@ const ( // roles
 
 var (
 	DEFAULT_REMOTE_PERIODIC_SYNC_TIME = time.Second * 120
+	DEFAULT_SUBMIT_PERIOD             = time.Minute
+	DEFAULT_SUBMIT_LOCKOUT            = time.Second * 30
+	DEFAULT_SUBMIT_MAX_LOCKOUT        = time.Hour
+	DEFAULT_INSTANCE_TIMEOUT          = time.Minute * 30
+	DEFAULT_INSTANCE_EXTENSION        = time.Minute * 30
+	DEFAULT_INSTANCE_CLEANUP_PERIOD   = time.Minute
+	DEFAULT_REDEPLOY_HEALTH_TIMEOUT   = time.Minute
+	HEALTHCHECK_SYNC_PERIOD           = time.Second * 30
+	DEFAULT_SELF_HEAL_BACKOFF         = time.Second * 30
+	DEFAULT_SELF_HEAL_MAX_BACKOFF     = time.Minute * 10
+	DEFAULT_HEALTH_HISTORY            = time.Hour * 24
+	DEFAULT_RESOURCE_MONITOR_PERIOD   = time.Second * 30
+	DEFAULT_RESOURCE_ALERT_AFTER      = time.Minute * 5
+	CTFTIME_FEED_CACHE_DURATION       = time.Second * 30
 )
 
 var DEPLOY_STATUS = map[string]string{
-	"undeployed": "Undeployed",
-	"staging":    "Staging",
-	"committing": "Commiting",
-	"deploying":  "Deploying",
-	"deployed":   "Deployed",
-	"building":   "Building",
-	"queued":     "Queued",
+	"undeployed":   "Undeployed",
+	"staging":      "Staging",
+	"committing":   "Commiting",
+	"deploying":    "Deploying",
+	"deployed":     "Deployed",
+	"building":     "Building",
+	"queued":       "Queued",
+	"crashlooping": "Crashlooping",
+}
+
+var DEPLOYMENT_STATUS = map[string]string{
+	"running": "Running",
+	"success": "Success",
+	"failed":  "Failed",
 }
 
 var USER_ROLES = map[string]string{
@@ -125,6 +208,13 @@ var SIDECAR_NETWORK_MAP = map[string]string{
 	"mongo": "beast-mongo",
 }
 
+// Ports the sidecars are reachable on, used to forward the connections to the
+// sidecar of a challenge restricting egress through its egress proxy.
+var SIDECAR_PORT_MAP = map[string]uint32{
+	"mysql": 3306,
+	"mongo": 27017,
+}
+
 var SIDECAR_ENV_PREFIX = map[string]string{
 	"mysql": "MYSQL",
 	"mongo": "MONGO",
@@ -195,3 +285,18 @@ var USER_STATUS = map[string]string{
 	"ban":   "ban",
 	"unban": "unban",
 }
+
+var CHEATING_REASON = map[string]string{
+	"user_flag":   "submitted_user_flag",
+	"solved_flag": "submitted_solved_flag",
+}
+
+var SUBMISSION_RESULT = map[string]string{
+	"correct":     "correct",
+	"incorrect":   "incorrect",
+	"solved":      "already_solved",
+	"unavailable": "unavailable",
+	"limited":     "rate_limited",
+	"locked":      "locked",
+	"leaked":      "leaked_flag",
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `submission_attempts` table has the following columns
+// user_id
+// challenge_id
+// flag
+// result
+// source_ip
+// created_at
+//
+// Unlike user_challenges, which only contains the correct submissions,
+// every flag submitted by a user is recorded here along with its result.
+type SubmissionAttempt struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `gorm:"index"`
+	UserID      uint      `gorm:"not null;index"`
+	ChallengeID uint      `gorm:"not null;index"`
+	Flag        string    `gorm:"type:text"`
+	Result      string    `gorm:"not null;type:varchar(32)"`
+	SourceIP    string    `gorm:"type:varchar(64)"`
+}
+
+// Create an entry for the attempt in the SubmissionAttempt table
+func CreateSubmissionAttempt(attempt *SubmissionAttempt) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(attempt).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Query the submission attempts matching the whereMap, made in the time range
+// [from, to]. A zero from or to leaves that side of the range open. The results
+// are ordered with the latest attempt first, offset and limit are used for
+// pagination, a negative limit returns all the matching attempts.
+// It also returns the total number of attempts matching the query.
+func QuerySubmissionAttempts(whereMap map[string]interface{}, from, to time.Time, offset, limit int) ([]SubmissionAttempt, int64, error) {
+	var attempts []SubmissionAttempt
+	var total int64
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	query := Db.Model(&SubmissionAttempt{}).Where(whereMap)
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	tx := query.Order("created_at desc").Offset(offset).Limit(limit).Find(&attempts)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, 0, nil
+	}
+
+	return attempts, total, tx.Error
+}
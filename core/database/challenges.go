@@ -62,6 +62,23 @@ type Challenge struct {
 	Ports           []Port
 	Tags            []*Tag  `gorm:"many2many:tag_challenges;"`
 	Users           []*User `gorm:"many2many:user_challenges;"`
+
+	ScoringStrategy string  `gorm:"type:varchar(32)"`
+	ScoringDecay    float64 `gorm:"default:0"`
+	FirstBloodBonus string  `gorm:"type:text"`
+
+	Requires []*Challenge `gorm:"many2many:challenge_requirements;joinForeignKey:ChallengeID;joinReferences:RequiredID"`
+
+	Flags     string `gorm:"type:text"`
+	FlagMatch string `gorm:"type:varchar(32)"`
+
+	UserFlag         bool   `gorm:"not null;default:false"`
+	FlagFormat       string `gorm:"type:varchar(128)"`
+	FlagSecret       string `gorm:"type:varchar(64)"`
+	Handouts         string `gorm:"type:text"`
+	TemplateHandouts string `gorm:"type:text"`
+
+	Instanced bool `gorm:"not null;default:false"`
 }
 
 type UserChallenges struct {
@@ -71,6 +88,17 @@ type UserChallenges struct {
 	Flag        string
 }
 
+// The `challenge_requirements` table has the following columns
+// challenge_id
+// required_id
+//
+// A challenge is locked for a user until all the challenges it requires
+// have been solved by the user or their team.
+type ChallengeRequirement struct {
+	ChallengeID uint
+	RequiredID  uint
+}
+
 // The `DynamicFlags` table has the following columns
 // name
 // flag
@@ -242,6 +270,53 @@ func GetRelatedUsers(challenge *Challenge) ([]User, error) {
 	return users, nil
 }
 
+// Get the challenges required by the challenge
+func GetRequiredChallenges(challenge *Challenge) ([]Challenge, error) {
+	var challenges []Challenge
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	if err := Db.Model(challenge).Association("Requires").Find(&challenges); err != nil {
+		return challenges, err
+	}
+
+	return challenges, nil
+}
+
+// Replace the challenges required by the challenge
+func UpdateRequiredChallenges(challenge *Challenge, required []*Challenge) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	if len(required) == 0 {
+		return Db.Model(challenge).Association("Requires").Clear()
+	}
+
+	return Db.Model(challenge).Association("Requires").Replace(required)
+}
+
+// Query all the challenge requirements, returns a map from the id of each
+// challenge to the ids of the challenges it requires.
+func QueryChallengeRequirements() (map[uint][]uint, error) {
+	var requirements []ChallengeRequirement
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Table("challenge_requirements").Find(&requirements)
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, tx.Error
+	}
+
+	graph := make(map[uint][]uint)
+	for _, requirement := range requirements {
+		graph[requirement.ChallengeID] = append(graph[requirement.ChallengeID], requirement.RequiredID)
+	}
+
+	return graph, nil
+}
+
 func DeleteChallengeEntry(challenge *Challenge) error {
 	DBMux.Lock()
 	defer DBMux.Unlock()
@@ -257,6 +332,22 @@ func DeleteChallengeEntry(challenge *Challenge) error {
 		return err
 	}
 
+	if err := tx.Where("challenge_id = ? OR required_id = ?", challenge.ID, challenge.ID).Delete(&ChallengeRequirement{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	deployments := tx.Model(&Deployment{}).Select("id").Where("challenge_id = ?", challenge.ID)
+	if err := tx.Where("deployment_id IN (?)", deployments).Delete(&DeploymentStage{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Unscoped().Where("challenge_id = ?", challenge.ID).Delete(&Deployment{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	return tx.Commit().Error
 }
 
@@ -295,6 +386,14 @@ func QuerySubmissions(whereMap map[string]interface{}) ([]UserChallenges, error)
 	return userChallenges, nil
 }
 
+// ErrAlreadySolved is returned when saving a solve of a challenge which has already
+// been solved by the user or by a member of the team of the user.
+var ErrAlreadySolved = errors.New("challenge has already been solved")
+
+// SaveFlagSubmission saves the solve of the challenge by the user. The solves of the
+// user and of the team of the user are checked in the same transaction as the solve
+// is saved in, so concurrent submissions of the members of a team are credited only
+// once and the others return ErrAlreadySolved.
 func SaveFlagSubmission(user_challenges *UserChallenges) error {
 	DBMux.Lock()
 	defer DBMux.Unlock()
@@ -305,7 +404,38 @@ func SaveFlagSubmission(user_challenges *UserChallenges) error {
 		return fmt.Errorf("error while saving record: %s", tx.Error)
 	}
 
-	if err := tx.FirstOrCreate(user_challenges, *user_challenges).Error; err != nil {
+	var count int64
+	err := tx.Model(&UserChallenges{}).
+		Where("user_id = ? AND challenge_id = ?", user_challenges.UserID, user_challenges.ChallengeID).
+		Count(&count).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var user User
+	if err = tx.Select("team_id").First(&user, user_challenges.UserID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if count == 0 && user.TeamID != 0 {
+		err = tx.Model(&UserChallenges{}).
+			Joins("JOIN users ON users.id = user_challenges.user_id").
+			Where("users.team_id = ? AND user_challenges.challenge_id = ?", user.TeamID, user_challenges.ChallengeID).
+			Count(&count).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if count > 0 {
+		tx.Rollback()
+		return ErrAlreadySolved
+	}
+
+	if err = tx.Create(user_challenges).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `cheating_reports` table has the following columns
+// challenge_id
+// submitter_id
+// owner_id
+// flag
+// reason
+// source_ip
+//
+// A report is created whenever a user submits a flag which belongs to another
+// user, the submitter is the user who submitted the flag and the owner is the
+// user the flag was generated for or who solved the challenge with it.
+type CheatingReport struct {
+	gorm.Model
+
+	ChallengeID uint   `gorm:"not null;index"`
+	SubmitterID uint   `gorm:"not null;index"`
+	OwnerID     uint   `gorm:"not null;index"`
+	Flag        string `gorm:"type:text"`
+	Reason      string `gorm:"type:varchar(64)"`
+	SourceIP    string `gorm:"type:varchar(64)"`
+}
+
+// Create an entry for the report in the CheatingReport table
+func CreateCheatingReport(report *CheatingReport) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(report).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Query cheating reports using map, the latest report is returned first
+func QueryCheatingReports(whereMap map[string]interface{}) ([]CheatingReport, error) {
+	var reports []CheatingReport
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where(whereMap).Order("created_at desc").Find(&reports)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return reports, tx.Error
+}
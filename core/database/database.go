@@ -48,7 +48,7 @@ func init() {
 		log.Fatalf("Cannot create related models: %s", err)
 	}
 
-	Db.AutoMigrate(&Challenge{}, &Transaction{}, &Port{}, &User{}, &Tag{}, &Notification{}, &DynamicFlag{})
+	Db.AutoMigrate(&Challenge{}, &Transaction{}, &Port{}, &User{}, &Tag{}, &Notification{}, &DynamicFlag{}, &Team{}, &SubmissionAttempt{}, &ScoreAdjustment{}, &Hint{}, &HintUnlock{}, &CheatingReport{}, &Instance{}, &Deployment{}, &DeploymentStage{}, &ChallengeImage{}, &ChallengeRestart{}, &HealthCheckResult{}, &HealthOutage{}, &QueuedTask{}, &ScheduledAction{})
 
 	users, err := QueryUserEntries("email", core.DEFAULT_USER_EMAIL)
 	if err != nil {
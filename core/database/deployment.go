@@ -0,0 +1,144 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `deployments` table has the following columns
+// challenge_id
+// status
+// commit
+// error
+// build_log
+// ended_at
+//
+// A deployment is created for every run of the deploy pipeline of a challenge,
+// commit is the git commit of the challenge directory the run was started from
+// and build log is the output of the image build in the commit stage.
+type Deployment struct {
+	gorm.Model
+
+	ChallengeID uint   `gorm:"not null;index"`
+	Status      string `gorm:"type:varchar(32);not null"`
+	Commit      string `gorm:"type:varchar(64)"`
+	Error       string `gorm:"type:text"`
+	BuildLog    string `gorm:"type:text"`
+	EndedAt     *time.Time
+	Stages      []DeploymentStage
+}
+
+// The `deployment_stages` table has the following columns
+// deployment_id
+// name
+// started_at
+// ended_at
+// error
+//
+// A stage is created whenever the deploy pipeline enters a stage, stages
+// which are skipped in a run have no entry.
+type DeploymentStage struct {
+	ID           uint      `gorm:"primarykey"`
+	DeploymentID uint      `gorm:"not null;index"`
+	Name         string    `gorm:"type:varchar(32);not null"`
+	StartedAt    time.Time `gorm:"not null"`
+	EndedAt      *time.Time
+	Error        string `gorm:"type:text"`
+}
+
+// Create an entry for the deployment in the Deployment table
+func CreateDeploymentEntry(deployment *Deployment) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(deployment).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Update an entry of the deployment in the Deployment table
+func UpdateDeployment(deployment *Deployment, m map[string]interface{}) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Model(deployment).Updates(m).Error
+}
+
+// Create an entry for the stage in the DeploymentStage table
+func CreateDeploymentStage(stage *DeploymentStage) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(stage).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Update an entry of the stage in the DeploymentStage table
+func UpdateDeploymentStage(stage *DeploymentStage, m map[string]interface{}) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Model(stage).Updates(m).Error
+}
+
+// QueryDeployments returns the deployments of the challenge along with their stages,
+// the latest deployment is returned first. At most limit deployments are returned,
+// all of them if limit is not positive.
+func QueryDeployments(challengeID uint, limit int) ([]Deployment, error) {
+	var deployments []Deployment
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("challenge_id = ?", challengeID).Order("created_at desc").Preload("Stages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("started_at")
+	})
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+
+	tx = tx.Find(&deployments)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return deployments, tx.Error
+}
+
+// QueryDeploymentById returns the deployment along with its stages.
+func QueryDeploymentById(id uint) (Deployment, error) {
+	var deployment Deployment
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Preload("Stages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("started_at")
+	}).Where("id = ?", id).First(&deployment)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return deployment, nil
+	}
+
+	return deployment, tx.Error
+}
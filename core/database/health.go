@@ -0,0 +1,148 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `health_check_results` table has the following columns
+// challenge_id
+// result
+// error
+// created_at
+//
+// A result is created for every health check of a challenge, the results older
+// than the health history of beast are deleted periodically.
+type HealthCheckResult struct {
+	ID          uint      `gorm:"primarykey"`
+	ChallengeID uint      `gorm:"not null;index:idx_challenge_checked_at"`
+	Result      string    `gorm:"type:varchar(16);not null"`
+	Error       string    `gorm:"type:text"`
+	CreatedAt   time.Time `gorm:"index:idx_challenge_checked_at;index"`
+}
+
+// The `health_outages` table has the following columns
+// challenge_id
+// started_at
+// ended_at
+// reason
+//
+// An outage is created once a challenge is unhealthy, it starts at the first of
+// the failed health checks and ends at the next successful health check. The
+// outage is open until then and has no end.
+type HealthOutage struct {
+	ID          uint      `gorm:"primarykey"`
+	ChallengeID uint      `gorm:"not null;index"`
+	StartedAt   time.Time `gorm:"not null"`
+	EndedAt     *time.Time
+	Reason      string `gorm:"type:text"`
+}
+
+// Create an entry for the result in the HealthCheckResult table
+func CreateHealthCheckResult(result *HealthCheckResult) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(result).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// QueryHealthCheckResults returns at most limit latest health check results of
+// the challenge, the latest result is returned first.
+func QueryHealthCheckResults(challengeID uint, limit int) ([]HealthCheckResult, error) {
+	var results []HealthCheckResult
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("challenge_id = ?", challengeID).Order("created_at desc").Limit(limit).Find(&results)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return results, tx.Error
+}
+
+// DeleteHealthCheckResultsBefore deletes the health check results of all the
+// challenges older than the time provided.
+func DeleteHealthCheckResultsBefore(before time.Time) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Where("created_at < ?", before).Delete(&HealthCheckResult{}).Error
+}
+
+// Create an entry for the outage in the HealthOutage table
+func CreateHealthOutage(outage *HealthOutage) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(outage).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Update an entry of the outage in the HealthOutage table
+func UpdateHealthOutage(outage *HealthOutage, m map[string]interface{}) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Model(outage).Updates(m).Error
+}
+
+// QueryOpenHealthOutage returns the outage of the challenge which has not ended,
+// nil is returned if the challenge has no such outage.
+func QueryOpenHealthOutage(challengeID uint) (*HealthOutage, error) {
+	var outage HealthOutage
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("challenge_id = ? AND ended_at IS NULL", challengeID).Order("started_at desc").First(&outage)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return &outage, nil
+}
+
+// QueryHealthOutages returns the outages of the challenge which have not ended
+// before the time provided, the latest outage is returned first.
+func QueryHealthOutages(challengeID uint, since time.Time) ([]HealthOutage, error) {
+	var outages []HealthOutage
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("challenge_id = ? AND (ended_at IS NULL OR ended_at > ?)", challengeID, since).
+		Order("started_at desc").Find(&outages)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return outages, tx.Error
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `hints` table has the following columns
+// challenge_id
+// text
+// cost
+// unlock_after
+//
+// UnlockAfter is the number of seconds after the start of the competition after
+// which the hint is released for free to everyone, zero if it is never released.
+type Hint struct {
+	gorm.Model
+
+	ChallengeID uint   `gorm:"not null;index"`
+	Text        string `gorm:"type:text"`
+	Cost        uint   `gorm:"default:0"`
+	UnlockAfter int64  `gorm:"default:0"`
+}
+
+// The `hint_unlocks` table has the following columns
+// user_id
+// hint_id
+// cost
+// created_at
+//
+// Cost is the cost of the hint at the time of the unlock, it is deducted
+// from the score of the user.
+type HintUnlock struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint `gorm:"not null;uniqueIndex:idx_user_hint"`
+	HintID    uint `gorm:"not null;uniqueIndex:idx_user_hint"`
+	Cost      uint `gorm:"default:0"`
+}
+
+// Create an entry for the hint in the Hint table
+func CreateHintEntry(hint *Hint) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(hint).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Query hints using map
+func QueryHintEntries(whereMap map[string]interface{}) ([]Hint, error) {
+	var hints []Hint
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where(whereMap).Order("id").Find(&hints)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return hints, tx.Error
+}
+
+// Query hint by id
+func QueryHintById(id uint) (Hint, error) {
+	var hint Hint
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.First(&hint, id)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return hint, nil
+	}
+
+	return hint, tx.Error
+}
+
+// SyncChallengeHints updates the hints of the challenge to the ones provided, matching
+// them by their position. Hints present at both the positions are updated in place
+// keeping their unlocks, the extra hints are created and the hints no longer present
+// are deleted along with their unlocks.
+func SyncChallengeHints(challengeID uint, hints []Hint) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	var existing []Hint
+	if err := tx.Where("challenge_id = ?", challengeID).Order("id").Find(&existing).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := range hints {
+		hints[i].ChallengeID = challengeID
+		if i >= len(existing) {
+			if err := tx.Create(&hints[i]).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+			continue
+		}
+
+		err := tx.Model(&existing[i]).Updates(map[string]interface{}{
+			"Text":        hints[i].Text,
+			"Cost":        hints[i].Cost,
+			"UnlockAfter": hints[i].UnlockAfter,
+		}).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	var removed []uint
+	for i := len(hints); i < len(existing); i++ {
+		removed = append(removed, existing[i].ID)
+	}
+
+	if len(removed) > 0 {
+		if err := tx.Where("hint_id IN ?", removed).Delete(&HintUnlock{}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Unscoped().Where("id IN ?", removed).Delete(&Hint{}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// Create an entry for the unlock of the hint by the user, unlocking the same
+// hint twice is not an error and does not create a second entry.
+func CreateHintUnlock(unlock *HintUnlock) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Where(HintUnlock{UserID: unlock.UserID, HintID: unlock.HintID}).FirstOrCreate(unlock).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Query hint unlocks using map
+func QueryHintUnlocks(whereMap map[string]interface{}) ([]HintUnlock, error) {
+	var unlocks []HintUnlock
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where(whereMap).Find(&unlocks)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return unlocks, tx.Error
+}
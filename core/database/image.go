@@ -0,0 +1,108 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `challenge_images` table has the following columns
+// challenge_name
+// version
+// image_id
+// tag
+// commit
+// config
+//
+// It keeps the history of the images committed for a challenge so that the
+// challenge can be rolled back to an earlier image. The history is kept by the
+// name of the challenge so that it survives redeploys of the challenge, the
+// time of the build is the time of creation of the entry. The config of the
+// challenge the image was built with is kept so the image is deployed with it.
+type ChallengeImage struct {
+	gorm.Model
+
+	ChallengeName string `gorm:"not null;type:varchar(64);uniqueIndex:idx_challenge_version"`
+	Version       uint   `gorm:"not null;uniqueIndex:idx_challenge_version"`
+	ImageId       string `gorm:"size:64;not null"`
+	Tag           string `gorm:"type:varchar(128)"`
+	Commit        string `gorm:"type:varchar(64)"`
+	Config        string `gorm:"type:text"`
+}
+
+// Create an entry for the image in the ChallengeImage table, the image gets
+// the version next to the latest version of the images of the challenge.
+func CreateChallengeImage(image *ChallengeImage) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	var latest uint
+	if err := tx.Unscoped().Model(&ChallengeImage{}).Where("challenge_name = ?", image.ChallengeName).
+		Select("COALESCE(MAX(version), 0)").Row().Scan(&latest); err != nil {
+		tx.Rollback()
+		return err
+	}
+	image.Version = latest + 1
+
+	if err := tx.Create(image).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Update an entry of the image in the ChallengeImage table
+func UpdateChallengeImage(image *ChallengeImage, m map[string]interface{}) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Model(image).Updates(m).Error
+}
+
+// QueryChallengeImages returns the image history of the challenge, the latest
+// image is returned first.
+func QueryChallengeImages(challengeName string) ([]ChallengeImage, error) {
+	var images []ChallengeImage
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("challenge_name = ?", challengeName).Order("version desc").Find(&images)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return images, tx.Error
+}
+
+// QueryChallengeImage returns the image of the challenge with the version, the
+// returned image has a zero ID if no such image exists.
+func QueryChallengeImage(challengeName string, version uint) (ChallengeImage, error) {
+	var image ChallengeImage
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("challenge_name = ? AND version = ?", challengeName, version).First(&image)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return image, nil
+	}
+
+	return image, tx.Error
+}
+
+// Delete the entry of the image from the ChallengeImage table
+func DeleteChallengeImage(image *ChallengeImage) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Unscoped().Delete(image).Error
+}
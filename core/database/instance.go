@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `instances` table has the following columns
+// challenge_id
+// user_id
+// container_id
+// port
+// expires_at
+// extensions
+//
+// An instance is a private copy of an instanced challenge started by a user,
+// it is exposed on the host port allocated to it and is removed once it expires.
+type Instance struct {
+	gorm.Model
+
+	ChallengeID uint      `gorm:"not null;index"`
+	UserID      uint      `gorm:"not null;index"`
+	ContainerId string    `gorm:"size:64"`
+	Port        uint32    `gorm:"not null;unique"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	Extensions  uint      `gorm:"not null;default:0"`
+}
+
+// Create an entry for the instance in the Instance table allocating the
+// first host port in the range from minPort to maxPort which is neither
+// used by a challenge nor by another instance. The allocated port is set
+// in the instance.
+func CreateInstanceEntry(instance *Instance, minPort, maxPort uint32) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	var used []uint32
+	if err := tx.Model(&Port{}).Where("port_no BETWEEN ? AND ?", minPort, maxPort).Pluck("port_no", &used).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var instancePorts []uint32
+	if err := tx.Model(&Instance{}).Where("port BETWEEN ? AND ?", minPort, maxPort).Pluck("port", &instancePorts).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	usedPorts := make(map[uint32]bool)
+	for _, port := range append(used, instancePorts...) {
+		usedPorts[port] = true
+	}
+
+	instance.Port = 0
+	for port := minPort; port <= maxPort; port++ {
+		if !usedPorts[port] {
+			instance.Port = port
+			break
+		}
+	}
+
+	if instance.Port == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no free port available in the range %d-%d", minPort, maxPort)
+	}
+
+	if err := tx.Create(instance).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Query instances using map, the oldest instance is returned first
+func QueryInstances(whereMap map[string]interface{}) ([]Instance, error) {
+	var instances []Instance
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where(whereMap).Order("created_at").Find(&instances)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return instances, tx.Error
+}
+
+// QueryExpiredInstances returns the instances which have expired till the time.
+func QueryExpiredInstances(at time.Time) ([]Instance, error) {
+	var instances []Instance
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("expires_at <= ?", at).Find(&instances)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return instances, tx.Error
+}
+
+// CountUserInstances returns the number of instances the user is running.
+func CountUserInstances(userID uint) (int64, error) {
+	var count int64
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Model(&Instance{}).Where("user_id = ?", userID).Count(&count)
+
+	return count, tx.Error
+}
+
+// Update an entry of the instance in the Instance table
+func UpdateInstance(instance *Instance, m map[string]interface{}) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Model(instance).Updates(m).Error
+}
+
+// Delete the entry of the instance from the Instance table, the entry is
+// deleted permanently to free the port allocated to it.
+func DeleteInstanceEntry(instance *Instance) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Unscoped().Delete(instance).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
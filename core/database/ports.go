@@ -1,40 +1,33 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
+// The `ports` table has the following columns
+// challenge_id
+// port_no
+// container_port
+// service
+// auto
+//
+// Each host port used by a challenge has an entry in the table, which is the
+// only record of the ports in use so a port can be used by a single challenge.
+// The container port and the service, empty for the challenge container, of
+// an automatically allocated port are kept so the same port is used again
+// when the challenge is redeployed.
 type Port struct {
 	gorm.Model
 
-	ChallengeID uint   `gorm:"not null"`
-	PortNo      uint32 `gorm:"not null;unique"`
-}
-
-// Create an entry for the port in the Port table
-// It returns an error if anything wrong happen during the
-// transaction. If the entry already exists then it does not
-// do anything and returns.
-func PortEntryGetOrCreate(port *Port) (Port, error) {
-	DBMux.Lock()
-	defer DBMux.Unlock()
-
-	tx := Db.Begin()
-
-	if tx.Error != nil {
-		return Port{}, fmt.Errorf("Error while starting transaction : %s", tx.Error)
-	}
-
-	err := tx.FirstOrCreate(port, *port).Error
-	if err != nil {
-		tx.Rollback()
-		return Port{}, err
-	}
-
-	return *port, tx.Commit().Error
+	ChallengeID   uint   `gorm:"not null;index"`
+	PortNo        uint32 `gorm:"not null;uniqueIndex"`
+	ContainerPort uint32 `gorm:"not null;default:0"`
+	Service       string `gorm:"not null;default:''"`
+	Auto          bool   `gorm:"not null;default:false"`
 }
 
 func GetAllocatedPorts(challenge Challenge) ([]Port, error) {
@@ -50,27 +43,30 @@ func GetAllocatedPorts(challenge Challenge) ([]Port, error) {
 	return ports, nil
 }
 
-func UpdatePorts(challenge *Challenge) error {
+// QueryAllPorts returns all the host ports in use by the challenges.
+func QueryAllPorts() ([]Port, error) {
 	var ports []Port
 
 	DBMux.Lock()
 	defer DBMux.Unlock()
 
-	tx := Db.Begin()
-
-	if err := tx.Model(&challenge).Association("Ports").Find(&ports); err != nil {
-		return fmt.Errorf("error while searching port for challenge : %s", err)
-	}
-	tx.Commit()
-
-	if err := Db.Unscoped().Where("challenge_id = ?", challenge.ID).Delete(ports); err != nil {
-		return err.Error
+	tx := Db.Order("port_no").Find(&ports)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
 	}
 
-	return nil
+	return ports, tx.Error
 }
 
 func DeleteRelatedPorts(portList []Port) error {
+	if len(portList) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(portList))
+	for i, port := range portList {
+		ids[i] = port.ID
+	}
 
 	DBMux.Lock()
 	defer DBMux.Unlock()
@@ -81,10 +77,110 @@ func DeleteRelatedPorts(portList []Port) error {
 		return fmt.Errorf("Error while starting transaction : %s", tx.Error)
 	}
 
-	if err := tx.Where("1 = 1").Unscoped().Delete(portList).Error; err != nil {
+	if err := tx.Unscoped().Where("id IN ?", ids).Delete(&Port{}).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
 
 	return tx.Commit().Error
 }
+
+// AllocateChallengePorts replaces the ports of the challenge with the requested ports
+// in a single transaction and returns them. A requested port with Auto set gets the
+// host port already allocated to the same container port of the same service, else
+// the first port in the range from minPort to maxPort which is neither used by a
+// challenge nor by an instance. An error is returned if a requested host port is
+// used by another challenge or by an instance, or no free port is left in the range.
+func AllocateChallengePorts(challengeID uint, requests []Port, minPort, maxPort uint32) ([]Port, error) {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return nil, fmt.Errorf("Error while starting transaction : %s", tx.Error)
+	}
+
+	var existing []Port
+	if err := tx.Where("challenge_id = ?", challengeID).Find(&existing).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	allocated := make(map[string]uint32)
+	for _, port := range existing {
+		if port.Auto {
+			allocated[fmt.Sprintf("%s:%d", port.Service, port.ContainerPort)] = port.PortNo
+		}
+	}
+
+	var usedPorts []uint32
+	if err := tx.Model(&Port{}).Where("challenge_id != ?", challengeID).Pluck("port_no", &usedPorts).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var instancePorts []uint32
+	if err := tx.Model(&Instance{}).Pluck("port", &instancePorts).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	used := make(map[uint32]bool)
+	for _, port := range append(usedPorts, instancePorts...) {
+		used[port] = true
+	}
+
+	ports := make([]Port, len(requests))
+	for i, request := range requests {
+		request.ChallengeID = challengeID
+
+		if !request.Auto {
+			if used[request.PortNo] {
+				tx.Rollback()
+				return nil, fmt.Errorf("The port %d requested is already in use by another challenge", request.PortNo)
+			}
+		} else if port, ok := allocated[fmt.Sprintf("%s:%d", request.Service, request.ContainerPort)]; ok && !used[port] {
+			request.PortNo = port
+		} else {
+			request.PortNo = 0
+		}
+
+		used[request.PortNo] = true
+		ports[i] = request
+	}
+
+	// Ports are allocated once the ports requested explicitly and the ports
+	// kept from an earlier allocation are known, so they are not handed out.
+	for i := range ports {
+		if ports[i].PortNo != 0 {
+			continue
+		}
+
+		for port := minPort; port <= maxPort; port++ {
+			if !used[port] {
+				ports[i].PortNo = port
+				break
+			}
+		}
+
+		if ports[i].PortNo == 0 {
+			tx.Rollback()
+			return nil, fmt.Errorf("no free port available in the range %d-%d", minPort, maxPort)
+		}
+		used[ports[i].PortNo] = true
+	}
+
+	if err := tx.Unscoped().Where("challenge_id = ?", challengeID).Delete(&Port{}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if len(ports) > 0 {
+		if err := tx.Create(&ports).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return ports, tx.Commit().Error
+}
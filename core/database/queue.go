@@ -0,0 +1,86 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `queued_tasks` table has the following columns
+// challenge_name
+// action
+// info
+// priority
+// started_at
+//
+// A queued task is created for every task pushed to the queue of the workers and is
+// deleted once the task has been performed, so that the tasks in the queue can be
+// resumed when beast restarts. Info is the JSON encoded information of the task and
+// started at is set once a worker starts performing the task.
+type QueuedTask struct {
+	gorm.Model
+
+	ChallengeName string `gorm:"not null;type:varchar(64);uniqueIndex"`
+	Action        string `gorm:"type:varchar(32);not null"`
+	Info          string `gorm:"type:text"`
+	Priority      int    `gorm:"not null;default:0"`
+	StartedAt     *time.Time
+}
+
+// SaveQueuedTask creates the entry for the task in the QueuedTask table, replacing
+// any earlier entry of a task of the challenge.
+func SaveQueuedTask(task *QueuedTask) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Unscoped().Where("challenge_name = ?", task.ChallengeName).Delete(&QueuedTask{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Create(task).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Update the entry of the task of the challenge in the QueuedTask table
+func UpdateQueuedTask(challengeName string, m map[string]interface{}) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Model(&QueuedTask{}).Where("challenge_name = ?", challengeName).Updates(m).Error
+}
+
+// Delete the entry of the task of the challenge from the QueuedTask table
+func DeleteQueuedTask(challengeName string) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Unscoped().Where("challenge_name = ?", challengeName).Delete(&QueuedTask{}).Error
+}
+
+// QueryQueuedTasks returns all the queued tasks, in the order they are to be performed.
+func QueryQueuedTasks() ([]QueuedTask, error) {
+	var tasks []QueuedTask
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Order("priority desc").Order("created_at asc").Find(&tasks)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return tasks, tx.Error
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `challenge_restarts` table has the following columns
+// challenge_id
+// action
+// attempt
+// reason
+// success
+// error
+//
+// A restart is created for every attempt of the self healing to bring an
+// unhealthy challenge back, action is either restart or recreate, reason is
+// the error of the failed health check and error the error of the attempt.
+type ChallengeRestart struct {
+	gorm.Model
+
+	ChallengeID uint   `gorm:"not null;index"`
+	Action      string `gorm:"type:varchar(32);not null"`
+	Attempt     int    `gorm:"not null"`
+	Reason      string `gorm:"type:text"`
+	Success     bool   `gorm:"not null;default:false"`
+	Error       string `gorm:"type:text"`
+}
+
+// Create an entry for the restart in the ChallengeRestart table
+func CreateChallengeRestart(restart *ChallengeRestart) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(restart).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// QueryChallengeRestarts returns at most limit latest restarts of the challenge,
+// the latest restart is returned first.
+func QueryChallengeRestarts(challengeID uint, limit int) ([]ChallengeRestart, error) {
+	var restarts []ChallengeRestart
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("challenge_id = ?", challengeID).Order("created_at desc").Limit(limit).Find(&restarts)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return restarts, tx.Error
+}
+
+// CountChallengeRestarts returns the number of restarts of the challenge
+func CountChallengeRestarts(challengeID uint) (int64, error) {
+	var count int64
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Model(&ChallengeRestart{}).Where("challenge_id = ?", challengeID).Count(&count)
+
+	return count, tx.Error
+}
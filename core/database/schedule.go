@@ -0,0 +1,106 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `scheduled_actions` table has the following columns
+// action
+// challenge
+// tag
+// username
+// cron
+// next_run
+// last_run
+//
+// A scheduled action is an action on a challenge, or on the challenges with the
+// tag, scheduled through the API. The action is run once at next run if cron is
+// empty and the entry is deleted after the run, otherwise it is run at the times
+// matching the cron expression until the entry is deleted.
+type ScheduledAction struct {
+	gorm.Model
+
+	Action    string `gorm:"type:varchar(32);not null"`
+	Challenge string `gorm:"type:varchar(64)"`
+	Tag       string `gorm:"type:varchar(64)"`
+	Username  string `gorm:"type:varchar(64)"`
+	Cron      string `gorm:"type:varchar(128)"`
+	NextRun   time.Time
+	LastRun   *time.Time
+}
+
+// Create an entry for the scheduled action in the ScheduledAction table
+func CreateScheduledAction(action *ScheduledAction) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(action).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// QueryScheduledActions returns all the scheduled actions, the action which is to be
+// run first is returned first.
+func QueryScheduledActions() ([]ScheduledAction, error) {
+	var actions []ScheduledAction
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Order("next_run asc").Find(&actions)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return actions, tx.Error
+}
+
+// QueryScheduledActionById returns the scheduled action with the ID, nil if there
+// is no such action.
+func QueryScheduledActionById(id uint) (*ScheduledAction, error) {
+	var action ScheduledAction
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.First(&action, id)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return &action, nil
+}
+
+// Update the entry of the scheduled action in the ScheduledAction table
+func UpdateScheduledAction(id uint, m map[string]interface{}) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Model(&ScheduledAction{}).Where("id = ?", id).Updates(m).Error
+}
+
+// Delete the entry of the scheduled action from the ScheduledAction table, it
+// returns false if there is no such entry.
+func DeleteScheduledAction(id uint) (bool, error) {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Unscoped().Delete(&ScheduledAction{}, id)
+	return tx.RowsAffected > 0, tx.Error
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `score_adjustments` table has the following columns
+// user_id
+// points
+// reason
+// admin_id
+//
+// Scores of the users are derived from their solves, any manual change
+// to the score of a user is recorded here as an adjustment which is
+// added to the score derived from the solves.
+type ScoreAdjustment struct {
+	gorm.Model
+
+	UserID  uint   `gorm:"not null;index"`
+	Points  int    `gorm:"not null"`
+	Reason  string `gorm:"type:text"`
+	AdminID uint
+}
+
+// Create an entry for the score adjustment in the ScoreAdjustment table
+func CreateScoreAdjustment(adjustment *ScoreAdjustment) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Create(adjustment).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Query score adjustments using map
+func QueryScoreAdjustments(whereMap map[string]interface{}) ([]ScoreAdjustment, error) {
+	var adjustments []ScoreAdjustment
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where(whereMap).Find(&adjustments)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return adjustments, tx.Error
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	_ "gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The `teams` table has the following columns
+// name
+// join_code
+// captain_id
+// score
+//
+// Members of a team are the users whose team_id points to the team, a user
+// can be a member of at most one team. Solves are still recorded per user
+// in the user_challenges table, but are credited to the team of the user.
+type Team struct {
+	gorm.Model
+
+	Name      string `gorm:"not null;type:varchar(64);unique"`
+	JoinCode  string `gorm:"not null;type:varchar(64);unique"`
+	CaptainID uint   `gorm:"not null"`
+	Score     uint   `gorm:"default:0"`
+}
+
+// Create an entry for the team in the Team table
+// It returns an error if anything wrong happen during the
+// transaction.
+func CreateTeamEntry(team *Team) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+	tx := Db.Begin()
+
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.FirstOrCreate(team, *team).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Queries all the team entries where the column represented by key
+// have the value in value.
+func QueryTeamEntries(key string, value string) ([]Team, error) {
+	queryKey := fmt.Sprintf("%s = ?", key)
+
+	var teams []Team
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where(queryKey, value).Find(&teams)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return teams, tx.Error
+}
+
+// Using the column value in key and value in value get the first
+// result of the query.
+func QueryFirstTeamEntry(key string, value string) (Team, error) {
+	teams, err := QueryTeamEntries(key, value)
+	if err != nil {
+		return Team{}, err
+	}
+
+	if len(teams) == 0 {
+		return Team{}, nil
+	}
+
+	return teams[0], nil
+}
+
+// Query all the entries in the Team table
+func QueryAllTeams() ([]Team, error) {
+	var teams []Team
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Find(&teams)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return teams, tx.Error
+}
+
+func QueryTeamById(teamID uint) (Team, error) {
+	var team Team
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.First(&team, teamID)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return Team{}, nil
+	}
+
+	return team, tx.Error
+}
+
+// Update an entry for the team in the Team table
+func UpdateTeam(team *Team, m map[string]interface{}) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	return Db.Model(team).Updates(m).Error
+}
+
+// Delete the team entry, all the members of the team are
+// detached from it in the same transaction.
+func DeleteTeamEntry(team *Team) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	if err := tx.Model(&User{}).Where("team_id = ?", team.ID).Update("team_id", 0).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Unscoped().Delete(team).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Get all the users who are members of the team
+func GetTeamMembers(teamID uint) ([]User, error) {
+	var users []User
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("team_id = ?", teamID).Find(&users)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return users, tx.Error
+}
+
+// Get the number of members in the team
+func CountTeamMembers(teamID uint) (int64, error) {
+	var count int64
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Model(&User{}).Where("team_id = ?", teamID).Count(&count)
+
+	return count, tx.Error
+}
+
+// ErrTeamFull is returned when joining a team which already has the maximum
+// number of members.
+var ErrTeamFull = errors.New("team already has the maximum number of members")
+
+// JoinTeam makes the user a member of the team if the team has less than maxSize
+// members, else ErrTeamFull is returned. The members are counted in the same
+// transaction the user joins the team in, so concurrent joins can't exceed maxSize.
+func JoinTeam(user *User, teamID uint, maxSize uint) error {
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("error while starting transaction: %s", tx.Error)
+	}
+
+	var count int64
+	if err := tx.Model(&User{}).Where("team_id = ?", teamID).Count(&count).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if uint(count) >= maxSize {
+		tx.Rollback()
+		return ErrTeamFull
+	}
+
+	if err := tx.Model(user).Updates(map[string]interface{}{"TeamID": teamID}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Rank of the team among all the teams, ties are broken the same way as on
+// the scoreboard, a team whose last solve was earlier ranks higher and teams
+// without any solve rank after the ones with solves.
+func GetTeamRank(teamID uint, teamScore uint) (rank int64, error error) {
+	var teams []Team
+	var solves []struct {
+		TeamID    uint
+		CreatedAt time.Time
+	}
+
+	rank = 1
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Where("id != ? AND score >= ?", teamID, teamScore).Find(&teams)
+	if tx.Error != nil {
+		return rank, tx.Error
+	}
+
+	tx = Db.Model(&UserChallenges{}).
+		Select("users.team_id AS team_id, user_challenges.created_at AS created_at").
+		Joins("JOIN users ON users.id = user_challenges.user_id").
+		Where("users.team_id != 0").
+		Scan(&solves)
+	if tx.Error != nil {
+		return rank, tx.Error
+	}
+
+	lastSolve := make(map[uint]time.Time)
+	for _, solve := range solves {
+		if solve.CreatedAt.After(lastSolve[solve.TeamID]) {
+			lastSolve[solve.TeamID] = solve.CreatedAt
+		}
+	}
+
+	last := lastSolve[teamID]
+	for _, team := range teams {
+		other := lastSolve[team.ID]
+		switch {
+		case team.Score > teamScore:
+			rank++
+		case other.Equal(last):
+			if team.ID < teamID {
+				rank++
+			}
+		case last.IsZero() || (!other.IsZero() && other.Before(last)):
+			rank++
+		}
+	}
+
+	return rank, nil
+}
+
+// Query all the submissions made by the members of the team
+func QueryTeamSubmissions(teamID uint) ([]UserChallenges, error) {
+	var userChallenges []UserChallenges
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Joins("JOIN users ON users.id = user_challenges.user_id").
+		Where("users.team_id = ?", teamID).
+		Find(&userChallenges)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return userChallenges, tx.Error
+}
+
+// Check whether challenge is submitted by any member of the team
+func CheckPreviousTeamSubmissions(teamID uint, challId uint) (bool, error) {
+	var count int64
+
+	DBMux.Lock()
+	defer DBMux.Unlock()
+
+	tx := Db.Model(&UserChallenges{}).
+		Joins("JOIN users ON users.id = user_challenges.user_id").
+		Where("users.team_id = ? AND user_challenges.challenge_id = ?", teamID, challId).
+		Count(&count)
+
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	return (count >= 1), tx.Error
+}
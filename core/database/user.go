@@ -32,6 +32,7 @@ type User struct {
 	SshKey     string
 	Status     uint `gorm:"not null;default:0"` // 0 for unbanned, 1 for banned
 	Score      uint `gorm:"default:0"`
+	TeamID     uint `gorm:"default:0"` // 0 when the user is not part of any team
 }
 
 // Queries all the users entries where the column represented by key
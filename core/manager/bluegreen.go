@@ -0,0 +1,293 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	cfg "github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/cr"
+	"github.com/sdslabs/beastv4/pkg/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Suffixes of the names of the containers of a challenge during a blue/green
+// redeploy, the new container runs as green until it is found healthy while
+// the old container is renamed to blue during the switch.
+const (
+	greenContainerSuffix = "_green"
+	blueContainerSuffix  = "_blue"
+)
+
+// blueGreenChallengeDir returns the challenge directory the challenge can be redeployed
+// from using the blue/green strategy, an error is returned if the challenge can only be
+// redeployed by recreating it. Only a challenge with a running container which is not
+// instanced, has no services and does not restrict egress can be redeployed this way.
+func blueGreenChallengeDir(challengeName string) (string, error) {
+	challenge, err := database.QueryFirstChallengeEntry("name", challengeName)
+	if err != nil {
+		return "", fmt.Errorf("error while querying challenge: %s", err)
+	}
+
+	if challenge.Format == core.STATIC_CHALLENGE_TYPE_NAME || challenge.Instanced {
+		return "", fmt.Errorf("challenge has no shared container")
+	}
+
+	if !coreUtils.IsContainerIdValid(challenge.ContainerId) {
+		return "", fmt.Errorf("challenge is not deployed")
+	}
+
+	running, err := cr.IsContainerRunning(challenge.ContainerId)
+	if err != nil || !running {
+		return "", fmt.Errorf("container of the challenge is not running")
+	}
+
+	config, err := stagedChallengeConfig(challengeName)
+	if err != nil {
+		return "", fmt.Errorf("error while loading config of challenge: %s", err)
+	}
+
+	if err = checkBlueGreenConfig(&config); err != nil {
+		return "", err
+	}
+
+	challengeDir := coreUtils.GetChallengeDir(challengeName)
+	if challengeDir == "" {
+		return "", fmt.Errorf("challenge does not exist in the remote")
+	}
+
+	return challengeDir, nil
+}
+
+// errBlueGreenUnsupported is returned by the deploy pipeline if the config of the
+// challenge being deployed does not allow a blue/green redeploy.
+var errBlueGreenUnsupported = errors.New("challenge can't be redeployed using blue/green strategy")
+
+// checkBlueGreenConfig returns an error if the challenge with the config can't be
+// redeployed using the blue/green strategy.
+func checkBlueGreenConfig(config *cfg.BeastChallengeConfig) error {
+	if config.Challenge.Metadata.Type == core.STATIC_CHALLENGE_TYPE_NAME || config.Challenge.Env.Instanced {
+		return fmt.Errorf("challenge has no shared container")
+	}
+
+	if len(config.Challenge.Services) > 0 {
+		return fmt.Errorf("challenge has services")
+	}
+
+	if config.Challenge.Env.Egress.Restricted() {
+		return fmt.Errorf("challenge restricts egress")
+	}
+
+	return nil
+}
+
+// StartBlueGreenRedeploy redeploys the challenge from the challenge directory without
+// removing its running container until the new container is found healthy. This is a
+// decorator over bootstrapDeployPipeline generating the notifications for the result.
+// An error wrapping errBlueGreenUnsupported is returned if the new config of the challenge
+// does not allow a blue/green redeploy, nothing is done then and the challenge is to be
+// redeployed by recreating it.
+func StartBlueGreenRedeploy(challengeDir string, noCache bool) error {
+	challengeName := filepath.Base(challengeDir)
+	var sendNotificationError error
+
+	err := bootstrapDeployPipeline(challengeDir, false, false, noCache, true)
+	if errors.Is(err, errBlueGreenUnsupported) {
+		return err
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("REDEPLOY ERROR : %s : previous container is still serving the challenge : %s", challengeName, err)
+		sendNotificationError = notify.SendNotification(notify.Error, msg)
+	} else {
+		msg := fmt.Sprintf("REDEPLOY SUCCESS : %s : Switched to the new container of the challenge.", challengeName)
+		sendNotificationError = notify.SendNotification(notify.Success, msg)
+	}
+
+	if sendNotificationError == nil {
+		log.Debugf("%s: Notification sent", challengeName)
+	}
+
+	return nil
+}
+
+// waitUntilHealthy waits for the container to pass the health check of the challenge with
+// the config for core.REDEPLOY_HEALTHY_CHECKS consecutive checks, for at most timeout. The
+// ports of the container are published as in the port mappings.
+func waitUntilHealthy(containerId string, config *cfg.BeastChallengeConfig, portMappings []cr.PortMapping, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	var healthy int
+	var lastErr error
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+
+		running, err := cr.IsContainerRunning(containerId)
+		if err != nil || !running {
+			return fmt.Errorf("container exited before becoming healthy")
+		}
+
+		if _, err = probeContainer(containerId, config, portMappings); err != nil {
+			healthy, lastErr = 0, err
+			continue
+		}
+
+		healthy++
+		if healthy >= core.REDEPLOY_HEALTHY_CHECKS {
+			return nil
+		}
+	}
+
+	if lastErr != nil {
+		return fmt.Errorf("health check timed out after %s : %s", timeout, lastErr)
+	}
+
+	return fmt.Errorf("health check timed out after %s", timeout)
+}
+
+// switchChallengeContainer is the deploy stage of a blue/green redeploy. The new container
+// of the challenge is started with its ports bound to temporary host ports allocated from
+// the port range of the challenges and is health checked on them. Only if it is healthy the
+// old container is stopped and the new container is started on the ports of the challenge,
+// the old container is removed once the new one passes the health check again. On failure
+// the old container is started again and is left serving the challenge.
+func switchChallengeContainer(challenge *database.Challenge, config cfg.BeastChallengeConfig, run *deploymentRun) error {
+	// The ports of a challenge with restricted egress are published by its egress
+	// proxy, so the new container can't be health checked on temporary ports.
+	if config.Challenge.Env.Egress.Restricted() {
+		return fmt.Errorf("challenges restricting egress can only be redeployed by recreating them")
+	}
+
+	if err := loadAllocatedPorts(challenge, &config); err != nil {
+		return err
+	}
+
+	containerConfig, err := challengeContainerConfig(challenge, config)
+	if err != nil {
+		return err
+	}
+
+	// The network does not exist if the challenge was deployed before every
+	// challenge got its own network.
+	network, err := createChallengeNetwork(&config)
+	if err != nil {
+		return err
+	}
+
+	challengeName := config.Challenge.Metadata.Name
+	containerName := containerConfig.ContainerName
+	oldContainerId := challenge.ContainerId
+	healthTimeout := cfg.Cfg.Redeploy.HealthTimeoutDuration
+
+	greenConfig := containerConfig
+	greenConfig.ContainerName = containerName + greenContainerSuffix
+	greenConfig.PortMapping, err = allocateTemporaryPorts(challenge, containerConfig.PortMapping)
+	if err != nil {
+		return fmt.Errorf("Error while allocating temporary ports for the new container : %s", err)
+	}
+	defer func() {
+		if e := releaseTemporaryPorts(challenge); e != nil {
+			log.Errorf("Error while releasing temporary ports of %s : %s", challengeName, e)
+		}
+	}()
+
+	// A container left by an earlier failed redeploy would conflict with the name.
+	if err = coreUtils.CleanupContainerByFilter("name", greenConfig.ContainerName); err != nil {
+		return err
+	}
+
+	log.Debugf("create container config for new container of challenge(%s): %v", challengeName, greenConfig)
+	greenId, err := cr.CreateContainerFromImage(&greenConfig)
+	removeGreen := func() {
+		if greenId == "" {
+			return
+		}
+		if e := cr.StopAndRemoveContainer(greenId); e != nil {
+			log.Errorf("Error while removing new container %s of %s : %s", greenId, challengeName, e)
+		}
+	}
+	if err != nil {
+		removeGreen()
+		return fmt.Errorf("Error while starting the new container : %s", err)
+	}
+
+	run.startStage("health_check")
+
+	log.Infof("Health checking new container of %s on temporary ports %v", challengeName, greenConfig.PortMapping)
+	err = waitUntilHealthy(greenId, &config, greenConfig.PortMapping, healthTimeout)
+	removeGreen()
+	if err != nil {
+		return fmt.Errorf("New container failed the health check : %s", err)
+	}
+
+	run.startStage("switching")
+
+	// The port bindings of a container can not be changed, so the old container is
+	// stopped to free the ports and the new container is created on them.
+	if err = cr.RenameContainer(oldContainerId, containerName+blueContainerSuffix); err != nil {
+		return fmt.Errorf("Error while renaming the old container : %s", err)
+	}
+
+	restoreOld := func() {
+		if e := cr.RenameContainer(oldContainerId, containerName); e != nil {
+			log.Errorf("Error while renaming the old container of %s back : %s", challengeName, e)
+		}
+		if e := cr.StartContainer(oldContainerId); e != nil {
+			log.Errorf("Error while starting the old container of %s again : %s", challengeName, e)
+		}
+	}
+
+	if err = cr.StopContainer(oldContainerId); err != nil {
+		restoreOld()
+		return fmt.Errorf("Error while stopping the old container : %s", err)
+	}
+
+	containerId, err := cr.CreateContainerFromImage(&containerConfig)
+	removeNew := func() {
+		if containerId == "" {
+			return
+		}
+		if e := cr.StopAndRemoveContainer(containerId); e != nil {
+			log.Errorf("Error while removing failed container %s of %s : %s", containerId, challengeName, e)
+		}
+	}
+	if err != nil {
+		removeNew()
+		restoreOld()
+		return fmt.Errorf("Error while starting the new container on the challenge ports : %s", err)
+	}
+
+	// The container checked earlier is not the one serving the challenge, so the
+	// new container is checked again before the old container is removed.
+	log.Infof("Health checking new container of %s on the challenge ports", challengeName)
+	if err = waitUntilHealthy(containerId, &config, containerConfig.PortMapping, healthTimeout); err != nil {
+		removeNew()
+		restoreOld()
+		return fmt.Errorf("New container failed the health check on the challenge ports : %s", err)
+	}
+
+	if err = database.UpdateChallenge(challenge, map[string]interface{}{"ContainerId": containerId}); err != nil {
+		removeNew()
+		restoreOld()
+		return fmt.Errorf("Error while saving containerId to database : %s", err)
+	}
+	challenge.ContainerId = containerId
+
+	if err = cr.StopAndRemoveContainer(oldContainerId); err != nil {
+		log.Errorf("Error while removing the old container %s of %s : %s", oldContainerId, challengeName, err)
+	}
+
+	if len(containerConfig.NetworkAliases) == 0 {
+		if err = cr.ConnectContainerToNetwork(containerId, network, []string{core.CHALLENGE_NETWORK_ALIAS}); err != nil {
+			return fmt.Errorf("Error while connecting the container to the network of the challenge : %s", err)
+		}
+	}
+
+	log.Infof("Switched %s to the new container %s", challengeName, containerId)
+
+	return nil
+}
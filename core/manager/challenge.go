@@ -26,6 +26,9 @@ type TaskInfo struct {
 	SkipCommit bool
 	Purge      bool
 	NoCache    bool
+
+	// Version of the image in the image history of the challenge to rollback to.
+	Version uint
 }
 
 var Q *wpool.Queue
@@ -39,6 +42,7 @@ var ChallengeActionHandlers = map[string]func(string) error{
 	core.MANAGE_ACTION_UNDEPLOY: UndeployChallenge,
 	core.MANAGE_ACTION_REDEPLOY: RedeployChallenge,
 	core.MANAGE_ACTION_PURGE:    PurgeChallenge,
+	core.MANAGE_ACTION_ROLLBACK: RollbackChallengeToPrevious,
 }
 
 // Function which commits the deployed challenge provided
@@ -66,24 +70,39 @@ func CommitChallengeContainer(challName string) error {
 		log.Errorf("Error while updating imageid : %s", e.Error())
 		return e
 	}
+
+	if e := recordChallengeImage(challName, imageId, ""); e != nil {
+		log.Errorf("Error while recording image history of %s : %s", challName, e)
+	}
 	return nil
 }
 
 // This function is used by the worker nodes or goroutines to perform the task which is pushed in the queue by the beast manager
-func (worker *Worker) PerformTask(w wpool.Task) *wpool.Task {
+func performTask(w wpool.Task) *wpool.Task {
 	info := w.Info.(TaskInfo)
 	switch info.Action {
 	case core.MANAGE_ACTION_DEPLOY:
 		StartDeployPipeline(info.ChallDir, info.SkipStage, info.SkipCommit, info.NoCache)
 
 	case core.MANAGE_ACTION_UNDEPLOY:
-		err := StartUndeployChallenge(w.ID, false)
+		err := StartUndeployChallenge(w.ID, false, false)
 		if err != nil {
 			log.Errorf("Error while undeplying challenge(%s): %s", w.ID, err.Error())
 		}
 
 	case core.MANAGE_ACTION_REDEPLOY:
-		err := StartUndeployChallenge(w.ID, true)
+		if config.Cfg.Redeploy.Strategy == core.REDEPLOY_STRATEGY_BLUE_GREEN {
+			challengeDir, err := blueGreenChallengeDir(w.ID)
+			if err == nil {
+				err = StartBlueGreenRedeploy(challengeDir, info.NoCache)
+			}
+			if err == nil {
+				return nil
+			}
+			log.Infof("Cannot redeploy challenge(%s) using blue/green strategy, recreating it : %s", w.ID, err)
+		}
+
+		err := StartUndeployChallenge(w.ID, true, true)
 		if err != nil {
 			log.Errorf("Error while redeplying challenge(%s): %s", w.ID, err.Error())
 			return nil
@@ -96,11 +115,22 @@ func (worker *Worker) PerformTask(w wpool.Task) *wpool.Task {
 		return work
 
 	case core.MANAGE_ACTION_PURGE:
-		err := StartUndeployChallenge(w.ID, true)
+		err := StartUndeployChallenge(w.ID, true, false)
 		if err != nil {
 			log.Errorf("Error while purging challenge(%s): %s", w.ID, err.Error())
 		}
 
+	case core.MANAGE_ACTION_ROLLBACK:
+		work, err := rollbackChallenge(w.ID, info.Version)
+		if err != nil {
+			log.Errorf("Error while rolling back challenge(%s): %s", w.ID, err.Error())
+			if chall, e := database.QueryFirstChallengeEntry("name", w.ID); e == nil && chall.Status == core.DEPLOY_STATUS["queued"] {
+				database.UpdateChallenge(&chall, map[string]interface{}{"Status": core.DEPLOY_STATUS["undeployed"]})
+			}
+			return nil
+		}
+		return work
+
 	default:
 		chall, err := database.QueryFirstChallengeEntry("name", w.ID)
 		if err != nil {
@@ -141,7 +171,7 @@ func DeployChallengePipeline(challengeDir string) error {
 
 	//TODO: add status queued
 
-	return Q.Push(wpool.Task{
+	return pushTask(wpool.Task{
 		ID:   challengeName,
 		Info: info,
 	})
@@ -583,7 +613,10 @@ func unstageChallenge(challengeName string) error {
 // Do not touch any files in staging, commit phase.
 // This function returns a error if the challenge was not found or if
 // an error happened while removing the challenge instance.
-func undeployChallenge(challengeName string, purge bool) error {
+//
+// With keepImages set a purge keeps the image history of the challenge,
+// this is used while redeploying so that the challenge can be rolled back.
+func undeployChallenge(challengeName string, purge, keepImages bool) error {
 	log.Infof("Got request to Undeploy challenge : %s", challengeName)
 
 	challenge, err := database.QueryFirstChallengeEntry("name", challengeName)
@@ -616,6 +649,20 @@ func undeployChallenge(challengeName string, purge bool) error {
 		}
 	}
 
+	// The containers of the services, the egress proxy and the network of the
+	// challenge are removed along with the challenge container.
+	if err = removeChallengeServices(challengeName); err != nil {
+		log.Errorf("Error while removing services of challenge %s : %s", challengeName, err)
+	}
+
+	if err = removeChallengeNetwork(challengeName); err != nil {
+		log.Errorf("Error while removing network of challenge %s : %s", challengeName, err)
+	}
+
+	if err = StopChallengeInstances(challenge.ID); err != nil {
+		log.Errorf("Error while stopping instances of challenge %s : %s", challengeName, err)
+	}
+
 	err = database.UpdateChallenge(&challenge, map[string]interface{}{
 		"Status":      core.DEPLOY_STATUS["undeployed"],
 		"ContainerId": coreUtils.GetTempContainerId(challengeName),
@@ -642,7 +689,15 @@ func undeployChallenge(challengeName string, purge bool) error {
 			return err
 		}
 
-		err = coreUtils.CleanupChallengeIfExist(cfg)
+		removeServiceImages(&cfg)
+		if keepImages {
+			err = coreUtils.CleanupChallengeContainers(&challenge, cfg)
+		} else {
+			if err = removeChallengeImages(challengeName); err != nil {
+				log.Error(err)
+			}
+			err = coreUtils.CleanupChallengeIfExist(cfg)
+		}
 		if err != nil {
 			return fmt.Errorf("Error while cleaning up the challenge: %s", err)
 		}
@@ -664,9 +719,9 @@ func undeployChallenge(challengeName string, purge bool) error {
 	return nil
 }
 
-func StartUndeployChallenge(challengeName string, purge bool) error {
+func StartUndeployChallenge(challengeName string, purge, keepImages bool) error {
 	var sendNotificationError error
-	err := undeployChallenge(challengeName, purge)
+	err := undeployChallenge(challengeName, purge, keepImages)
 	if err != nil {
 		msg := fmt.Sprintf("UNDEPLOY ERROR: %s : %s", challengeName, err)
 		log.Error(msg)
@@ -697,7 +752,7 @@ func DeployChallenge(challengeName string) error {
 	if chall.Name != "" {
 		database.UpdateChallenge(&chall, map[string]interface{}{"Status": core.DEPLOY_STATUS["queued"]})
 	}
-	return Q.Push(*w)
+	return pushTask(*w)
 }
 
 func UndeployChallenge(challengeName string) error {
@@ -712,7 +767,7 @@ func UndeployChallenge(challengeName string) error {
 		database.UpdateChallenge(&chall, map[string]interface{}{"Status": core.DEPLOY_STATUS["queued"]})
 	}
 
-	return Q.Push(wpool.Task{
+	return pushTask(wpool.Task{
 		Info: TaskInfo{Action: core.MANAGE_ACTION_UNDEPLOY},
 		ID:   challengeName,
 	})
@@ -729,7 +784,7 @@ func PurgeChallenge(challengeName string) error {
 		database.UpdateChallenge(&chall, map[string]interface{}{"Status": core.DEPLOY_STATUS["queued"]})
 	}
 
-	return Q.Push(wpool.Task{
+	return pushTask(wpool.Task{
 		Info: TaskInfo{Action: core.MANAGE_ACTION_PURGE},
 		ID:   challengeName,
 	})
@@ -746,7 +801,7 @@ func RedeployChallenge(challengeName string) error {
 		database.UpdateChallenge(&chall, map[string]interface{}{"Status": core.DEPLOY_STATUS["queued"]})
 	}
 
-	return Q.Push(wpool.Task{
+	return pushTask(wpool.Task{
 		Info: TaskInfo{Action: core.MANAGE_ACTION_REDEPLOY},
 		ID:   challengeName,
 	})
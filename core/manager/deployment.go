@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// deploymentRun records the run of the deploy pipeline of a challenge along with
+// the stages it goes through. Failing to record the run never fails the pipeline,
+// the errors are only logged.
+type deploymentRun struct {
+	deployment *database.Deployment
+	stage      *database.DeploymentStage
+}
+
+// startDeployment creates the deployment record for a run of the deploy pipeline of
+// the challenge started from the git commit.
+func startDeployment(challenge *database.Challenge, commit string) *deploymentRun {
+	run := &deploymentRun{
+		deployment: &database.Deployment{
+			ChallengeID: challenge.ID,
+			Status:      core.DEPLOYMENT_STATUS["running"],
+			Commit:      commit,
+		},
+	}
+
+	if err := database.CreateDeploymentEntry(run.deployment); err != nil {
+		log.Errorf("Error while creating deployment record for %s : %s", challenge.Name, err)
+		run.deployment = nil
+	}
+
+	return run
+}
+
+// startStage records the start of the stage, ending the previous stage if any.
+func (run *deploymentRun) startStage(name string) {
+	run.endStage(nil)
+	if run.deployment == nil {
+		return
+	}
+
+	run.stage = &database.DeploymentStage{
+		DeploymentID: run.deployment.ID,
+		Name:         name,
+		StartedAt:    time.Now(),
+	}
+
+	if err := database.CreateDeploymentStage(run.stage); err != nil {
+		log.Errorf("Error while recording stage %s of deployment %d : %s", name, run.deployment.ID, err)
+		run.stage = nil
+	}
+}
+
+// endStage records the end of the current stage with the error it ended with.
+func (run *deploymentRun) endStage(stageErr error) {
+	if run.stage == nil {
+		return
+	}
+
+	values := map[string]interface{}{"EndedAt": time.Now()}
+	if stageErr != nil {
+		values["Error"] = stageErr.Error()
+	}
+
+	if err := database.UpdateDeploymentStage(run.stage, values); err != nil {
+		log.Errorf("Error while recording end of stage %s of deployment %d : %s", run.stage.Name, run.stage.DeploymentID, err)
+	}
+	run.stage = nil
+}
+
+// finish records the end of the run along with the build log and the error the
+// pipeline failed with, if any.
+func (run *deploymentRun) finish(buildLog string, pipelineErr error) {
+	run.endStage(pipelineErr)
+	if run.deployment == nil {
+		return
+	}
+
+	values := map[string]interface{}{
+		"Status":   core.DEPLOYMENT_STATUS["success"],
+		"BuildLog": buildLog,
+		"EndedAt":  time.Now(),
+	}
+	if pipelineErr != nil {
+		values["Status"] = core.DEPLOYMENT_STATUS["failed"]
+		values["Error"] = pipelineErr.Error()
+	}
+
+	if err := database.UpdateDeployment(run.deployment, values); err != nil {
+		log.Errorf("Error while recording end of deployment %d : %s", run.deployment.ID, err)
+	}
+}
@@ -0,0 +1,225 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/sdslabs/beastv4/core"
+	cfg "github.com/sdslabs/beastv4/core/config"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/cr"
+	log "github.com/sirupsen/logrus"
+)
+
+// proxyForward is a port the egress proxy listens on and the address the
+// connections to the port are forwarded to.
+type proxyForward struct {
+	port    uint32
+	traffic cr.TrafficType
+	address string
+}
+
+// createChallengeNetwork creates the network of the challenge if it does not exist
+// and returns its name. The network is internal if the egress of the challenge is
+// restricted.
+func createChallengeNetwork(config *cfg.BeastChallengeConfig) (string, error) {
+	network := coreUtils.ChallengeNetworkName(config.Challenge.Metadata.Name)
+
+	if _, err := cr.CreateNetworkIfNotExist(network, config.Challenge.Env.Egress.Restricted()); err != nil {
+		return "", fmt.Errorf("Error while creating network of the challenge : %s", err)
+	}
+
+	return network, nil
+}
+
+// removeChallengeNetwork removes the egress proxy and the network of the challenge,
+// the containers of the challenge and its services must be removed before.
+func removeChallengeNetwork(challengeName string) error {
+	filter := fmt.Sprintf("^/%s$", coreUtils.EgressProxyName(challengeName))
+	if err := coreUtils.CleanupContainerByFilter("name", filter); err != nil {
+		return fmt.Errorf("Error while removing egress proxy : %s", err)
+	}
+
+	if err := cr.RemoveNetwork(coreUtils.ChallengeNetworkName(challengeName)); err != nil {
+		return fmt.Errorf("Error while removing network of the challenge : %s", err)
+	}
+
+	return nil
+}
+
+// sidecarDestination returns the sidecar of the challenge as an egress destination, the
+// sidecar is always allowed and is reached through the egress proxy. ok is false if the
+// challenge does not use a sidecar.
+func sidecarDestination(config *cfg.BeastChallengeConfig) (destination cfg.EgressDestination, ok bool) {
+	sidecar := config.Challenge.Metadata.Sidecar
+	if sidecar == "" {
+		return destination, false
+	}
+
+	return cfg.EgressDestination{
+		Host: core.SIDECAR_CONTAINER_MAP[sidecar],
+		Port: core.SIDECAR_PORT_MAP[sidecar],
+	}, true
+}
+
+// egressProxyForwards returns the ports the egress proxy of the challenge listens on.
+// The host ports of the challenge and its services are forwarded to their containers
+// and the port of each allowed destination is forwarded to the destination, the host
+// of the destination is resolved once while deploying the challenge. The port of the
+// sidecar is forwarded to the sidecar, which is resolved by the proxy in its network.
+func egressProxyForwards(config *cfg.BeastChallengeConfig) ([]proxyForward, []proxyForward, error) {
+	var ingress, egress []proxyForward
+	traffic := config.Challenge.Env.TrafficType()
+
+	mappings, err := config.Challenge.Env.GetPortMappings()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, mapping := range mappings {
+		ingress = append(ingress, proxyForward{
+			port:    mapping.HostPort,
+			traffic: traffic,
+			address: fmt.Sprintf("%s:%d", core.CHALLENGE_NETWORK_ALIAS, mapping.ContainerPort),
+		})
+	}
+
+	for _, service := range config.Challenge.Services {
+		mappings, err := service.GetPortMappings()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, mapping := range mappings {
+			ingress = append(ingress, proxyForward{
+				port:    mapping.HostPort,
+				traffic: traffic,
+				address: fmt.Sprintf("%s:%d", service.Name, mapping.ContainerPort),
+			})
+		}
+	}
+
+	if sidecar, ok := sidecarDestination(config); ok {
+		for _, forward := range ingress {
+			if forward.port == sidecar.Port {
+				return nil, nil, fmt.Errorf("Port %d of the sidecar is also a host port of the challenge", sidecar.Port)
+			}
+		}
+
+		egress = append(egress, proxyForward{
+			port:    sidecar.Port,
+			traffic: cr.TCPTraffic,
+			address: net.JoinHostPort(sidecar.Host, fmt.Sprint(sidecar.Port)),
+		})
+	}
+
+	for _, destination := range config.Challenge.Env.Egress.Destinations {
+		for _, forward := range ingress {
+			if forward.port == destination.Port {
+				return nil, nil, fmt.Errorf("Port %d of egress destination %s is also a host port of the challenge", destination.Port, destination.Host)
+			}
+		}
+
+		addrs, err := net.LookupHost(destination.Host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error while resolving egress destination %s : %s", destination.Host, err)
+		}
+
+		egress = append(egress, proxyForward{
+			port:    destination.Port,
+			traffic: cr.TCPTraffic,
+			address: net.JoinHostPort(addrs[0], fmt.Sprint(destination.Port)),
+		})
+	}
+
+	return ingress, egress, nil
+}
+
+// egressProxyCommand returns the shell command run by the egress proxy, which runs
+// socat for each port forwarded.
+func egressProxyCommand(forwards []proxyForward) string {
+	var cmd strings.Builder
+	for _, forward := range forwards {
+		protocol := strings.ToUpper(forward.traffic.String())
+		fmt.Fprintf(&cmd, "socat %s-LISTEN:%d,fork,reuseaddr %s:%s & ", protocol, forward.port, protocol, forward.address)
+	}
+	cmd.WriteString("wait")
+
+	return cmd.String()
+}
+
+// deployEgressProxy starts the egress proxy of a challenge with restricted egress. The
+// proxy is the only container of the challenge outside its internal network, it publishes
+// the host ports of the challenge and its services and lets the containers of the challenge
+// connect to the allowed destinations, the host names of the destinations resolve to the
+// proxy inside the network of the challenge. The proxy joins the network of the sidecar of
+// the challenge, if any, and the host of the sidecar resolves to the proxy as well.
+func deployEgressProxy(config *cfg.BeastChallengeConfig, network string) error {
+	challengeName := config.Challenge.Metadata.Name
+	containerName := coreUtils.EgressProxyName(challengeName)
+
+	ingress, egress, err := egressProxyForwards(config)
+	if err != nil {
+		return err
+	}
+
+	var portMapping []cr.PortMapping
+	for _, forward := range ingress {
+		portMapping = append(portMapping, cfg.NewPortMapping(forward.port, forward.port))
+	}
+
+	var aliases []string
+	for _, destination := range config.Challenge.Env.Egress.Destinations {
+		aliases = append(aliases, destination.Host)
+	}
+
+	sidecar, useSidecar := sidecarDestination(config)
+	if useSidecar {
+		aliases = append(aliases, sidecar.Host)
+	}
+
+	if err = coreUtils.CleanupContainerByFilter("name", fmt.Sprintf("^/%s$", containerName)); err != nil {
+		return err
+	}
+
+	image := cfg.Cfg.EgressProxyImage
+	if exists, err := cr.CheckIfImageExists(image); err != nil || !exists {
+		log.Infof("Pulling egress proxy image %s", image)
+		if _, err = cr.PullImage(image); err != nil {
+			return fmt.Errorf("Error while pulling the egress proxy image %s : %s", image, err)
+		}
+	}
+
+	containerConfig := cr.CreateContainerConfig{
+		PortMapping:   portMapping,
+		ImageId:       image,
+		ContainerName: containerName,
+		Traffic:       config.Challenge.Env.TrafficType(),
+		CPUShares:     config.Resources.CPUShares,
+		Memory:        config.Resources.Memory,
+		PidsLimit:     config.Resources.PidsLimit,
+		Entrypoint:    []string{"/bin/sh", "-c"},
+		Cmd:           []string{egressProxyCommand(append(ingress, egress...))},
+	}
+
+	log.Debugf("create container config for egress proxy of challenge(%s): %v", challengeName, containerConfig)
+	containerId, err := cr.CreateContainerFromImage(&containerConfig)
+	if err != nil {
+		return fmt.Errorf("Error while starting the egress proxy : %s", err)
+	}
+
+	if err = cr.ConnectContainerToNetwork(containerId, network, aliases); err != nil {
+		return fmt.Errorf("Error while connecting the egress proxy to the network of the challenge : %s", err)
+	}
+
+	if useSidecar {
+		sidecarNetwork := getSidecarNetwork(config.Challenge.Metadata.Sidecar)
+		if err = cr.ConnectContainerToNetwork(containerId, sidecarNetwork, nil); err != nil {
+			return fmt.Errorf("Error while connecting the egress proxy to the network of the sidecar : %s", err)
+		}
+	}
+
+	log.Infof("Egress proxy of challenge %s started", challengeName)
+	return nil
+}
@@ -0,0 +1,221 @@
+package manager
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/pkg/ctftime"
+)
+
+// CTFtimeFeed returns the standings of the users, or teams if teams is true, as they
+// were at the time in the format of the CTFtime scoreboard feed. A zero time returns
+// the live standings.
+func CTFtimeFeed(ledger *ScoreLedger, teams bool, at time.Time) (*ctftime.Feed, error) {
+	scoreboard, err := Scoreboard(ledger, teams, at)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &ctftime.Feed{
+		Tasks:     make([]string, 0),
+		Standings: make([]ctftime.Standing, len(scoreboard)),
+	}
+
+	for _, challenge := range ledger.Challenges() {
+		feed.Tasks = append(feed.Tasks, challenge.Name)
+	}
+
+	owners := make(map[uint]*ctftime.Standing)
+	for index, entry := range scoreboard {
+		feed.Standings[index] = ctftime.Standing{
+			Pos:   entry.Rank,
+			Team:  entry.Name,
+			Score: entry.Score,
+		}
+		if !entry.LastSolve.IsZero() {
+			feed.Standings[index].LastAccept = entry.LastSolve.Unix()
+		}
+
+		for member := range entry.members {
+			owners[member] = &feed.Standings[index]
+		}
+	}
+
+	for _, solve := range ledger.SolvePoints(at) {
+		standing, ok := owners[solve.UserID]
+		if !ok {
+			continue
+		}
+
+		if standing.TaskStats == nil {
+			standing.TaskStats = make(map[string]ctftime.TaskStat)
+		}
+
+		// Only the first solve of the challenge by a member of the team counts.
+		if _, ok := standing.TaskStats[solve.Challenge.Name]; ok {
+			continue
+		}
+
+		standing.TaskStats[solve.Challenge.Name] = ctftime.TaskStat{
+			Points: solve.Points,
+			Time:   solve.CreatedAt.Unix(),
+		}
+	}
+
+	return feed, nil
+}
+
+// ExportResults writes a zip archive of the results of the competition to w. The
+// archive contains the CTFtime feed of the users, or teams if teams is true, along
+// with the CSV files of all the solves, challenges and users.
+func ExportResults(w io.Writer, teams bool) error {
+	ledger, err := LoadScoreLedger()
+	if err != nil {
+		return err
+	}
+
+	feed, err := CTFtimeFeed(ledger, teams, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	users, err := database.QueryUserEntries("role", core.USER_ROLES["contestant"])
+	if err != nil {
+		return fmt.Errorf("error while querying users: %s", err)
+	}
+
+	allTeams, err := database.QueryAllTeams()
+	if err != nil {
+		return fmt.Errorf("error while querying teams: %s", err)
+	}
+
+	teamNames := make(map[uint]string)
+	for _, team := range allTeams {
+		teamNames[team.ID] = team.Name
+	}
+
+	usersMap := make(map[uint]database.User)
+	for _, user := range users {
+		usersMap[user.ID] = user
+	}
+
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create(core.RESULTS_CTFTIME_FILE)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(feed); err != nil {
+		return fmt.Errorf("error while writing CTFtime feed: %s", err)
+	}
+
+	solves := [][]string{{"user_id", "username", "team", "challenge", "category", "points", "solved_at"}}
+	solveCount := make(map[uint]uint)
+	for _, solve := range ledger.SolvePoints(time.Time{}) {
+		user, ok := usersMap[solve.UserID]
+		if !ok {
+			continue
+		}
+
+		solveCount[solve.ChallengeID]++
+		solves = append(solves, []string{
+			strconv.Itoa(int(user.ID)),
+			user.Username,
+			teamNames[user.TeamID],
+			solve.Challenge.Name,
+			solve.Challenge.Type,
+			strconv.Itoa(int(solve.Points)),
+			solve.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	if err = writeResultsCSV(archive, core.RESULTS_SOLVES_FILE, solves); err != nil {
+		return err
+	}
+
+	challenges := [][]string{{"id", "name", "category", "points", "solves", "scoring_strategy"}}
+	for _, challenge := range ledger.Challenges() {
+		challenges = append(challenges, []string{
+			strconv.Itoa(int(challenge.ID)),
+			challenge.Name,
+			challenge.Type,
+			strconv.Itoa(int(challenge.Points)),
+			strconv.Itoa(int(solveCount[challenge.ID])),
+			challenge.ScoringStrategy,
+		})
+	}
+
+	if err = writeResultsCSV(archive, core.RESULTS_CHALLENGES_FILE, challenges); err != nil {
+		return err
+	}
+
+	scoreboard, err := Scoreboard(ledger, false, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"rank", "id", "username", "name", "email", "team", "score", "solves", "banned"}}
+	for _, entry := range scoreboard {
+		user := usersMap[entry.ID]
+		rows = append(rows, []string{
+			strconv.Itoa(int(entry.Rank)),
+			strconv.Itoa(int(user.ID)),
+			user.Username,
+			user.Name,
+			user.Email,
+			teamNames[user.TeamID],
+			strconv.Itoa(int(entry.Score)),
+			strconv.Itoa(int(entry.Solves)),
+			"false",
+		})
+	}
+
+	// Banned users are not a part of the scoreboard and are listed at the end without a rank.
+	for _, user := range users {
+		if user.Status != 1 {
+			continue
+		}
+
+		rows = append(rows, []string{
+			"",
+			strconv.Itoa(int(user.ID)),
+			user.Username,
+			user.Name,
+			user.Email,
+			teamNames[user.TeamID],
+			strconv.Itoa(int(user.Score)),
+			"",
+			"true",
+		})
+	}
+
+	if err = writeResultsCSV(archive, core.RESULTS_USERS_FILE, rows); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeResultsCSV(archive *zip.Writer, name string, rows [][]string) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	if err = writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("error while writing %s: %s", name, err)
+	}
+
+	return nil
+}
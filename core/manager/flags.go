@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/pkg/flagmatch"
+	"github.com/sdslabs/beastv4/utils"
+)
+
+// ChallengeFlagMatcher returns the matcher for the flags of the challenge using
+// the flag match mode of the challenge.
+func ChallengeFlagMatcher(challenge *database.Challenge) (*flagmatch.Matcher, error) {
+	var flags []string
+	if challenge.Flag != "" {
+		flags = append(flags, challenge.Flag)
+	}
+
+	if challenge.Flags != "" {
+		flags = append(flags, strings.Split(challenge.Flags, core.DELIMITER)...)
+	}
+
+	return flagmatch.NewMatcher(challenge.FlagMatch, flags)
+}
+
+// MatchDynamicFlag returns the dynamic flag of the challenge matched by the submitted
+// flag, nil if the submitted flag does not match any of them. Dynamic flags are compared
+// literally for the regex mode since they are values and not patterns.
+func MatchDynamicFlag(challenge *database.Challenge, submitted string) (*database.DynamicFlag, error) {
+	mode := challenge.FlagMatch
+	if mode == flagmatch.REGEX || mode == flagmatch.EXACT || mode == "" {
+		flags, err := database.QueryDynamicFlagEntries(map[string]interface{}{
+			"Name": challenge.Name,
+			"Flag": submitted,
+		})
+		if err != nil || len(flags) == 0 {
+			return nil, err
+		}
+
+		return &flags[0], nil
+	}
+
+	flags, err := database.QueryDynamicFlagEntries(map[string]interface{}{
+		"Name": challenge.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range flags {
+		if flagmatch.Equal(mode, flags[i].Flag, submitted) {
+			return &flags[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ChallengeFlagSecret returns the secret used to derive the flags of the users for
+// the challenge, a secret is generated for challenges which do not have one yet.
+func ChallengeFlagSecret(challenge *database.Challenge) (string, error) {
+	if challenge.FlagSecret != "" {
+		return challenge.FlagSecret, nil
+	}
+
+	secret := utils.GenerateRandomID()
+	err := database.UpdateChallenge(challenge, map[string]interface{}{"FlagSecret": secret})
+	if err != nil {
+		return "", fmt.Errorf("Error while saving flag secret for challenge %s : %s", challenge.Name, err)
+	}
+
+	challenge.FlagSecret = secret
+	return secret, nil
+}
+
+// userFlagFormat returns the format of the flags generated for the users of the challenge.
+func userFlagFormat(challenge *database.Challenge) string {
+	if challenge.FlagFormat == "" {
+		return core.DEFAULT_USER_FLAG_FORMAT
+	}
+
+	return challenge.FlagFormat
+}
+
+// UserFlag returns the flag of the challenge for the user, which is derived from
+// the secret of the challenge and the id of the user using HMAC so that it is the
+// same every time and can't be guessed from the flags of other users.
+func UserFlag(challenge *database.Challenge, userID uint) (string, error) {
+	secret, err := ChallengeFlagSecret(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d:%d", challenge.ID, userID)
+	digest := hex.EncodeToString(mac.Sum(nil))[:core.USER_FLAG_LENGTH]
+
+	return fmt.Sprintf(userFlagFormat(challenge), digest), nil
+}
+
+// userFlagShape returns the pattern matched by every flag which could be the flag of
+// a user under the flag match mode of the challenge. With wrapper_insensitive matching
+// the wrapper of the flag can differ, so only the user specific part is looked for.
+func userFlagShape(challenge *database.Challenge) *regexp.Regexp {
+	digest := fmt.Sprintf("[0-9a-f]{%d}", core.USER_FLAG_LENGTH)
+
+	switch challenge.FlagMatch {
+	case flagmatch.WRAPPER_INSENSITIVE:
+		return regexp.MustCompile(digest)
+	case flagmatch.CASE_INSENSITIVE:
+		digest = "(?i)" + digest
+	}
+
+	parts := strings.SplitN(userFlagFormat(challenge), "%s", 2)
+	if len(parts) != 2 {
+		return regexp.MustCompile(digest)
+	}
+
+	return regexp.MustCompile("^" + regexp.QuoteMeta(parts[0]) + digest + regexp.QuoteMeta(parts[1]) + "$")
+}
+
+// MatchUserFlag returns the user for whom the submitted flag of the challenge was
+// generated, nil if the flag does not belong to any user. The flag of the user who
+// submitted it is checked first, the flags of the other contestants are only checked
+// if the submitted flag has the shape of a generated flag.
+func MatchUserFlag(challenge *database.Challenge, user *database.User, submitted string) (*database.User, error) {
+	mode := challenge.FlagMatch
+	if mode == flagmatch.REGEX {
+		mode = flagmatch.EXACT
+	}
+
+	flag, err := UserFlag(challenge, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if flagmatch.Equal(mode, flag, submitted) {
+		return user, nil
+	}
+
+	if !userFlagShape(challenge).MatchString(strings.TrimSpace(submitted)) {
+		return nil, nil
+	}
+
+	users, err := database.QueryUserEntries("role", core.USER_ROLES["contestant"])
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if users[i].ID == user.ID {
+			continue
+		}
+
+		flag, err = UserFlag(challenge, users[i].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if flagmatch.Equal(mode, flag, submitted) {
+			return &users[i], nil
+		}
+	}
+
+	return nil, nil
+}
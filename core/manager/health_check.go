@@ -2,10 +2,15 @@ package manager
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/sdslabs/beastv4/core"
+	cfg "github.com/sdslabs/beastv4/core/config"
 	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/pkg/cr"
 	"github.com/sdslabs/beastv4/pkg/notify"
 	"github.com/sdslabs/beastv4/pkg/probes"
 	log "github.com/sirupsen/logrus"
@@ -14,57 +19,330 @@ import (
 const MAX_RETRIES = 3
 const CHALLENGE_HOST = "127.0.0.1"
 
+// ChallengesHealthProber keeps a health checker running for each deployed, or
+// crashlooping, challenge with health checks enabled. The checkers run concurrently,
+// each on the interval of the health check of its challenge, and are synced with the
+// deployed challenges every core.HEALTHCHECK_SYNC_PERIOD. waitTime is the default
+// interval in seconds.
+//
+// Errors while querying the database are retried on the next sync, a notification is
+// sent once MAX_RETRIES consecutive queries have failed.
 func ChallengesHealthProber(waitTime int) {
 	log.Info("Starting Health Check prober.")
 
+	checkers := make(map[string]chan struct{})
+
 	var retries int = 0
 	for {
-		if retries > MAX_RETRIES {
-			return
-		}
-
 		challs, err := database.QueryChallengeEntriesMap(map[string]interface{}{
-			"Status":       core.DEPLOY_STATUS["deployed"],
+			"Status":       []string{core.DEPLOY_STATUS["deployed"], core.DEPLOY_STATUS["crashlooping"]},
 			"health_check": 1,
 		})
 
 		if err != nil {
-			log.Errorf("Error while querying challenges : %v", err)
 			retries += 1
+			log.Errorf("Error while querying challenges for health checks (attempt %d) : %v", retries, err)
+			if retries == MAX_RETRIES {
+				msg := fmt.Sprintf("HEALTHCHECK : Error while querying challenges %d times in a row : %v", retries, err)
+				notify.SendNotification(notify.Error, msg)
+			}
+
+			time.Sleep(core.HEALTHCHECK_SYNC_PERIOD)
 			continue
 		}
+		retries = 0
+
+		if err = database.DeleteHealthCheckResultsBefore(time.Now().Add(-cfg.Cfg.HealthHistoryDuration)); err != nil {
+			log.Errorf("Error while deleting old health check results : %v", err)
+		}
 
+		deployed := make(map[string]bool)
 		for _, chall := range challs {
-			if chall.Format != core.STATIC_CHALLENGE_TYPE_NAME {
-				allocatedPorts, err := database.GetAllocatedPorts(chall)
+			if chall.Format == core.STATIC_CHALLENGE_TYPE_NAME || chall.Instanced {
+				continue
+			}
+
+			deployed[chall.Name] = true
+			if _, ok := checkers[chall.Name]; !ok {
+				stop := make(chan struct{})
+				checkers[chall.Name] = stop
+				go checkChallengeHealth(chall.Name, time.Duration(waitTime)*time.Second, stop)
+			}
+		}
+
+		for name, stop := range checkers {
+			if !deployed[name] {
+				close(stop)
+				delete(checkers, name)
+			}
+		}
+
+		time.Sleep(core.HEALTHCHECK_SYNC_PERIOD)
+	}
+}
+
+// checkChallengeHealth runs the health check of the challenge on its interval until
+// stop is closed. A notification is sent when the number of consecutive failed checks
+// reaches the failure threshold of the challenge and when the challenge recovers. An
+// unhealthy challenge is self healed if enabled.
+//
+// The result of every check is stored, and an outage of the challenge is recorded from
+// the first of the failed checks which made it unhealthy until it recovers or until it
+// is no longer checked.
+func checkChallengeHealth(challengeName string, defaultInterval time.Duration, stop <-chan struct{}) {
+	var failures int
+	var firstFailure time.Time
+	var outage *database.HealthOutage
+	var outageLoaded bool
+	healer := selfHealer{challengeName: challengeName}
+
+	defer func() {
+		if outage != nil {
+			endHealthOutage(outage, time.Now())
+		}
+	}()
+
+	for {
+		interval := defaultInterval
+
+		config, err := stagedChallengeConfig(challengeName)
+		if err != nil {
+			log.Errorf("Error while loading config of %s for health check : %s", challengeName, err)
+		} else if challenge, err := database.QueryFirstChallengeEntry("name", challengeName); err != nil {
+			log.Errorf("Error while querying challenge %s for health check : %s", challengeName, err)
+		} else {
+			healthCheck := &config.Challenge.HealthCheck
+			if healthCheck.Interval != "" {
+				interval = healthCheck.GetInterval()
+			}
+			threshold := healthCheck.GetFailureThreshold()
+
+			// An outage left open by an earlier run of beast is continued.
+			if !outageLoaded {
+				outage, err = database.QueryOpenHealthOutage(challenge.ID)
 				if err != nil {
-					log.Errorf("Error while accessing database : %v", err)
-					retries += 1
-					continue
+					log.Errorf("Error while querying outages of %s : %s", challengeName, err)
 				}
+				if outage != nil {
+					failures, firstFailure = threshold, outage.StartedAt
+				}
+				outageLoaded = true
+			}
 
-				log.Debugf("Doing helthcheck probe for %s", chall.Name)
+			log.Debugf("Doing %s health check probe for %s", healthCheck.GetType(), challengeName)
+			result, err := probeChallenge(&challenge, &config)
+			checkedAt := time.Now()
+			recordHealthCheck(&challenge, result, err)
 
-				// Do a better job at health probing mechanism.
-				port := int(allocatedPorts[0].PortNo)
-				prober := probes.NewTcpProber()
-				result, err := prober.Probe(CHALLENGE_HOST, port, time.Duration(core.DEFAULT_PROBE_TIMEOUT)*time.Second)
+			if err != nil {
+				failures += 1
+				if failures == 1 {
+					firstFailure = checkedAt
+				}
 
-				if err != nil {
-					msg := fmt.Sprintf("HEALTHCHECK %s: %s : %s", result, chall.Name, err)
-					log.WithFields(log.Fields{
-						"ChallName": chall.Name,
-					}).Error(msg)
+				msg := fmt.Sprintf("HEALTHCHECK %s: %s : %s", result, challengeName, err)
+				log.WithFields(log.Fields{
+					"ChallName": challengeName,
+					"Failures":  failures,
+				}).Error(msg)
+
+				if failures == threshold {
 					notify.SendNotification(notify.Error, msg)
-				} else {
-					log.WithFields(log.Fields{
-						"ChallName": chall.Name,
-					}).Info("HEALTH CHECK returned success.")
 				}
+
+				if failures >= threshold && outage == nil {
+					outage = &database.HealthOutage{
+						ChallengeID: challenge.ID,
+						StartedAt:   firstFailure,
+						Reason:      err.Error(),
+					}
+					if e := database.CreateHealthOutage(outage); e != nil {
+						log.Errorf("Error while recording outage of %s : %s", challengeName, e)
+						outage = nil
+					}
+				}
+
+				// The container is not healed when the check itself could not be run.
+				if failures >= threshold && result != probes.Unknown {
+					healer.heal(&config, err)
+				}
+			} else {
+				if failures >= threshold {
+					msg := fmt.Sprintf("HEALTHCHECK %s: %s : challenge is healthy again", result, challengeName)
+					notify.SendNotification(notify.Success, msg)
+				}
+				failures = 0
+				healer.recovered(&challenge)
+
+				if outage != nil {
+					endHealthOutage(outage, checkedAt)
+					outage = nil
+				}
+
+				log.WithFields(log.Fields{
+					"ChallName": challengeName,
+				}).Info("HEALTH CHECK returned success.")
 			}
 		}
 
-		// Wait for some time before next probing.
-		time.Sleep(time.Duration(waitTime) * time.Second)
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
 	}
 }
+
+// recordHealthCheck stores the result of the health check of the challenge.
+func recordHealthCheck(challenge *database.Challenge, result probes.ProbeResult, err error) {
+	entry := database.HealthCheckResult{
+		ChallengeID: challenge.ID,
+		Result:      string(result),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if e := database.CreateHealthCheckResult(&entry); e != nil {
+		log.Errorf("Error while recording health check of %s : %s", challenge.Name, e)
+	}
+}
+
+// endHealthOutage ends the outage at the time provided.
+func endHealthOutage(outage *database.HealthOutage, endedAt time.Time) {
+	if err := database.UpdateHealthOutage(outage, map[string]interface{}{"EndedAt": endedAt}); err != nil {
+		log.Errorf("Error while ending outage %d : %s", outage.ID, err)
+	}
+}
+
+// HealthUptime returns the percentage of the time between since and now for which the
+// challenge was not in any of the outages.
+func HealthUptime(outages []database.HealthOutage, since, now time.Time) float64 {
+	if !now.After(since) {
+		return 100
+	}
+
+	var downtime time.Duration
+	for _, outage := range outages {
+		start, end := outage.StartedAt, now
+		if outage.EndedAt != nil && outage.EndedAt.Before(now) {
+			end = *outage.EndedAt
+		}
+		if start.Before(since) {
+			start = since
+		}
+
+		if end.After(start) {
+			downtime += end.Sub(start)
+		}
+	}
+
+	return 100 * float64(now.Sub(since)-downtime) / float64(now.Sub(since))
+}
+
+// probeChallenge runs the health check of the challenge once against its container.
+func probeChallenge(challenge *database.Challenge, config *cfg.BeastChallengeConfig) (probes.ProbeResult, error) {
+	var portMappings []cr.PortMapping
+	if config.Challenge.HealthCheck.GetType() != core.HEALTHCHECK_TYPE_EXEC {
+		if err := loadAllocatedPorts(challenge, config); err != nil {
+			return probes.Unknown, err
+		}
+
+		var err error
+		portMappings, err = config.Challenge.Env.GetPortMappings()
+		if err != nil {
+			return probes.Unknown, fmt.Errorf("error while parsing port mapping : %s", err)
+		}
+	}
+
+	return probeContainer(challenge.ContainerId, config, portMappings)
+}
+
+// probeContainer runs the health check of the challenge with the config once against
+// the container, the ports of the container are published as in the port mappings.
+func probeContainer(containerId string, config *cfg.BeastChallengeConfig, portMappings []cr.PortMapping) (probes.ProbeResult, error) {
+	healthCheck := &config.Challenge.HealthCheck
+	timeout := healthCheck.GetTimeout()
+
+	if healthCheck.GetType() == core.HEALTHCHECK_TYPE_EXEC {
+		exitCode, output, err := cr.ExecInContainer(containerId, healthCheck.Command, timeout)
+		if err != nil {
+			return probes.Failure, fmt.Errorf("error while running command : %s", err)
+		}
+
+		if exitCode != 0 {
+			return probes.Failure, fmt.Errorf("command exited with status %d : %s", exitCode, strings.TrimSpace(output))
+		}
+
+		return probes.Success, nil
+	}
+
+	port, err := healthCheckHostPort(config, portMappings)
+	if err != nil {
+		return probes.Unknown, err
+	}
+
+	switch healthCheck.GetType() {
+	case core.HEALTHCHECK_TYPE_HTTP:
+		path := healthCheck.Path
+		if path == "" {
+			path = "/"
+		}
+
+		statusCode, body, err := probes.NewHTTPProber().Get(&url.URL{
+			Scheme: "http",
+			Host:   fmt.Sprintf("%s:%d", CHALLENGE_HOST, port),
+			Path:   path,
+		}, http.Header{}, timeout)
+		if err != nil {
+			return probes.Failure, err
+		}
+
+		if healthCheck.Status != 0 {
+			if statusCode != healthCheck.Status {
+				return probes.Failure, fmt.Errorf("HTTP probe returned status %d, expected %d", statusCode, healthCheck.Status)
+			}
+		} else if statusCode < http.StatusOK || statusCode >= http.StatusBadRequest {
+			return probes.Failure, fmt.Errorf("HTTP probe failed with statuscode: %d", statusCode)
+		}
+
+		if !strings.Contains(body, healthCheck.Body) {
+			return probes.Failure, fmt.Errorf("HTTP response does not contain %q", healthCheck.Body)
+		}
+
+		return probes.Success, nil
+
+	default:
+		// Connections can't be checked for udp, so only the container is checked.
+		if config.Challenge.Env.TrafficType() == cr.UDPTraffic {
+			running, err := cr.IsContainerRunning(containerId)
+			if err != nil {
+				return probes.Unknown, err
+			}
+			if !running {
+				return probes.Failure, fmt.Errorf("container of the challenge is not running")
+			}
+
+			return probes.Success, nil
+		}
+
+		return probes.NewTcpProber().Probe(CHALLENGE_HOST, int(port), timeout)
+	}
+}
+
+// healthCheckHostPort returns the host port the port checked by the health check
+// of the challenge is mapped to in the port mappings.
+func healthCheckHostPort(config *cfg.BeastChallengeConfig, portMappings []cr.PortMapping) (uint32, error) {
+	port := config.Challenge.HealthCheck.Port
+	if port == 0 {
+		port = config.Challenge.Env.GetDefaultPort()
+	}
+
+	for _, mapping := range portMappings {
+		if mapping.ContainerPort == port {
+			return mapping.HostPort, nil
+		}
+	}
+
+	return 0, fmt.Errorf("port %d is not mapped to a host port", port)
+}
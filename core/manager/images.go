@@ -0,0 +1,251 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	cfg "github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/cr"
+	wpool "github.com/sdslabs/beastv4/pkg/workerpool"
+	"github.com/sdslabs/beastv4/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// imageTag returns the tag of the image of the challenge with the version, the tag
+// contains the version, the short git commit, if any, and the time of the build.
+func imageTag(challengeName string, image *database.ChallengeImage) string {
+	tag := fmt.Sprintf("v%d", image.Version)
+	if len(image.Commit) >= 12 {
+		tag = fmt.Sprintf("%s-%s", tag, image.Commit[:12])
+	}
+
+	return fmt.Sprintf("%s:%s-%s", coreUtils.EncodeID(challengeName), tag, image.CreatedAt.UTC().Format("20060102150405"))
+}
+
+// stagedConfigPath returns the path of the config of the challenge in the staging area.
+func stagedConfigPath(challengeName string) string {
+	return filepath.Join(core.BEAST_GLOBAL_DIR, core.BEAST_STAGING_DIR, challengeName, core.CHALLENGE_CONFIG_FILE_NAME)
+}
+
+// recordChallengeImage adds the image to the image history of the challenge tagging it
+// with its version, the git commit and the time of the build. The staged config of the
+// challenge is recorded along with the image as the config the image is deployed with.
+// The images older than the latest `image_history` images are removed unless they are
+// in use by the challenge.
+func recordChallengeImage(challengeName, imageId, commit string) error {
+	// The image is recorded without a config if the config can't be read, it
+	// can't be rolled back to then.
+	config, err := ioutil.ReadFile(stagedConfigPath(challengeName))
+	if err != nil {
+		log.Warnf("Error while reading staged config of %s, recording image without it : %s", challengeName, err)
+	}
+
+	image := database.ChallengeImage{
+		ChallengeName: challengeName,
+		ImageId:       imageId,
+		Commit:        commit,
+		Config:        string(config),
+	}
+
+	if err := database.CreateChallengeImage(&image); err != nil {
+		return fmt.Errorf("error while recording image of %s: %s", challengeName, err)
+	}
+
+	tag := imageTag(challengeName, &image)
+	if err := cr.TagImage(imageId, tag); err != nil {
+		return fmt.Errorf("error while tagging image %s of %s: %s", imageId, challengeName, err)
+	}
+
+	if err := database.UpdateChallengeImage(&image, map[string]interface{}{"Tag": tag}); err != nil {
+		return fmt.Errorf("error while saving tag of image %s: %s", imageId, err)
+	}
+
+	log.Infof("Image %s of %s recorded as version %d", imageId, challengeName, image.Version)
+
+	return pruneChallengeImages(challengeName, imageId)
+}
+
+// pruneChallengeImages removes the images of the challenge older than the latest
+// `image_history` images, current is the image in use which is never removed.
+func pruneChallengeImages(challengeName, current string) error {
+	images, err := database.QueryChallengeImages(challengeName)
+	if err != nil {
+		return fmt.Errorf("error while querying images of %s: %s", challengeName, err)
+	}
+
+	if len(images) <= cfg.Cfg.ImageHistory {
+		return nil
+	}
+
+	for i := range images[cfg.Cfg.ImageHistory:] {
+		image := &images[cfg.Cfg.ImageHistory+i]
+		if image.ImageId == current {
+			continue
+		}
+
+		// Removing the tag deletes the image only if no other tag refers to it.
+		if image.Tag != "" {
+			if err := cr.RemoveImage(image.Tag); err != nil {
+				log.Warnf("Error while removing image %s of %s, keeping it in history : %s", image.Tag, challengeName, err)
+				continue
+			}
+		}
+
+		if err := database.DeleteChallengeImage(image); err != nil {
+			return fmt.Errorf("error while deleting image %s from history: %s", image.Tag, err)
+		}
+
+		log.Infof("Removed image version %d of %s from history", image.Version, challengeName)
+	}
+
+	return nil
+}
+
+// rollbackImage returns the image of the challenge with the version, or the latest
+// image older than the image in use if version is zero.
+func rollbackImage(challenge *database.Challenge, version uint) (*database.ChallengeImage, error) {
+	images, err := database.QueryChallengeImages(challenge.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying images of %s: %s", challenge.Name, err)
+	}
+
+	// The images are ordered from the latest version, an image in use which is not
+	// in the history is considered newer than all of them.
+	var current uint
+	for i := range images {
+		if images[i].ImageId == challenge.ImageId {
+			current = images[i].Version
+			break
+		}
+	}
+
+	var versions []string
+	for i := range images {
+		image := &images[i]
+		versions = append(versions, fmt.Sprintf("v%d", image.Version))
+
+		earlier := image.ImageId != challenge.ImageId && (current == 0 || image.Version < current)
+		if (version == 0 && earlier) || (version != 0 && image.Version == version) {
+			exists, err := cr.CheckIfImageExists(image.ImageId)
+			if err != nil || !exists {
+				return nil, fmt.Errorf("image of version %d of %s does not exist anymore", image.Version, challenge.Name)
+			}
+
+			// The image can't be deployed with the current config, which may
+			// not match the image, if its own config was not recorded.
+			if image.Config == "" {
+				return nil, fmt.Errorf("no config is recorded for image version %d of %s", image.Version, challenge.Name)
+			}
+
+			return image, nil
+		}
+	}
+
+	if version == 0 {
+		return nil, fmt.Errorf("no earlier image of %s available to rollback to, available versions: %v", challenge.Name, versions)
+	}
+
+	return nil, fmt.Errorf("no image with version %d of %s, available versions: %v", version, challenge.Name, versions)
+}
+
+// RollbackChallenge queues a rollback of the challenge to the image with the version,
+// or to the image before the one in use if version is zero. The container of the
+// challenge is recreated from the image, with the config recorded for the image,
+// without rebuilding the challenge.
+func RollbackChallenge(challengeName string, version uint) error {
+	challenge, err := database.QueryFirstChallengeEntry("name", challengeName)
+	if err != nil {
+		log.Errorf("DB_ACCESS_ERROR : %s", err.Error())
+		return err
+	}
+
+	if challenge.Name == "" {
+		return fmt.Errorf("ChallengeName %s not valid", challengeName)
+	}
+
+	if challenge.Format == core.STATIC_CHALLENGE_TYPE_NAME {
+		return errors.New("static challenges have no images to rollback to")
+	}
+
+	if err = utils.ValidateFileExists(stagedConfigPath(challengeName)); err != nil {
+		return fmt.Errorf("challenge %s is not staged, cannot rollback", challengeName)
+	}
+
+	image, err := rollbackImage(&challenge, version)
+	if err != nil {
+		return err
+	}
+
+	database.UpdateChallenge(&challenge, map[string]interface{}{"Status": core.DEPLOY_STATUS["queued"]})
+
+	return pushTask(wpool.Task{
+		Info: TaskInfo{Action: core.MANAGE_ACTION_ROLLBACK, Version: image.Version},
+		ID:   challengeName,
+	})
+}
+
+// RollbackChallengeToPrevious queues a rollback of the challenge to the image before
+// the one in use.
+func RollbackChallengeToPrevious(challengeName string) error {
+	return RollbackChallenge(challengeName, 0)
+}
+
+// rollbackChallenge undeploys the challenge and switches it to the image with the
+// version, the staged config of the challenge is replaced with the config recorded
+// for the image. It returns the task deploying the challenge from the image, which
+// updates the challenge from the config.
+func rollbackChallenge(challengeName string, version uint) (*wpool.Task, error) {
+	challenge, err := database.QueryFirstChallengeEntry("name", challengeName)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := rollbackImage(&challenge, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = undeployChallenge(challengeName, false, false); err != nil {
+		return nil, err
+	}
+
+	if err = ioutil.WriteFile(stagedConfigPath(challengeName), []byte(image.Config), 0644); err != nil {
+		return nil, fmt.Errorf("error while restoring config of image version %d of %s: %s", image.Version, challengeName, err)
+	}
+
+	if err = database.UpdateChallenge(&challenge, map[string]interface{}{"ImageId": image.ImageId}); err != nil {
+		return nil, fmt.Errorf("error while updating image of %s: %s", challengeName, err)
+	}
+
+	log.Infof("Rolling back %s to image version %d built at %s", challengeName, image.Version, image.CreatedAt.Format(time.RFC3339))
+
+	return GetDeployWork(challengeName)
+}
+
+// removeChallengeImages removes all the images in the image history of the challenge.
+func removeChallengeImages(challengeName string) error {
+	images, err := database.QueryChallengeImages(challengeName)
+	if err != nil {
+		return fmt.Errorf("error while querying images of %s: %s", challengeName, err)
+	}
+
+	for i := range images {
+		if images[i].Tag != "" {
+			if err := cr.RemoveImage(images[i].Tag); err != nil {
+				log.Warnf("Error while removing image %s of %s : %s", images[i].Tag, challengeName, err)
+			}
+		}
+
+		if err := database.DeleteChallengeImage(&images[i]); err != nil {
+			return fmt.Errorf("error while deleting image %s from history: %s", images[i].Tag, err)
+		}
+	}
+
+	return nil
+}
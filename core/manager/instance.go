@@ -0,0 +1,274 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sdslabs/beastv4/core"
+	cfg "github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/cr"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNotInstanced      = errors.New("challenge is not instanced")
+	ErrNotDeployed       = errors.New("challenge is not deployed")
+	ErrInstanceLimit     = errors.New("maximum number of running instances reached")
+	ErrExtensionDisabled = errors.New("instances cannot be extended")
+	ErrExtensionLimit    = errors.New("maximum number of extensions reached")
+)
+
+// Serializes the reservation of the instances so that a user can not go
+// above the limit of running instances with concurrent requests.
+var instancesMux sync.Mutex
+
+// stagedChallengeConfig returns the config of the challenge from the staging area.
+func stagedChallengeConfig(challengeName string) (cfg.BeastChallengeConfig, error) {
+	var config cfg.BeastChallengeConfig
+
+	configFile := filepath.Join(core.BEAST_GLOBAL_DIR, core.BEAST_STAGING_DIR, challengeName, core.CHALLENGE_CONFIG_FILE_NAME)
+	_, err := toml.DecodeFile(configFile, &config)
+
+	return config, err
+}
+
+// reserveInstance creates the entry of an instance of the challenge for the user
+// with a port allocated to it, existing is true if the user already has an
+// instance of the challenge in which case that instance is returned.
+func reserveInstance(challenge *database.Challenge, user *database.User, timeout time.Duration) (instance *database.Instance, existing bool, err error) {
+	instancesMux.Lock()
+	defer instancesMux.Unlock()
+
+	instances, err := database.QueryInstances(map[string]interface{}{
+		"challenge_id": challenge.ID,
+		"user_id":      user.ID,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("error while querying instances: %s", err)
+	}
+
+	if len(instances) > 0 {
+		return &instances[0], true, nil
+	}
+
+	count, err := database.CountUserInstances(user.ID)
+	if err != nil {
+		return nil, false, fmt.Errorf("error while querying instances: %s", err)
+	}
+
+	if count >= int64(cfg.Cfg.Instances.MaxPerUser) {
+		return nil, false, ErrInstanceLimit
+	}
+
+	instance = &database.Instance{
+		ChallengeID: challenge.ID,
+		UserID:      user.ID,
+		ContainerId: coreUtils.GetTempContainerId(challenge.Name),
+		ExpiresAt:   time.Now().Add(timeout),
+	}
+
+	err = database.CreateInstanceEntry(instance, cfg.Cfg.Instances.MinPort, cfg.Cfg.Instances.MaxPort)
+	if err != nil {
+		return nil, false, fmt.Errorf("error while allocating instance: %s", err)
+	}
+
+	return instance, false, nil
+}
+
+// StartInstance starts a private instance of the instanced challenge for the user from
+// the committed image of the challenge. The default port of the challenge is exposed on
+// the port allocated to the instance and the flag generated for the user is available
+// in the FLAG environment variable if the challenge uses user flags.
+//
+// If the user already has an instance of the challenge running it is returned.
+func StartInstance(challenge *database.Challenge, user *database.User) (*database.Instance, error) {
+	if !challenge.Instanced {
+		return nil, ErrNotInstanced
+	}
+
+	if challenge.Status != core.DEPLOY_STATUS["deployed"] || !coreUtils.IsImageIdValid(challenge.ImageId) {
+		return nil, ErrNotDeployed
+	}
+
+	config, err := stagedChallengeConfig(challenge.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error while loading config of challenge %s: %s", challenge.Name, err)
+	}
+
+	instance, existing, err := reserveInstance(challenge, user, config.Challenge.Env.GetInstanceTimeout())
+	if err != nil || existing {
+		return instance, err
+	}
+
+	containerConfig, err := challengeContainerConfig(challenge, config)
+	if err != nil {
+		database.DeleteInstanceEntry(instance)
+		return nil, err
+	}
+
+	containerPort := config.Challenge.Env.DefaultPort
+	if containerPort == 0 {
+		containerPort = config.Challenge.Env.GetDefaultPort()
+	}
+
+	// Every instance runs in its own network so the instances can't reach each
+	// other, an instance of a challenge using a sidecar runs in the network of
+	// the sidecar instead.
+	containerConfig.ContainerNetwork = getSidecarNetwork(config.Challenge.Metadata.Sidecar)
+	containerConfig.NetworkAliases = nil
+	if containerConfig.ContainerNetwork == "" {
+		network := coreUtils.InstanceNetworkName(instance.ID)
+		if _, err = cr.CreateNetworkIfNotExist(network, false); err != nil {
+			database.DeleteInstanceEntry(instance)
+			return nil, fmt.Errorf("error while creating network for the instance: %s", err)
+		}
+		containerConfig.ContainerNetwork = network
+	}
+
+	containerConfig.ContainerName = fmt.Sprintf("%s_%d", coreUtils.EncodeID(challenge.Name), instance.ID)
+	containerConfig.PortMapping = []cr.PortMapping{{
+		HostPort:      instance.Port,
+		ContainerPort: containerPort,
+	}}
+
+	if challenge.UserFlag {
+		flag, err := UserFlag(challenge, user.ID)
+		if err != nil {
+			removeInstanceNetwork(instance)
+			database.DeleteInstanceEntry(instance)
+			return nil, fmt.Errorf("error while generating flag for the instance: %s", err)
+		}
+		containerConfig.ContainerEnv = append(containerConfig.ContainerEnv, fmt.Sprintf("%s=%s", core.INSTANCE_FLAG_ENV, flag))
+	}
+
+	log.Debugf("create container config for instance of challenge(%s) for %s: %v", challenge.Name, user.Username, containerConfig)
+	containerId, err := cr.CreateContainerFromImage(&containerConfig)
+	if err != nil {
+		if containerId != "" {
+			if e := cr.StopAndRemoveContainer(containerId); e != nil {
+				log.Errorf("Error while removing failed instance container %s : %s", containerId, e)
+			}
+		}
+
+		removeInstanceNetwork(instance)
+		database.DeleteInstanceEntry(instance)
+		return nil, fmt.Errorf("error while creating container for the instance: %s", err)
+	}
+
+	instance.ContainerId = containerId
+	if err = database.UpdateInstance(instance, map[string]interface{}{"ContainerId": containerId}); err != nil {
+		// The instance can't be stopped later without its container, so it is
+		// cleaned up right away.
+		if e := cr.StopAndRemoveContainer(containerId); e != nil {
+			log.Errorf("Error while removing instance container %s : %s", containerId, e)
+		}
+
+		removeInstanceNetwork(instance)
+		database.DeleteInstanceEntry(instance)
+		return nil, fmt.Errorf("error while saving containerId of the instance: %s", err)
+	}
+
+	log.Infof("Started instance %d of challenge %s for %s on port %d", instance.ID, challenge.Name, user.Username, instance.Port)
+
+	return instance, nil
+}
+
+// removeInstanceNetwork removes the network of the instance, the container of the
+// instance must be removed before.
+func removeInstanceNetwork(instance *database.Instance) {
+	network := coreUtils.InstanceNetworkName(instance.ID)
+	if err := cr.RemoveNetwork(network); err != nil {
+		log.Errorf("Error while removing network of instance %d : %s", instance.ID, err)
+	}
+}
+
+// ExtendInstance extends the expiry of the instance by the extension time configured
+// for the instances, an instance can be extended only a limited number of times.
+func ExtendInstance(instance *database.Instance) error {
+	instancesConfig := cfg.Cfg.Instances
+	if instancesConfig.MaxExtensions < 0 {
+		return ErrExtensionDisabled
+	}
+
+	if instance.Extensions >= uint(instancesConfig.MaxExtensions) {
+		return ErrExtensionLimit
+	}
+
+	expiresAt := instance.ExpiresAt.Add(instancesConfig.ExtensionDuration)
+	err := database.UpdateInstance(instance, map[string]interface{}{
+		"ExpiresAt":  expiresAt,
+		"Extensions": instance.Extensions + 1,
+	})
+	if err != nil {
+		return fmt.Errorf("error while extending instance: %s", err)
+	}
+
+	instance.ExpiresAt = expiresAt
+	instance.Extensions++
+
+	return nil
+}
+
+// StopInstance removes the container of the instance and frees the port allocated to it.
+func StopInstance(instance *database.Instance) error {
+	if coreUtils.IsContainerIdValid(instance.ContainerId) {
+		// The instance is removed if the container does not exist anymore, else
+		// the port is kept until the container holding it is removed.
+		if err := cr.StopAndRemoveContainer(instance.ContainerId); err != nil {
+			containers, e := cr.SearchContainerByFilter(map[string]string{"id": instance.ContainerId})
+			if e != nil || len(containers) > 0 {
+				return fmt.Errorf("error while removing container of instance %d: %s", instance.ID, err)
+			}
+		}
+	}
+
+	removeInstanceNetwork(instance)
+
+	if err := database.DeleteInstanceEntry(instance); err != nil {
+		return fmt.Errorf("error while deleting instance: %s", err)
+	}
+
+	log.Infof("Stopped instance %d of challenge %d", instance.ID, instance.ChallengeID)
+
+	return nil
+}
+
+// StopChallengeInstances stops all the running instances of the challenge.
+func StopChallengeInstances(challengeID uint) error {
+	instances, err := database.QueryInstances(map[string]interface{}{
+		"challenge_id": challengeID,
+	})
+	if err != nil {
+		return fmt.Errorf("error while querying instances: %s", err)
+	}
+
+	for i := range instances {
+		if err := StopInstance(&instances[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CleanupExpiredInstances stops all the instances which have expired, this is
+// run periodically by the scheduler.
+func CleanupExpiredInstances() {
+	instances, err := database.QueryExpiredInstances(time.Now())
+	if err != nil {
+		log.Errorf("Error while querying expired instances : %s", err)
+		return
+	}
+
+	for i := range instances {
+		if err := StopInstance(&instances[i]); err != nil {
+			log.Errorf("Error while stopping expired instance %d : %s", instances[i].ID, err)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package manager
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -11,6 +13,7 @@ import (
 	"github.com/sdslabs/beastv4/core/database"
 	coreUtils "github.com/sdslabs/beastv4/core/utils"
 	"github.com/sdslabs/beastv4/pkg/cr"
+	"github.com/sdslabs/beastv4/pkg/git"
 	"github.com/sdslabs/beastv4/pkg/notify"
 	"github.com/sdslabs/beastv4/utils"
 
@@ -93,6 +96,10 @@ func stageChallenge(challengeDir string, config *cfg.BeastChallengeConfig) error
 		return err
 	}
 
+	if err = stageChallengeServices(contextDir, config); err != nil {
+		return err
+	}
+
 	log.Debugf("Copying challenge config to staging directory")
 	err = utils.CopyFile(challengeConfig, filepath.Join(stagingDir, core.CHALLENGE_CONFIG_FILE_NAME))
 	if err != nil {
@@ -103,12 +110,15 @@ func stageChallenge(challengeDir string, config *cfg.BeastChallengeConfig) error
 	return nil
 }
 
-// Commit the challenge as a docker image removing the previously existing image
-// This first checks if there is an existing image for the challenge that exist
-// if it exists then first the new image is created and then the old image is removed.
+// Commit the challenge as a docker image. The previous image is kept in the image
+// history of the challenge so that the challenge can be rolled back to it.
 //
 // stagedPath is the complete path to the tar file for the challenge in the staging dir
-func commitChallenge(challenge *database.Challenge, config cfg.BeastChallengeConfig, stagedPath string, noCache bool) error {
+// and commit is the git commit the challenge is built from, the new image is recorded
+// in the image history with it.
+//
+// The output of the image build is also written to buildLog.
+func commitChallenge(challenge *database.Challenge, config cfg.BeastChallengeConfig, stagedPath, commit string, noCache bool, buildLog io.Writer) error {
 	challengeName := config.Challenge.Metadata.Name
 	challengeStagingDir := filepath.Dir(stagedPath)
 
@@ -118,14 +128,11 @@ func commitChallenge(challenge *database.Challenge, config cfg.BeastChallengeCon
 		return err
 	}
 
-	err = coreUtils.CleanupChallengeIfExist(config)
-	if err != nil {
-		log.Errorf("Error while cleaning up the challenge")
-		return err
-	}
-
 	challengeTag := coreUtils.EncodeID(challengeName)
 	buff, imageId, buildErr := cr.BuildImageFromTarContext(challengeName, challengeTag, stagedPath, config.Challenge.Env.DockerCtx, noCache)
+	if buff != nil {
+		buildLog.Write(buff.Bytes())
+	}
 
 	// Create logs directory for the challenge in staging directory.
 	challengeStagingLogsDir := filepath.Join(challengeStagingDir, core.BEAST_CHALLENGE_LOGS_DIR)
@@ -161,6 +168,14 @@ func commitChallenge(challenge *database.Challenge, config cfg.BeastChallengeCon
 
 	log.Infof("Image build for `%s` done", challengeName)
 
+	if err = recordChallengeImage(challengeName, imageId, commit); err != nil {
+		log.Errorf("Error while recording image history of %s : %s", challengeName, err)
+	}
+
+	if err = commitChallengeServices(&config, noCache, buildLog); err != nil {
+		return err
+	}
+
 	if config.Challenge.Metadata.Sidecar != "" {
 		// Need to configure the sidecar container, so we can use the configuration
 		// during deployment. We don't want sidecar configuration to change each time we
@@ -175,16 +190,9 @@ func commitChallenge(challenge *database.Challenge, config cfg.BeastChallengeCon
 	return nil
 }
 
-// Deploy the challenge as a docker container from the image built
-// This function first collects the environment variables and
-// container config including ports, networks, resource limitations needed to spawn the container,
-// then it creates the container and finally the challenge is deployed
-//
-// This function assumes that you have validated the configuration beforehand, so it won't be
-// validated here.
-func deployChallenge(challenge *database.Challenge, config cfg.BeastChallengeConfig) error {
-	log.Debug("Starting to deploy the challenge")
-
+// challengeContainerConfig returns the config of the container of the challenge including
+// the ports, mounts, environment and resource limits from the challenge config.
+func challengeContainerConfig(challenge *database.Challenge, config cfg.BeastChallengeConfig) (cr.CreateContainerConfig, error) {
 	staticMount := make(map[string]string)
 	staticMountDir := filepath.Join(core.BEAST_GLOBAL_DIR, core.BEAST_STAGING_DIR, config.Challenge.Metadata.Name, core.BEAST_STATIC_FOLDER)
 	relativeStaticContentDir := config.Challenge.Env.StaticContentDir
@@ -202,7 +210,19 @@ func deployChallenge(challenge *database.Challenge, config cfg.BeastChallengeCon
 		env := getSidecarEnv(&config)
 		containerEnv = append(containerEnv, env...)
 
-		containerNetwork = getSidecarNetwork(config.Challenge.Metadata.Sidecar)
+		// With restricted egress the sidecar is reached through the egress proxy,
+		// as the network of the sidecar is not internal.
+		if !config.Challenge.Env.Egress.Restricted() {
+			containerNetwork = getSidecarNetwork(config.Challenge.Metadata.Sidecar)
+		}
+	}
+
+	// Every challenge runs in its own network shared with its services, with a
+	// sidecar it is connected to the network once it is created.
+	var networkAliases []string
+	if containerNetwork == "" {
+		containerNetwork = coreUtils.ChallengeNetworkName(config.Challenge.Metadata.Name)
+		networkAliases = []string{core.CHALLENGE_NETWORK_ALIAS}
 	}
 
 	for _, env := range config.Challenge.Env.EnvironmentVars {
@@ -218,10 +238,20 @@ func deployChallenge(challenge *database.Challenge, config cfg.BeastChallengeCon
 	// unlikely to fail.
 	portMapping, err := config.Challenge.Env.GetPortMappings()
 	if err != nil {
-		return fmt.Errorf("Error while parsing port mapping for the challenge %s: %s", config.Challenge.Metadata.Name, err)
+		return cr.CreateContainerConfig{}, fmt.Errorf("Error while parsing port mapping for the challenge %s: %s", config.Challenge.Metadata.Name, err)
+	}
+
+	// With restricted egress the network of the challenge is internal, so the ports
+	// are only exposed in the network and are published by the egress proxy.
+	var internalPorts []uint32
+	if config.Challenge.Env.Egress.Restricted() {
+		for _, mapping := range portMapping {
+			internalPorts = append(internalPorts, mapping.ContainerPort)
+		}
+		portMapping = nil
 	}
 
-	containerConfig := cr.CreateContainerConfig{
+	return cr.CreateContainerConfig{
 		PortMapping:      portMapping,
 		MountsMap:        staticMount,
 		ImageId:          challenge.ImageId,
@@ -232,10 +262,61 @@ func deployChallenge(challenge *database.Challenge, config cfg.BeastChallengeCon
 		CPUShares:        config.Resources.CPUShares,
 		Memory:           config.Resources.Memory,
 		PidsLimit:        config.Resources.PidsLimit,
+		InternalPorts:    internalPorts,
+		NetworkAliases:   networkAliases,
+	}, nil
+}
+
+// Deploy the challenge as a docker container from the image built
+// This function first collects the environment variables and
+// container config including ports, networks, resource limitations needed to spawn the container,
+// then it creates the container and finally the challenge is deployed
+//
+// This function assumes that you have validated the configuration beforehand, so it won't be
+// validated here.
+func deployChallenge(challenge *database.Challenge, config cfg.BeastChallengeConfig) error {
+	log.Debug("Starting to deploy the challenge")
+
+	// Instanced challenges are not deployed as a shared container, the contestants
+	// start their own instances from the committed image.
+	if config.Challenge.Env.Instanced {
+		log.Infof("Challenge %s is instanced, skipping creation of the shared container", config.Challenge.Metadata.Name)
+		return nil
+	}
+
+	if err := loadAllocatedPorts(challenge, &config); err != nil {
+		return err
+	}
+
+	containerConfig, err := challengeContainerConfig(challenge, config)
+	if err != nil {
+		return err
 	}
+
+	network, err := createChallengeNetwork(&config)
+	if err != nil {
+		return err
+	}
+
+	// The services and the egress proxy are started first so that they are
+	// available to the challenge container once it starts.
+	if err = deployChallengeServices(&config, network); err != nil {
+		removeChallengeContainers(config.Challenge.Metadata.Name)
+		return err
+	}
+
+	if config.Challenge.Env.Egress.Restricted() {
+		if err = deployEgressProxy(&config, network); err != nil {
+			removeChallengeContainers(config.Challenge.Metadata.Name)
+			return err
+		}
+	}
+
 	log.Debugf("create container config for challenge(%s): %v", config.Challenge.Metadata.Name, containerConfig)
 	containerId, err := cr.CreateContainerFromImage(&containerConfig)
 	if err != nil {
+		removeChallengeContainers(config.Challenge.Metadata.Name)
+
 		if containerId != "" {
 			if e := database.UpdateChallenge(challenge, map[string]interface{}{"ContainerId": containerId}); e != nil {
 				return fmt.Errorf("Error while starting container : %s and saving database : %s", err, e)
@@ -252,6 +333,12 @@ func deployChallenge(challenge *database.Challenge, config cfg.BeastChallengeCon
 		return fmt.Errorf("Error while saving containerId to database : %s", err)
 	}
 
+	if len(containerConfig.NetworkAliases) == 0 {
+		if err = cr.ConnectContainerToNetwork(containerId, network, []string{core.CHALLENGE_NETWORK_ALIAS}); err != nil {
+			return fmt.Errorf("Error while connecting the container to the network of the challenge : %s", err)
+		}
+	}
+
 	return nil
 }
 
@@ -278,7 +365,14 @@ func deployChallenge(challenge *database.Challenge, config cfg.BeastChallengeCon
 //
 // During the staging steup if any error occurs, then the state of the challenge
 // in the database is set to undeployed.
-func bootstrapDeployPipeline(challengeDir string, skipStage bool, skipCommit bool, noCache bool) error {
+//
+// Every run of the pipeline is recorded as a deployment of the challenge along with
+// the time spent in each stage, the build log and the error the run failed with.
+//
+// With blueGreen set the running container of the challenge is not removed before the
+// commit stage, instead the deploy stage switches to the new container only if it is
+// healthy. If the pipeline fails the old container keeps serving the challenge.
+func bootstrapDeployPipeline(challengeDir string, skipStage, skipCommit, noCache, blueGreen bool) (err error) {
 	log.Debug("Loading Beast config")
 
 	// If we are skipping commit step then we are automatically skipping
@@ -291,7 +385,7 @@ func bootstrapDeployPipeline(challengeDir string, skipStage bool, skipCommit boo
 	configFile := filepath.Join(challengeDir, core.CHALLENGE_CONFIG_FILE_NAME)
 
 	var config cfg.BeastChallengeConfig
-	_, err := toml.DecodeFile(configFile, &config)
+	_, err = toml.DecodeFile(configFile, &config)
 	if err != nil {
 		log.Errorf("Error while loading beast config for challenge %s : %s", challengeName, err)
 		return fmt.Errorf("CONFIG ERROR: %s : %s", challengeName, err)
@@ -314,6 +408,14 @@ func bootstrapDeployPipeline(challengeDir string, skipStage bool, skipCommit boo
 		return fmt.Errorf("CONFIG ERROR: %s : Inconsistent configuration name and challengeName", challengeName)
 	}
 
+	// The config being deployed may not allow the blue/green redeploy the running
+	// challenge was found eligible for, the challenge is then to be recreated.
+	if blueGreen {
+		if e := checkBlueGreenConfig(&config); e != nil {
+			return fmt.Errorf("%w: %s", errBlueGreenUnsupported, e)
+		}
+	}
+
 	challenge, err := database.QueryFirstChallengeEntry("name", config.Challenge.Metadata.Name)
 	if err != nil {
 		log.Errorf("Error while querying challenge %s : %s", config.Challenge.Metadata.Name, err)
@@ -344,6 +446,7 @@ func bootstrapDeployPipeline(challengeDir string, skipStage bool, skipCommit boo
 	// deploying
 	if challenge.Status != core.DEPLOY_STATUS["undeployed"] &&
 		challenge.Status != core.DEPLOY_STATUS["deployed"] &&
+		challenge.Status != core.DEPLOY_STATUS["crashlooping"] &&
 		challenge.Status != core.DEPLOY_STATUS["queued"] &&
 		challenge.Status != "" {
 		log.Errorf("Deploy for %s already in progress, wait and check for the status(cur: %s)", challengeName, challenge.Status)
@@ -352,11 +455,36 @@ func bootstrapDeployPipeline(challengeDir string, skipStage bool, skipCommit boo
 
 	log.Debugf("Starting deploy pipeline for challenge %s", challengeName)
 
+	var buildLog bytes.Buffer
+	commit, err := git.GetHeadCommit(challengeDir)
+	if err != nil {
+		log.Debugf("No git commit found for the deployment of %s : %s", challengeName, err)
+	}
+
+	run := startDeployment(&challenge, commit)
+	defer func() {
+		run.finish(buildLog.String(), err)
+	}()
+
+	if blueGreen {
+		previousImageId := challenge.ImageId
+		defer func() {
+			if err != nil {
+				// The previous container is still serving the challenge.
+				database.UpdateChallenge(&challenge, map[string]interface{}{
+					"Status":  core.DEPLOY_STATUS["deployed"],
+					"ImageId": previousImageId,
+				})
+			}
+		}()
+	}
+
 	stagingDir := filepath.Join(core.BEAST_GLOBAL_DIR, core.BEAST_STAGING_DIR, challengeName)
 	stagedChallengePath := filepath.Join(stagingDir, fmt.Sprintf("%s.tar.gz", challengeName))
 
 	if !skipStage {
 		database.UpdateChallenge(&challenge, map[string]interface{}{"Status": core.DEPLOY_STATUS["staging"]})
+		run.startStage("staging")
 
 		err = stageChallenge(challengeDir, &config)
 		if err != nil {
@@ -385,8 +513,18 @@ func bootstrapDeployPipeline(challengeDir string, skipStage bool, skipCommit boo
 
 	if !skipCommit {
 		database.UpdateChallenge(&challenge, map[string]interface{}{"Status": core.DEPLOY_STATUS["committing"]})
+		run.startStage("committing")
+
+		if !blueGreen {
+			err = coreUtils.CleanupChallengeContainers(&challenge, config)
+			if err != nil {
+				log.Errorf("Error while cleaning up the challenge")
+				database.UpdateChallenge(&challenge, map[string]interface{}{"Status": core.DEPLOY_STATUS["undeployed"]})
+				return fmt.Errorf("COMMIT ERROR: %s : %s", challengeName, err)
+			}
+		}
 
-		err = commitChallenge(&challenge, config, stagedChallengePath, noCache)
+		err = commitChallenge(&challenge, config, stagedChallengePath, commit, noCache, &buildLog)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"DEPLOY_ERROR": "COMMIT :: " + challengeName,
@@ -404,8 +542,13 @@ func bootstrapDeployPipeline(challengeDir string, skipStage bool, skipCommit boo
 	}
 
 	database.UpdateChallenge(&challenge, map[string]interface{}{"Status": core.DEPLOY_STATUS["deploying"]})
+	run.startStage("deploying")
 
-	err = deployChallenge(&challenge, config)
+	if blueGreen {
+		err = switchChallengeContainer(&challenge, config, run)
+	} else {
+		err = deployChallenge(&challenge, config)
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"DEPLOY_ERROR": "DEPLOY :: " + challengeName,
@@ -429,7 +572,7 @@ func StartDeployPipeline(challengeDir string, skipStage bool, skipCommit bool, n
 	challengeName := filepath.Base(challengeDir)
 	var sendNotificationError error
 
-	err := bootstrapDeployPipeline(challengeDir, skipStage, skipCommit, noCache)
+	err := bootstrapDeployPipeline(challengeDir, skipStage, skipCommit, noCache, false)
 	if err != nil {
 		sendNotificationError = notify.SendNotification(notify.Error, err.Error())
 	} else {
@@ -0,0 +1,225 @@
+package manager
+
+import (
+	"fmt"
+
+	cfg "github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/pkg/cr"
+)
+
+// challengePortRequests returns the host ports to reserve for the challenge and
+// its services, a port with Auto set is to be allocated by beast.
+func challengePortRequests(config *cfg.BeastChallengeConfig) ([]database.Port, error) {
+	var ports []database.Port
+
+	// The host ports allocated earlier are not considered, every port without
+	// a host port in the configuration is requested to be allocated.
+	env := config.Challenge.Env
+	env.HostPorts = nil
+	mappings, err := env.GetPortMappings()
+	if err != nil {
+		return nil, err
+	}
+	ports = appendPortRequests(ports, "", mappings)
+
+	for _, service := range config.Challenge.Services {
+		service.HostPorts = nil
+		mappings, err := service.GetPortMappings()
+		if err != nil {
+			return nil, err
+		}
+		ports = appendPortRequests(ports, service.Name, mappings)
+	}
+
+	return ports, nil
+}
+
+func appendPortRequests(ports []database.Port, service string, mappings []cr.PortMapping) []database.Port {
+	for _, mapping := range mappings {
+		ports = append(ports, database.Port{
+			PortNo:        mapping.HostPort,
+			ContainerPort: mapping.ContainerPort,
+			Service:       service,
+			Auto:          mapping.HostPort == 0,
+		})
+	}
+
+	return ports
+}
+
+// loadAllocatedPorts sets the host ports allocated to the challenge and its services
+// in the configuration, so the port mappings of the configuration contain them. An
+// error is returned if a port to be allocated has not been allocated, which happens
+// if the ports of the challenge changed since it was last deployed.
+func loadAllocatedPorts(challenge *database.Challenge, config *cfg.BeastChallengeConfig) error {
+	ports, err := database.GetAllocatedPorts(*challenge)
+	if err != nil {
+		return err
+	}
+
+	allocated := make(map[string]map[uint32]uint32)
+	for _, port := range ports {
+		if !port.Auto {
+			continue
+		}
+
+		if allocated[port.Service] == nil {
+			allocated[port.Service] = make(map[uint32]uint32)
+		}
+		allocated[port.Service][port.ContainerPort] = port.PortNo
+	}
+
+	config.Challenge.Env.HostPorts = allocated[""]
+	if err = checkAllocatedPorts(config.Challenge.Env.GetPortMappings()); err != nil {
+		return fmt.Errorf("%s of challenge %s", err, config.Challenge.Metadata.Name)
+	}
+
+	for i := range config.Challenge.Services {
+		service := &config.Challenge.Services[i]
+		service.HostPorts = allocated[service.Name]
+		if err = checkAllocatedPorts(service.GetPortMappings()); err != nil {
+			return fmt.Errorf("%s of service %s", err, service.Name)
+		}
+	}
+
+	return nil
+}
+
+func checkAllocatedPorts(mappings []cr.PortMapping, err error) error {
+	if err != nil {
+		return err
+	}
+
+	for _, mapping := range mappings {
+		if mapping.HostPort == 0 {
+			return fmt.Errorf("no host port is allocated for the port %d", mapping.ContainerPort)
+		}
+	}
+
+	return nil
+}
+
+// UpdateChallengeHostPorts replaces the host ports of the challenge set explicitly with
+// the ports, the ports allocated by beast are kept. The ports must be within the port
+// range of the challenges and must not be used by another challenge or an instance.
+func UpdateChallengeHostPorts(challenge *database.Challenge, hostPorts []uint32) error {
+	existing, err := database.GetAllocatedPorts(*challenge)
+	if err != nil {
+		return err
+	}
+
+	var requests []database.Port
+	explicit := make(map[uint32]database.Port)
+	for _, port := range existing {
+		if port.Auto {
+			requests = append(requests, database.Port{
+				ContainerPort: port.ContainerPort,
+				Service:       port.Service,
+				Auto:          true,
+			})
+		} else {
+			explicit[port.PortNo] = port
+		}
+	}
+
+	requested := make(map[uint32]bool)
+	for _, hostPort := range hostPorts {
+		if hostPort < cfg.Cfg.MinPort || hostPort > cfg.Cfg.MaxPort {
+			return fmt.Errorf("port %d is not in the range %d-%d", hostPort, cfg.Cfg.MinPort, cfg.Cfg.MaxPort)
+		}
+
+		if requested[hostPort] {
+			continue
+		}
+		requested[hostPort] = true
+
+		// The container port and the service of a port already in use by the
+		// challenge are kept.
+		requests = append(requests, database.Port{
+			PortNo:        hostPort,
+			ContainerPort: explicit[hostPort].ContainerPort,
+			Service:       explicit[hostPort].Service,
+		})
+	}
+
+	_, err = database.AllocateChallengePorts(challenge.ID, requests, cfg.Cfg.MinPort, cfg.Cfg.MaxPort)
+	return err
+}
+
+// temporaryPortService is the service the temporary host ports of a challenge are
+// allocated for, it is not a valid service name so it can't clash with a service.
+const temporaryPortService = "_temporary"
+
+// keptPortRequests returns the requests keeping the host ports currently allocated
+// to the challenge, except the temporary ports.
+func keptPortRequests(challenge *database.Challenge) ([]database.Port, error) {
+	existing, err := database.GetAllocatedPorts(*challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []database.Port
+	for _, port := range existing {
+		if port.Service == temporaryPortService {
+			continue
+		}
+
+		requests = append(requests, database.Port{
+			PortNo:        port.PortNo,
+			ContainerPort: port.ContainerPort,
+			Service:       port.Service,
+			Auto:          port.Auto,
+		})
+	}
+
+	return requests, nil
+}
+
+// allocateTemporaryPorts allocates a free host port from the port range of the challenges
+// for each of the port mappings and returns the mappings with the allocated host ports.
+// The ports stay allocated to the challenge until releaseTemporaryPorts is called.
+func allocateTemporaryPorts(challenge *database.Challenge, mappings []cr.PortMapping) ([]cr.PortMapping, error) {
+	requests, err := keptPortRequests(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mapping := range mappings {
+		requests = append(requests, database.Port{
+			ContainerPort: mapping.ContainerPort,
+			Service:       temporaryPortService,
+			Auto:          true,
+		})
+	}
+
+	ports, err := database.AllocateChallengePorts(challenge.ID, requests, cfg.Cfg.MinPort, cfg.Cfg.MaxPort)
+	if err != nil {
+		return nil, err
+	}
+
+	hostPorts := make(map[uint32]uint32)
+	for _, port := range ports {
+		if port.Service == temporaryPortService {
+			hostPorts[port.ContainerPort] = port.PortNo
+		}
+	}
+
+	temporary := make([]cr.PortMapping, len(mappings))
+	for i, mapping := range mappings {
+		temporary[i] = cr.PortMapping{HostPort: hostPorts[mapping.ContainerPort], ContainerPort: mapping.ContainerPort}
+	}
+
+	return temporary, nil
+}
+
+// releaseTemporaryPorts frees the temporary host ports allocated to the challenge.
+func releaseTemporaryPorts(challenge *database.Challenge) error {
+	requests, err := keptPortRequests(challenge)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.AllocateChallengePorts(challenge.ID, requests, cfg.Cfg.MinPort, cfg.Cfg.MaxPort)
+	return err
+}
@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/cr"
+	wpool "github.com/sdslabs/beastv4/pkg/workerpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// Serializes the pushes to the queue with the entries of the queued tasks in the
+// database, so that every task in the queue has an entry.
+var queueMux sync.Mutex
+
+// InitQueue creates the queue of the tasks and starts the workers performing them.
+func InitQueue(completionChannel chan bool) {
+	Q = wpool.InitQueue(config.Cfg.Queue.MaxSize, completionChannel)
+	Q.StartWorkers(&Worker{}, config.Cfg.Queue.Workers)
+}
+
+// pushTask pushes the task to the queue, with an entry for it in the database.
+func pushTask(task wpool.Task) error {
+	queueMux.Lock()
+	defer queueMux.Unlock()
+
+	if Q.IsQueued(task.ID) {
+		return fmt.Errorf("The Task ID : %s is already in queue", task.ID)
+	}
+
+	if err := saveQueuedTask(task); err != nil {
+		log.Errorf("Error while saving queued task of %s : %s", task.ID, err)
+		return fmt.Errorf("DATABASE ERROR")
+	}
+
+	if err := Q.Push(task); err != nil {
+		if e := database.DeleteQueuedTask(task.ID); e != nil {
+			log.Errorf("Error while deleting queued task of %s : %s", task.ID, e)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// saveQueuedTask creates the entry of the task in the database.
+func saveQueuedTask(task wpool.Task) error {
+	info := task.Info.(TaskInfo)
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return database.SaveQueuedTask(&database.QueuedTask{
+		ChallengeName: task.ID,
+		Action:        info.Action,
+		Info:          string(encoded),
+		Priority:      task.Priority,
+	})
+}
+
+// ResumeQueuedTasks pushes the tasks which were in the queue when beast stopped back
+// to the queue, tasks which were being performed are performed again from the start.
+// Challenges left queued without a task are marked as undeployed.
+func ResumeQueuedTasks() {
+	tasks, err := database.QueryQueuedTasks()
+	if err != nil {
+		log.Errorf("Error while querying queued tasks : %s", err)
+		return
+	}
+
+	resumed := make(map[string]bool)
+	for _, task := range tasks {
+		var info TaskInfo
+		if err = json.Unmarshal([]byte(task.Info), &info); err != nil {
+			log.Errorf("Error while decoding queued task of %s : %s", task.ChallengeName, err)
+			database.DeleteQueuedTask(task.ChallengeName)
+			continue
+		}
+
+		// The pipeline is started again only for a challenge in the queued status.
+		if chall, e := database.QueryFirstChallengeEntry("name", task.ChallengeName); e == nil && chall.Name != "" {
+			database.UpdateChallenge(&chall, map[string]interface{}{"Status": core.DEPLOY_STATUS["queued"]})
+		}
+		database.UpdateQueuedTask(task.ChallengeName, map[string]interface{}{"StartedAt": nil})
+
+		err = Q.Push(wpool.Task{
+			ID:       task.ChallengeName,
+			Info:     info,
+			Priority: task.Priority,
+		})
+		if err != nil {
+			log.Errorf("Error while resuming %s of %s : %s", info.Action, task.ChallengeName, err)
+			database.DeleteQueuedTask(task.ChallengeName)
+			continue
+		}
+
+		resumed[task.ChallengeName] = true
+		log.Infof("Resumed queued %s of %s", info.Action, task.ChallengeName)
+	}
+
+	challenges, err := database.QueryChallengeEntries("status", core.DEPLOY_STATUS["queued"])
+	if err != nil {
+		log.Errorf("Error while querying queued challenges : %s", err)
+		return
+	}
+
+	for _, chall := range challenges {
+		if !resumed[chall.Name] {
+			log.Warnf("Challenge %s is queued without a task, marking it as %s", chall.Name, unqueuedStatus(&chall))
+			database.UpdateChallenge(&chall, map[string]interface{}{"Status": unqueuedStatus(&chall)})
+		}
+	}
+}
+
+// unqueuedStatus returns the status of the queued challenge once it is no longer
+// in the queue, which is deployed only if its container is running.
+func unqueuedStatus(challenge *database.Challenge) string {
+	if coreUtils.IsContainerIdValid(challenge.ContainerId) {
+		if running, err := cr.IsContainerRunning(challenge.ContainerId); err == nil && running {
+			return core.DEPLOY_STATUS["deployed"]
+		}
+	}
+
+	return core.DEPLOY_STATUS["undeployed"]
+}
+
+// CancelQueuedTask removes the pending task of the challenge from the queue, the
+// challenge gets back the status it had before the task was queued.
+func CancelQueuedTask(challengeName string) error {
+	queueMux.Lock()
+	defer queueMux.Unlock()
+
+	task, err := Q.Cancel(challengeName)
+	if err != nil {
+		return err
+	}
+
+	if err = database.DeleteQueuedTask(challengeName); err != nil {
+		log.Errorf("Error while deleting queued task of %s : %s", challengeName, err)
+	}
+
+	chall, err := database.QueryFirstChallengeEntry("name", challengeName)
+	if err != nil {
+		return fmt.Errorf("DATABASE ERROR")
+	}
+
+	if chall.Name != "" && chall.Status == core.DEPLOY_STATUS["queued"] {
+		database.UpdateChallenge(&chall, map[string]interface{}{"Status": unqueuedStatus(&chall)})
+	}
+
+	log.Infof("Cancelled queued %s of %s", task.Info.(TaskInfo).Action, challengeName)
+	return nil
+}
+
+// SetTaskPriority changes the priority of the pending task of the challenge.
+func SetTaskPriority(challengeName string, priority int) error {
+	queueMux.Lock()
+	defer queueMux.Unlock()
+
+	if err := Q.SetPriority(challengeName, priority); err != nil {
+		return err
+	}
+
+	return database.UpdateQueuedTask(challengeName, map[string]interface{}{"Priority": priority})
+}
+
+// QueueState returns the pending tasks, in the order they will be performed, and the
+// tasks being performed.
+func QueueState() (pending []wpool.TaskState, running []wpool.TaskState) {
+	return Q.Pending(), Q.Running()
+}
+
+// PerformTask performs the task and keeps the entry of the task in the database
+// in sync, the entry is deleted once the task is done or replaced by the entry of
+// the next task of the challenge.
+func (worker *Worker) PerformTask(w wpool.Task) *wpool.Task {
+	if err := database.UpdateQueuedTask(w.ID, map[string]interface{}{"StartedAt": time.Now()}); err != nil {
+		log.Errorf("Error while updating queued task of %s : %s", w.ID, err)
+	}
+
+	next := performTask(w)
+
+	if next != nil {
+		if err := saveQueuedTask(*next); err != nil {
+			log.Errorf("Error while saving queued task of %s : %s", next.ID, err)
+		}
+	} else if err := database.DeleteQueuedTask(w.ID); err != nil {
+		log.Errorf("Error while deleting queued task of %s : %s", w.ID, err)
+	}
+
+	return next
+}
@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"fmt"
+
+	cfg "github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+)
+
+// UpdateChallengeRequirements replaces the challenges required by the challenge
+// with the ones provided. All the required challenges must already have a database
+// entry, and the requirements must not create a cycle with the existing ones.
+func UpdateChallengeRequirements(challenge *database.Challenge, requires []string) error {
+	challenges, err := database.QueryAllChallenges()
+	if err != nil {
+		return fmt.Errorf("Error while querying challenges : %s", err)
+	}
+
+	names := make(map[uint]string, len(challenges))
+	byName := make(map[string]*database.Challenge, len(challenges))
+	for i := range challenges {
+		names[challenges[i].ID] = challenges[i].Name
+		byName[challenges[i].Name] = &challenges[i]
+	}
+
+	required := make([]*database.Challenge, len(requires))
+	for i, name := range requires {
+		entry, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("Required challenge %s for %s does not exist, deploy it first", name, challenge.Name)
+		}
+		required[i] = entry
+	}
+
+	requirements, err := database.QueryChallengeRequirements()
+	if err != nil {
+		return fmt.Errorf("Error while querying challenge requirements : %s", err)
+	}
+
+	graph := make(map[string][]string, len(requirements)+1)
+	for challengeID, requiredIDs := range requirements {
+		for _, requiredID := range requiredIDs {
+			graph[names[challengeID]] = append(graph[names[challengeID]], names[requiredID])
+		}
+	}
+	graph[challenge.Name] = requires
+
+	if err = cfg.ValidateRequirementGraph(graph); err != nil {
+		return err
+	}
+
+	return database.UpdateRequiredChallenges(challenge, required)
+}
+
+// LockedChallenges returns the set of the challenges which are locked for the user,
+// a challenge is locked until all the challenges it requires are solved by the user
+// or by their team.
+func LockedChallenges(user *database.User) (map[uint]bool, error) {
+	requirements, err := database.QueryChallengeRequirements()
+	if err != nil {
+		return nil, err
+	}
+
+	locked := make(map[uint]bool)
+	if len(requirements) == 0 {
+		return locked, nil
+	}
+
+	var solves []database.UserChallenges
+	if user.TeamID != 0 {
+		solves, err = database.QueryTeamSubmissions(user.TeamID)
+	} else {
+		solves, err = database.QuerySubmissions(map[string]interface{}{
+			"user_id": user.ID,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	solved := make(map[uint]bool, len(solves))
+	for _, solve := range solves {
+		solved[solve.ChallengeID] = true
+	}
+
+	for challengeID, requiredIDs := range requirements {
+		for _, requiredID := range requiredIDs {
+			if !solved[requiredID] {
+				locked[challengeID] = true
+				break
+			}
+		}
+	}
+
+	return locked, nil
+}
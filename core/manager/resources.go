@@ -0,0 +1,139 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	cfg "github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/cr"
+	"github.com/sdslabs/beastv4/pkg/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// resourceAlert keeps the time since which a challenge has been above the threshold
+// of its memory and pids limits, and whether a notification has been sent for it.
+type resourceAlert struct {
+	memorySince    time.Time
+	memoryNotified bool
+	pidsSince      time.Time
+	pidsNotified   bool
+}
+
+var (
+	resourceCollector = cr.NewStatsCollector()
+	resourceAlerts    = make(map[string]*resourceAlert)
+
+	// Serializes the collections so that the alerts are updated in order.
+	resourcesMux sync.Mutex
+)
+
+// deployedChallengeContainers returns the containers of the deployed challenges by
+// the name of the challenge.
+func deployedChallengeContainers() (map[string]string, error) {
+	challenges, err := database.QueryChallengeEntriesMap(map[string]interface{}{
+		"Status": []string{core.DEPLOY_STATUS["deployed"], core.DEPLOY_STATUS["crashlooping"]},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make(map[string]string)
+	for _, challenge := range challenges {
+		if challenge.Format == core.STATIC_CHALLENGE_TYPE_NAME || challenge.Instanced {
+			continue
+		}
+
+		if coreUtils.IsContainerIdValid(challenge.ContainerId) {
+			containers[challenge.Name] = challenge.ContainerId
+		}
+	}
+
+	return containers, nil
+}
+
+// CollectChallengeResources samples the resources used by the containers of all the
+// deployed challenges and warns about the challenges which stay close to their memory
+// or pids limit.
+func CollectChallengeResources() {
+	resourcesMux.Lock()
+	defer resourcesMux.Unlock()
+
+	containers, err := deployedChallengeContainers()
+	if err != nil {
+		log.Errorf("Error while querying challenges for resource monitoring : %s", err)
+		return
+	}
+
+	samples := resourceCollector.Collect(containers)
+	log.Debugf("Sampled resources of %d challenges", len(samples))
+
+	now := time.Now()
+	for name := range resourceAlerts {
+		if _, ok := samples[name]; !ok {
+			delete(resourceAlerts, name)
+		}
+	}
+
+	for name, stats := range samples {
+		alert, ok := resourceAlerts[name]
+		if !ok {
+			alert = &resourceAlert{}
+			resourceAlerts[name] = alert
+		}
+
+		checkResourceLimit(name, "memory", stats.MemoryPercent(), now, &alert.memorySince, &alert.memoryNotified)
+		checkResourceLimit(name, "pids", stats.PidsPercent(), now, &alert.pidsSince, &alert.pidsNotified)
+	}
+}
+
+// checkResourceLimit sends a warning notification once the usage of the resource by
+// the challenge, as a percentage of its limit, stays above the threshold for the alert
+// duration. The alert is reset once the usage falls below the threshold.
+func checkResourceLimit(challengeName, resource string, percent float64, now time.Time, since *time.Time, notified *bool) {
+	if percent < cfg.Cfg.ResourceMonitor.Threshold {
+		*since, *notified = time.Time{}, false
+		return
+	}
+
+	if since.IsZero() {
+		*since = now
+	}
+
+	if *notified || now.Sub(*since) < cfg.Cfg.ResourceMonitor.AlertAfterDuration {
+		return
+	}
+
+	msg := fmt.Sprintf("RESOURCES WARNING : %s : %s usage at %.1f%% of the limit for %s",
+		challengeName, resource, percent, now.Sub(*since).Round(time.Second))
+	log.Warn(msg)
+	notify.SendNotification(notify.Warning, msg)
+	*notified = true
+}
+
+// ChallengeResources returns the latest sample of the resources used by each deployed
+// challenge by the name of the challenge, the challenges are sampled if they have not
+// been sampled yet.
+func ChallengeResources() map[string]cr.ContainerStats {
+	latest := resourceCollector.Latest()
+	if len(latest) > 0 {
+		return latest
+	}
+
+	CollectChallengeResources()
+	return resourceCollector.Latest()
+}
+
+// SampleChallengeResources samples the resources used by each deployed challenge
+// without updating the alerts.
+func SampleChallengeResources() (map[string]cr.ContainerStats, error) {
+	containers, err := deployedChallengeContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	return cr.NewStatsCollector().Collect(containers), nil
+}
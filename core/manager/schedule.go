@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/pkg/scheduler"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateScheduledAction stores the action on the challenge, or on the challenges
+// with the tag, to be run once at the time, or at the times matching the cron
+// expression if one is provided.
+func CreateScheduledAction(action, challenge, tag, username string, at time.Time, cron string) (*database.ScheduledAction, error) {
+	if _, ok := ChallengeActionHandlers[action]; !ok {
+		return nil, fmt.Errorf("Invalid Action : %s", action)
+	}
+
+	if challenge == "" && tag == "" {
+		return nil, fmt.Errorf("A challenge selector like name or tag is required")
+	}
+
+	if cron != "" {
+		expr, err := scheduler.ParseCron(cron)
+		if err != nil {
+			return nil, err
+		}
+		at = expr.Next(time.Now())
+	}
+
+	scheduled := &database.ScheduledAction{
+		Action:    action,
+		Challenge: challenge,
+		Tag:       tag,
+		Username:  username,
+		Cron:      cron,
+		NextRun:   at,
+	}
+	if err := database.CreateScheduledAction(scheduled); err != nil {
+		log.Errorf("Error while creating scheduled action : %s", err)
+		return nil, fmt.Errorf("DATABASE ERROR")
+	}
+
+	return scheduled, nil
+}
+
+// RunScheduledAction runs the scheduled action with the ID, it returns false if
+// the action no longer exists, like when it has been cancelled.
+func RunScheduledAction(id uint) bool {
+	scheduled, err := database.QueryScheduledActionById(id)
+	if err != nil {
+		log.Errorf("Error while querying scheduled action %d : %s", id, err)
+		return true
+	}
+
+	if scheduled == nil {
+		log.Infof("Scheduled action %d no longer exists, skipping", id)
+		return false
+	}
+
+	if scheduled.Tag != "" {
+		log.Infof("Running scheduled %s for challenges with tag %s", scheduled.Action, scheduled.Tag)
+		HandleTagRelatedChallenges(scheduled.Action, scheduled.Tag, scheduled.Username)
+	} else {
+		log.Infof("Running scheduled %s for challenge %s", scheduled.Action, scheduled.Challenge)
+		if err = ChallengeActionHandlers[scheduled.Action](scheduled.Challenge); err != nil {
+			log.Errorf("Error while running scheduled %s for challenge %s : %s", scheduled.Action, scheduled.Challenge, err)
+		}
+	}
+
+	if scheduled.Cron == "" {
+		if _, err = database.DeleteScheduledAction(id); err != nil {
+			log.Errorf("Error while deleting scheduled action %d : %s", id, err)
+		}
+		return true
+	}
+
+	now := time.Now()
+	update := map[string]interface{}{"LastRun": now}
+	if expr, e := scheduler.ParseCron(scheduled.Cron); e == nil {
+		update["NextRun"] = expr.Next(now)
+	}
+	if err = database.UpdateScheduledAction(id, update); err != nil {
+		log.Errorf("Error while updating scheduled action %d : %s", id, err)
+	}
+
+	return true
+}
+
+// CancelScheduledAction deletes the scheduled action with the ID.
+func CancelScheduledAction(id uint) error {
+	deleted, err := database.DeleteScheduledAction(id)
+	if err != nil {
+		log.Errorf("Error while deleting scheduled action %d : %s", id, err)
+		return fmt.Errorf("DATABASE ERROR")
+	}
+
+	if !deleted {
+		return fmt.Errorf("No scheduled action with ID %d", id)
+	}
+
+	return nil
+}
+
+// ListScheduledActions returns all the scheduled actions, the action which is to be
+// run first is returned first.
+func ListScheduledActions() ([]database.ScheduledAction, error) {
+	return database.QueryScheduledActions()
+}
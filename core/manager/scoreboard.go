@@ -0,0 +1,300 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/database"
+	"github.com/sdslabs/beastv4/pkg/scoring"
+)
+
+// ScoreboardEntry is a single ranked user or team on the scoreboard.
+type ScoreboardEntry struct {
+	Rank      uint
+	ID        uint
+	Name      string
+	Score     uint
+	Solves    uint
+	LastSolve time.Time
+
+	members map[uint]bool
+}
+
+// ScorePoint is the score of a scoreboard entry at a point of time.
+type ScorePoint struct {
+	Time  time.Time
+	Score uint
+}
+
+// ScoreSeries is the progression of the score of a scoreboard entry.
+type ScoreSeries struct {
+	ScoreboardEntry
+
+	Points []ScorePoint
+}
+
+// Scoreboard returns the ranked contestants, or teams if teams is true, as the
+// scoreboard was at the time. A zero time returns the live scoreboard.
+//
+// Entries with the same score are ranked by the time of their last solve, the
+// entry which reached the score first is ranked higher.
+func Scoreboard(ledger *ScoreLedger, teams bool, at time.Time) ([]ScoreboardEntry, error) {
+	users, err := database.QueryUserEntries("role", core.USER_ROLES["contestant"])
+	if err != nil {
+		return nil, fmt.Errorf("error while querying users: %s", err)
+	}
+
+	entries := make(map[uint]*ScoreboardEntry)
+	owners := make(map[uint]*ScoreboardEntry)
+
+	if teams {
+		allTeams, err := database.QueryAllTeams()
+		if err != nil {
+			return nil, fmt.Errorf("error while querying teams: %s", err)
+		}
+
+		for _, team := range allTeams {
+			entries[team.ID] = &ScoreboardEntry{
+				ID:      team.ID,
+				Name:    team.Name,
+				members: make(map[uint]bool),
+			}
+		}
+	}
+
+	for _, user := range users {
+		if user.Status == 1 {
+			continue
+		}
+
+		if !teams {
+			entries[user.ID] = &ScoreboardEntry{
+				ID:      user.ID,
+				Name:    user.Username,
+				members: map[uint]bool{user.ID: true},
+			}
+			owners[user.ID] = entries[user.ID]
+		} else if entry, ok := entries[user.TeamID]; ok && user.TeamID != 0 {
+			entry.members[user.ID] = true
+			owners[user.ID] = entry
+		}
+	}
+
+	for userID, score := range ledger.ScoresAt(at) {
+		if entry, ok := owners[userID]; ok {
+			entry.Score += score
+		}
+	}
+
+	for _, solve := range ledger.SolvePoints(at) {
+		if entry, ok := owners[solve.UserID]; ok {
+			entry.Solves++
+			if solve.CreatedAt.After(entry.LastSolve) {
+				entry.LastSolve = solve.CreatedAt
+			}
+		}
+	}
+
+	scoreboard := make([]ScoreboardEntry, 0, len(entries))
+	for _, entry := range entries {
+		scoreboard = append(scoreboard, *entry)
+	}
+
+	sort.Slice(scoreboard, func(i, j int) bool {
+		if scoreboard[i].Score != scoreboard[j].Score {
+			return scoreboard[i].Score > scoreboard[j].Score
+		}
+		if !scoreboard[i].LastSolve.Equal(scoreboard[j].LastSolve) {
+			if scoreboard[i].LastSolve.IsZero() || scoreboard[j].LastSolve.IsZero() {
+				return scoreboard[j].LastSolve.IsZero()
+			}
+			return scoreboard[i].LastSolve.Before(scoreboard[j].LastSolve)
+		}
+		return scoreboard[i].ID < scoreboard[j].ID
+	})
+
+	for index := range scoreboard {
+		scoreboard[index].Rank = uint(index) + 1
+	}
+
+	return scoreboard, nil
+}
+
+// ScoreboardGraph returns the score progression of the top entries of the scoreboard
+// at the time, a point is added to the series of an entry whenever its score changes.
+func ScoreboardGraph(ledger *ScoreLedger, teams bool, top int, at time.Time) ([]ScoreSeries, error) {
+	scoreboard, err := Scoreboard(ledger, teams, at)
+	if err != nil {
+		return nil, err
+	}
+
+	if top < len(scoreboard) {
+		scoreboard = scoreboard[:top]
+	}
+
+	series := make([]ScoreSeries, len(scoreboard))
+	for index := range scoreboard {
+		series[index].ScoreboardEntry = scoreboard[index]
+	}
+
+	// The points of a challenge can change with every solve depending on its
+	// scoring strategy, so the scores are evaluated after each solve, score
+	// adjustment and hint unlock. Only the scores of the members of the entries
+	// in the graph are tracked.
+	tracked := make(map[uint]bool)
+	for index := range series {
+		for member := range series[index].members {
+			tracked[member] = true
+		}
+	}
+
+	timeline := ledger.scoreTimeline(tracked, at)
+	for _, point := range timeline {
+		for index := range series {
+			var score uint
+			for member := range series[index].members {
+				if point.scores[member] > 0 {
+					score += uint(point.scores[member])
+				}
+			}
+
+			points := series[index].Points
+			if len(points) == 0 && score == 0 {
+				continue
+			}
+			if len(points) > 0 && points[len(points)-1].Score == score {
+				continue
+			}
+
+			series[index].Points = append(points, ScorePoint{Time: point.time, Score: score})
+		}
+	}
+
+	return series, nil
+}
+
+// timelinePoint is the time of an event along with the scores of the users after it.
+type timelinePoint struct {
+	time   time.Time
+	scores map[uint]int64
+}
+
+// trackedSolve is a solve of a tracked user along with the points currently
+// awarded for it.
+type trackedSolve struct {
+	userID   uint
+	rank     uint
+	solvedAt time.Time
+	points   uint
+}
+
+// timelineEvent is a solve, a score adjustment or a hint unlock. For a solve the index
+// of the challenge in the ledger and the rank of the solve are set, challenge is -1 for
+// the other events which change the score of the user by the points.
+type timelineEvent struct {
+	time      time.Time
+	userID    uint
+	challenge int
+	rank      uint
+	points    int64
+}
+
+// scoreTimeline returns the scores of the tracked users after every distinct time of
+// a solve, or of a score adjustment or hint unlock of a tracked user, made till the
+// time, a zero time considers everything. The events are replayed in a single
+// chronological pass, the points of the tracked solves of a challenge are updated
+// whenever the challenge is solved since they can depend on the number of solvers.
+// The scores returned are not clamped at zero.
+func (ledger *ScoreLedger) scoreTimeline(tracked map[uint]bool, at time.Time) []timelinePoint {
+	include := func(t time.Time) bool {
+		return at.IsZero() || !t.After(at)
+	}
+
+	var events []timelineEvent
+	for i := range ledger.challenges {
+		for index, solve := range ledger.challenges[i].solves {
+			if include(solve.CreatedAt) {
+				events = append(events, timelineEvent{
+					time:      solve.CreatedAt,
+					userID:    solve.UserID,
+					challenge: i,
+					rank:      uint(index) + 1,
+				})
+			}
+		}
+	}
+
+	for _, adjustment := range ledger.adjustments {
+		if tracked[adjustment.UserID] && include(adjustment.CreatedAt) {
+			events = append(events, timelineEvent{
+				time:      adjustment.CreatedAt,
+				userID:    adjustment.UserID,
+				challenge: -1,
+				points:    int64(adjustment.Points),
+			})
+		}
+	}
+
+	for _, unlock := range ledger.unlocks {
+		if tracked[unlock.UserID] && include(unlock.CreatedAt) {
+			events = append(events, timelineEvent{
+				time:      unlock.CreatedAt,
+				userID:    unlock.UserID,
+				challenge: -1,
+				points:    -int64(unlock.Cost),
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].time.Before(events[j].time)
+	})
+
+	scores := make(map[uint]int64)
+	solvers := make([]uint, len(ledger.challenges))
+	trackedSolves := make([][]trackedSolve, len(ledger.challenges))
+
+	var timeline []timelinePoint
+	for index, event := range events {
+		if event.challenge < 0 {
+			scores[event.userID] += event.points
+		} else {
+			challenge := &ledger.challenges[event.challenge]
+			solvers[event.challenge]++
+
+			if tracked[event.userID] {
+				trackedSolves[event.challenge] = append(trackedSolves[event.challenge], trackedSolve{
+					userID:   event.userID,
+					rank:     event.rank,
+					solvedAt: event.time,
+				})
+			}
+
+			for i := range trackedSolves[event.challenge] {
+				solve := &trackedSolves[event.challenge][i]
+				points := challenge.strategy.Points(scoring.Solve{
+					Rank:     solve.rank,
+					Solvers:  solvers[event.challenge],
+					SolvedAt: solve.solvedAt,
+				})
+				scores[solve.userID] += int64(points) - int64(solve.points)
+				solve.points = points
+			}
+		}
+
+		// The scores are recorded once all the events at the same time are replayed.
+		if index+1 < len(events) && events[index+1].time.Equal(event.time) {
+			continue
+		}
+
+		point := timelinePoint{time: event.time, scores: make(map[uint]int64, len(scores))}
+		for userID, score := range scores {
+			point.scores[userID] = score
+		}
+		timeline = append(timeline, point)
+	}
+
+	return timeline
+}
@@ -0,0 +1,601 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	"github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/scoring"
+	"github.com/sdslabs/beastv4/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scores stored for the users and teams are only a cache of the scores
+// derived from the solves, this serializes the rebuilding of the cache so
+// that a stale computation never overwrites a newer one.
+var scoresMux sync.Mutex
+
+// ScoreMismatch represents a user or team whose stored score differs from
+// the score derived from the solves.
+type ScoreMismatch struct {
+	Type     string
+	ID       uint
+	Name     string
+	Stored   uint
+	Computed uint
+}
+
+// ChallengeScoringStrategy returns the scoring strategy used by the challenge. Challenges
+// which do not specify a strategy use logarithmic decay if dynamic scoring is enabled
+// for the competition and static scoring otherwise.
+func ChallengeScoringStrategy(challenge *database.Challenge) (scoring.ScoringStrategy, error) {
+	strategy := challenge.ScoringStrategy
+	if strategy == "" {
+		log.Debugf("Dynamic scoring is set to %t", config.Cfg.CompetitionInfo.DynamicScore)
+		if config.Cfg.CompetitionInfo.DynamicScore {
+			strategy = scoring.LOGARITHMIC
+		} else {
+			strategy = scoring.STATIC
+		}
+	}
+
+	params := scoring.Params{
+		MaxPoints: challenge.MaxPoints,
+		MinPoints: challenge.MinPoints,
+		Decay:     challenge.ScoringDecay,
+	}
+	if params.MaxPoints == 0 {
+		params.MaxPoints = challenge.Points
+	}
+
+	bonus, err := utils.SplitUints(challenge.FirstBloodBonus, core.DELIMITER)
+	if err != nil {
+		return nil, err
+	}
+	params.FirstBloodBonus = bonus
+
+	if strategy == scoring.TIME_DECAY {
+		params.Start, err = coreUtils.GetCompetitionStartTime()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return scoring.NewStrategy(strategy, params)
+}
+
+// GetChallengeSolves returns the solves of the challenge ordered by the time of the solve.
+func GetChallengeSolves(challengeID uint) ([]database.UserChallenges, error) {
+	solves, err := database.QuerySubmissions(map[string]interface{}{
+		"challenge_id": challengeID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(solves, func(i, j int) bool {
+		return solves[i].CreatedAt.Before(solves[j].CreatedAt)
+	})
+
+	return solves, nil
+}
+
+// ScoreLedger contains everything the scores of the users are derived from, it is
+// used to compute the scores as they were at any point of time.
+type ScoreLedger struct {
+	challenges  []ledgerChallenge
+	adjustments []database.ScoreAdjustment
+	unlocks     []database.HintUnlock
+}
+
+type ledgerChallenge struct {
+	challenge database.Challenge
+	strategy  scoring.ScoringStrategy
+	solves    []database.UserChallenges
+}
+
+// SolvePoints is a solve along with the points awarded for it.
+type SolvePoints struct {
+	database.UserChallenges
+
+	Challenge *database.Challenge
+	Points    uint
+}
+
+// LoadScoreLedger loads the solves, the score adjustments and the hint unlocks
+// along with the scoring strategies of all the challenges.
+func LoadScoreLedger() (*ScoreLedger, error) {
+	challenges, err := database.QueryAllChallenges()
+	if err != nil {
+		return nil, fmt.Errorf("error while querying challenges: %s", err)
+	}
+
+	ledger := &ScoreLedger{
+		challenges: make([]ledgerChallenge, len(challenges)),
+	}
+
+	for i := range challenges {
+		strategy, err := ChallengeScoringStrategy(&challenges[i])
+		if err != nil {
+			return nil, fmt.Errorf("error while getting scoring strategy for %s: %s", challenges[i].Name, err)
+		}
+
+		solves, err := GetChallengeSolves(challenges[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("error while querying solves of %s: %s", challenges[i].Name, err)
+		}
+
+		ledger.challenges[i] = ledgerChallenge{
+			challenge: challenges[i],
+			strategy:  strategy,
+			solves:    solves,
+		}
+	}
+
+	ledger.adjustments, err = database.QueryScoreAdjustments(map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("error while querying score adjustments: %s", err)
+	}
+
+	ledger.unlocks, err = database.QueryHintUnlocks(map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("error while querying hint unlocks: %s", err)
+	}
+
+	return ledger, nil
+}
+
+// ScoresAt returns the scores of the users as they were at the time, only the
+// solves, adjustments and unlocks made till then are considered. A zero time
+// considers everything.
+func (ledger *ScoreLedger) ScoresAt(at time.Time) map[uint]uint {
+	include := func(t time.Time) bool {
+		return at.IsZero() || !t.After(at)
+	}
+
+	scores := make(map[uint]int64)
+	for _, solve := range ledger.SolvePoints(at) {
+		scores[solve.UserID] += int64(solve.Points)
+	}
+
+	for _, adjustment := range ledger.adjustments {
+		if include(adjustment.CreatedAt) {
+			scores[adjustment.UserID] += int64(adjustment.Points)
+		}
+	}
+
+	for _, unlock := range ledger.unlocks {
+		if include(unlock.CreatedAt) {
+			scores[unlock.UserID] -= int64(unlock.Cost)
+		}
+	}
+
+	computed := make(map[uint]uint, len(scores))
+	for userID, score := range scores {
+		if score < 0 {
+			score = 0
+		}
+		computed[userID] = uint(score)
+	}
+
+	return computed
+}
+
+// Challenges returns all the challenges of the ledger.
+func (ledger *ScoreLedger) Challenges() []database.Challenge {
+	challenges := make([]database.Challenge, len(ledger.challenges))
+	for i := range ledger.challenges {
+		challenges[i] = ledger.challenges[i].challenge
+	}
+
+	return challenges
+}
+
+// SolvePoints returns the solves of all the challenges made till the time along with
+// the points awarded for them at that time ordered by the time of the solve, a zero
+// time returns all the solves.
+func (ledger *ScoreLedger) SolvePoints(at time.Time) []SolvePoints {
+	var solves []SolvePoints
+	for i := range ledger.challenges {
+		challenge := &ledger.challenges[i]
+
+		var solvers uint
+		for _, solve := range challenge.solves {
+			if at.IsZero() || !solve.CreatedAt.After(at) {
+				solvers++
+			}
+		}
+
+		for index, solve := range challenge.solves[:solvers] {
+			solves = append(solves, SolvePoints{
+				UserChallenges: solve,
+				Challenge:      &challenge.challenge,
+				Points: challenge.strategy.Points(scoring.Solve{
+					Rank:     uint(index) + 1,
+					Solvers:  solvers,
+					SolvedAt: solve.CreatedAt,
+				}),
+			})
+		}
+	}
+
+	sort.SliceStable(solves, func(i, j int) bool {
+		return solves[i].CreatedAt.Before(solves[j].CreatedAt)
+	})
+
+	return solves
+}
+
+// ChallengeAt returns the set of the users who solved the challenge till the time along
+// with the points the next solver of the challenge would have got at that time, a zero
+// time considers all the solves. found is false if the challenge is not in the ledger.
+func (ledger *ScoreLedger) ChallengeAt(challengeID uint, at time.Time) (solvers map[uint]bool, points uint, found bool) {
+	for i := range ledger.challenges {
+		challenge := &ledger.challenges[i]
+		if challenge.challenge.ID != challengeID {
+			continue
+		}
+
+		solvers = make(map[uint]bool)
+		for _, solve := range challenge.solves {
+			if at.IsZero() || !solve.CreatedAt.After(at) {
+				solvers[solve.UserID] = true
+			}
+		}
+
+		next := uint(len(solvers)) + 1
+		solvedAt := at
+		if solvedAt.IsZero() {
+			solvedAt = time.Now()
+		}
+
+		points = challenge.strategy.Points(scoring.Solve{Rank: next, Solvers: next, SolvedAt: solvedAt})
+		return solvers, points, true
+	}
+
+	return nil, 0, false
+}
+
+// ComputeScores derives the scores of all the users from their solves using the
+// current points of the challenges, along with the manual score adjustments and
+// the cost of the hints unlocked by them.
+func ComputeScores() (map[uint]uint, error) {
+	ledger, err := LoadScoreLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	return ledger.ScoresAt(time.Time{}), nil
+}
+
+// RefreshScores rebuilds the stored scores of the provided users, and of the teams
+// they are part of, from the solves.
+func RefreshScores(userIDs []uint) error {
+	scoresMux.Lock()
+	defer scoresMux.Unlock()
+
+	computed, err := ComputeScores()
+	if err != nil {
+		return err
+	}
+
+	teams := make(map[uint]bool)
+	for _, userID := range userIDs {
+		user, err := database.QueryUserById(userID)
+		if err != nil {
+			return err
+		}
+
+		if user.Role != core.USER_ROLES["contestant"] {
+			continue
+		}
+
+		if user.Score != computed[user.ID] {
+			err = database.UpdateUser(&user, map[string]interface{}{"Score": computed[user.ID]})
+			if err != nil {
+				return err
+			}
+		}
+
+		if user.TeamID != 0 {
+			teams[user.TeamID] = true
+		}
+	}
+
+	for teamID := range teams {
+		team, err := database.QueryTeamById(teamID)
+		if err != nil {
+			return err
+		}
+
+		if _, err = refreshTeamScore(&team, computed, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// challengeSolvePoints returns the points awarded to each user for their solve of the
+// challenge with the solves ordered by the time of the solve.
+func challengeSolvePoints(strategy scoring.ScoringStrategy, solves []database.UserChallenges) map[uint]uint {
+	points := make(map[uint]uint, len(solves))
+	for index, solve := range solves {
+		points[solve.UserID] = strategy.Points(scoring.Solve{
+			Rank:     uint(index) + 1,
+			Solvers:  uint(len(solves)),
+			SolvedAt: solve.CreatedAt,
+		})
+	}
+
+	return points
+}
+
+// computeUserScore derives the score of the user from the solves of the user along
+// with the score adjustments and the cost of the hints unlocked by the user.
+func computeUserScore(userID uint) (uint, error) {
+	submissions, err := database.QuerySubmissions(map[string]interface{}{
+		"user_id": userID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var score int64
+	for _, submission := range submissions {
+		challenges, err := database.QueryChallengeEntriesMap(map[string]interface{}{
+			"id": submission.ChallengeID,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(challenges) == 0 {
+			continue
+		}
+
+		strategy, err := ChallengeScoringStrategy(&challenges[0])
+		if err != nil {
+			return 0, fmt.Errorf("error while getting scoring strategy for %s: %s", challenges[0].Name, err)
+		}
+
+		solves, err := GetChallengeSolves(challenges[0].ID)
+		if err != nil {
+			return 0, err
+		}
+
+		score += int64(challengeSolvePoints(strategy, solves)[userID])
+	}
+
+	adjustments, err := database.QueryScoreAdjustments(map[string]interface{}{
+		"user_id": userID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, adjustment := range adjustments {
+		score += int64(adjustment.Points)
+	}
+
+	unlocks, err := database.QueryHintUnlocks(map[string]interface{}{
+		"user_id": userID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, unlock := range unlocks {
+		score -= int64(unlock.Cost)
+	}
+
+	if score < 0 {
+		return 0, nil
+	}
+
+	return uint(score), nil
+}
+
+// RecordSolve saves the solve of the challenge and updates the stored scores of the
+// solvers of the challenge, and of the teams they are part of, by the change in the
+// points awarded for their solves of the challenge. Only the points of the challenge
+// are computed, the solve is saved while holding the lock of the scores so that each
+// change in the points is applied exactly once. The solves of the challenge including
+// the new solve are returned, they are nil if the solve could not be saved, along with
+// database.ErrAlreadySolved if the user or their team has already solved the challenge.
+func RecordSolve(challenge *database.Challenge, solve *database.UserChallenges) ([]database.UserChallenges, error) {
+	scoresMux.Lock()
+	defer scoresMux.Unlock()
+
+	before, err := GetChallengeSolves(challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = database.SaveFlagSubmission(solve); err != nil {
+		return nil, err
+	}
+
+	// Every solve is saved while holding the lock, so the solves of the challenge
+	// are the solves queried along with the new solve.
+	after := append(append(make([]database.UserChallenges, 0, len(before)+1), before...), *solve)
+	sort.SliceStable(after, func(i, j int) bool {
+		return after[i].CreatedAt.Before(after[j].CreatedAt)
+	})
+
+	strategy, err := ChallengeScoringStrategy(challenge)
+	if err != nil {
+		return after, fmt.Errorf("error while getting scoring strategy for %s: %s", challenge.Name, err)
+	}
+
+	oldPoints := challengeSolvePoints(strategy, before)
+	newPoints := challengeSolvePoints(strategy, after)
+
+	teams := make(map[uint]int64)
+	for userID, points := range newPoints {
+		delta := int64(points) - int64(oldPoints[userID])
+		if delta == 0 {
+			continue
+		}
+
+		user, err := database.QueryUserById(userID)
+		if err != nil {
+			return after, err
+		}
+
+		if user.Role != core.USER_ROLES["contestant"] {
+			continue
+		}
+
+		// A score of zero may be a negative score clamped at zero, in which case
+		// the score gained can't be derived from the stored score.
+		var score uint
+		if user.Score == 0 && delta > 0 {
+			if score, err = computeUserScore(user.ID); err != nil {
+				return after, err
+			}
+		} else if int64(user.Score)+delta > 0 {
+			score = uint(int64(user.Score) + delta)
+		}
+
+		if score == user.Score {
+			continue
+		}
+
+		if user.TeamID != 0 {
+			teams[user.TeamID] += int64(score) - int64(user.Score)
+		}
+
+		if err = database.UpdateUser(&user, map[string]interface{}{"Score": score}); err != nil {
+			return after, err
+		}
+	}
+
+	for teamID, delta := range teams {
+		team, err := database.QueryTeamById(teamID)
+		if err != nil {
+			return after, err
+		}
+
+		score := int64(team.Score) + delta
+		if score < 0 {
+			score = 0
+		}
+
+		if err = database.UpdateTeam(&team, map[string]interface{}{"Score": uint(score)}); err != nil {
+			return after, err
+		}
+	}
+
+	return after, nil
+}
+
+// RefreshTeamScore rebuilds the stored score of the team from the solves of its members.
+func RefreshTeamScore(teamID uint) error {
+	scoresMux.Lock()
+	defer scoresMux.Unlock()
+
+	computed, err := ComputeScores()
+	if err != nil {
+		return err
+	}
+
+	team, err := database.QueryTeamById(teamID)
+	if err != nil {
+		return err
+	}
+
+	_, err = refreshTeamScore(&team, computed, true)
+	return err
+}
+
+func refreshTeamScore(team *database.Team, computed map[uint]uint, update bool) (uint, error) {
+	members, err := database.GetTeamMembers(team.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var score uint
+	for _, member := range members {
+		if member.Role == core.USER_ROLES["contestant"] {
+			score += computed[member.ID]
+		}
+	}
+
+	if update && team.Score != score {
+		if err := database.UpdateTeam(team, map[string]interface{}{"Score": score}); err != nil {
+			return score, err
+		}
+	}
+
+	return score, nil
+}
+
+// RecomputeScores derives the scores of all the contestants and teams from the
+// solves and returns the ones whose stored score does not match. If update is
+// true the stored scores are rebuilt as well.
+func RecomputeScores(update bool) ([]ScoreMismatch, error) {
+	scoresMux.Lock()
+	defer scoresMux.Unlock()
+
+	computed, err := ComputeScores()
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := database.QueryUserEntries("role", core.USER_ROLES["contestant"])
+	if err != nil {
+		return nil, fmt.Errorf("error while querying users: %s", err)
+	}
+
+	var mismatches []ScoreMismatch
+	for i := range users {
+		if users[i].Score == computed[users[i].ID] {
+			continue
+		}
+
+		mismatches = append(mismatches, ScoreMismatch{
+			Type:     "user",
+			ID:       users[i].ID,
+			Name:     users[i].Username,
+			Stored:   users[i].Score,
+			Computed: computed[users[i].ID],
+		})
+
+		if update {
+			err = database.UpdateUser(&users[i], map[string]interface{}{"Score": computed[users[i].ID]})
+			if err != nil {
+				return mismatches, fmt.Errorf("error while updating score of %s: %s", users[i].Username, err)
+			}
+		}
+	}
+
+	teams, err := database.QueryAllTeams()
+	if err != nil {
+		return mismatches, fmt.Errorf("error while querying teams: %s", err)
+	}
+
+	for i := range teams {
+		stored := teams[i].Score
+		score, err := refreshTeamScore(&teams[i], computed, update)
+		if err != nil {
+			return mismatches, fmt.Errorf("error while updating score of team %s: %s", teams[i].Name, err)
+		}
+
+		if stored != score {
+			mismatches = append(mismatches, ScoreMismatch{
+				Type:     "team",
+				ID:       teams[i].ID,
+				Name:     teams[i].Name,
+				Stored:   stored,
+				Computed: score,
+			})
+		}
+	}
+
+	log.Infof("Recomputed scores from solves, found %d mismatches", len(mismatches))
+
+	return mismatches, nil
+}
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sdslabs/beastv4/core"
+	cfg "github.com/sdslabs/beastv4/core/config"
+	"github.com/sdslabs/beastv4/core/database"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/cr"
+	"github.com/sdslabs/beastv4/pkg/notify"
+	log "github.com/sirupsen/logrus"
+)
+
+// selfHealer keeps the state of the self healing of a challenge across the
+// health checks of the challenge.
+type selfHealer struct {
+	challengeName string
+	attempts      int
+	nextAttempt   time.Time
+	crashlooping  bool
+}
+
+// backoff returns the time to wait after the latest attempt before the next one,
+// the back-off doubles after every attempt up to the maximum back-off.
+func (h *selfHealer) backoff() time.Duration {
+	backoff := cfg.Cfg.SelfHeal.BackoffDuration
+	for i := 1; i < h.attempts && backoff < cfg.Cfg.SelfHeal.MaxBackoffDuration; i++ {
+		backoff *= 2
+	}
+
+	if backoff > cfg.Cfg.SelfHeal.MaxBackoffDuration {
+		return cfg.Cfg.SelfHeal.MaxBackoffDuration
+	}
+
+	return backoff
+}
+
+// heal is called for every failed health check once the challenge is unhealthy. The
+// first attempt restarts the container of the challenge and the later attempts recreate
+// it from the committed image, attempts are made only once the back-off has passed.
+// The challenge is marked as crashlooping once all the attempts have failed.
+func (h *selfHealer) heal(config *cfg.BeastChallengeConfig, reason error) {
+	if !cfg.Cfg.SelfHeal.Enabled || time.Now().Before(h.nextAttempt) {
+		return
+	}
+
+	challenge, err := database.QueryFirstChallengeEntry("name", h.challengeName)
+	if err != nil {
+		log.Errorf("Error while querying challenge %s for self healing : %s", h.challengeName, err)
+		return
+	}
+
+	if challenge.Status != core.DEPLOY_STATUS["deployed"] {
+		return
+	}
+
+	// The challenge was deployed again since it was marked as crashlooping.
+	if h.crashlooping {
+		h.attempts, h.crashlooping = 0, false
+	}
+
+	if h.attempts >= cfg.Cfg.SelfHeal.MaxAttempts {
+		h.crashlooping = true
+		if err = database.UpdateChallenge(&challenge, map[string]interface{}{"Status": core.DEPLOY_STATUS["crashlooping"]}); err != nil {
+			log.Errorf("Error while marking %s as crashlooping : %s", h.challengeName, err)
+		}
+
+		msg := fmt.Sprintf("SELF HEAL ERROR : %s : challenge is crashlooping after %d attempts : %s", h.challengeName, h.attempts, reason)
+		log.Error(msg)
+		notify.SendNotification(notify.Error, msg)
+		return
+	}
+
+	h.attempts += 1
+	action := core.RESTART_ACTION_RESTART
+	if h.attempts > 1 {
+		action = core.RESTART_ACTION_RECREATE
+	}
+
+	log.Infof("Self healing %s, attempt %d : %s", h.challengeName, h.attempts, action)
+	if action == core.RESTART_ACTION_RESTART {
+		err = cr.RestartContainer(challenge.ContainerId)
+	} else {
+		err = recreateChallengeContainer(&challenge, *config)
+	}
+
+	restart := database.ChallengeRestart{
+		ChallengeID: challenge.ID,
+		Action:      action,
+		Attempt:     h.attempts,
+		Reason:      reason.Error(),
+		Success:     err == nil,
+	}
+	if err != nil {
+		restart.Error = err.Error()
+		log.Errorf("Error while self healing %s : %s", h.challengeName, err)
+	}
+
+	if e := database.CreateChallengeRestart(&restart); e != nil {
+		log.Errorf("Error while recording restart of %s : %s", h.challengeName, e)
+	}
+
+	h.nextAttempt = time.Now().Add(h.backoff())
+}
+
+// recovered is called for every successful health check, it resets the state of the
+// self healing and marks a crashlooping challenge as deployed again. The status of the
+// challenge is used since it may have been marked as crashlooping before beast restarted.
+func (h *selfHealer) recovered(challenge *database.Challenge) {
+	if challenge.Status == core.DEPLOY_STATUS["crashlooping"] {
+		if err := database.UpdateChallenge(challenge, map[string]interface{}{"Status": core.DEPLOY_STATUS["deployed"]}); err != nil {
+			log.Errorf("Error while marking %s as deployed : %s", h.challengeName, err)
+		}
+	}
+
+	h.attempts, h.nextAttempt, h.crashlooping = 0, time.Time{}, false
+}
+
+// recreateChallengeContainer removes the container of the challenge and deploys it
+// again from the committed image of the challenge along with its services.
+func recreateChallengeContainer(challenge *database.Challenge, config cfg.BeastChallengeConfig) error {
+	if !coreUtils.IsImageIdValid(challenge.ImageId) {
+		return fmt.Errorf("challenge has no committed image")
+	}
+
+	// Only the container with exactly the name is removed, docker matches
+	// the name filter as a regular expression on the container names.
+	containerName := coreUtils.EncodeID(challenge.Name)
+	if err := coreUtils.CleanupContainerByFilter("name", fmt.Sprintf("^/%s$", containerName)); err != nil {
+		return err
+	}
+
+	config.Resources.ValidateRequiredFields()
+
+	return deployChallenge(challenge, config)
+}
@@ -0,0 +1,222 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sdslabs/beastv4/core"
+	cfg "github.com/sdslabs/beastv4/core/config"
+	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/cr"
+	"github.com/sdslabs/beastv4/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// serviceStagingDir returns the directory in the staging area of the challenge
+// containing the build context of the service.
+func serviceStagingDir(challengeName string, service *cfg.Service) string {
+	return filepath.Join(core.BEAST_GLOBAL_DIR, core.BEAST_STAGING_DIR, challengeName, core.BEAST_SERVICES_DIR, service.Name)
+}
+
+// serviceDockerfile returns the Dockerfile in the build context of the service.
+func serviceDockerfile(service *cfg.Service) string {
+	if service.Dockerfile == "" {
+		return core.DEFAULT_DOCKER_FILE
+	}
+
+	return service.Dockerfile
+}
+
+// stageChallengeServices adds the build context of each service which is built from
+// a context to the staging area of the challenge as a tar file.
+func stageChallengeServices(contextDir string, config *cfg.BeastChallengeConfig) error {
+	for i := range config.Challenge.Services {
+		service := &config.Challenge.Services[i]
+		if service.Context == "" {
+			continue
+		}
+
+		stagingDir := serviceStagingDir(config.Challenge.Metadata.Name, service)
+		if err := os.RemoveAll(stagingDir); err != nil {
+			return fmt.Errorf("Error while cleaning staging directory of service %s : %s", service.Name, err)
+		}
+
+		if err := utils.CreateIfNotExistDir(stagingDir); err != nil {
+			return err
+		}
+
+		log.Debugf("Staging service %s of challenge %s", service.Name, config.Challenge.Metadata.Name)
+		if err := utils.Tar(filepath.Join(contextDir, service.Context), utils.Gzip, stagingDir, nil, nil); err != nil {
+			return fmt.Errorf("Error while staging service %s : %s", service.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// commitChallengeServices builds the images of the services built from a context and
+// pulls the images of the other services if they are not available. The output of the
+// builds and the pulls is written to buildLog.
+func commitChallengeServices(config *cfg.BeastChallengeConfig, noCache bool, buildLog io.Writer) error {
+	challengeName := config.Challenge.Metadata.Name
+
+	for i := range config.Challenge.Services {
+		service := &config.Challenge.Services[i]
+		fmt.Fprintf(buildLog, "\n===> Service %s\n", service.Name)
+
+		if service.Image != "" {
+			if exists, err := cr.CheckIfImageExists(service.Image); err == nil && exists {
+				continue
+			}
+
+			log.Infof("Pulling image %s for service %s of %s", service.Image, service.Name, challengeName)
+			buff, err := cr.PullImage(service.Image)
+			if buff != nil {
+				buildLog.Write(buff.Bytes())
+			}
+			if err != nil {
+				return fmt.Errorf("Error while pulling image of service %s : %s", service.Name, err)
+			}
+			continue
+		}
+
+		stagedPath := filepath.Join(serviceStagingDir(challengeName, service), fmt.Sprintf("%s.tar.gz", filepath.Base(service.Context)))
+		if err := utils.ValidateFileExists(stagedPath); err != nil {
+			return fmt.Errorf("Service %s is not staged : %s", service.Name, err)
+		}
+
+		tag := coreUtils.ServiceContainerName(challengeName, service.Name)
+		buff, imageId, err := cr.BuildImageFromTarContext(challengeName, tag, stagedPath, serviceDockerfile(service), noCache)
+		if buff != nil {
+			buildLog.Write(buff.Bytes())
+		}
+		if err != nil {
+			return fmt.Errorf("Error while building image of service %s : %s", service.Name, err)
+		}
+
+		if imageId == "" {
+			return fmt.Errorf("Error while getting imageId for the service %s", service.Name)
+		}
+
+		log.Infof("Image build for service %s of `%s` done", service.Name, challengeName)
+	}
+
+	return nil
+}
+
+// deployChallengeServices starts the containers of all the services of the challenge
+// in the network of the challenge. On failure the containers of the services started
+// are removed.
+func deployChallengeServices(config *cfg.BeastChallengeConfig, network string) error {
+	challengeName := config.Challenge.Metadata.Name
+
+	for i := range config.Challenge.Services {
+		service := &config.Challenge.Services[i]
+		containerName := coreUtils.ServiceContainerName(challengeName, service.Name)
+
+		// Only the container with exactly the name is removed, docker matches
+		// the name filter as a regular expression on the container names.
+		if err := coreUtils.CleanupContainerByFilter("name", fmt.Sprintf("^/%s$", containerName)); err != nil {
+			removeChallengeServices(challengeName)
+			return err
+		}
+
+		portMapping, err := service.GetPortMappings()
+		if err != nil {
+			removeChallengeServices(challengeName)
+			return fmt.Errorf("Error while parsing port mapping for service %s : %s", service.Name, err)
+		}
+
+		imageId := service.Image
+		if imageId == "" {
+			imageId = containerName
+		}
+
+		keys := make([]string, 0, len(service.Env))
+		for key := range service.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var containerEnv []string
+		for _, key := range keys {
+			containerEnv = append(containerEnv, fmt.Sprintf("%s=%s", key, service.Env[key]))
+		}
+
+		// The ports of the services are published by the egress proxy if the
+		// network of the challenge is internal.
+		internalPorts := append([]uint32{}, service.Ports...)
+		if config.Challenge.Env.Egress.Restricted() {
+			for _, mapping := range portMapping {
+				internalPorts = append(internalPorts, mapping.ContainerPort)
+			}
+			portMapping = nil
+		}
+
+		containerConfig := cr.CreateContainerConfig{
+			PortMapping:      portMapping,
+			ImageId:          imageId,
+			ContainerName:    containerName,
+			ContainerEnv:     containerEnv,
+			ContainerNetwork: network,
+			Traffic:          config.Challenge.Env.TrafficType(),
+			CPUShares:        config.Resources.CPUShares,
+			Memory:           config.Resources.Memory,
+			PidsLimit:        config.Resources.PidsLimit,
+			InternalPorts:    internalPorts,
+			NetworkAliases:   []string{service.Name},
+		}
+
+		log.Debugf("create container config for service %s of challenge(%s): %v", service.Name, challengeName, containerConfig)
+		if _, err := cr.CreateContainerFromImage(&containerConfig); err != nil {
+			removeChallengeServices(challengeName)
+			return fmt.Errorf("Error while starting the container of service %s : %s", service.Name, err)
+		}
+
+		log.Infof("Service %s of challenge %s started", service.Name, challengeName)
+	}
+
+	return nil
+}
+
+// removeChallengeServices removes the containers of all the services of the challenge.
+func removeChallengeServices(challengeName string) error {
+	filter := fmt.Sprintf("^/%s-", coreUtils.EncodeID(challengeName))
+	if err := coreUtils.CleanupContainerByFilter("name", filter); err != nil {
+		return fmt.Errorf("Error while removing containers of services : %s", err)
+	}
+
+	return nil
+}
+
+// removeChallengeContainers removes the containers of the services, the egress proxy
+// and the network of the challenge, the challenge container must be removed before.
+// The errors are only logged as this is used to clean up after a failed deploy.
+func removeChallengeContainers(challengeName string) {
+	if err := removeChallengeServices(challengeName); err != nil {
+		log.Error(err)
+	}
+
+	if err := removeChallengeNetwork(challengeName); err != nil {
+		log.Error(err)
+	}
+}
+
+// removeServiceImages removes the images built for the services of the challenge,
+// the images used by the services which are not built by beast are left as is.
+func removeServiceImages(config *cfg.BeastChallengeConfig) {
+	challengeName := config.Challenge.Metadata.Name
+	for _, service := range config.Challenge.Services {
+		if service.Context == "" {
+			continue
+		}
+
+		tag := coreUtils.ServiceContainerName(challengeName, service.Name)
+		if err := cr.RemoveImage(tag); err != nil {
+			log.Warnf("Error while removing image of service %s of %s : %s", service.Name, challengeName, err)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/sdslabs/beastv4/pkg/auth"
+	"github.com/sdslabs/beastv4/pkg/scoring"
 	"io"
 	"io/ioutil"
 	"net/url"
@@ -13,11 +14,13 @@ import (
 	"path/filepath"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/sdslabs/beastv4/core"
 	cfg "github.com/sdslabs/beastv4/core/config"
 	"github.com/sdslabs/beastv4/core/database"
 	coreUtils "github.com/sdslabs/beastv4/core/utils"
+	"github.com/sdslabs/beastv4/pkg/flagmatch"
 	tools "github.com/sdslabs/beastv4/templates"
 	"github.com/sdslabs/beastv4/utils"
 
@@ -245,6 +248,15 @@ func GenerateDockerfile(config *cfg.BeastChallengeConfig) (string, error) {
 	var executables []string
 	modifier := emptyFunction
 
+	// The default port is exposed in place of `auto` in the ports of the challenge.
+	containerPorts := make([]uint32, len(config.Challenge.Env.Ports))
+	for i, port := range config.Challenge.Env.Ports {
+		if port == 0 {
+			port = config.Challenge.Env.DefaultPort
+		}
+		containerPorts[i] = port
+	}
+
 	// The challenge type we are looking at is service. This should be deployed
 	// using xinetd. The Dockerfile is different for this. Change the runCmd and the
 	// apt dependencies to add xinetd.
@@ -279,7 +291,7 @@ func GenerateDockerfile(config *cfg.BeastChallengeConfig) (string, error) {
 
 	data := BeastBareDockerfile{
 		DockerBaseImage:      baseImage,
-		Ports:                strings.Trim(strings.Replace(fmt.Sprint(config.Challenge.Env.Ports), " ", " ", -1), "[]"),
+		Ports:                strings.Trim(fmt.Sprint(containerPorts), "[]"),
 		AptDeps:              aptDeps,
 		SetupScripts:         setupScripts,
 		RunCmd:               runCmd,
@@ -407,6 +419,18 @@ func copyAdditionalContextToStaging(fileCtx map[string]string, stagingDir string
 
 // TODO: Refactor this.
 func UpdateOrCreateChallengeDbEntry(challEntry *database.Challenge, config cfg.BeastChallengeConfig, defaultauthorpassword string) error {
+	if config.Challenge.Metadata.MaxPoints > 0 {
+		log.Debugf("Setting points for challenge %s equal to it's maxpoints = %d", config.Challenge.Metadata.Name, config.Challenge.Metadata.MaxPoints)
+		config.Challenge.Metadata.Points = config.Challenge.Metadata.MaxPoints
+	} else {
+		log.Debugf("MinPoints for challenge %s is not set. Setting it equal to its points = %d", config.Challenge.Metadata.Name, config.Challenge.Metadata.Points)
+		config.Challenge.Metadata.MaxPoints = config.Challenge.Metadata.Points
+	}
+	if config.Challenge.Metadata.MinPoints == 0 {
+		log.Debugf("MinPoints for challenge %s is not set. Setting it equal to its points = %d", config.Challenge.Metadata.Name, config.Challenge.Metadata.Points)
+		config.Challenge.Metadata.MinPoints = config.Challenge.Metadata.Points
+	}
+
 	// Challenge is nil, which means the challenge entry does not exist
 	// So create a new challenge entry on the basis of the fields provided
 	// in the config file for the challenge.
@@ -474,17 +498,6 @@ func UpdateOrCreateChallengeDbEntry(challEntry *database.Challenge, config cfg.B
 			beastStaticAssetUrl.Path = path.Join(beastStaticAssetUrl.Path, config.Challenge.Metadata.Name, core.BEAST_STATIC_FOLDER, asset)
 			assetsURL[index] = beastStaticAssetUrl.String()
 		}
-		if config.Challenge.Metadata.MaxPoints > 0 {
-			log.Debugf("Setting points for challenge %s equal to it's maxpoints = %d", config.Challenge.Metadata.Name, config.Challenge.Metadata.MaxPoints)
-			config.Challenge.Metadata.Points = config.Challenge.Metadata.MaxPoints
-		} else {
-			log.Debugf("MinPoints for challenge %s is not set. Setting it equal to its points = %d", config.Challenge.Metadata.Name, config.Challenge.Metadata.Points)
-			config.Challenge.Metadata.MaxPoints = config.Challenge.Metadata.Points
-		}
-		if config.Challenge.Metadata.MinPoints == 0 {
-			log.Debugf("MinPoints for challenge %s is not set. Setting it equal to its points = %d", config.Challenge.Metadata.Name, config.Challenge.Metadata.Points)
-			config.Challenge.Metadata.MinPoints = config.Challenge.Metadata.Points
-		}
 		*challEntry = database.Challenge{
 			Name:        config.Challenge.Metadata.Name,
 			AuthorID:    userEntry.ID,
@@ -497,11 +510,26 @@ func UpdateOrCreateChallengeDbEntry(challEntry *database.Challenge, config cfg.B
 			Type:        config.Challenge.Metadata.Type,
 			Sidecar:     config.Challenge.Metadata.Sidecar,
 			Description: config.Challenge.Metadata.Description,
-			Hints:       strings.Join(config.Challenge.Metadata.Hints, core.DELIMITER),
+			Hints:       strings.Join(freeHints(config.Challenge.Metadata.Hints), core.DELIMITER),
 			Assets:      strings.Join(assetsURL, core.DELIMITER),
 			Points:      config.Challenge.Metadata.Points,
 			MinPoints:   config.Challenge.Metadata.MinPoints,
 			MaxPoints:   config.Challenge.Metadata.MaxPoints,
+
+			ScoringStrategy: config.Challenge.Metadata.Scoring,
+			ScoringDecay:    config.Challenge.Metadata.Decay,
+			FirstBloodBonus: utils.JoinUints(config.Challenge.Metadata.FirstBloodBonus, core.DELIMITER),
+
+			Flags:     strings.Join(config.Challenge.Metadata.Flags, core.DELIMITER),
+			FlagMatch: config.Challenge.Metadata.FlagMatch,
+
+			UserFlag:         config.Challenge.Metadata.UserFlag,
+			FlagFormat:       config.Challenge.Metadata.FlagFormat,
+			FlagSecret:       utils.GenerateRandomID(),
+			Handouts:         strings.Join(config.Challenge.Metadata.HandoutFiles(), core.DELIMITER),
+			TemplateHandouts: strings.Join(config.Challenge.Metadata.TemplateHandouts(), core.DELIMITER),
+
+			Instanced: config.Challenge.Env.Instanced,
 		}
 
 		err = database.CreateChallengeEntry(challEntry)
@@ -509,71 +537,175 @@ func UpdateOrCreateChallengeDbEntry(challEntry *database.Challenge, config cfg.B
 			return fmt.Errorf("Error while creating chall entry with config : %s : %v", err, challEntry)
 		}
 
+		hints, err := hintEntries(config.Challenge.Metadata.Hints)
+		if err != nil {
+			return err
+		}
+
+		err = database.SyncChallengeHints(challEntry.ID, hints)
+		if err != nil {
+			return fmt.Errorf("Error while creating hints for challenge %s : %s", challEntry.Name, err)
+		}
+
 		database.Db.Model(challEntry).Association("Tags").Append(tags)
 
 		database.Db.Model(challEntry).Association("Users").Append(users)
+	} else if err := syncChallengeDbEntry(challEntry, config); err != nil {
+		return err
 	}
 
-	allocatedPorts, err := database.GetAllocatedPorts(*challEntry)
+	ports, err := challengePortRequests(&config)
 	if err != nil {
-		return fmt.Errorf("Error while getting allocated ports for : %s : %s", challEntry.Name, err)
+		return fmt.Errorf("Error while parsing host port for challenge %s : %s", challEntry.Name, err)
 	}
 
-	isAllocated := func(port uint32) bool {
-		for i, p := range allocatedPorts {
-			if port == p.PortNo {
-				allocatedPorts[len(allocatedPorts)-1], allocatedPorts[i] = allocatedPorts[i], allocatedPorts[len(allocatedPorts)-1]
-				allocatedPorts = allocatedPorts[:len(allocatedPorts)-1]
-				return true
-			}
-		}
+	// Instances of an instanced challenge are exposed on the ports allocated
+	// to them, so no host port is reserved for the challenge itself.
+	if config.Challenge.Env.Instanced {
+		ports = nil
+	}
 
-		return false
+	// Once the challenge entry has been created, the ports table is updated
+	// with the ports to expose for the challenge, allocating the ports which
+	// are to be allocated by beast.
+	_, err = database.AllocateChallengePorts(challEntry.ID, ports, cfg.Cfg.MinPort, cfg.Cfg.MaxPort)
+	if err != nil {
+		return fmt.Errorf("Error while allocating ports for challenge %s : %s", challEntry.Name, err)
 	}
 
-	hostPorts, err := config.Challenge.Env.GetAllHostPorts()
+	err = UpdateChallengeRequirements(challEntry, config.Challenge.Metadata.Requires)
 	if err != nil {
-		return fmt.Errorf("Error while parsing host port for challenge %s : %s", challEntry.Name, err)
+		return fmt.Errorf("Error while updating requirements for challenge %s : %s", challEntry.Name, err)
 	}
-	// Once the challenge entry has been created, add entries to the ports
-	// table in the database with the ports to expose
-	// for the challenge.
-	// TODO: Do all this under a database transaction so that if any port
-	// request is not available
-	for _, port := range hostPorts {
-		if isAllocated(port) {
-			// The port has already been allocated to the challenge
-			// Do nothing for this.
-			continue
+
+	return nil
+}
+
+// syncChallengeDbEntry updates the entry of an existing challenge with the fields of the
+// challenge config deciding how the challenge is deployed, scored and solved. The points
+// of the challenge and the scores are recomputed if the scoring of the challenge changed,
+// the hints are updated only if they changed since the scores are recomputed with them.
+func syncChallengeDbEntry(challEntry *database.Challenge, config cfg.BeastChallengeConfig) error {
+	metadata := config.Challenge.Metadata
+
+	fields := map[string]interface{}{
+		"Instanced":        config.Challenge.Env.Instanced,
+		"DynamicFlag":      metadata.DynamicFlag,
+		"Flag":             metadata.Flag,
+		"Flags":            strings.Join(metadata.Flags, core.DELIMITER),
+		"FlagMatch":        metadata.FlagMatch,
+		"UserFlag":         metadata.UserFlag,
+		"FlagFormat":       metadata.FlagFormat,
+		"Handouts":         strings.Join(metadata.HandoutFiles(), core.DELIMITER),
+		"TemplateHandouts": strings.Join(metadata.TemplateHandouts(), core.DELIMITER),
+	}
+
+	scoringFields := map[string]interface{}{
+		"ScoringStrategy": metadata.Scoring,
+		"ScoringDecay":    metadata.Decay,
+		"FirstBloodBonus": utils.JoinUints(metadata.FirstBloodBonus, core.DELIMITER),
+		"MinPoints":       metadata.MinPoints,
+		"MaxPoints":       metadata.MaxPoints,
+	}
+
+	current := map[string]interface{}{
+		"Instanced":        challEntry.Instanced,
+		"DynamicFlag":      challEntry.DynamicFlag,
+		"Flag":             challEntry.Flag,
+		"Flags":            challEntry.Flags,
+		"FlagMatch":        challEntry.FlagMatch,
+		"UserFlag":         challEntry.UserFlag,
+		"FlagFormat":       challEntry.FlagFormat,
+		"Handouts":         challEntry.Handouts,
+		"TemplateHandouts": challEntry.TemplateHandouts,
+		"ScoringStrategy":  challEntry.ScoringStrategy,
+		"ScoringDecay":     challEntry.ScoringDecay,
+		"FirstBloodBonus":  challEntry.FirstBloodBonus,
+		"MinPoints":        challEntry.MinPoints,
+		"MaxPoints":        challEntry.MaxPoints,
+	}
+
+	updates := make(map[string]interface{})
+	for field, value := range fields {
+		if current[field] != value {
+			updates[field] = value
 		}
+	}
 
-		portEntry := database.Port{
-			ChallengeID: challEntry.ID,
-			PortNo:      port,
+	scoringChanged := false
+	for field, value := range scoringFields {
+		if current[field] != value {
+			updates[field] = value
+			scoringChanged = true
 		}
+	}
 
-		gotPort, err := database.PortEntryGetOrCreate(&portEntry)
-		if err != nil {
-			return err
+	if len(updates) > 0 {
+		log.Infof("Updating fields %v of challenge %s from its config", updates, challEntry.Name)
+		if err := database.UpdateChallenge(challEntry, updates); err != nil {
+			return fmt.Errorf("Error while updating challenge %s : %s", challEntry.Name, err)
 		}
+	}
 
-		// var gotChall database.Challenge
-		// database.Db.Model(&gotPort).Related(&gotChall)
+	if scoringChanged {
+		if err := refreshChallengePoints(challEntry); err != nil {
+			return fmt.Errorf("Error while updating points of challenge %s : %s", challEntry.Name, err)
+		}
 
-		if gotPort.ChallengeID != challEntry.ID {
-			return fmt.Errorf("The port %s requested is already in use by another challenge", gotPort.PortNo)
+		if _, err := RecomputeScores(true); err != nil {
+			return fmt.Errorf("Error while recomputing scores after scoring of %s changed : %s", challEntry.Name, err)
 		}
 	}
 
-	if len(allocatedPorts) > 0 {
-		if err = database.DeleteRelatedPorts(allocatedPorts); err != nil {
-			return fmt.Errorf("There was an error while deleting the ports which were already allocated to the challenge : %s : %s", challEntry.Name, err)
-		}
+	existing, err := database.QueryHintEntries(map[string]interface{}{
+		"challenge_id": challEntry.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("Error while querying hints of challenge %s : %s", challEntry.Name, err)
+	}
+
+	hints, err := hintEntries(metadata.Hints)
+	if err != nil {
+		return err
+	}
+
+	hintsChanged := len(existing) != len(hints)
+	for i := 0; !hintsChanged && i < len(hints); i++ {
+		hintsChanged = existing[i].Text != hints[i].Text ||
+			existing[i].Cost != hints[i].Cost ||
+			existing[i].UnlockAfter != hints[i].UnlockAfter
+	}
+
+	if hintsChanged {
+		log.Infof("Updating hints of challenge %s from its config", challEntry.Name)
+		return UpdateChallengeHints(challEntry, metadata.Hints)
 	}
 
 	return nil
 }
 
+// refreshChallengePoints updates the points of the challenge shown to the users, which
+// are the points the next solver of the challenge will get.
+func refreshChallengePoints(challenge *database.Challenge) error {
+	strategy, err := ChallengeScoringStrategy(challenge)
+	if err != nil {
+		return err
+	}
+
+	solves, err := GetChallengeSolves(challenge.ID)
+	if err != nil {
+		return err
+	}
+
+	solvers := uint(len(solves)) + 1
+	points := strategy.Points(scoring.Solve{Rank: solvers, Solvers: solvers, SolvedAt: time.Now()})
+	if points == challenge.Points {
+		return nil
+	}
+
+	return database.UpdateChallenge(challenge, map[string]interface{}{"Points": points})
+}
+
 //Provides the Static Content Folder Name from the config
 func GetStaticContentDir(configFile, contextDir string) (string, error) {
 	var config cfg.BeastChallengeConfig
@@ -816,6 +948,10 @@ func CopyDir(src string, dst string) error {
 func UpdateChallenges(defaultauthorpassword string) {
 	beastRemoteDir := filepath.Join(core.BEAST_GLOBAL_DIR, core.BEAST_REMOTES_DIR)
 
+	// Requirements of a challenge can only be stored once the entries for the
+	// required challenges exist, so they are updated again after all the entries.
+	requirements := make(map[string][]string)
+
 	for _, gitRemote := range cfg.Cfg.GitRemotes {
 		if !gitRemote.Active {
 			continue
@@ -866,6 +1002,9 @@ func UpdateChallenges(defaultauthorpassword string) {
 
 			// Using the challenge dir we got, update the database entries for the challenge.
 			err = UpdateOrCreateChallengeDbEntry(&challenge, config, defaultauthorpassword)
+			if len(config.Challenge.Metadata.Requires) > 0 {
+				requirements[challengeName] = config.Challenge.Metadata.Requires
+			}
 			if err != nil {
 				log.Errorf("An error occured while creating db entry for challenge :: %s", challengeName)
 				log.Errorf("Db error : %s", err)
@@ -874,10 +1013,26 @@ func UpdateChallenges(defaultauthorpassword string) {
 
 		}
 	}
+
+	for challengeName, requires := range requirements {
+		challenge, err := database.QueryFirstChallengeEntry("name", challengeName)
+		if err != nil || challenge.ID == 0 {
+			continue
+		}
+
+		err = UpdateChallengeRequirements(&challenge, requires)
+		if err != nil {
+			log.Errorf("Error while updating requirements for challenge %s : %s", challengeName, err)
+		}
+	}
 	log.Debugf("Challenges updated in Db")
 }
 
-func ValidateFlag(flag, challenge_name string)  error{
+// ValidateFlag validates the flag for the challenge. For a challenge with dynamic
+// flags the flag is registered as a valid flag for the challenge, it must match the
+// flag patterns if the challenge uses regex matching. For other challenges the flag
+// must match one of the flags of the challenge.
+func ValidateFlag(flag, challenge_name string) error {
 	if challenge_name == "" {
 		log.Errorf("Challenge name is empty")
 		return fmt.Errorf("challenge name is empty")
@@ -888,11 +1043,38 @@ func ValidateFlag(flag, challenge_name string)  error{
 		return fmt.Errorf("flag for challenge %s is empty", challenge_name)
 	}
 
+	challenge, err := database.QueryFirstChallengeEntry("name", challenge_name)
+	if err != nil {
+		log.Errorf("Error while querying challenge %s : %s", challenge_name, err)
+		return err
+	}
+
+	if challenge.ID == 0 {
+		return fmt.Errorf("challenge %s does not exist", challenge_name)
+	}
+
+	matcher, err := ChallengeFlagMatcher(&challenge)
+	if err != nil {
+		log.Errorf("Error while getting flag matcher for challenge %s : %s", challenge_name, err)
+		return err
+	}
+
+	if !challenge.DynamicFlag {
+		if !matcher.Match(flag) {
+			return fmt.Errorf("flag does not match the flags of challenge %s", challenge_name)
+		}
+		return nil
+	}
+
+	if matcher.Mode == flagmatch.REGEX && len(matcher.Flags) > 0 && !matcher.Match(flag) {
+		return fmt.Errorf("flag does not match the flag patterns of challenge %s", challenge_name)
+	}
+
 	dynamicflag := database.DynamicFlag{
 		Name: challenge_name,
-		Flag:          flag,
+		Flag: flag,
 	}
-	err := database.CreateDynamicFlagEntry(&dynamicflag)
+	err = database.CreateDynamicFlagEntry(&dynamicflag)
 
 	if err != nil {
 		log.Errorf("Error while creating dynamic flag for challenge %s : %s", challenge_name, err)
@@ -900,3 +1082,67 @@ func ValidateFlag(flag, challenge_name string)  error{
 	}
 	return nil
 }
+
+// freeHints returns the text of the hints which are visible to everyone
+// without unlocking them.
+func freeHints(hints []cfg.Hint) []string {
+	var free []string
+	for _, hint := range hints {
+		if hint.Cost == 0 && hint.UnlockAfter == "" {
+			free = append(free, hint.Text)
+		}
+	}
+
+	return free
+}
+
+// hintEntries converts the hints in the challenge config to their database entries.
+func hintEntries(hints []cfg.Hint) ([]database.Hint, error) {
+	entries := make([]database.Hint, len(hints))
+	for i := range hints {
+		unlockAfter, err := hints[i].UnlockDuration()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid unlock_after for hint %d : %s", i+1, err)
+		}
+
+		entries[i] = database.Hint{
+			Text:        hints[i].Text,
+			Cost:        hints[i].Cost,
+			UnlockAfter: int64(unlockAfter / time.Second),
+		}
+	}
+
+	return entries, nil
+}
+
+// UpdateChallengeHints updates the hints of the challenge to the ones provided, the
+// hints are matched by their position so the unlocks of the hints that are kept
+// remain. The unlocks of the removed hints are deleted and the scores are recomputed
+// so that the cost paid for them is refunded.
+func UpdateChallengeHints(challenge *database.Challenge, hints []cfg.Hint) error {
+	for i := range hints {
+		if err := hints[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	entries, err := hintEntries(hints)
+	if err != nil {
+		return err
+	}
+
+	err = database.SyncChallengeHints(challenge.ID, entries)
+	if err != nil {
+		return fmt.Errorf("Error while updating hints for challenge %s : %s", challenge.Name, err)
+	}
+
+	err = database.UpdateChallenge(challenge, map[string]interface{}{
+		"Hints": strings.Join(freeHints(hints), core.DELIMITER),
+	})
+	if err != nil {
+		return fmt.Errorf("Error while updating hints for challenge %s : %s", challenge.Name, err)
+	}
+
+	_, err = RecomputeScores(true)
+	return err
+}
@@ -87,6 +87,12 @@ func CleanupChallengeIfExist(config cfg.BeastChallengeConfig) error {
 		log.Warn("Looks like we don't have the image ID in database for challenge, Nothing to remove")
 		return nil
 	}
+
+	// The image might already be removed along with the image history of the challenge.
+	if exists, err := cr.CheckIfImageExists(chall.ImageId); err == nil && !exists {
+		database.UpdateChallenge(&chall, map[string]interface{}{"ImageId": GetTempImageId(chall.Name)})
+		return nil
+	}
 	err = CleanupChallengeImage(&chall)
 	return err
 }
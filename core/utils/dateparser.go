@@ -1,13 +1,10 @@
 package utils
 
 import (
-	"fmt"
 	"strings"
 	"time"
 
 	"github.com/sdslabs/beastv4/core/config"
-
-	"github.com/araddon/dateparse"
 )
 
 func CheckTime() (error, int) {
@@ -21,24 +18,12 @@ func CheckTime() (error, int) {
 	time.Local = loc
 	currentTime := time.Now().In(loc)
 
-	compStartTime := strings.Split(competitionInfo.StartingTime, ",")
-	compStartDate := strings.Split(compStartTime[1][1:], " ")
-	startDate := fmt.Sprintf("%s %s, %s", compStartDate[1], compStartDate[0], compStartDate[2])
-	startTime := strings.Split(compStartTime[0], " ")[0]
-	startTime = fmt.Sprintf("%s, %s", startDate, startTime)
-
-	st, err := dateparse.ParseLocal(startTime)
+	st, err := config.ParseCompetitionTime(competitionInfo.StartingTime)
 	if err != nil {
 		return err, -1
 	}
 
-	compEndTime := strings.Split(competitionInfo.EndingTime, ",")
-	compEndDate := strings.Split(compEndTime[1][1:], " ")
-	endDate := fmt.Sprintf("%s %s, %s", compEndDate[1], compEndDate[0], compEndDate[2])
-	endTime := strings.Split(compEndTime[0], " ")[0]
-	endTime = fmt.Sprintf("%s, %s", endDate, endTime)
-
-	et, err := dateparse.ParseLocal(endTime)
+	et, err := config.ParseCompetitionTime(competitionInfo.EndingTime)
 	if err != nil {
 		return err, -1
 	}
@@ -53,3 +38,46 @@ func CheckTime() (error, int) {
 
 	return nil, 1
 }
+
+// GetCompetitionStartTime returns the starting time of the competition.
+func GetCompetitionStartTime() (time.Time, error) {
+	competitionInfo, err := config.GetCompetitionInfo()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return competitionTimeIn(competitionInfo.StartingTime, competitionInfo.TimeZone)
+}
+
+// GetCompetitionFreezeTime returns the time after which the scoreboard is frozen,
+// zero if the competition does not have a freeze time.
+func GetCompetitionFreezeTime() (time.Time, error) {
+	competitionInfo, err := config.GetCompetitionInfo()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if competitionInfo.FreezeTime == "" {
+		return time.Time{}, nil
+	}
+
+	return competitionTimeIn(competitionInfo.FreezeTime, competitionInfo.TimeZone)
+}
+
+// competitionTimeIn parses the time of the competition in the timezone of the competition.
+func competitionTimeIn(compTime, timezone string) (time.Time, error) {
+	loc, err := time.LoadLocation(strings.Split(timezone, ":")[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	parsed, err := config.ParseCompetitionTime(compTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// ParseLocal uses the local timezone, interpret the parsed time in
+	// the timezone of the competition instead.
+	return time.Date(parsed.Year(), parsed.Month(), parsed.Day(),
+		parsed.Hour(), parsed.Minute(), parsed.Second(), 0, loc), nil
+}
@@ -35,3 +35,27 @@ func IsImageIdValid(a string) bool {
 func IsContainerIdValid(a string) bool {
 	return ((!strings.HasPrefix(a, core.CONTAINER_NA)) && a != "")
 }
+
+// ServiceContainerName returns the name of the container, which is also
+// the tag of the image built, of the service of the challenge.
+func ServiceContainerName(challengeName, service string) string {
+	return fmt.Sprintf("%s-%s", EncodeID(challengeName), service)
+}
+
+// ChallengeNetworkName returns the name of the network shared by the
+// containers of the challenge.
+func ChallengeNetworkName(challengeName string) string {
+	return fmt.Sprintf("%s-network", EncodeID(challengeName))
+}
+
+// InstanceNetworkName returns the name of the network of the instance of a
+// challenge.
+func InstanceNetworkName(instanceID uint) string {
+	return fmt.Sprintf("beast-instance-%d-network", instanceID)
+}
+
+// EgressProxyName returns the name of the container of the egress proxy of
+// the challenge.
+func EgressProxyName(challengeName string) string {
+	return EncodeID(challengeName) + core.EGRESS_PROXY_SUFFIX
+}
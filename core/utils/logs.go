@@ -3,13 +3,16 @@ package utils
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/sdslabs/beastv4/core"
 	"github.com/sdslabs/beastv4/core/database"
 	"github.com/sdslabs/beastv4/pkg/cr"
 )
 
-func GetLogs(challname string, live bool) (*cr.Log, error) {
+// GetLogs returns the logs of the container of the challenge, or of the container
+// of the service of the challenge if service is not empty.
+func GetLogs(challname, service string, live bool) (*cr.Log, error) {
 	chall, err := database.QueryFirstChallengeEntry("name", challname)
 	if err != nil {
 		return nil, fmt.Errorf("Error while database access : %s", err)
@@ -23,9 +26,14 @@ func GetLogs(challname string, live bool) (*cr.Log, error) {
 		return nil, fmt.Errorf("Underlying challenge configuration present is not valid.")
 	}
 
-	containers, err := cr.SearchContainerByFilter(map[string]string{"id": chall.ContainerId})
+	filter := map[string]string{"id": chall.ContainerId}
+	if service != "" {
+		filter = map[string]string{"name": fmt.Sprintf("^/%s$", ServiceContainerName(chall.Name, service))}
+	}
+
+	containers, err := cr.SearchContainerByFilter(filter)
 	if err != nil {
-		return nil, fmt.Errorf("Error while searching for container with id %s", chall.ContainerId)
+		return nil, fmt.Errorf("Error while searching for container of %s", challname)
 	}
 
 	if len(containers) > 1 {
@@ -37,9 +45,30 @@ func GetLogs(challname string, live bool) (*cr.Log, error) {
 	}
 
 	if live {
-		cr.ShowLiveContainerLogs(chall.ContainerId)
+		cr.ShowLiveContainerLogs(containers[0].ID)
 		return nil, nil
 	}
 
-	return cr.GetContainerStdLogs(chall.ContainerId)
+	return cr.GetContainerStdLogs(containers[0].ID)
+}
+
+// GetServiceStates returns the state, like running or exited, of the container of
+// each service of the challenge which exists.
+func GetServiceStates(challname string) (map[string]string, error) {
+	prefix := fmt.Sprintf("/%s-", EncodeID(challname))
+	containers, err := cr.SearchContainerByFilter(map[string]string{"name": "^" + prefix})
+	if err != nil {
+		return nil, fmt.Errorf("Error while searching for containers of services of %s : %s", challname, err)
+	}
+
+	states := make(map[string]string)
+	for _, container := range containers {
+		for _, name := range container.Names {
+			if strings.HasPrefix(name, prefix) {
+				states[strings.TrimPrefix(name, prefix)] = container.State
+			}
+		}
+	}
+
+	return states, nil
 }
@@ -2,19 +2,10 @@ package cr
 
 import (
 	"fmt"
-	"io/ioutil"
-	"strconv"
+	"time"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
-	"github.com/sdslabs/beastv4/pkg/defaults"
-
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/net/context"
 )
 
 type PortMapping struct {
@@ -63,6 +54,15 @@ type CreateContainerConfig struct {
 	CPUShares int64
 	Memory    int64
 	PidsLimit int64
+
+	// Ports exposed to the other containers in the network without binding
+	// them on the host, and the aliases of the container in the network.
+	InternalPorts  []uint32
+	NetworkAliases []string
+
+	// Entrypoint and command overriding the ones of the image if not empty.
+	Entrypoint []string
+	Cmd        []string
 }
 
 func (c *CreateContainerConfig) TrafficType() string {
@@ -79,183 +79,72 @@ type Log struct {
 }
 
 func SearchContainerByFilter(filterMap map[string]string) ([]types.Container, error) {
-	cli, err := client.NewEnvClient()
-	if err != nil {
-		return []types.Container{}, err
-	}
-
-	filterArgs := filters.NewArgs()
-	for key, val := range filterMap {
-		filterArgs.Add(key, val)
-	}
-
-	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{
-		All:     true,
-		Filters: filterArgs,
-	})
-
-	return containers, err
+	return GetRuntime().SearchContainerByFilter(filterMap)
 }
 
 func StopAndRemoveContainer(containerId string) error {
-	cli, err := client.NewEnvClient()
-	if err != nil {
-		return err
-	}
-
-	// Try to stop using default timeout we are using for beast
-	err = cli.ContainerStop(context.Background(), containerId, &defaults.DefaultDockerStopTimeout)
-	if err != nil {
-		return err
-	}
-	log.Debug("Stopped container with ID ", containerId)
-
-	log.Debug("Removing container with ID ", containerId)
-	err = cli.ContainerRemove(context.Background(), containerId, types.ContainerRemoveOptions{
-		RemoveVolumes: false,
-		RemoveLinks:   false,
-		Force:         true,
-	})
-
-	return err
+	return GetRuntime().RemoveContainer(containerId)
 }
 
 func CreateContainerFromImage(containerConfig *CreateContainerConfig) (string, error) {
-	containerName := containerConfig.ContainerName
-	ctx := context.Background()
-	cli, err := client.NewEnvClient()
-	if err != nil {
-		return "", err
-	}
-
-	portSet := make(nat.PortSet)
-	portMap := make(nat.PortMap)
-
-	for _, portMapping := range containerConfig.PortMapping {
-		natPort, err := nat.NewPort(containerConfig.TrafficType(), strconv.Itoa(int(portMapping.ContainerPort)))
-		if err != nil {
-			return "", fmt.Errorf("Error while creating new port from port %d", portMapping.ContainerPort)
-		}
-
-		portSet[natPort] = struct{}{}
-
-		portMap[natPort] = []nat.PortBinding{{
-			HostIP:   "0.0.0.0",
-			HostPort: strconv.Itoa(int(portMapping.HostPort)),
-		}}
-	}
-
-	config := &container.Config{
-		Image:        containerConfig.ImageId,
-		ExposedPorts: portSet,
-		Env:          containerConfig.ContainerEnv,
-	}
-
-	var mountBindings []mount.Mount
-	for src, dest := range containerConfig.MountsMap {
-		mnt := mount.Mount{
-			Type:   mount.TypeBind,
-			Source: src,
-			Target: dest,
-		}
-
-		mountBindings = append(mountBindings, mnt)
-	}
-
-	resources := container.Resources{
-		CPUShares: containerConfig.CPUShares,
-		Memory:    containerConfig.Memory,
-		PidsLimit: containerConfig.PidsLimit,
-	}
-
-	hostConfig := &container.HostConfig{
-		PortBindings: portMap,
-		Mounts:       mountBindings,
-		NetworkMode:  container.NetworkMode(containerConfig.ContainerNetwork),
-		Resources:    resources,
-	}
-
-	createResp, err := cli.ContainerCreate(ctx, config, hostConfig, nil, containerName)
-	if err != nil {
-		log.Error("Error while creating the container with name %s", containerName)
-		return "", err
-	}
-
-	containerId := createResp.ID
-	if len(createResp.Warnings) > 0 {
-		log.Warnf("Warnings while creating the container : %s", createResp.Warnings)
-	}
-
-	if err := cli.ContainerStart(ctx, containerId, types.ContainerStartOptions{}); err != nil {
-		log.Error("Error while starting the container : %s", err)
-		return "", err
-	}
-
-	return containerId, nil
+	return GetRuntime().CreateContainer(containerConfig)
 }
 
 func GetContainerStdLogs(containerID string) (*Log, error) {
-	cli, err := client.NewEnvClient()
-	if err != nil {
-		return nil, err
-	}
+	runtime := GetRuntime()
 
-	stdout, err := cli.ContainerLogs(context.Background(), containerID, types.ContainerLogsOptions{
-		ShowStdout: true,
-		Details:    true,
-	})
+	stdout, err := runtime.ContainerLogs(containerID, true, false)
 	if err != nil {
 		return nil, err
 	}
-	defer stdout.Close()
-
-	stdoutlogs, _ := ioutil.ReadAll(stdout)
 
-	stderr, err := cli.ContainerLogs(context.Background(), containerID, types.ContainerLogsOptions{
-		ShowStderr: true,
-		Details:    true,
-	})
+	stderr, err := runtime.ContainerLogs(containerID, false, true)
 	if err != nil {
 		return nil, err
 	}
-	defer stderr.Close()
 
-	stderrlogs, _ := ioutil.ReadAll(stderr)
-
-	return &Log{Stdout: string(stdoutlogs), Stderr: string(stderrlogs)}, nil
+	return &Log{Stdout: stdout, Stderr: stderr}, nil
 }
 
 func ShowLiveContainerLogs(containerID string) {
-	cli, err := client.NewEnvClient()
+	logs, err := GetRuntime().ContainerLogs(containerID, true, true)
 	if err != nil {
 		log.Error(err)
 	}
 
-	stream, err := cli.ContainerLogs(context.Background(), containerID, types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Details:    true,
-	})
-	if err != nil {
-		log.Error(err)
-	}
-	defer stream.Close()
-
-	logs, _ := ioutil.ReadAll(stream)
-	fmt.Println(string(logs))
+	fmt.Println(logs)
 }
 
 func CommitContainer(containerId string) (string, error) {
-	ctx := context.Background()
-	cli, err := client.NewEnvClient()
-	if err != nil {
-		return "", err
-	}
+	return GetRuntime().CommitContainer(containerId)
+}
 
-	commitResp, err := cli.ContainerCommit(ctx, containerId, types.ContainerCommitOptions{})
-	if err != nil {
-		return "", err
-	}
+// StopContainer stops the container without removing it, so that it can
+// be started again with StartContainer.
+func StopContainer(containerId string) error {
+	return GetRuntime().StopContainer(containerId)
+}
+
+func StartContainer(containerId string) error {
+	return GetRuntime().StartContainer(containerId)
+}
+
+// RestartContainer stops the container, if running, and starts it again.
+func RestartContainer(containerId string) error {
+	return GetRuntime().RestartContainer(containerId)
+}
+
+func RenameContainer(containerId, name string) error {
+	return GetRuntime().RenameContainer(containerId, name)
+}
+
+// IsContainerRunning checks if the container exists and is running.
+func IsContainerRunning(containerId string) (bool, error) {
+	return GetRuntime().IsContainerRunning(containerId)
+}
 
-	return commitResp.ID, nil
+// ExecInContainer runs the command inside the running container and waits for it to
+// exit for at most timeout. The exit code and the output of the command are returned.
+func ExecInContainer(containerId string, cmd []string, timeout time.Duration) (int, string, error) {
+	return GetRuntime().ExecInContainer(containerId, cmd, timeout)
 }
@@ -0,0 +1,554 @@
+package cr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/sdslabs/beastv4/pkg/defaults"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// DockerRuntime is the runtime using the docker engine API. The client is
+// configured from the environment, like DOCKER_HOST, unless a host is set.
+type DockerRuntime struct {
+	// Host is the address of the API like `unix:///var/run/docker.sock`.
+	Host string
+}
+
+func NewDockerRuntime() *DockerRuntime {
+	return &DockerRuntime{}
+}
+
+func (d *DockerRuntime) Name() string {
+	return DockerRuntimeName
+}
+
+func (d *DockerRuntime) newClient() (*client.Client, error) {
+	if d.Host == "" {
+		return client.NewEnvClient()
+	}
+
+	return client.NewClient(d.Host, client.DefaultVersion, nil, nil)
+}
+
+func (d *DockerRuntime) BuildImage(challengeName, challengeTag, tarContextPath, dockerCtxFile string, noCache bool) (*bytes.Buffer, string, error) {
+	builderContext, err := os.Open(tarContextPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error while opening staged file :: %s", tarContextPath)
+	}
+	defer builderContext.Close()
+
+	buildOptions := types.ImageBuildOptions{
+		Tags:       []string{challengeTag},
+		Remove:     true,
+		Dockerfile: dockerCtxFile,
+		NoCache:    noCache,
+	}
+
+	dockerClient, err := d.newClient()
+	if err != nil {
+		return nil, "", fmt.Errorf("Error while creating a docker client for beast: %s", err)
+	}
+
+	log.Debug("Image build in process")
+	imageBuildResp, err := dockerClient.ImageBuild(context.Background(), builderContext, buildOptions)
+	if err != nil {
+		return nil, "", fmt.Errorf("An error while build image for challenge %s :: %s", challengeName, err)
+	}
+	defer imageBuildResp.Body.Close()
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(imageBuildResp.Body)
+
+	images, err := d.SearchImageByFilter(map[string]string{"reference": fmt.Sprintf("%s:latest", challengeTag)})
+	if len(images) > 0 {
+		log.Infof("Image ID for the image built is : %s", images[0].ID[7:])
+		return buf, images[0].ID[7:], nil
+	}
+
+	return buf, "", err
+}
+
+func (d *DockerRuntime) RemoveImage(imageId string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = cli.ImageRemove(context.Background(), imageId, types.ImageRemoveOptions{
+		Force:         false,
+		PruneChildren: true,
+	})
+
+	return err
+}
+
+func (d *DockerRuntime) CheckIfImageExists(imageId string) (bool, error) {
+	ctx := context.Background()
+	cli, err := d.newClient()
+	if err != nil {
+		return false, err
+	}
+
+	inspectVal, _, err := cli.ImageInspectWithRaw(ctx, imageId)
+	if err != nil {
+		return false, err
+	}
+
+	if inspectVal.ID != "" {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (d *DockerRuntime) SearchImageByFilter(filterMap map[string]string) ([]types.ImageSummary, error) {
+	cli, err := d.newClient()
+	if err != nil {
+		return []types.ImageSummary{}, err
+	}
+
+	filterArgs := filters.NewArgs()
+	for key, val := range filterMap {
+		filterArgs.Add(key, val)
+	}
+
+	images, err := cli.ImageList(context.Background(), types.ImageListOptions{
+		All:     false,
+		Filters: filterArgs,
+	})
+
+	return images, err
+}
+
+func (d *DockerRuntime) TagImage(imageId, ref string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.ImageTag(context.Background(), imageId, ref)
+}
+
+func (d *DockerRuntime) PullImage(ref string) (*bytes.Buffer, error) {
+	cli, err := d.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cli.ImagePull(context.Background(), ref, types.ImagePullOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error while pulling image %s :: %s", ref, err)
+	}
+	defer resp.Close()
+
+	// The pull completes only once the whole output is read.
+	buf := new(bytes.Buffer)
+	if _, err = buf.ReadFrom(resp); err != nil {
+		return buf, fmt.Errorf("Error while pulling image %s :: %s", ref, err)
+	}
+
+	return buf, nil
+}
+
+func (d *DockerRuntime) CreateContainer(containerConfig *CreateContainerConfig) (string, error) {
+	containerName := containerConfig.ContainerName
+	ctx := context.Background()
+	cli, err := d.newClient()
+	if err != nil {
+		return "", err
+	}
+
+	portSet := make(nat.PortSet)
+	portMap := make(nat.PortMap)
+
+	for _, portMapping := range containerConfig.PortMapping {
+		natPort, err := nat.NewPort(containerConfig.TrafficType(), strconv.Itoa(int(portMapping.ContainerPort)))
+		if err != nil {
+			return "", fmt.Errorf("Error while creating new port from port %d", portMapping.ContainerPort)
+		}
+
+		portSet[natPort] = struct{}{}
+
+		portMap[natPort] = []nat.PortBinding{{
+			HostIP:   "0.0.0.0",
+			HostPort: strconv.Itoa(int(portMapping.HostPort)),
+		}}
+	}
+
+	for _, port := range containerConfig.InternalPorts {
+		natPort, err := nat.NewPort(containerConfig.TrafficType(), strconv.Itoa(int(port)))
+		if err != nil {
+			return "", fmt.Errorf("Error while creating new port from port %d", port)
+		}
+
+		portSet[natPort] = struct{}{}
+	}
+
+	config := &container.Config{
+		Image:        containerConfig.ImageId,
+		ExposedPorts: portSet,
+		Env:          containerConfig.ContainerEnv,
+		Entrypoint:   containerConfig.Entrypoint,
+		Cmd:          containerConfig.Cmd,
+	}
+
+	var mountBindings []mount.Mount
+	for src, dest := range containerConfig.MountsMap {
+		mnt := mount.Mount{
+			Type:   mount.TypeBind,
+			Source: src,
+			Target: dest,
+		}
+
+		mountBindings = append(mountBindings, mnt)
+	}
+
+	resources := container.Resources{
+		CPUShares: containerConfig.CPUShares,
+		Memory:    containerConfig.Memory,
+		PidsLimit: containerConfig.PidsLimit,
+	}
+
+	hostConfig := &container.HostConfig{
+		PortBindings: portMap,
+		Mounts:       mountBindings,
+		NetworkMode:  container.NetworkMode(containerConfig.ContainerNetwork),
+		Resources:    resources,
+	}
+
+	var networkingConfig *network.NetworkingConfig
+	if containerConfig.ContainerNetwork != "" && len(containerConfig.NetworkAliases) > 0 {
+		networkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				containerConfig.ContainerNetwork: {Aliases: containerConfig.NetworkAliases},
+			},
+		}
+	}
+
+	createResp, err := cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, containerName)
+	if err != nil {
+		log.Errorf("Error while creating the container with name %s", containerName)
+		return "", err
+	}
+
+	containerId := createResp.ID
+	if len(createResp.Warnings) > 0 {
+		log.Warnf("Warnings while creating the container : %s", createResp.Warnings)
+	}
+
+	if err := cli.ContainerStart(ctx, containerId, types.ContainerStartOptions{}); err != nil {
+		log.Errorf("Error while starting the container : %s", err)
+		return "", err
+	}
+
+	return containerId, nil
+}
+
+func (d *DockerRuntime) StartContainer(containerId string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.ContainerStart(context.Background(), containerId, types.ContainerStartOptions{})
+}
+
+func (d *DockerRuntime) StopContainer(containerId string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.ContainerStop(context.Background(), containerId, &defaults.DefaultDockerStopTimeout)
+}
+
+func (d *DockerRuntime) RestartContainer(containerId string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.ContainerRestart(context.Background(), containerId, &defaults.DefaultDockerStopTimeout)
+}
+
+func (d *DockerRuntime) RemoveContainer(containerId string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	// Try to stop using default timeout we are using for beast
+	err = cli.ContainerStop(context.Background(), containerId, &defaults.DefaultDockerStopTimeout)
+	if err != nil {
+		return err
+	}
+	log.Debug("Stopped container with ID ", containerId)
+
+	log.Debug("Removing container with ID ", containerId)
+	err = cli.ContainerRemove(context.Background(), containerId, types.ContainerRemoveOptions{
+		RemoveVolumes: false,
+		RemoveLinks:   false,
+		Force:         true,
+	})
+
+	return err
+}
+
+func (d *DockerRuntime) RenameContainer(containerId, name string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.ContainerRename(context.Background(), containerId, name)
+}
+
+func (d *DockerRuntime) IsContainerRunning(containerId string) (bool, error) {
+	cli, err := d.newClient()
+	if err != nil {
+		return false, err
+	}
+
+	info, err := cli.ContainerInspect(context.Background(), containerId)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return info.State != nil && info.State.Running, nil
+}
+
+func (d *DockerRuntime) SearchContainerByFilter(filterMap map[string]string) ([]types.Container, error) {
+	cli, err := d.newClient()
+	if err != nil {
+		return []types.Container{}, err
+	}
+
+	filterArgs := filters.NewArgs()
+	for key, val := range filterMap {
+		filterArgs.Add(key, val)
+	}
+
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{
+		All:     true,
+		Filters: filterArgs,
+	})
+
+	return containers, err
+}
+
+func (d *DockerRuntime) ContainerLogs(containerId string, stdout, stderr bool) (string, error) {
+	cli, err := d.newClient()
+	if err != nil {
+		return "", err
+	}
+
+	stream, err := cli.ContainerLogs(context.Background(), containerId, types.ContainerLogsOptions{
+		ShowStdout: stdout,
+		ShowStderr: stderr,
+		Details:    true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	logs, _ := ioutil.ReadAll(stream)
+	return string(logs), nil
+}
+
+func (d *DockerRuntime) CommitContainer(containerId string) (string, error) {
+	ctx := context.Background()
+	cli, err := d.newClient()
+	if err != nil {
+		return "", err
+	}
+
+	commitResp, err := cli.ContainerCommit(ctx, containerId, types.ContainerCommitOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return commitResp.ID, nil
+}
+
+func (d *DockerRuntime) ExecInContainer(containerId string, cmd []string, timeout time.Duration) (int, string, error) {
+	cli, err := d.newClient()
+	if err != nil {
+		return 0, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// A tty is used so that stdout and stderr are not multiplexed in the output.
+	execConfig := types.ExecConfig{
+		Cmd:          cmd,
+		Tty:          true,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+
+	execResp, err := cli.ContainerExecCreate(ctx, containerId, execConfig)
+	if err != nil {
+		return 0, "", err
+	}
+
+	resp, err := cli.ContainerExecAttach(ctx, execResp.ID, execConfig)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		resp.Conn.SetDeadline(deadline)
+	}
+
+	output, err := ioutil.ReadAll(resp.Reader)
+	if err != nil {
+		return 0, string(output), err
+	}
+
+	for {
+		info, err := cli.ContainerExecInspect(ctx, execResp.ID)
+		if err != nil {
+			return 0, string(output), err
+		}
+
+		if !info.Running {
+			return info.ExitCode, string(output), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, string(output), ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (d *DockerRuntime) ContainerStats(containerId string) (*ContainerStats, error) {
+	cli, err := d.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cli.ContainerStats(context.Background(), containerId, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var raw types.StatsJSON
+	if err = json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	stats := &ContainerStats{
+		ContainerId: containerId,
+		CPUPercent:  cpuPercent(&raw),
+		MemoryUsage: raw.MemoryStats.Usage,
+		MemoryLimit: raw.MemoryStats.Limit,
+		Pids:        raw.PidsStats.Current,
+		PidsLimit:   raw.PidsStats.Limit,
+		SampledAt:   raw.Read,
+	}
+
+	// The page cache is counted in the usage but can be reclaimed, so it is not
+	// counted as used like the docker CLI does.
+	if cache, ok := raw.MemoryStats.Stats["cache"]; ok && cache < stats.MemoryUsage {
+		stats.MemoryUsage -= cache
+	}
+
+	for _, network := range raw.Networks {
+		stats.NetworkRx += network.RxBytes
+		stats.NetworkTx += network.TxBytes
+	}
+
+	return stats, nil
+}
+
+func (d *DockerRuntime) CreateNetworkIfNotExist(name string, internal bool) (string, error) {
+	ctx := context.Background()
+	cli, err := d.newClient()
+	if err != nil {
+		return "", err
+	}
+
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("name", name)
+
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{
+		Filters: filterArgs,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The name filter also matches the networks with the name as a substring.
+	for _, n := range networks {
+		if n.Name == name {
+			if n.Internal != internal {
+				return "", fmt.Errorf("network %s exists with internal set to %t", name, n.Internal)
+			}
+			return n.ID, nil
+		}
+	}
+
+	resp, err := cli.NetworkCreate(ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Internal:       internal,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Warning != "" {
+		log.Warnf("Warnings while creating the network %s : %s", name, resp.Warning)
+	}
+
+	return resp.ID, nil
+}
+
+func (d *DockerRuntime) RemoveNetwork(name string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	err = cli.NetworkRemove(context.Background(), name)
+	if err != nil && client.IsErrNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (d *DockerRuntime) ConnectContainerToNetwork(containerId, networkName string, aliases []string) error {
+	cli, err := d.newClient()
+	if err != nil {
+		return err
+	}
+
+	return cli.NetworkConnect(context.Background(), networkName, containerId, &network.EndpointSettings{
+		Aliases: aliases,
+	})
+}
@@ -0,0 +1,646 @@
+package cr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// FakeRuntime is an in-memory runtime which keeps track of the images, containers
+// and networks without running anything, so that the packages using the runtime
+// can be tested without a container runtime.
+//
+// Errors can be injected for the methods of the runtime using Fail, and the result
+// of the commands run in the containers is decided by ExecFunc.
+type FakeRuntime struct {
+	// ExecFunc returns the exit code and the output of the command run in the
+	// container, the commands exit with code 0 and no output if it is nil.
+	ExecFunc func(containerId string, cmd []string) (int, string, error)
+
+	mutex      sync.Mutex
+	seq        int
+	images     map[string]*fakeImage
+	containers map[string]*fakeContainer
+	networks   map[string]*fakeNetwork
+	failures   map[string]error
+}
+
+type fakeImage struct {
+	id      string
+	tags    []string
+	created time.Time
+}
+
+type fakeContainer struct {
+	id       string
+	name     string
+	imageId  string
+	running  bool
+	config   CreateContainerConfig
+	networks map[string][]string
+	stdout   string
+	stderr   string
+	created  time.Time
+}
+
+type fakeNetwork struct {
+	id       string
+	name     string
+	internal bool
+}
+
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		images:     make(map[string]*fakeImage),
+		containers: make(map[string]*fakeContainer),
+		networks:   make(map[string]*fakeNetwork),
+		failures:   make(map[string]error),
+	}
+}
+
+func (f *FakeRuntime) Name() string {
+	return FakeRuntimeName
+}
+
+// Fail makes the method of the runtime with the name, like `CreateContainer`,
+// return the error until it is cleared by calling Fail with a nil error.
+func (f *FakeRuntime) Fail(method string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err == nil {
+		delete(f.failures, method)
+	} else {
+		f.failures[method] = err
+	}
+}
+
+// AddImage adds an image with the tags, as if it was pulled, and returns its ID.
+func (f *FakeRuntime) AddImage(tags ...string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.addImage(tags...).id
+}
+
+// SetContainerLogs sets the logs written by the container.
+func (f *FakeRuntime) SetContainerLogs(containerId, stdout, stderr string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return err
+	}
+
+	c.stdout, c.stderr = stdout, stderr
+	return nil
+}
+
+// ContainerConfig returns the configuration the container was created with.
+func (f *FakeRuntime) ContainerConfig(containerId string) (*CreateContainerConfig, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	config := c.config
+	return &config, nil
+}
+
+func (f *FakeRuntime) failure(method string) error {
+	return f.failures[method]
+}
+
+// newID returns a new ID of the same format as the IDs of docker.
+func (f *FakeRuntime) newID() string {
+	f.seq++
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("fake-%d", f.seq))))
+}
+
+func (f *FakeRuntime) addImage(tags ...string) *fakeImage {
+	// A tag refers to a single image, so it is moved to the new image.
+	for _, image := range f.images {
+		image.tags = removeTags(image.tags, tags)
+	}
+
+	image := &fakeImage{
+		id:      f.newID(),
+		tags:    tags,
+		created: time.Now(),
+	}
+	f.images[image.id] = image
+
+	return image
+}
+
+func removeTags(tags, removed []string) []string {
+	kept := tags[:0]
+	for _, tag := range tags {
+		found := false
+		for _, r := range removed {
+			if tag == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+// normalizeRef adds the latest tag to the reference without a tag.
+func normalizeRef(ref string) string {
+	if i := strings.LastIndex(ref, ":"); i < 0 || strings.Contains(ref[i:], "/") {
+		return ref + ":latest"
+	}
+	return ref
+}
+
+// image returns the image with the ID, a prefix of the ID or a tag.
+func (f *FakeRuntime) image(ref string) (*fakeImage, error) {
+	ref = strings.TrimPrefix(ref, "sha256:")
+	if image, ok := f.images[ref]; ok {
+		return image, nil
+	}
+
+	for _, image := range f.images {
+		if strings.HasPrefix(image.id, ref) {
+			return image, nil
+		}
+		for _, tag := range image.tags {
+			if tag == normalizeRef(ref) {
+				return image, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("No such image: %s", ref)
+}
+
+// container returns the container with the ID, a prefix of the ID or the name.
+func (f *FakeRuntime) container(ref string) (*fakeContainer, error) {
+	if c, ok := f.containers[ref]; ok {
+		return c, nil
+	}
+
+	for _, c := range f.containers {
+		if (ref != "" && strings.HasPrefix(c.id, ref)) || c.name == strings.TrimPrefix(ref, "/") {
+			return c, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No such container: %s", ref)
+}
+
+func (f *FakeRuntime) BuildImage(challengeName, challengeTag, tarContextPath, dockerCtxFile string, noCache bool) (*bytes.Buffer, string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("BuildImage"); err != nil {
+		return nil, "", fmt.Errorf("An error while build image for challenge %s :: %s", challengeName, err)
+	}
+
+	image := f.addImage(normalizeRef(challengeTag))
+	buf := bytes.NewBufferString(fmt.Sprintf("{\"stream\":\"Successfully built %s\\n\"}\n", image.id[:12]))
+
+	return buf, image.id, nil
+}
+
+func (f *FakeRuntime) RemoveImage(imageId string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("RemoveImage"); err != nil {
+		return err
+	}
+
+	image, err := f.image(imageId)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range f.containers {
+		if c.imageId == image.id {
+			return fmt.Errorf("conflict: unable to remove image %s, image is being used by container %s", imageId, c.id[:12])
+		}
+	}
+
+	delete(f.images, image.id)
+	return nil
+}
+
+func (f *FakeRuntime) CheckIfImageExists(imageId string) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("CheckIfImageExists"); err != nil {
+		return false, err
+	}
+
+	if _, err := f.image(imageId); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SearchImageByFilter supports the `reference` filter, the reference is matched
+// with the tags of the images.
+func (f *FakeRuntime) SearchImageByFilter(filterMap map[string]string) ([]types.ImageSummary, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("SearchImageByFilter"); err != nil {
+		return []types.ImageSummary{}, err
+	}
+
+	images := []types.ImageSummary{}
+	for _, image := range f.images {
+		if ref, ok := filterMap["reference"]; ok {
+			found := false
+			for _, tag := range image.tags {
+				if tag == normalizeRef(ref) {
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		images = append(images, types.ImageSummary{
+			ID:       "sha256:" + image.id,
+			RepoTags: append([]string{}, image.tags...),
+			Created:  image.created.Unix(),
+		})
+	}
+
+	return images, nil
+}
+
+func (f *FakeRuntime) TagImage(imageId, ref string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("TagImage"); err != nil {
+		return err
+	}
+
+	image, err := f.image(imageId)
+	if err != nil {
+		return err
+	}
+
+	ref = normalizeRef(ref)
+	for _, other := range f.images {
+		other.tags = removeTags(other.tags, []string{ref})
+	}
+	image.tags = append(image.tags, ref)
+
+	return nil
+}
+
+// PullImage adds an image with the reference unless it already exists.
+func (f *FakeRuntime) PullImage(ref string) (*bytes.Buffer, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("PullImage"); err != nil {
+		return nil, fmt.Errorf("Error while pulling image %s :: %s", ref, err)
+	}
+
+	if _, err := f.image(ref); err != nil {
+		f.addImage(normalizeRef(ref))
+	}
+
+	return bytes.NewBufferString(fmt.Sprintf("{\"status\":\"Downloaded newer image for %s\"}\n", ref)), nil
+}
+
+func (f *FakeRuntime) CreateContainer(containerConfig *CreateContainerConfig) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("CreateContainer"); err != nil {
+		return "", err
+	}
+
+	image, err := f.image(containerConfig.ImageId)
+	if err != nil {
+		return "", err
+	}
+
+	if containerConfig.ContainerName != "" {
+		if _, err := f.container(containerConfig.ContainerName); err == nil {
+			return "", fmt.Errorf("Conflict. The container name %q is already in use", containerConfig.ContainerName)
+		}
+	}
+
+	c := &fakeContainer{
+		id:       f.newID(),
+		name:     containerConfig.ContainerName,
+		imageId:  image.id,
+		running:  true,
+		config:   *containerConfig,
+		networks: make(map[string][]string),
+		created:  time.Now(),
+	}
+	if c.name == "" {
+		c.name = c.id[:12]
+	}
+	if containerConfig.ContainerNetwork != "" {
+		c.networks[containerConfig.ContainerNetwork] = containerConfig.NetworkAliases
+	}
+	f.containers[c.id] = c
+
+	return c.id, nil
+}
+
+func (f *FakeRuntime) setRunning(method, containerId string, running bool) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure(method); err != nil {
+		return err
+	}
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return err
+	}
+
+	c.running = running
+	return nil
+}
+
+func (f *FakeRuntime) StartContainer(containerId string) error {
+	return f.setRunning("StartContainer", containerId, true)
+}
+
+func (f *FakeRuntime) StopContainer(containerId string) error {
+	return f.setRunning("StopContainer", containerId, false)
+}
+
+func (f *FakeRuntime) RestartContainer(containerId string) error {
+	return f.setRunning("RestartContainer", containerId, true)
+}
+
+func (f *FakeRuntime) RemoveContainer(containerId string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("RemoveContainer"); err != nil {
+		return err
+	}
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return err
+	}
+
+	delete(f.containers, c.id)
+	return nil
+}
+
+func (f *FakeRuntime) RenameContainer(containerId, name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("RenameContainer"); err != nil {
+		return err
+	}
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return err
+	}
+
+	if other, err := f.container(name); err == nil && other != c {
+		return fmt.Errorf("Conflict. The container name %q is already in use", name)
+	}
+
+	c.name = strings.TrimPrefix(name, "/")
+	return nil
+}
+
+// IsContainerRunning returns false without an error if the container does not
+// exist, the same as the docker runtime.
+func (f *FakeRuntime) IsContainerRunning(containerId string) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("IsContainerRunning"); err != nil {
+		return false, err
+	}
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return false, nil
+	}
+
+	return c.running, nil
+}
+
+// SearchContainerByFilter supports the `id` filter, matched as a prefix of the ID,
+// and the `name` filter, matched as a regular expression with the name prefixed
+// by a `/`, the same as docker.
+func (f *FakeRuntime) SearchContainerByFilter(filterMap map[string]string) ([]types.Container, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("SearchContainerByFilter"); err != nil {
+		return []types.Container{}, err
+	}
+
+	var nameRegexp *regexp.Regexp
+	if name, ok := filterMap["name"]; ok {
+		var err error
+		if nameRegexp, err = regexp.Compile(name); err != nil {
+			return []types.Container{}, err
+		}
+	}
+
+	containers := []types.Container{}
+	for _, c := range f.containers {
+		if id, ok := filterMap["id"]; ok && !strings.HasPrefix(c.id, id) {
+			continue
+		}
+		if nameRegexp != nil && !nameRegexp.MatchString("/"+c.name) {
+			continue
+		}
+
+		state, status := "exited", "Exited (0)"
+		if c.running {
+			state, status = "running", "Up"
+		}
+
+		containers = append(containers, types.Container{
+			ID:      c.id,
+			Names:   []string{"/" + c.name},
+			ImageID: "sha256:" + c.imageId,
+			Created: c.created.Unix(),
+			State:   state,
+			Status:  status,
+		})
+	}
+
+	return containers, nil
+}
+
+func (f *FakeRuntime) ContainerLogs(containerId string, stdout, stderr bool) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("ContainerLogs"); err != nil {
+		return "", err
+	}
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return "", err
+	}
+
+	var logs string
+	if stdout {
+		logs += c.stdout
+	}
+	if stderr {
+		logs += c.stderr
+	}
+
+	return logs, nil
+}
+
+func (f *FakeRuntime) CommitContainer(containerId string) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("CommitContainer"); err != nil {
+		return "", err
+	}
+
+	if _, err := f.container(containerId); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + f.addImage().id, nil
+}
+
+func (f *FakeRuntime) ExecInContainer(containerId string, cmd []string, timeout time.Duration) (int, string, error) {
+	f.mutex.Lock()
+	if err := f.failure("ExecInContainer"); err != nil {
+		f.mutex.Unlock()
+		return 0, "", err
+	}
+
+	c, err := f.container(containerId)
+	if err == nil && !c.running {
+		err = fmt.Errorf("Container %s is not running", containerId)
+	}
+	exec := f.ExecFunc
+	f.mutex.Unlock()
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	if exec == nil {
+		return 0, "", nil
+	}
+
+	return exec(c.id, cmd)
+}
+
+// ContainerStats returns a sample with no resources used and the limits the
+// container was created with.
+func (f *FakeRuntime) ContainerStats(containerId string) (*ContainerStats, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("ContainerStats"); err != nil {
+		return nil, err
+	}
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContainerStats{
+		ContainerId: c.id,
+		MemoryLimit: uint64(c.config.Memory),
+		PidsLimit:   uint64(c.config.PidsLimit),
+		SampledAt:   time.Now(),
+	}, nil
+}
+
+func (f *FakeRuntime) CreateNetworkIfNotExist(name string, internal bool) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("CreateNetworkIfNotExist"); err != nil {
+		return "", err
+	}
+
+	if n, ok := f.networks[name]; ok {
+		if n.internal != internal {
+			return "", fmt.Errorf("network %s exists with internal set to %t", name, n.internal)
+		}
+		return n.id, nil
+	}
+
+	n := &fakeNetwork{id: f.newID(), name: name, internal: internal}
+	f.networks[name] = n
+
+	return n.id, nil
+}
+
+func (f *FakeRuntime) RemoveNetwork(name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("RemoveNetwork"); err != nil {
+		return err
+	}
+
+	for _, c := range f.containers {
+		if _, ok := c.networks[name]; ok {
+			return fmt.Errorf("network %s has active endpoints", name)
+		}
+	}
+
+	delete(f.networks, name)
+	return nil
+}
+
+func (f *FakeRuntime) ConnectContainerToNetwork(containerId, networkName string, aliases []string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err := f.failure("ConnectContainerToNetwork"); err != nil {
+		return err
+	}
+
+	c, err := f.container(containerId)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := f.networks[networkName]; !ok {
+		return fmt.Errorf("network %s not found", networkName)
+	}
+
+	c.networks[networkName] = aliases
+	return nil
+}
@@ -0,0 +1,22 @@
+package cr
+
+// CreateNetworkIfNotExist creates a bridge network with the name if no network
+// with the name exists and returns the ID of the network. The containers in an
+// internal network can only reach the other containers in the network. An error
+// is returned if the network exists but differs in being internal.
+func CreateNetworkIfNotExist(name string, internal bool) (string, error) {
+	return GetRuntime().CreateNetworkIfNotExist(name, internal)
+}
+
+// RemoveNetwork removes the network, it is not an error if the network
+// does not exist.
+func RemoveNetwork(name string) error {
+	return GetRuntime().RemoveNetwork(name)
+}
+
+// ConnectContainerToNetwork connects the container to the network, the
+// container can be reached by the other containers in the network using
+// any of the aliases.
+func ConnectContainerToNetwork(containerId, networkName string, aliases []string) error {
+	return GetRuntime().ConnectContainerToNetwork(containerId, networkName, aliases)
+}
@@ -0,0 +1,43 @@
+package cr
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// The socket of the podman service run as root, the socket of the rootless
+// service is in $XDG_RUNTIME_DIR.
+const defaultPodmanSocket = "/run/podman/podman.sock"
+
+// PodmanRuntime is the runtime using the docker compatible API served by the
+// podman service on its local socket, which can be started using
+// `podman system service`.
+type PodmanRuntime struct {
+	DockerRuntime
+
+	Socket string
+}
+
+// NewPodmanRuntime returns the runtime using the podman socket, the socket of the
+// rootless service is used if socket is empty and it exists, else the socket of
+// the service run as root.
+func NewPodmanRuntime(socket string) *PodmanRuntime {
+	if socket == "" {
+		socket = defaultPodmanSocket
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			rootless := filepath.Join(dir, "podman", "podman.sock")
+			if _, err := os.Stat(rootless); err == nil {
+				socket = rootless
+			}
+		}
+	}
+
+	return &PodmanRuntime{
+		DockerRuntime: DockerRuntime{Host: "unix://" + socket},
+		Socket:        socket,
+	}
+}
+
+func (p *PodmanRuntime) Name() string {
+	return PodmanRuntimeName
+}
@@ -0,0 +1,100 @@
+package cr
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	DockerRuntimeName = "docker"
+	PodmanRuntimeName = "podman"
+	FakeRuntimeName   = "fake"
+)
+
+// Runtime is a container runtime managing the images, containers and networks of
+// the challenges. The functions of the package use the runtime set using
+// SetRuntime, which is docker by default.
+type Runtime interface {
+	// Name returns the name of the runtime.
+	Name() string
+
+	// BuildImage builds the image of the challenge tagged challengeTag from the tar
+	// build context and returns the output of the build and the ID of the image.
+	BuildImage(challengeName, challengeTag, tarContextPath, dockerCtxFile string, noCache bool) (*bytes.Buffer, string, error)
+	RemoveImage(imageId string) error
+	CheckIfImageExists(imageId string) (bool, error)
+	SearchImageByFilter(filterMap map[string]string) ([]types.ImageSummary, error)
+	TagImage(imageId, ref string) error
+	PullImage(ref string) (*bytes.Buffer, error)
+
+	// CreateContainer creates the container from the configuration and starts it.
+	CreateContainer(containerConfig *CreateContainerConfig) (string, error)
+	StartContainer(containerId string) error
+	StopContainer(containerId string) error
+	RestartContainer(containerId string) error
+	// RemoveContainer stops the container and removes it.
+	RemoveContainer(containerId string) error
+	RenameContainer(containerId, name string) error
+	IsContainerRunning(containerId string) (bool, error)
+	SearchContainerByFilter(filterMap map[string]string) ([]types.Container, error)
+	// ContainerLogs returns the logs of the container written to the selected streams.
+	ContainerLogs(containerId string, stdout, stderr bool) (string, error)
+	CommitContainer(containerId string) (string, error)
+	ExecInContainer(containerId string, cmd []string, timeout time.Duration) (int, string, error)
+	ContainerStats(containerId string) (*ContainerStats, error)
+
+	// CreateNetworkIfNotExist creates the network, an internal network has no
+	// connectivity outside of it.
+	CreateNetworkIfNotExist(name string, internal bool) (string, error)
+	RemoveNetwork(name string) error
+	ConnectContainerToNetwork(containerId, networkName string, aliases []string) error
+}
+
+var (
+	runtimeMux    sync.RWMutex
+	activeRuntime Runtime = NewDockerRuntime()
+)
+
+// SetRuntime sets the runtime used by the functions of the package, like the
+// FakeRuntime to use the package without a container runtime.
+func SetRuntime(runtime Runtime) {
+	runtimeMux.Lock()
+	defer runtimeMux.Unlock()
+
+	activeRuntime = runtime
+}
+
+// GetRuntime returns the runtime used by the functions of the package.
+func GetRuntime() Runtime {
+	runtimeMux.RLock()
+	defer runtimeMux.RUnlock()
+
+	return activeRuntime
+}
+
+// NewRuntime returns the runtime with the name, socket is the path of the socket of
+// the podman service, the default socket is used if it is empty.
+func NewRuntime(name, socket string) (Runtime, error) {
+	switch name {
+	case "", DockerRuntimeName:
+		return NewDockerRuntime(), nil
+	case PodmanRuntimeName:
+		return NewPodmanRuntime(socket), nil
+	default:
+		return nil, fmt.Errorf("Invalid container runtime %s", name)
+	}
+}
+
+// IsValidRuntime checks if the runtime with the name can be used.
+func IsValidRuntime(name string) bool {
+	switch name {
+	case DockerRuntimeName, PodmanRuntimeName:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,122 @@
+package cr
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ContainerStats is a sample of the resources used by a container.
+type ContainerStats struct {
+	ContainerId string
+	CPUPercent  float64
+	MemoryUsage uint64
+	MemoryLimit uint64
+	NetworkRx   uint64
+	NetworkTx   uint64
+	Pids        uint64
+	PidsLimit   uint64
+	SampledAt   time.Time
+}
+
+// MemoryPercent returns the memory used by the container as a percentage of its
+// memory limit.
+func (stats *ContainerStats) MemoryPercent() float64 {
+	if stats.MemoryLimit == 0 {
+		return 0
+	}
+
+	return 100 * float64(stats.MemoryUsage) / float64(stats.MemoryLimit)
+}
+
+// PidsPercent returns the number of processes of the container as a percentage of
+// its pids limit, zero if the container has no pids limit.
+func (stats *ContainerStats) PidsPercent() float64 {
+	if stats.PidsLimit == 0 {
+		return 0
+	}
+
+	return 100 * float64(stats.Pids) / float64(stats.PidsLimit)
+}
+
+// GetContainerStats samples the resources used by the running container using the
+// stats API of the runtime.
+func GetContainerStats(containerId string) (*ContainerStats, error) {
+	return GetRuntime().ContainerStats(containerId)
+}
+
+// cpuPercent returns the CPU used by the container between the previous and the
+// current sample as a percentage of a single CPU, the same as the docker CLI.
+func cpuPercent(stats *types.StatsJSON) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := len(stats.CPUStats.CPUUsage.PercpuUsage)
+	if cpus == 0 {
+		cpus = runtime.NumCPU()
+	}
+
+	return cpuDelta / systemDelta * float64(cpus) * 100
+}
+
+// StatsCollector samples the resources used by a set of containers and keeps the
+// latest sample of each container.
+type StatsCollector struct {
+	mutex  sync.RWMutex
+	latest map[string]ContainerStats
+}
+
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{latest: make(map[string]ContainerStats)}
+}
+
+// Collect samples the containers concurrently, containers maps a key identifying
+// each container to the ID of the container. The samples are returned by the key,
+// containers which could not be sampled are left out. The samples replace the
+// latest samples of the collector.
+func (collector *StatsCollector) Collect(containers map[string]string) map[string]ContainerStats {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	samples := make(map[string]ContainerStats)
+
+	for key, containerId := range containers {
+		wg.Add(1)
+		go func(key, containerId string) {
+			defer wg.Done()
+
+			stats, err := GetContainerStats(containerId)
+			if err != nil {
+				return
+			}
+
+			mutex.Lock()
+			samples[key] = *stats
+			mutex.Unlock()
+		}(key, containerId)
+	}
+	wg.Wait()
+
+	collector.mutex.Lock()
+	collector.latest = samples
+	collector.mutex.Unlock()
+
+	return samples
+}
+
+// Latest returns the latest sample of each container by its key.
+func (collector *StatsCollector) Latest() map[string]ContainerStats {
+	collector.mutex.RLock()
+	defer collector.mutex.RUnlock()
+
+	latest := make(map[string]ContainerStats, len(collector.latest))
+	for key, stats := range collector.latest {
+		latest[key] = stats
+	}
+
+	return latest
+}
@@ -0,0 +1,36 @@
+package ctftime
+
+// Feed is the scoreboard feed of a competition in the format accepted by CTFtime
+// for importing the results of an event, for example
+//
+//	{
+//	  "tasks": ["task1", "task2"],
+//	  "standings": [
+//	    {
+//	      "pos": 1,
+//	      "team": "team1",
+//	      "score": 200,
+//	      "taskStats": {"task1": {"points": 100, "time": 1600000000}},
+//	      "lastAccept": 1600000000
+//	    }
+//	  ]
+//	}
+type Feed struct {
+	Tasks     []string   `json:"tasks"`
+	Standings []Standing `json:"standings"`
+}
+
+// Standing of a single team in the feed, times are unix timestamps.
+type Standing struct {
+	Pos        uint                `json:"pos"`
+	Team       string              `json:"team"`
+	Score      uint                `json:"score"`
+	TaskStats  map[string]TaskStat `json:"taskStats,omitempty"`
+	LastAccept int64               `json:"lastAccept,omitempty"`
+}
+
+// TaskStat is the solve of a task by a team.
+type TaskStat struct {
+	Points uint  `json:"points"`
+	Time   int64 `json:"time"`
+}
@@ -0,0 +1,123 @@
+package flagmatch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	EXACT               string = "exact"
+	CASE_INSENSITIVE    string = "case_insensitive"
+	REGEX               string = "regex"
+	WRAPPER_INSENSITIVE string = "wrapper_insensitive"
+)
+
+// Matches a flag wrapped in a format like flag{...}, the first group is the
+// inner text of the flag.
+var wrapperRegex = regexp.MustCompile(`^[A-Za-z0-9_\-]*\{(.*)\}$`)
+
+// Matcher checks submitted flags against the valid flags of a challenge
+// according to the match mode.
+//
+// * exact - The submitted flag must be equal to one of the flags.
+// * case_insensitive - Same as exact but ignoring the case.
+// * regex - The submitted flag must completely match one of the flags
+//   which are regular expressions.
+// * wrapper_insensitive - The inner text of the flags is compared, so that
+//   the wrapper like flag{...} can be omitted or different.
+type Matcher struct {
+	Mode  string
+	Flags []string
+
+	patterns []*regexp.Regexp
+}
+
+// NewMatcher returns a matcher for the flags with the mode, an empty mode
+// means exact matching. For the regex mode all the flags are compiled and
+// an error is returned if any of them is not a valid regular expression.
+func NewMatcher(mode string, flags []string) (*Matcher, error) {
+	if mode == "" {
+		mode = EXACT
+	}
+
+	matcher := &Matcher{
+		Mode:  mode,
+		Flags: flags,
+	}
+
+	switch mode {
+	case EXACT, CASE_INSENSITIVE, WRAPPER_INSENSITIVE:
+		return matcher, nil
+	case REGEX:
+		matcher.patterns = make([]*regexp.Regexp, len(flags))
+		for i, flag := range flags {
+			pattern, err := regexp.Compile(`^(?:` + flag + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("invalid flag pattern %q: %s", flag, err)
+			}
+			matcher.patterns[i] = pattern
+		}
+		return matcher, nil
+	}
+
+	return nil, fmt.Errorf("not a valid flag match mode: %s", mode)
+}
+
+// Match returns true if the submitted flag matches any of the flags.
+func (matcher *Matcher) Match(submitted string) bool {
+	return matcher.MatchIndex(submitted) >= 0
+}
+
+// MatchIndex returns the index of the first flag matched by the submitted
+// flag, or -1 if none of the flags match.
+func (matcher *Matcher) MatchIndex(submitted string) int {
+	if submitted == "" {
+		return -1
+	}
+
+	if matcher.Mode == REGEX {
+		for i, pattern := range matcher.patterns {
+			if pattern.MatchString(submitted) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for i, flag := range matcher.Flags {
+		if Equal(matcher.Mode, flag, submitted) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Equal compares a flag with the submitted flag using the mode, flags are
+// compared literally for the regex mode.
+func Equal(mode, flag, submitted string) bool {
+	switch mode {
+	case CASE_INSENSITIVE:
+		return strings.EqualFold(flag, submitted)
+	case WRAPPER_INSENSITIVE:
+		return unwrap(flag) == unwrap(submitted)
+	}
+
+	return flag == submitted
+}
+
+// unwrap returns the inner text of a flag wrapped like flag{...}.
+func unwrap(flag string) string {
+	flag = strings.TrimSpace(flag)
+	if match := wrapperRegex.FindStringSubmatch(flag); match != nil {
+		return match[1]
+	}
+
+	return flag
+}
+
+// AvailableModes returns all the flag match modes.
+func AvailableModes() []string {
+	return []string{EXACT, CASE_INSENSITIVE, REGEX, WRAPPER_INSENSITIVE}
+}
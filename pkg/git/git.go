@@ -124,6 +124,22 @@ func getLatestCommit(repo *git.Repository) (*object.Commit, error) {
 	return latestCommit, nil
 }
 
+// GetHeadCommit returns the hash of the commit pointed by HEAD of the git repository
+// containing the directory, the directory can be anywhere inside the repository.
+func GetHeadCommit(dir string) (string, error) {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", fmt.Errorf("Error while opening git repository of %s : %s", dir, err)
+	}
+
+	commit, err := getLatestCommit(repo)
+	if err != nil {
+		return "", err
+	}
+
+	return commit.Hash.String(), nil
+}
+
 // PullAndGetChanges pulls changes from remote and returns an array of file names which were changed
 func PullAndGetChanges(gitDir string, sshkeyFile string, branch string, remote string) ([]string, error) {
 	auth, err := getSSHAuth(sshkeyFile)
@@ -2,6 +2,7 @@ package probes
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -45,6 +46,28 @@ type HttpProber struct {
 // If the HTTP response code is successful (i.e. 400 > code >= 200), it returns Success.
 // If the HTTP response code is unsuccessful or HTTP communication fails, it returns Failure.
 func (pr HttpProber) Probe(url *url.URL, headers http.Header, timeout time.Duration) (ProbeResult, string, error) {
+	statusCode, body, err := pr.Get(url, headers, timeout)
+	if err == errReadBody {
+		return Failure, "", err
+	} else if err != nil {
+		return Failure, err.Error(), nil
+	}
+
+	if statusCode >= http.StatusOK && statusCode < http.StatusBadRequest {
+		if statusCode >= http.StatusMultipleChoices { // Redirect
+			return Warning, body, nil
+		}
+		return Success, body, nil
+	}
+
+	return Failure, fmt.Sprintf("HTTP probe failed with statuscode: %d", statusCode), nil
+}
+
+var errReadBody = errors.New("error while reading the response body")
+
+// Get does a GET request to the url and returns the status code and the
+// body of the response.
+func (pr HttpProber) Get(url *url.URL, headers http.Header, timeout time.Duration) (int, string, error) {
 	client := &http.Client{
 		Timeout:   timeout,
 		Transport: pr.transport,
@@ -52,7 +75,7 @@ func (pr HttpProber) Probe(url *url.URL, headers http.Header, timeout time.Durat
 
 	req, err := http.NewRequest("GET", url.String(), nil)
 	if err != nil {
-		return Failure, err.Error(), nil
+		return 0, "", err
 	}
 
 	req.Header = headers
@@ -61,22 +84,14 @@ func (pr HttpProber) Probe(url *url.URL, headers http.Header, timeout time.Durat
 	}
 	res, err := client.Do(req)
 	if err != nil {
-		return Failure, err.Error(), nil
+		return 0, "", err
 	}
 	defer res.Body.Close()
 
 	b, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return Failure, "", err
-	}
-	body := string(b)
-
-	if res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusBadRequest {
-		if res.StatusCode >= http.StatusMultipleChoices { // Redirect
-			return Warning, body, nil
-		}
-		return Success, body, nil
+		return res.StatusCode, "", errReadBody
 	}
 
-	return Failure, fmt.Sprintf("HTTP probe failed with statuscode: %d", res.StatusCode), nil
+	return res.StatusCode, string(b), nil
 }
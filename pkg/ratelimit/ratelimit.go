@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Limiter allows at most Attempts attempts per key in any window of length
+// Period. A key which exceeds the limit is locked out, the lockout duration
+// doubles on every consecutive lockout of the key starting from Lockout,
+// and is capped at MaxLockout. A key which stays clean for MaxLockout after
+// its last lockout starts again from the base lockout.
+type Limiter struct {
+	Attempts   int
+	Period     time.Duration
+	Lockout    time.Duration
+	MaxLockout time.Duration
+
+	mux    sync.Mutex
+	states map[string]*State
+
+	// Serializes the saves so that an older state never overwrites a newer one.
+	saveMux sync.Mutex
+}
+
+// State of a single key of the limiter, this is exported so that it
+// can be persisted across restarts.
+type State struct {
+	Attempts    []time.Time `json:"attempts"`
+	LockedUntil time.Time   `json:"locked_until"`
+	Lockouts    int         `json:"lockouts"`
+}
+
+// Result of an attempt made for a key.
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+
+	// Lockouts is the number of consecutive lockouts of the key, including
+	// the lockout caused by this attempt if any.
+	Lockouts int
+
+	// NewLockout is true when this attempt caused the key to be locked out.
+	NewLockout bool
+}
+
+func NewLimiter(attempts int, period, lockout, maxLockout time.Duration) *Limiter {
+	return &Limiter{
+		Attempts:   attempts,
+		Period:     period,
+		Lockout:    lockout,
+		MaxLockout: maxLockout,
+		states:     make(map[string]*State),
+	}
+}
+
+// Attempt registers an attempt for the key and returns if the attempt
+// is allowed, when it is not RetryAfter is the time after which the next
+// attempt for the key will be considered.
+func (limiter *Limiter) Attempt(key string) Result {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	now := time.Now()
+	state, ok := limiter.states[key]
+	if !ok {
+		state = &State{}
+		limiter.states[key] = state
+	}
+
+	if now.Before(state.LockedUntil) {
+		return Result{
+			Allowed:    false,
+			RetryAfter: state.LockedUntil.Sub(now),
+			Lockouts:   state.Lockouts,
+		}
+	}
+
+	if state.Lockouts > 0 && now.Sub(state.LockedUntil) > limiter.MaxLockout {
+		state.Lockouts = 0
+	}
+
+	attempts := state.Attempts[:0]
+	for _, attempt := range state.Attempts {
+		if now.Sub(attempt) < limiter.Period {
+			attempts = append(attempts, attempt)
+		}
+	}
+	state.Attempts = attempts
+
+	if len(state.Attempts) >= limiter.Attempts {
+		lockout := limiter.Lockout << uint(state.Lockouts)
+		if lockout > limiter.MaxLockout || lockout <= 0 {
+			lockout = limiter.MaxLockout
+		}
+
+		state.Lockouts++
+		state.LockedUntil = now.Add(lockout)
+		state.Attempts = nil
+
+		return Result{
+			Allowed:    false,
+			RetryAfter: lockout,
+			Lockouts:   state.Lockouts,
+			NewLockout: true,
+		}
+	}
+
+	state.Attempts = append(state.Attempts, now)
+
+	return Result{
+		Allowed:  true,
+		Lockouts: state.Lockouts,
+	}
+}
+
+// Reset removes all the state associated with the key.
+func (limiter *Limiter) Reset(key string) {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	delete(limiter.states, key)
+}
+
+// Save writes the state of all the keys which are still relevant to the
+// file at path in JSON format. The state is written to a temporary file
+// which is then renamed to path, so the file is never partially written.
+func (limiter *Limiter) Save(path string) error {
+	limiter.saveMux.Lock()
+	defer limiter.saveMux.Unlock()
+
+	limiter.mux.Lock()
+	now := time.Now()
+	states := make(map[string]*State)
+	for key, state := range limiter.states {
+		if state.Lockouts > 0 && now.Sub(state.LockedUntil) <= limiter.MaxLockout {
+			states[key] = state
+		} else if len(state.Attempts) > 0 && now.Sub(state.Attempts[len(state.Attempts)-1]) < limiter.Period {
+			states[key] = state
+		}
+	}
+	data, err := json.Marshal(states)
+	limiter.mux.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("error while encoding rate limit state: %s", err)
+	}
+
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Load reads the state of the keys from the file at path, a missing file
+// is not considered an error.
+func (limiter *Limiter) Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	states := make(map[string]*State)
+	if err := json.Unmarshal(data, &states); err != nil {
+		return fmt.Errorf("error while decoding rate limit state: %s", err)
+	}
+
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	for key, state := range states {
+		limiter.states[key] = state
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronExpression is a parsed cron expression with the five standard fields
+// minute, hour, day of month, month and day of week. Each field is a
+// comma separated list of `*`, a value or a range `a-b`, each optionally
+// followed by a step `/n`, so `*/30 * * * *` is every 30 minutes.
+//
+// The descriptors @yearly, @monthly, @weekly, @daily and @hourly are also
+// supported along with `@every <duration>`, for example `@every 1h30m`.
+type CronExpression struct {
+	Expression string
+
+	minute, hour, dom, month, dow uint64
+
+	// Whether the day of month or the day of week field is a `*`, if both are
+	// restricted a day matches if either of them matches.
+	domStar, dowStar bool
+
+	// every is the period of an `@every` expression.
+	every time.Duration
+}
+
+type cronField struct {
+	min, max uint
+}
+
+var (
+	minuteField = cronField{0, 59}
+	hourField   = cronField{0, 23}
+	domField    = cronField{1, 31}
+	monthField  = cronField{1, 12}
+	dowField    = cronField{0, 6}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses the cron expression.
+func ParseCron(expression string) (*CronExpression, error) {
+	expr := strings.TrimSpace(expression)
+	cron := &CronExpression{Expression: expr}
+
+	if strings.HasPrefix(expr, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %s", expression, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("Invalid cron expression %q: period should be at least a second", expression)
+		}
+
+		cron.every = every
+		return cron, nil
+	}
+
+	if descriptor, ok := cronDescriptors[expr]; ok {
+		expr = descriptor
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Invalid cron expression %q: expected 5 fields, found %d", expression, len(fields))
+	}
+
+	var err error
+	bits := []*uint64{&cron.minute, &cron.hour, &cron.dom, &cron.month, &cron.dow}
+	for i, field := range []cronField{minuteField, hourField, domField, monthField, dowField} {
+		// Sunday can also be written as 7 in the day of week field.
+		if i == 4 {
+			field.max = 7
+		}
+
+		if *bits[i], err = field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %s", expression, err)
+		}
+	}
+
+	if cron.dow&(1<<7) != 0 {
+		cron.dow = (cron.dow | 1) &^ (1 << 7)
+	}
+	cron.domStar = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	cron.dowStar = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+
+	if cron.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("Invalid cron expression %q: never matches", expression)
+	}
+
+	return cron, nil
+}
+
+// parse returns the set of the values of the field as a bitset.
+func (field cronField) parse(value string) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(value, ",") {
+		rng, step := part, uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], uint(s)
+		}
+
+		start, end := field.min, field.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			s, err := strconv.ParseUint(bounds[0], 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			start, end = uint(s), uint(s)
+
+			if len(bounds) == 2 {
+				e, err := strconv.ParseUint(bounds[1], 10, 8)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+				end = uint(e)
+			} else if step > 1 {
+				end = field.max
+			}
+		}
+
+		if start < field.min || end > field.max || start > end {
+			return 0, fmt.Errorf("%q is out of the range %d-%d", part, field.min, field.max)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+// Next returns the first time after t matching the expression.
+func (cron *CronExpression) Next(t time.Time) time.Time {
+	if cron.every > 0 {
+		return t.Add(cron.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// A matching time is always found within a few years, unless the expression
+	// can never match like `0 0 30 2 *`.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if cron.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !cron.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if cron.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if cron.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (cron *CronExpression) dayMatches(t time.Time) bool {
+	domMatch := cron.dom&(1<<uint(t.Day())) != 0
+	dowMatch := cron.dow&(1<<uint(t.Weekday())) != 0
+
+	if cron.domStar || cron.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
@@ -5,7 +5,7 @@ import (
 )
 
 type Scheduler struct {
-	Tasks        TaskMap
+	Tasks        *TaskMap
 	FuncRegister TaskFunctionRegister
 
 	stopChan chan bool
@@ -79,19 +79,52 @@ func (scheduler *Scheduler) ScheduleEvery(duration time.Duration, function Funct
 	return nil
 }
 
-func (scheduler *Scheduler) runPending() {
-	for id, task := range scheduler.Tasks {
-		if task.IsDue() {
-			if function, ok := scheduler.FuncRegister.Functions[task.FunctionID]; ok {
-				go function.Run()
-			}
+// ScheduleCron schedules the function to run at the times matching the cron
+// expression, see CronExpression for the format.
+func (scheduler *Scheduler) ScheduleCron(expression string, function Function, params ...FuncParam) error {
+	_, err := scheduler.ScheduleTask("", expression, time.Time{}, function, params...)
+	return err
+}
 
-			if !task.Schedule.IsRecurring {
-				delete(scheduler.Tasks, id)
-			} else {
-				task.Schedule.LastRun = time.Now()
-				task.Schedule.NextRun = task.Schedule.NextRun.Add(task.Schedule.Duration)
-			}
+// ScheduleTask schedules the function with the ID, replacing any task with the same
+// ID. The function is run at the times matching the cron expression, or once at the
+// time if the expression is empty. The ID of the task is derived from the function
+// and the schedule if an empty ID is provided.
+func (scheduler *Scheduler) ScheduleTask(id TaskID, expression string, at time.Time, function Function, params ...FuncParam) (TaskID, error) {
+	schedule := Schedule{
+		IsRecurring: false,
+		NextRun:     at,
+	}
+
+	if expression != "" {
+		var err error
+		if schedule, err = NewCronSchedule(expression); err != nil {
+			return id, err
+		}
+	}
+
+	funcID, err := scheduler.FuncRegister.AddFunction(function, params...)
+	if err != nil {
+		return id, err
+	}
+
+	if id == "" {
+		return scheduler.Tasks.AddTask(schedule, funcID), nil
+	}
+
+	return scheduler.Tasks.AddTaskWithID(id, NewTask(schedule, funcID)), nil
+}
+
+// Cancel removes the scheduled task with the ID, it returns false if there is no
+// such task.
+func (scheduler *Scheduler) Cancel(id TaskID) bool {
+	return scheduler.Tasks.RemoveTask(id)
+}
+
+func (scheduler *Scheduler) runPending() {
+	for _, task := range scheduler.Tasks.popDue() {
+		if function, ok := scheduler.FuncRegister.GetFunction(task.FunctionID); ok {
+			go function.Run()
 		}
 	}
 }
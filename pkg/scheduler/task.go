@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"runtime"
+	"sync"
 	"time"
 )
 
@@ -41,7 +43,18 @@ func (tf *TaskFunction) GetFunctionID() FunctionID {
 	return FunctionID(fmt.Sprintf("%x", hash.Sum(nil)))
 }
 
+// functionName returns the fully qualified name of the function, the name of the
+// type of a function is empty for all the functions with the same signature.
+func functionName(function reflect.Value) string {
+	if fn := runtime.FuncForPC(function.Pointer()); fn != nil {
+		return fn.Name()
+	}
+
+	return ""
+}
+
 type TaskFunctionRegister struct {
+	mutex     sync.RWMutex
 	Functions map[FunctionID]TaskFunction
 }
 
@@ -59,7 +72,6 @@ func (tfr *TaskFunctionRegister) AddFunction(function Function, params ...FuncPa
 		return funcID, fmt.Errorf("The function provided is not of type Function")
 	}
 
-	funcType := reflect.TypeOf(function)
 	err := validateParamTypes(function, params...)
 	if err != nil {
 		return funcID, err
@@ -67,21 +79,61 @@ func (tfr *TaskFunctionRegister) AddFunction(function Function, params ...FuncPa
 
 	tf := TaskFunction{
 		Function: function,
-		Name:     funcType.Name(),
+		Name:     functionName(funcValue),
 		Params:   params,
 	}
 
 	funcID = tf.GetFunctionID()
+	tfr.mutex.Lock()
 	tfr.Functions[funcID] = tf
+	tfr.mutex.Unlock()
 
 	return funcID, nil
 }
 
+// GetFunction returns the registered function with the ID.
+func (tfr *TaskFunctionRegister) GetFunction(funcID FunctionID) (TaskFunction, bool) {
+	tfr.mutex.RLock()
+	defer tfr.mutex.RUnlock()
+
+	tf, ok := tfr.Functions[funcID]
+	return tf, ok
+}
+
 type Schedule struct {
 	IsRecurring bool
 	LastRun     time.Time
 	NextRun     time.Time
 	Duration    time.Duration
+
+	// Cron is the cron expression of a recurring schedule, the schedule is run
+	// every Duration if it is nil.
+	Cron *CronExpression
+}
+
+// NewCronSchedule returns a recurring schedule running at the times matching the
+// cron expression.
+func NewCronSchedule(expression string) (Schedule, error) {
+	cron, err := ParseCron(expression)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	return Schedule{
+		IsRecurring: true,
+		NextRun:     cron.Next(time.Now()),
+		Cron:        cron,
+	}, nil
+}
+
+// next advances the schedule after a run at now.
+func (schedule *Schedule) next(now time.Time) {
+	schedule.LastRun = now
+	if schedule.Cron != nil {
+		schedule.NextRun = schedule.Cron.Next(now)
+	} else {
+		schedule.NextRun = schedule.NextRun.Add(schedule.Duration)
+	}
 }
 
 type Task struct {
@@ -120,16 +172,97 @@ func (task *Task) IsDue() bool {
 	return time.Now() == task.Schedule.NextRun || time.Now().After(task.Schedule.NextRun)
 }
 
-type TaskMap map[TaskID]*Task
+// TaskMap is the set of the scheduled tasks by their ID, it is safe for use by
+// multiple goroutines.
+type TaskMap struct {
+	mutex sync.Mutex
+	tasks map[TaskID]*Task
+}
 
-func NewTaskMap() TaskMap {
-	return make(TaskMap)
+func NewTaskMap() *TaskMap {
+	return &TaskMap{
+		tasks: make(map[TaskID]*Task),
+	}
 }
 
-func (tMap TaskMap) AddTask(schedule Schedule, funcID FunctionID) {
+func (tMap *TaskMap) AddTask(schedule Schedule, funcID FunctionID) TaskID {
 	task := NewTask(schedule, funcID)
 
-	tMap[task.GetTaskID()] = task
+	return tMap.AddTaskWithID(task.GetTaskID(), task)
+}
+
+// AddTaskWithID adds the task with the ID, replacing any task with the same ID.
+func (tMap *TaskMap) AddTaskWithID(id TaskID, task *Task) TaskID {
+	task.id = id
+
+	tMap.mutex.Lock()
+	tMap.tasks[id] = task
+	tMap.mutex.Unlock()
+
+	return id
+}
+
+// RemoveTask removes the task with the ID, it returns false if there is no such
+// task.
+func (tMap *TaskMap) RemoveTask(id TaskID) bool {
+	tMap.mutex.Lock()
+	defer tMap.mutex.Unlock()
+
+	_, ok := tMap.tasks[id]
+	delete(tMap.tasks, id)
+	return ok
+}
+
+// GetTask returns a copy of the task with the ID.
+func (tMap *TaskMap) GetTask(id TaskID) (Task, bool) {
+	tMap.mutex.Lock()
+	defer tMap.mutex.Unlock()
+
+	task, ok := tMap.tasks[id]
+	if !ok {
+		return Task{}, false
+	}
+	return *task, true
+}
+
+// Tasks returns a copy of all the tasks.
+func (tMap *TaskMap) Tasks() []Task {
+	tMap.mutex.Lock()
+	defer tMap.mutex.Unlock()
+
+	tasks := make([]Task, 0, len(tMap.tasks))
+	for _, task := range tMap.tasks {
+		tasks = append(tasks, *task)
+	}
+	return tasks
+}
+
+// popDue returns the tasks which are due and advances their schedule, the tasks
+// which are not recurring are removed.
+func (tMap *TaskMap) popDue() []Task {
+	tMap.mutex.Lock()
+	defer tMap.mutex.Unlock()
+
+	now := time.Now()
+	var due []Task
+	for id, task := range tMap.tasks {
+		if !task.IsDue() {
+			continue
+		}
+
+		due = append(due, *task)
+		if !task.Schedule.IsRecurring {
+			delete(tMap.tasks, id)
+			continue
+		}
+
+		task.Schedule.next(now)
+		if task.Schedule.NextRun.IsZero() {
+			delete(tMap.tasks, id)
+		}
+	}
+
+	return due
 }
 
 func validateParamTypes(function Function, params ...FuncParam) error {
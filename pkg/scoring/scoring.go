@@ -0,0 +1,180 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	STATIC      string = "static"
+	LOGARITHMIC string = "logarithmic"
+	LINEAR      string = "linear"
+	TIME_DECAY  string = "time_decay"
+	FIRST_BLOOD string = "first_blood"
+)
+
+// Solve describes a single solve of a challenge for which the points
+// are to be calculated.
+type Solve struct {
+	// Position of the solve among all the solves of the challenge, starting from 1.
+	Rank uint
+
+	// Total number of solves of the challenge.
+	Solvers uint
+
+	SolvedAt time.Time
+}
+
+// ScoringStrategy calculates the points awarded for a solve of a challenge.
+//
+// The points of a solve can depend on the total number of solvers, in which case
+// they change for all the previous solvers whenever a new solve happens.
+type ScoringStrategy interface {
+	Points(solve Solve) uint
+}
+
+// Params used by the scoring strategies, each strategy only uses the
+// params relevant to it.
+type Params struct {
+	MaxPoints uint
+	MinPoints uint
+
+	// Points reduced per solve for linear decay and per hour
+	// for time based decay.
+	Decay float64
+
+	// Bonus points for the first, second, ... solvers of the challenge.
+	FirstBloodBonus []uint
+
+	// Time from which time based decay starts.
+	Start time.Time
+}
+
+// Static scoring, every solve gets the maximum points.
+type Static struct {
+	Params
+}
+
+func (s *Static) Points(solve Solve) uint {
+	return s.MaxPoints
+}
+
+// Logarithmic decay of points with the number of solvers, all the
+// solvers get the same points. The decay is based on the number of
+// solvers before the latest one, the points only start decaying from
+// the third solve.
+type Logarithmic struct {
+	Params
+}
+
+func (s *Logarithmic) Points(solve Solve) uint {
+	if solve.Solvers <= 2 {
+		return s.MaxPoints
+	}
+
+	previous := solve.Solvers - 1
+	divisor := (1 + math.Pow((float64(previous)-1)/11.92201, 1.206069))
+	return uint(math.Round(float64(s.MinPoints) + (float64(s.MaxPoints)-float64(s.MinPoints))/divisor))
+}
+
+// Linear decay of points by Decay for every solver after the first, all
+// the solvers get the same points.
+type Linear struct {
+	Params
+}
+
+func (s *Linear) Points(solve Solve) uint {
+	if solve.Solvers <= 1 {
+		return s.MaxPoints
+	}
+
+	return clamp(float64(s.MaxPoints)-s.Decay*float64(solve.Solvers-1), s.MinPoints, s.MaxPoints)
+}
+
+// Time based decay of points by Decay for every hour passed since Start,
+// the points of a solver depend only on the time of the solve.
+type TimeDecay struct {
+	Params
+}
+
+func (s *TimeDecay) Points(solve Solve) uint {
+	if s.Start.IsZero() || solve.SolvedAt.Before(s.Start) {
+		return s.MaxPoints
+	}
+
+	hours := solve.SolvedAt.Sub(s.Start).Hours()
+	return clamp(float64(s.MaxPoints)-s.Decay*hours, s.MinPoints, s.MaxPoints)
+}
+
+// First blood bonus tiers, the first solvers get the bonus points
+// corresponding to their rank on top of the maximum points.
+type FirstBlood struct {
+	Params
+}
+
+func (s *FirstBlood) Points(solve Solve) uint {
+	if solve.Rank >= 1 && solve.Rank <= uint(len(s.FirstBloodBonus)) {
+		return s.MaxPoints + s.FirstBloodBonus[solve.Rank-1]
+	}
+
+	return s.MaxPoints
+}
+
+func clamp(points float64, min, max uint) uint {
+	if points < float64(min) {
+		return min
+	}
+	if points > float64(max) {
+		return max
+	}
+
+	return uint(math.Round(points))
+}
+
+// AvailableStrategies returns the names of all the scoring strategies.
+func AvailableStrategies() []string {
+	return []string{STATIC, LOGARITHMIC, LINEAR, TIME_DECAY, FIRST_BLOOD}
+}
+
+// ValidateParams checks if the params provided are enough for the strategy.
+func ValidateParams(name string, params Params) error {
+	if params.MinPoints > params.MaxPoints {
+		return fmt.Errorf("minimum points %d are more than the maximum points %d", params.MinPoints, params.MaxPoints)
+	}
+
+	switch name {
+	case STATIC, LOGARITHMIC:
+		return nil
+	case LINEAR, TIME_DECAY:
+		if params.Decay <= 0 {
+			return fmt.Errorf("decay must be positive for %s scoring", name)
+		}
+		return nil
+	case FIRST_BLOOD:
+		if len(params.FirstBloodBonus) == 0 {
+			return fmt.Errorf("first_blood_bonus tiers are required for %s scoring", name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("not a valid scoring strategy: %s", name)
+}
+
+// NewStrategy returns the scoring strategy corresponding to the name.
+func NewStrategy(name string, params Params) (ScoringStrategy, error) {
+	switch name {
+	case STATIC:
+		return &Static{params}, nil
+	case LOGARITHMIC:
+		return &Logarithmic{params}, nil
+	case LINEAR:
+		return &Linear{params}, nil
+	case TIME_DECAY:
+		return &TimeDecay{params}, nil
+	case FIRST_BLOOD:
+		return &FirstBlood{params}, nil
+	}
+
+	return nil, fmt.Errorf("not a valid scoring strategy: %s", name)
+}
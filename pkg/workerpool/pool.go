@@ -1,86 +1,274 @@
 package Taskerpool
 
 import (
+	"container/heap"
 	"fmt"
 	"runtime"
+	"sort"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// Queue is a priority queue of tasks performed by a pool of workers. Tasks with
+// a higher priority are performed first, tasks with the same priority are
+// performed in the order they were pushed.
 type Queue struct {
-	TaskQueue chan Task
-	Mux       sync.RWMutex
-	InQueue   map[string]bool // A map which stores if the task related to some id is already in the queue
+	Mux     sync.RWMutex
+	InQueue map[string]bool // A map which stores if the task related to some id is already in the queue
 
 	CompletionChannel chan bool
+
+	maxSize uint32
+	seq     uint64
+	pending taskHeap
+	queued  map[string]*queuedTask
+	running map[string]TaskState
+	ready   *sync.Cond
 }
 
 type Task struct {
-	ID   string
-	Info interface{}
+	ID       string
+	Info     interface{}
+	Priority int
+}
+
+// TaskState is the state of a task which is either pending in the queue or
+// being performed by a worker, StartedAt is zero for a pending task.
+type TaskState struct {
+	Task
+	QueuedAt  time.Time
+	StartedAt time.Time
 }
 
 type Worker interface {
 	PerformTask(Task) *Task
 }
 
+type queuedTask struct {
+	state TaskState
+	seq   uint64
+	index int
+}
+
+// taskHeap implements heap.Interface ordering the tasks by their priority and
+// then by the order they were pushed in.
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].state.Priority != h[j].state.Priority {
+		return h[i].state.Priority > h[j].state.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	task := x.(*queuedTask)
+	task.index = len(*h)
+	*h = append(*h, task)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	task := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return task
+}
+
 func (q *Queue) Push(w Task) error {
 	q.Mux.Lock()
+	defer q.Mux.Unlock()
+
 	if _, ex := q.InQueue[w.ID]; ex {
-		q.Mux.Unlock()
 		log.Warnf("The Task ID : %s is already in queue", w.ID)
 		return fmt.Errorf("The Task ID : %s is already in queue", w.ID)
 	}
-	q.InQueue[w.ID] = true
-	q.Mux.Unlock()
-	select {
-	case q.TaskQueue <- w:
-	default:
+
+	if q.maxSize > 0 && uint32(len(q.pending)) >= q.maxSize {
 		return fmt.Errorf("Queue is full")
 	}
-	// TODO : get size of the queue
+
+	q.seq++
+	task := &queuedTask{
+		state: TaskState{Task: w, QueuedAt: time.Now()},
+		seq:   q.seq,
+	}
+	heap.Push(&q.pending, task)
+	q.queued[w.ID] = task
+	q.InQueue[w.ID] = true
+	q.ready.Signal()
+
 	return nil
 }
 
+// Pop removes the task from the queue once it has been performed.
 func (q *Queue) Pop(ID string) {
 	q.Mux.Lock()
 	delete(q.InQueue, ID)
+	delete(q.running, ID)
 	if q.CompletionChannel != nil && len(q.InQueue) == 0 {
 		q.CompletionChannel <- true
 	}
 	q.Mux.Unlock()
 }
 
+// IsQueued checks if a task with the ID is pending or being performed.
+func (q *Queue) IsQueued(ID string) bool {
+	q.Mux.RLock()
+	defer q.Mux.RUnlock()
+
+	return q.InQueue[ID]
+}
+
+// Cancel removes the pending task with the ID from the queue, a task which is
+// already being performed can not be cancelled.
+func (q *Queue) Cancel(ID string) (Task, error) {
+	q.Mux.Lock()
+	defer q.Mux.Unlock()
+
+	task, ok := q.queued[ID]
+	if !ok {
+		if _, running := q.running[ID]; running {
+			return Task{}, fmt.Errorf("The Task ID : %s is already running", ID)
+		}
+		return Task{}, fmt.Errorf("The Task ID : %s is not in queue", ID)
+	}
+
+	heap.Remove(&q.pending, task.index)
+	delete(q.queued, ID)
+	delete(q.InQueue, ID)
+
+	return task.state.Task, nil
+}
+
+// SetPriority changes the priority of the pending task with the ID.
+func (q *Queue) SetPriority(ID string, priority int) error {
+	q.Mux.Lock()
+	defer q.Mux.Unlock()
+
+	task, ok := q.queued[ID]
+	if !ok {
+		return fmt.Errorf("The Task ID : %s is not pending in queue", ID)
+	}
+
+	task.state.Priority = priority
+	heap.Fix(&q.pending, task.index)
+
+	return nil
+}
+
+// Pending returns the pending tasks in the order they will be performed.
+func (q *Queue) Pending() []TaskState {
+	// The tasks are copied since sorting the heap itself would change the
+	// indices of the tasks in the heap.
+	q.Mux.RLock()
+	tasks := make([]queuedTask, len(q.pending))
+	for i, task := range q.pending {
+		tasks[i] = queuedTask{state: task.state, seq: task.seq}
+	}
+	q.Mux.RUnlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].state.Priority != tasks[j].state.Priority {
+			return tasks[i].state.Priority > tasks[j].state.Priority
+		}
+		return tasks[i].seq < tasks[j].seq
+	})
+
+	states := make([]TaskState, len(tasks))
+	for i, task := range tasks {
+		states[i] = task.state
+	}
+
+	return states
+}
+
+// Running returns the tasks being performed, the earliest started task first.
+func (q *Queue) Running() []TaskState {
+	q.Mux.RLock()
+	states := make([]TaskState, 0, len(q.running))
+	for _, state := range q.running {
+		states = append(states, state)
+	}
+	q.Mux.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].StartedAt.Before(states[j].StartedAt)
+	})
+
+	return states
+}
+
+// next waits for a pending task and marks it as being performed.
+func (q *Queue) next() Task {
+	q.Mux.Lock()
+	defer q.Mux.Unlock()
+
+	for len(q.pending) == 0 {
+		q.ready.Wait()
+	}
+
+	task := heap.Pop(&q.pending).(*queuedTask)
+	delete(q.queued, task.state.ID)
+
+	task.state.StartedAt = time.Now()
+	q.running[task.state.ID] = task.state
+
+	return task.state.Task
+}
+
 func (q *Queue) startConcurrentWorker(i int, worker Worker) {
 	var newTask *Task
 	for {
-		w := <-q.TaskQueue
+		w := q.next()
 		newTask = worker.PerformTask(w)
 
 		q.Pop(w.ID)
 
 		if newTask != nil {
-			q.Push(*newTask)
+			if err := q.Push(*newTask); err != nil {
+				log.Errorf("Error while pushing the next task of %s : %s", w.ID, err)
+			}
 		}
 	}
 }
 
-func (q *Queue) StartWorkers(worker Worker) {
-	numCPUs := runtime.NumCPU()
-	log.Info("Total Workers: ", numCPUs)
-	for i := 0; i < numCPUs; i++ {
+// StartWorkers starts numWorkers workers performing the tasks in the queue, a
+// worker is started for each CPU if numWorkers is not positive.
+func (q *Queue) StartWorkers(worker Worker, numWorkers int) {
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+
+	log.Info("Total Workers: ", numWorkers)
+	for i := 0; i < numWorkers; i++ {
 		go q.startConcurrentWorker(i, worker)
 	}
 }
 
+// InitQueue creates a queue holding at most maxQueueSize pending tasks, the
+// size of the queue is not limited if maxQueueSize is zero.
 func InitQueue(maxQueueSize uint32, completionChannel chan bool) *Queue {
 	var Q *Queue
 	Q = &Queue{
-		TaskQueue:         make(chan Task, maxQueueSize),
 		Mux:               sync.RWMutex{},
 		InQueue:           map[string]bool{},
 		CompletionChannel: completionChannel,
+		maxSize:           maxQueueSize,
+		queued:            map[string]*queuedTask{},
+		running:           map[string]TaskState{},
 	}
+	Q.ready = sync.NewCond(&Q.Mux)
 	return Q
 }
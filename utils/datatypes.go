@@ -9,6 +9,9 @@ import (
 
 const mappingDelimeter = ":"
 
+// AutoPort is used in place of a host port to let beast allocate the port.
+const AutoPort = "auto"
+
 // From a list of strings generate a list containing only unique strings
 // from the list.
 func GetUniqueStrings(list []string) []string {
@@ -46,17 +49,27 @@ func UInt32InList(a uint32, list []uint32) bool {
 
 // ParsePortMapping parses the port mapping string and return the required ports
 // If the portMapping string is not valid, this returns an error.
-// The format of the port mapping is `HOST_PORT:CONTAINER_PORT`
+// The format of the port mapping is `HOST_PORT:CONTAINER_PORT`, the host port
+// can be `auto` or be left out as in `CONTAINER_PORT` in which case the returned
+// host port is 0 and is to be allocated by beast.
 func ParsePortMapping(portMap string) (uint32, uint32, error) {
 	ports := strings.Split(portMap, mappingDelimeter)
 
+	if len(ports) == 1 {
+		ports = []string{AutoPort, ports[0]}
+	}
+
 	if len(ports) != 2 {
 		return 0, 0, errors.New("port mapping string is not valid")
 	}
 
-	hostPort, err := strconv.ParseUint(ports[0], 10, 32)
-	if err != nil {
-		return 0, 0, fmt.Errorf("host port is not a valid port in: %s", portMap)
+	var hostPort uint64
+	if ports[0] != AutoPort {
+		var err error
+		hostPort, err = strconv.ParseUint(ports[0], 10, 32)
+		if err != nil || hostPort == 0 {
+			return 0, 0, fmt.Errorf("host port is not a valid port in: %s", portMap)
+		}
 	}
 
 	containerPort, err := strconv.ParseUint(ports[1], 10, 32)
@@ -66,3 +79,58 @@ func ParsePortMapping(portMap string) (uint32, uint32, error) {
 
 	return uint32(hostPort), uint32(containerPort), nil
 }
+
+// ParsePortRange parses a range of ports of the format `MIN_PORT-MAX_PORT` and
+// returns the minimum and the maximum port of the range.
+func ParsePortRange(portRange string) (uint32, uint32, error) {
+	ports := strings.Split(portRange, "-")
+
+	if len(ports) != 2 {
+		return 0, 0, errors.New("port range string is not valid")
+	}
+
+	min, err := strconv.ParseUint(strings.TrimSpace(ports[0]), 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("minimum port is not a valid port in: %s", portRange)
+	}
+
+	max, err := strconv.ParseUint(strings.TrimSpace(ports[1]), 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("maximum port is not a valid port in: %s", portRange)
+	}
+
+	if min == 0 || min > max {
+		return 0, 0, fmt.Errorf("port range is empty: %s", portRange)
+	}
+
+	return uint32(min), uint32(max), nil
+}
+
+// JoinUints joins the list of uints into a string separated by sep.
+func JoinUints(list []uint, sep string) string {
+	strs := make([]string, len(list))
+	for i, n := range list {
+		strs[i] = strconv.FormatUint(uint64(n), 10)
+	}
+
+	return strings.Join(strs, sep)
+}
+
+// SplitUints parses a string of uints separated by sep, as joined by JoinUints.
+func SplitUints(str string, sep string) ([]uint, error) {
+	if str == "" {
+		return nil, nil
+	}
+
+	strs := strings.Split(str, sep)
+	list := make([]uint, len(strs))
+	for i, s := range strs {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("not a valid unsigned integer: %s", s)
+		}
+		list[i] = uint(n)
+	}
+
+	return list, nil
+}